@@ -0,0 +1,442 @@
+package audio
+
+import (
+	"container/list"
+	"fmt"
+	"io"
+	"os"
+	"runtime"
+	"sync"
+	"time"
+)
+
+// AssetOptions are the properties of an AssetManager.
+type AssetOptions struct {
+	Workers         int                                         // the most files decoded at once; 0 for the number of CPUs
+	Budget          int64                                       // the most bytes of samples cached; 0 for no limit
+	StreamThreshold time.Duration                               // Open streams the files longer than this; 0 for 10 seconds
+	Open            func(key string) (io.ReadSeekCloser, error) // opens the file of a key; nil for os.Open
+	OnProgress      func(loaded, total int)                     // called after each load, on the worker of the load
+}
+
+// AssetManager is a cache of SoundBuffers loaded from files, by their keys,
+// e.g., paths, so that the systems using the same sound share one buffer.
+//
+// The buffers are reference counted: each Load or LoadAsync of a key takes
+// a reference, given back by Unload. The buffers with no references are kept
+// until the cache goes over its budget, and are then released, the least
+// recently used first. The buffers still referenced are never released,
+// even if the cache is over its budget.
+//
+// The files are decoded by at most Workers worker goroutines, started while
+// there are loads queued.
+type AssetManager struct {
+	opts AssetOptions
+
+	lock          sync.Mutex
+	assets        map[string]*cachedBuffer
+	unused        *list.List // of *cachedBuffer without references, the least recently used first
+	used          int64      // bytes of samples of the buffers loaded
+	loaded, total int        // the loads finished and queued, since the last time all were finished
+	queue         []assetJob // the loads waiting for a worker, the first queued first
+	workers       int        // the worker goroutines running
+}
+
+// cachedBuffer is a buffer of an AssetManager, loaded or loading.
+type cachedBuffer struct {
+	key  string
+	refs int
+	elem *list.Element // in unused, if it has no references
+
+	done    chan struct{}               // closed once loaded
+	loaded  bool                        // the fields below are set; protected by AssetManager.lock
+	waiters []func(*SoundBuffer, error) // the done functions of LoadAsync, called once loaded
+	buffer  *SoundBuffer
+	size    int64
+	err     error
+}
+
+// assetJob is a load of a buffer, queued for the workers.
+type assetJob struct {
+	c    *cachedBuffer
+	load func() (*SoundBuffer, error)
+}
+
+// NewAssetManager creates an asset manager with the options.
+func NewAssetManager(opts AssetOptions) *AssetManager {
+	if opts.Workers <= 0 {
+		opts.Workers = runtime.NumCPU()
+	}
+	if opts.StreamThreshold <= 0 {
+		opts.StreamThreshold = 10 * time.Second
+	}
+	if opts.Open == nil {
+		opts.Open = func(key string) (io.ReadSeekCloser, error) {
+			return os.Open(key)
+		}
+	}
+	return &AssetManager{
+		opts:   opts,
+		assets: make(map[string]*cachedBuffer),
+		unused: list.New(),
+	}
+}
+
+// AssetRequest is a load of a buffer by AssetManager.LoadAsync.
+type AssetRequest struct {
+	c *cachedBuffer
+}
+
+// Done returns a channel closed once the buffer is loaded, or has failed to.
+func (r *AssetRequest) Done() <-chan struct{} {
+	return r.c.done
+}
+
+// Wait waits for the buffer to be loaded, and returns it.
+func (r *AssetRequest) Wait() (*SoundBuffer, error) {
+	<-r.c.done
+	return r.c.buffer, r.c.err
+}
+
+// Load returns the buffer of the key, loading it if it is not cached,
+// and takes a reference to it.
+func (m *AssetManager) Load(key string) (*SoundBuffer, error) {
+	return m.LoadAsync(key, nil).Wait()
+}
+
+// LoadAsync takes a reference to the buffer of the key, and loads it
+// on a worker if it is not cached.
+//
+// If done is not nil, it is called once the buffer is loaded, or has failed to:
+// on the worker of the load, or before LoadAsync returns if the buffer is already
+// loaded. A failed load takes no reference, and is tried again by the next Load
+// of the key.
+func (m *AssetManager) LoadAsync(key string, done func(*SoundBuffer, error)) *AssetRequest {
+	m.lock.Lock()
+	c := m.cached(key)
+	if c != nil {
+		c.refs++
+		if c.elem != nil {
+			m.unused.Remove(c.elem)
+			c.elem = nil
+		}
+		if !c.loaded && done != nil {
+			c.waiters = append(c.waiters, done)
+			done = nil
+		}
+		m.lock.Unlock()
+
+		if done != nil {
+			done(c.buffer, c.err)
+		}
+		return &AssetRequest{c: c}
+	}
+
+	c = &cachedBuffer{key: key, refs: 1, done: make(chan struct{})}
+	if done != nil {
+		c.waiters = append(c.waiters, done)
+	}
+	m.enqueue(c, func() (*SoundBuffer, error) {
+		return m.loadBuffer(key)
+	})
+	m.lock.Unlock()
+	return &AssetRequest{c: c}
+}
+
+// cached returns the buffer of the key in the cache, loaded or loading, or nil.
+// m.lock must be held.
+func (m *AssetManager) cached(key string) *cachedBuffer {
+	c, ok := m.assets[key]
+	if ok && c.buffer != nil && c.buffer.isReleased() {
+		// released by Shutdown, or by hand
+		m.drop(c)
+		return nil
+	}
+	return c
+}
+
+// enqueue adds the buffer to the cache, and queues its load for the workers,
+// starting one if there are fewer than Workers. m.lock must be held.
+func (m *AssetManager) enqueue(c *cachedBuffer, load func() (*SoundBuffer, error)) {
+	m.assets[c.key] = c
+	if m.loaded == m.total {
+		m.loaded, m.total = 0, 0
+	}
+	m.total++
+
+	m.queue = append(m.queue, assetJob{c: c, load: load})
+	if m.workers < m.opts.Workers {
+		m.workers++
+		go m.work()
+	}
+}
+
+// work is a worker goroutine, loading the buffers queued until there are none left.
+func (m *AssetManager) work() {
+	for {
+		m.lock.Lock()
+		if len(m.queue) == 0 {
+			m.workers--
+			m.lock.Unlock()
+			return
+		}
+		job := m.queue[0]
+		m.queue[0] = assetJob{}
+		m.queue = m.queue[1:]
+		m.lock.Unlock()
+
+		m.load(job.c, job.load)
+	}
+}
+
+// load loads the buffer by the function, on a worker.
+func (m *AssetManager) load(c *cachedBuffer, load func() (*SoundBuffer, error)) {
+	b, err := load()
+
+	var size int64
+	if err == nil {
+		size = b.SampleCount() * 2
+		if b.IsFloat() {
+			size *= 2
+		}
+	}
+
+	m.lock.Lock()
+	c.buffer, c.size, c.err = b, size, err
+	c.loaded = true
+	waiters := c.waiters
+	c.waiters = nil
+	if err != nil {
+		if m.assets[c.key] == c {
+			delete(m.assets, c.key)
+		}
+	} else {
+		m.used += size
+		if c.refs == 0 {
+			c.elem = m.unused.PushBack(c)
+		}
+	}
+	m.loaded++
+	loaded, total := m.loaded, m.total
+	evicted := m.evict()
+	m.lock.Unlock()
+
+	close(c.done)
+	releaseAll(evicted)
+	for _, done := range waiters {
+		done(b, err)
+	}
+	if m.opts.OnProgress != nil {
+		m.opts.OnProgress(loaded, total)
+	}
+}
+
+// loadBuffer loads a new SoundBuffer with the file of the key.
+func (m *AssetManager) loadBuffer(key string) (*SoundBuffer, error) {
+	file, err := m.opts.Open(key)
+	if err != nil {
+		return nil, fmt.Errorf("AssetManager: cannot open %s: %w", key, err)
+	}
+	defer file.Close()
+
+	b := NewSoundBuffer()
+	if err = b.Load(file); err != nil {
+		b.Release()
+		return nil, fmt.Errorf("AssetManager: cannot load %s: %w", key, err)
+	}
+	return b, nil
+}
+
+// Unload gives back a reference to the buffer of the key, taken by Load or LoadAsync.
+//
+// The buffer is kept cached while the budget allows.
+func (m *AssetManager) Unload(key string) {
+	m.lock.Lock()
+	c, ok := m.assets[key]
+	if !ok || c.refs == 0 {
+		m.lock.Unlock()
+		return
+	}
+	c.refs--
+	if c.refs == 0 && c.buffer != nil {
+		c.elem = m.unused.PushBack(c)
+	}
+	evicted := m.evict()
+	m.lock.Unlock()
+
+	releaseAll(evicted)
+}
+
+// Progress returns the number of loads finished, and the number of loads queued,
+// since the last time all the loads were finished.
+func (m *AssetManager) Progress() (loaded, total int) {
+	m.lock.Lock()
+	defer m.lock.Unlock()
+	return m.loaded, m.total
+}
+
+// SetBudget sets the most bytes of samples cached, 0 for no limit.
+func (m *AssetManager) SetBudget(budget int64) {
+	m.lock.Lock()
+	m.opts.Budget = budget
+	evicted := m.evict()
+	m.lock.Unlock()
+
+	releaseAll(evicted)
+}
+
+// Budget returns the most bytes of samples cached.
+func (m *AssetManager) Budget() int64 {
+	m.lock.Lock()
+	defer m.lock.Unlock()
+	return m.opts.Budget
+}
+
+// MemoryUsage returns the bytes of samples of the buffers cached.
+func (m *AssetManager) MemoryUsage() int64 {
+	m.lock.Lock()
+	defer m.lock.Unlock()
+	return m.used
+}
+
+// Purge releases all the buffers without references.
+func (m *AssetManager) Purge() {
+	m.lock.Lock()
+	var evicted []*SoundBuffer
+	for m.unused.Len() > 0 {
+		c := m.unused.Front().Value.(*cachedBuffer)
+		m.drop(c)
+		evicted = append(evicted, c.buffer)
+	}
+	m.lock.Unlock()
+
+	releaseAll(evicted)
+}
+
+// evict removes the least recently used buffers without references,
+// until the cache is within its budget, and returns them to be released.
+// m.lock must be held.
+func (m *AssetManager) evict() (evicted []*SoundBuffer) {
+	for m.opts.Budget > 0 && m.used > m.opts.Budget && m.unused.Len() > 0 {
+		c := m.unused.Front().Value.(*cachedBuffer)
+		m.drop(c)
+		evicted = append(evicted, c.buffer)
+	}
+	return
+}
+
+// drop removes a loaded buffer from the cache. m.lock must be held.
+func (m *AssetManager) drop(c *cachedBuffer) {
+	if c.elem != nil {
+		m.unused.Remove(c.elem)
+		c.elem = nil
+	}
+	if m.assets[c.key] == c {
+		delete(m.assets, c.key)
+	}
+	m.used -= c.size
+}
+
+func releaseAll(buffers []*SoundBuffer) {
+	for _, b := range buffers {
+		b.Release()
+	}
+}
+
+// Asset is a sound opened by AssetManager.Open: a SoundBuffer from the cache
+// if the file is short, or a Music streaming it otherwise.
+type Asset struct {
+	Buffer *SoundBuffer // the buffer, or nil if the asset is streamed
+	Music  *Music       // the music, or nil if the asset is buffered
+
+	m    *AssetManager
+	key  string
+	file io.Closer
+}
+
+// Open opens the file of the key as a SoundBuffer, shared in the cache, if it is
+// no longer than the stream threshold, or as a Music of its own otherwise.
+//
+// The file is opened for its duration, unless the key is already cached,
+// and then streamed or decoded by the same reader.
+func (m *AssetManager) Open(key string) (*Asset, error) {
+	m.lock.Lock()
+	cached := m.cached(key) != nil
+	m.lock.Unlock()
+
+	if !cached {
+		file, err := m.opts.Open(key)
+		if err != nil {
+			return nil, fmt.Errorf("AssetManager: cannot open %s: %w", key, err)
+		}
+		reader := NewSoundFileReader(file)
+		if reader == nil {
+			file.Close()
+			return nil, fmt.Errorf("AssetManager: cannot open %s: %w", key, ErrUnknownFormat)
+		}
+		info, err := reader.Open(file)
+		if err != nil {
+			reader.Close()
+			file.Close()
+			return nil, fmt.Errorf("AssetManager: cannot open %s: %w", key, err)
+		}
+
+		if info.ChannelCount > 0 && framesToDuration(info.SampleCount/int64(info.ChannelCount), info.SampleRate) > m.opts.StreamThreshold {
+			music := NewMusic()
+			if err = music.openReader(reader, info); err != nil {
+				music.Close()
+				file.Close()
+				return nil, fmt.Errorf("AssetManager: cannot open %s: %w", key, err)
+			}
+			return &Asset{Music: music, m: m, key: key, file: file}, nil
+		}
+
+		// decode the file on a worker, unless it was loaded meanwhile
+		m.lock.Lock()
+		if m.cached(key) == nil {
+			c := &cachedBuffer{key: key, refs: 1, done: make(chan struct{})}
+			m.enqueue(c, func() (*SoundBuffer, error) {
+				defer file.Close()
+				defer reader.Close()
+
+				b := NewSoundBuffer()
+				if err := b.decode(reader, info); err != nil {
+					b.Release()
+					return nil, fmt.Errorf("AssetManager: cannot load %s: %w", key, err)
+				}
+				return b, nil
+			})
+			m.lock.Unlock()
+
+			b, err := (&AssetRequest{c: c}).Wait()
+			if err != nil {
+				return nil, err
+			}
+			return &Asset{Buffer: b, m: m, key: key}, nil
+		}
+		m.lock.Unlock()
+		reader.Close()
+		file.Close()
+	}
+
+	b, err := m.Load(key)
+	if err != nil {
+		return nil, err
+	}
+	return &Asset{Buffer: b, m: m, key: key}, nil
+}
+
+// Release closes the music of the asset, or gives back its reference to the buffer.
+//
+// Calling Release more than once does nothing.
+func (a *Asset) Release() {
+	if a.Music != nil {
+		a.Music.Close()
+		a.file.Close()
+		a.Music = nil
+	}
+	if a.Buffer != nil {
+		a.m.Unload(a.key)
+		a.Buffer = nil
+	}
+}
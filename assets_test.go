@@ -0,0 +1,186 @@
+package audio
+
+import (
+	"bytes"
+	"errors"
+	"io"
+	"sync"
+	"testing"
+	"time"
+)
+
+// testFiles are the files of an AssetManager opened by its Open option,
+// counting the opens of each key.
+type testFiles struct {
+	lock   sync.Mutex
+	frames map[string]int // the frames of the files, 16-bit mono with the magic
+	opens  map[string]int
+}
+
+type nopSeekCloser struct {
+	io.ReadSeeker
+}
+
+func (nopSeekCloser) Close() error { return nil }
+
+func (f *testFiles) open(key string) (io.ReadSeekCloser, error) {
+	f.lock.Lock()
+	defer f.lock.Unlock()
+
+	f.opens[key]++
+	frames, ok := f.frames[key]
+	if !ok {
+		return nil, errors.New("no such file")
+	}
+	data := append(append([]byte(nil), testTrackMagic...), make([]byte, frames*2)...)
+	return nopSeekCloser{bytes.NewReader(data)}, nil
+}
+
+func (f *testFiles) openCount(key string) int {
+	f.lock.Lock()
+	defer f.lock.Unlock()
+	return f.opens[key]
+}
+
+// newTestAssets returns an asset manager of files of 98 frames, 200 bytes
+// of samples with the magic, under the keys given.
+func newTestAssets(budget int64, keys ...string) (*AssetManager, *testFiles) {
+	files := &testFiles{frames: make(map[string]int), opens: make(map[string]int)}
+	for _, key := range keys {
+		files.frames[key] = 98
+	}
+	return NewAssetManager(AssetOptions{Workers: 2, Budget: budget, Open: files.open}), files
+}
+
+func TestAssetManagerEviction(t *testing.T) {
+	if err := Init(); err != nil {
+		t.Skip("cannot open the device:", err)
+	}
+	defer Shutdown()
+
+	m, files := newTestAssets(500, "a", "b", "c")
+	load := func(key string) *SoundBuffer {
+		b, err := m.Load(key)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return b
+	}
+
+	a, b := load("a"), load("b")
+	if again := load("a"); again != a || files.openCount("a") != 1 {
+		t.Fatalf("a loaded again, not shared from the cache")
+	}
+	m.Unload("a")
+	m.Unload("a")
+	m.Unload("b")
+	if got := m.MemoryUsage(); got != 400 {
+		t.Fatalf("MemoryUsage = %d, want 400", got)
+	}
+
+	// over the budget, the least recently used buffer goes first
+	c := load("c")
+	if got := m.MemoryUsage(); got != 400 {
+		t.Errorf("MemoryUsage = %d after an eviction, want 400", got)
+	}
+	if !a.isReleased() || b.isReleased() {
+		t.Errorf("released a: %v, b: %v; want a only", a.isReleased(), b.isReleased())
+	}
+
+	// the buffers referenced are kept over the budget
+	m.SetBudget(1)
+	if !b.isReleased() {
+		t.Errorf("b, unused, kept over the budget")
+	}
+	if c.isReleased() {
+		t.Errorf("c, referenced, released over the budget")
+	}
+	m.Unload("c")
+	if !c.isReleased() || m.MemoryUsage() != 0 {
+		t.Errorf("c kept after its last reference, over the budget")
+	}
+}
+
+func TestAssetManagerLoadAsync(t *testing.T) {
+	if err := Init(); err != nil {
+		t.Skip("cannot open the device:", err)
+	}
+	defer Shutdown()
+
+	m, files := newTestAssets(0, "a")
+	var lock sync.Mutex
+	calls := 0
+	done := func(b *SoundBuffer, err error) {
+		lock.Lock()
+		defer lock.Unlock()
+		if b == nil || err != nil {
+			t.Errorf("done(%v, %v), want the buffer", b, err)
+		}
+		calls++
+	}
+
+	reqs := []*AssetRequest{m.LoadAsync("a", done), m.LoadAsync("a", done)}
+	for _, r := range reqs {
+		if _, err := r.Wait(); err != nil {
+			t.Fatal(err)
+		}
+	}
+	// loaded: done is called before LoadAsync returns
+	m.LoadAsync("a", done)
+	lock.Lock()
+	if calls != 3 {
+		t.Errorf("done called %d times, want 3", calls)
+	}
+	lock.Unlock()
+	if n := files.openCount("a"); n != 1 {
+		t.Errorf("a opened %d times, want 1", n)
+	}
+	if loaded, total := m.Progress(); loaded != 1 || total != 1 {
+		t.Errorf("Progress = (%d, %d), want (1, 1)", loaded, total)
+	}
+
+	// a failed load is not cached
+	for i := 1; i <= 2; i++ {
+		if _, err := m.Load("missing"); err == nil {
+			t.Fatal("Load of a missing file succeeded")
+		}
+		if n := files.openCount("missing"); n != i {
+			t.Fatalf("missing opened %d times, want %d", n, i)
+		}
+	}
+}
+
+func TestAssetManagerOpen(t *testing.T) {
+	if err := Init(); err != nil {
+		t.Skip("cannot open the device:", err)
+	}
+	defer Shutdown()
+
+	m, files := newTestAssets(0, "short", "long")
+	files.frames["long"] = 44100
+
+	m.opts.StreamThreshold = 100 * time.Millisecond
+	short, err := m.Open("short")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer short.Release()
+	if short.Buffer == nil || short.Music != nil {
+		t.Fatalf("short file opened as %+v, want a buffer", short)
+	}
+	if n := files.openCount("short"); n != 1 {
+		t.Errorf("short opened %d times, want 1", n)
+	}
+
+	long, err := m.Open("long")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer long.Release()
+	if long.Music == nil || long.Buffer != nil {
+		t.Fatalf("long file opened as %+v, want a music", long)
+	}
+	if n := files.openCount("long"); n != 1 {
+		t.Errorf("long opened %d times, want 1", n)
+	}
+}
@@ -6,9 +6,10 @@ import (
 	"errors"
 	"fmt"
 	"io"
-	"runtime"
 	"time"
 	"unsafe"
+
+	"github.com/Edgaru089/audio/pcm"
 )
 
 // SoundBuffer holds sound sample data, together
@@ -17,93 +18,268 @@ import (
 // SoundBuffers load all the sound data uncompressed into memory,
 // so they tend to occupy a lot of room.
 type SoundBuffer struct {
-	buffer   C.ALuint // OpenAL buffer handle
-	samples  []int16
-	info     SoundFileInfo
-	duration time.Duration
+	buffer       C.ALuint // OpenAL buffer handle
+	gen          uint64   // generation of the buffer handle, see Shutdown
+	samples      []int16
+	floatSamples []float32 // non-nil if the buffer holds float samples
+	info         SoundFileInfo
+	duration     time.Duration
+
+	sounds map[C.ALuint]struct{} // sources of the Sounds using the buffer, by name, not to keep the Sounds alive
+	leak   *leakCheck
 }
 
 func NewSoundBuffer() *SoundBuffer {
 	b := &SoundBuffer{}
-	C.alGenBuffers(1, &b.buffer)
 
-	runtime.SetFinalizer(b, func(buf *SoundBuffer) {
-		C.alDeleteBuffers(1, &buf.buffer)
-	})
+	stateLock.Lock()
+	b.buffer, b.gen = genBuffer()
+	stateLock.Unlock()
+
+	b.leak = newLeakCheck("SoundBuffer")
+	b.leak.hold()
 
 	return b
 }
 
+// Release frees the OpenAL buffer and the samples.
+//
+// The Sounds using the buffer are stopped and detached from it.
+// The buffer should not be used again. Calling Release more than once does nothing.
+func (b *SoundBuffer) Release() {
+	b.leak.release()
+
+	stateLock.Lock()
+	defer stateLock.Unlock()
+
+	if b.buffer == 0 {
+		return
+	}
+	if isLive(b.buffer, b.gen) {
+		b.detachSources()
+	}
+	b.sounds = nil
+	deleteBuffer(b.buffer, b.gen)
+	b.buffer = 0
+	b.samples, b.floatSamples = nil, nil
+}
+
+// attachSound adds the source of a Sound to the ones using the buffer.
+// stateLock must be held.
+func (b *SoundBuffer) attachSound(source C.ALuint) {
+	if b.sounds == nil {
+		b.sounds = make(map[C.ALuint]struct{})
+	}
+	b.sounds[source] = struct{}{}
+}
+
+// detachSound removes the source of a Sound from the ones using the buffer.
+// stateLock must be held.
+func (b *SoundBuffer) detachSound(source C.ALuint) {
+	delete(b.sounds, source)
+}
+
+// detachSources stops the sources using the buffer, and takes the buffer off them,
+// keeping them among the ones using the buffer. stateLock must be held.
+func (b *SoundBuffer) detachSources() {
+	for source := range b.sounds {
+		if sourceStatus(source) != Stopped {
+			emitSource(source, b.gen, EventStopped)
+		}
+		C.alSourceStop(source)
+		alCheck("alSourceStop")
+		C.alSourcei(source, C.AL_BUFFER, 0)
+		alCheck("alSourcei")
+	}
+}
+
+func (b *SoundBuffer) isReleased() bool {
+	stateLock.Lock()
+	defer stateLock.Unlock()
+	return !isLive(b.buffer, b.gen)
+}
+
 // Samples returns the internal samples buffer.
+// It should not be modified.
+//
+// If the buffer holds float samples, they are converted to 16 bits
+// on the first call, and the result is kept.
 func (b *SoundBuffer) Samples() []int16 {
+	stateLock.Lock()
+	defer stateLock.Unlock()
+
+	if b.samples == nil && b.floatSamples != nil {
+		b.samples = make([]int16, len(b.floatSamples))
+		for i, f := range b.floatSamples {
+			b.samples[i] = pcm.FromFloat32(f)
+		}
+	}
 	return b.samples
 }
 
+// SamplesFloat returns the internal float samples buffer, normalized to [-1, 1].
+//
+// It returns nil if the buffer holds 16-bit samples (see IsFloat).
+func (b *SoundBuffer) SamplesFloat() []float32 {
+	stateLock.Lock()
+	defer stateLock.Unlock()
+
+	return b.floatSamples
+}
+
+// IsFloat tells if the buffer holds 32-bit float samples.
+//
+// Float samples are used when both the reader (SoundFileFloatReader)
+// and OpenAL (AL_EXT_FLOAT32) support them. Otherwise 16-bit samples are used.
+func (b *SoundBuffer) IsFloat() bool {
+	stateLock.Lock()
+	defer stateLock.Unlock()
+
+	return b.floatSamples != nil
+}
+
 // SampleCount returns the number of samples in the buffer.
 //
 // Two samples from two channels at the same timepoint count twice.
 func (b *SoundBuffer) SampleCount() int64 {
+	stateLock.Lock()
+	defer stateLock.Unlock()
+
 	return b.info.SampleCount
 }
 
 // SampleRate returns the sample rate of the buffer, in samples per second.
 func (b *SoundBuffer) SampleRate() int {
+	stateLock.Lock()
+	defer stateLock.Unlock()
+
 	return b.info.SampleRate
 }
 
 // ChannelCount returns the number of channels in the buffer.
 func (b *SoundBuffer) ChannelCount() int {
+	stateLock.Lock()
+	defer stateLock.Unlock()
+
 	return b.info.ChannelCount
 }
 
 // Duration returns the duration of the sound in the buffer.
 func (b *SoundBuffer) Duration() time.Duration {
+	stateLock.Lock()
+	defer stateLock.Unlock()
+
 	return b.duration
 }
 
 // Load loads the sound buffer with the given file.
 //
-// Please, please don't load it again if a Sound is already using it.
-// This may cause weird issues I cannot diagnose.
+// The buffer can be loaded again while Sounds are using it.
+// They are stopped, and then play the new samples.
 func (b *SoundBuffer) Load(file io.ReadSeeker) (err error) {
 	reader := NewSoundFileReader(file)
 	if reader == nil {
-		return errors.New("SoundBuffer: cannot load: unknown format")
+		return fmt.Errorf("SoundBuffer: cannot load: %w", ErrUnknownFormat)
+	}
+
+	return b.LoadReader(reader, file)
+}
+
+// LoadReader loads the sound buffer with the given file, decoded by the given reader.
+//
+// This is useful when the format cannot be detected from the file,
+// e.g., raw PCM data read by a RawPCMReader.
+//
+// The reader is opened on file, which is seeked to the beginning first.
+// It is closed when the samples are all read.
+func (b *SoundBuffer) LoadReader(reader SoundFileReader, file io.ReadSeeker) (err error) {
+	defer reader.Close()
+
+	_, err = file.Seek(0, io.SeekStart)
+	if err != nil {
+		return fmt.Errorf("SoundBuffer: cannot seek stream: %w", err)
 	}
 
-	b.info, err = reader.Open(file)
+	info, err := reader.Open(file)
 	if err != nil {
-		return fmt.Errorf("SoundBuffer: cannot open stream: %s", err.Error())
+		return fmt.Errorf("SoundBuffer: cannot open stream: %w", err)
 	}
+	return b.decode(reader, info)
+}
 
+// decode loads the sound buffer with the samples of the reader, opened with the info.
+func (b *SoundBuffer) decode(reader SoundFileReader, info SoundFileInfo) (err error) {
+	// decode without holding the lock; the Sounds keep playing the old samples meanwhile
 	// FIXME: SoundBuffer internal buffer reallocated on every Load
-	b.samples = make([]int16, b.info.SampleCount)
-	_, err = reader.Read(b.samples)
-	if err != nil {
+	var samples []int16
+	var floatSamples []float32
+	if fr, ok := reader.(SoundFileFloatReader); ok && getFloatFormatFromChannelCount(info.ChannelCount) != 0 {
+		floatSamples = make([]float32, info.SampleCount)
+		_, err = fr.ReadFloat(floatSamples)
+	} else {
+		samples = make([]int16, info.SampleCount)
+		_, err = reader.Read(samples)
+	}
+	if err != nil && err != io.EOF {
 		return err
 	}
 
+	stateLock.Lock()
+	defer stateLock.Unlock()
+
+	b.info = info
+	b.samples, b.floatSamples = samples, floatSamples
 	return b.update()
 }
 
 // update updates the OpenAL state of the buffer after samples change.
+// stateLock must be held.
 func (b *SoundBuffer) update() error {
-	if len(b.samples) == 0 {
-		return errors.New("SoundBuffer: OpenAL update on empty samples")
+	var data unsafe.Pointer
+	var size uintptr
+	var format C.ALenum
+	if b.floatSamples != nil {
+		if len(b.floatSamples) == 0 {
+			return errors.New("SoundBuffer: OpenAL update on empty samples")
+		}
+		data = unsafe.Pointer(&b.floatSamples[0])
+		size = uintptr(len(b.floatSamples)) * unsafe.Sizeof(float32(0))
+		format = getFloatFormatFromChannelCount(b.info.ChannelCount)
+	} else {
+		if len(b.samples) == 0 {
+			return errors.New("SoundBuffer: OpenAL update on empty samples")
+		}
+		data = unsafe.Pointer(&b.samples[0])
+		size = uintptr(len(b.samples)) * unsafe.Sizeof(int16(0))
+		format = getFormatFromChannelCount(b.info.ChannelCount)
 	}
-
-	format := getFormatFromChannelCount(b.info.ChannelCount)
 	if format == 0 {
-		return fmt.Errorf("SoundBuffer: failed to load (unsupported number of channels: %d)", b.info.ChannelCount)
+		return fmt.Errorf("SoundBuffer: failed to load: %w: %d", ErrUnsupportedChannels, b.info.ChannelCount)
 	}
 
+	// detach the sounds using the buffer, as OpenAL refuses to
+	// fill a buffer attached to a source
+	b.detachSources()
+
+	C.alGetError() // clear any earlier error
 	C.alBufferData(
 		b.buffer,
 		format,
-		unsafe.Pointer(&b.samples[0]),
-		C.ALsizei(uintptr(len(b.samples))*unsafe.Sizeof(int16(0))),
+		data,
+		C.ALsizei(size),
 		C.ALsizei(b.info.SampleRate),
 	)
+	alerr := alError("alBufferData")
+
+	// and attach them again
+	for source := range b.sounds {
+		C.alSourcei(source, C.AL_BUFFER, C.ALint(b.buffer))
+		alCheck("alSourcei")
+	}
+
+	if alerr != nil {
+		return fmt.Errorf("SoundBuffer: failed to load: %w", alerr)
+	}
 
 	// calculate the duration here
 	b.duration = time.Duration(float64(time.Second) * float64(b.info.SampleCount) / float64(b.info.ChannelCount) / float64(b.info.SampleRate))
@@ -0,0 +1,81 @@
+package audio
+
+import (
+	"bytes"
+	"testing"
+	"time"
+)
+
+// loadRaw loads the buffer with frames of silence, of the channel count.
+func loadRaw(t *testing.T, b *SoundBuffer, frames, channels int) {
+	t.Helper()
+	r := NewRawPCMReader(PCMS16, nil, channels, 44100)
+	if err := b.LoadReader(r, bytes.NewReader(make([]byte, frames*channels*2))); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestSoundBufferReload(t *testing.T) {
+	if err := Init(); err != nil {
+		t.Skip("cannot open the device:", err)
+	}
+	defer Shutdown()
+
+	b := NewSoundBuffer()
+	defer b.Release()
+	loadRaw(t, b, 100, 1)
+
+	s, other := NewSound(), NewSound()
+	defer s.Release()
+	s.SetBuffer(b)
+	other.SetBuffer(b)
+	events, cancel := s.Events(8)
+	defer cancel()
+	s.Play()
+
+	// loaded again under the Sounds, which stay attached, stopped
+	loadRaw(t, b, 200, 2)
+	if st := s.Status(); st != Stopped {
+		t.Errorf("Status = %v after a reload, want Stopped", st)
+	}
+	if s.Buffer() != b || other.Buffer() != b {
+		t.Errorf("Sounds detached by a reload")
+	}
+	if n, c := b.SampleCount(), b.ChannelCount(); n != 400 || c != 2 {
+		t.Errorf("reloaded buffer has %d samples of %d channels, want 400 of 2", n, c)
+	}
+
+	users := func() int {
+		stateLock.Lock()
+		defer stateLock.Unlock()
+		return len(b.sounds)
+	}
+	if n := users(); n != 2 {
+		t.Errorf("%d Sounds using the buffer, want 2", n)
+	}
+	other.Release()
+	if n := users(); n != 1 {
+		t.Errorf("%d Sounds using the buffer after a Release, want 1", n)
+	}
+
+	// released under the Sound, which is stopped and left without a buffer
+	s.Play()
+	b.Release()
+	if st := s.Status(); st != Stopped {
+		t.Errorf("Status = %v after the buffer is released, want Stopped", st)
+	}
+	if s.Buffer() != nil {
+		t.Errorf("Buffer = %p after it is released, want nil", s.Buffer())
+	}
+
+	for _, want := range []PlaybackEventType{EventStarted, EventStopped, EventStarted, EventStopped} {
+		select {
+		case ev := <-events:
+			if ev.Type != want {
+				t.Fatalf("event %v, want %v", ev.Type, want)
+			}
+		case <-time.After(time.Second):
+			t.Fatalf("no event, want %v", want)
+		}
+	}
+}
@@ -0,0 +1,381 @@
+package audio
+
+// #include "headers.h"
+import "C"
+
+// Bus is a group of sounds mixed together, like a channel of a mixing desk,
+// for the volume sliders of a settings menu.
+//
+// The buses form a tree under the master bus. The volume, the mute, the pause
+// and the pitch of a bus apply to its sounds and to all the buses under it:
+// the volume of a sound is multiplied by the volumes of its bus and of the
+// buses above, up to the master bus.
+//
+// Every Sound, SoundStream and Music is on the master bus until SetBus is called.
+type Bus struct {
+	name     string
+	parent   *Bus
+	children []*Bus
+
+	// protected by stateLock
+	volume  float32
+	pitch   float32
+	muted   bool
+	paused  bool
+	duck    float32                 // the gain of the ducking rules lowering the bus, from 0 to 1
+	members map[*busMember]struct{} // the sources with OpenAL names on the bus
+}
+
+// busMember is a source on a bus. It is kept apart from the object owning the
+// source, so that the bus does not keep the object alive: an object never
+// released can still be garbage collected (and reported as a leak in debug builds).
+//
+// It is protected by stateLock.
+type busMember struct {
+	source C.ALuint
+	gen    uint64
+	bus    *Bus    // the bus the source is on, never nil
+	volume float32 // the volume of the source, before the bus
+	pitch  float32 // the pitch of the source, before the bus
+
+	busPaused bool      // paused by the bus, to be resumed with it
+	player    busPlayer // the stream owning the source while it streams, or nil
+}
+
+// busPlayer is a stream paused and resumed by its bus, while it streams.
+//
+// The bus pauses and resumes the other sources itself. The streams are
+// referenced only while they stream, when their goroutines keep them alive anyway.
+type busPlayer interface {
+	Play()
+	Pause()
+}
+
+var masterBus = newBus("Master", nil)
+
+func newBus(name string, parent *Bus) *Bus {
+	return &Bus{
+		name:    name,
+		parent:  parent,
+		volume:  100,
+		pitch:   1,
+		duck:    1,
+		members: make(map[*busMember]struct{}),
+	}
+}
+
+// MasterBus returns the master bus, the root of all the buses.
+//
+// Unlike SetGlobalVolume, which is the volume of the listener, the volume of
+// the master bus is applied to each source.
+func MasterBus() *Bus {
+	return masterBus
+}
+
+// NewBus creates a bus under the parent bus, or under the master bus if parent is nil.
+//
+// If the parent already has a bus of the name, it is returned instead.
+func NewBus(name string, parent *Bus) *Bus {
+	if parent == nil {
+		parent = masterBus
+	}
+
+	stateLock.Lock()
+	defer stateLock.Unlock()
+
+	for _, c := range parent.children {
+		if c.name == name {
+			return c
+		}
+	}
+	b := newBus(name, parent)
+	parent.children = append(parent.children, b)
+	return b
+}
+
+// Name returns the name of the bus.
+func (b *Bus) Name() string {
+	return b.name
+}
+
+// Parent returns the bus above the bus, or nil for the master bus.
+func (b *Bus) Parent() *Bus {
+	return b.parent
+}
+
+// Child returns the bus of the name directly under the bus, or nil if there is none.
+func (b *Bus) Child(name string) *Bus {
+	stateLock.Lock()
+	defer stateLock.Unlock()
+
+	for _, c := range b.children {
+		if c.name == name {
+			return c
+		}
+	}
+	return nil
+}
+
+// Children returns the buses directly under the bus, in the order they are created.
+func (b *Bus) Children() []*Bus {
+	stateLock.Lock()
+	defer stateLock.Unlock()
+
+	return append([]*Bus(nil), b.children...)
+}
+
+// SetVolume sets the volume of the bus, from 0 (mute) to 100 (full volume).
+//
+// The default is 100.
+func (b *Bus) SetVolume(volume float32) {
+	stateLock.Lock()
+	defer stateLock.Unlock()
+
+	b.volume = volume
+	b.walk((*busMember).applyVolume)
+}
+
+// Volume returns the volume of the bus, from 0 to 100.
+func (b *Bus) Volume() float32 {
+	stateLock.Lock()
+	defer stateLock.Unlock()
+	return b.volume
+}
+
+// SetMuted mutes or unmutes the bus, keeping its volume.
+//
+// The default is false.
+func (b *Bus) SetMuted(muted bool) {
+	stateLock.Lock()
+	defer stateLock.Unlock()
+
+	b.muted = muted
+	b.walk((*busMember).applyVolume)
+}
+
+// IsMuted tells if the bus is muted, not counting the buses above.
+func (b *Bus) IsMuted() bool {
+	stateLock.Lock()
+	defer stateLock.Unlock()
+	return b.muted
+}
+
+// SetPitch sets the pitch of the bus, multiplying the pitch of its sounds.
+//
+// The default is 1.
+func (b *Bus) SetPitch(pitch float32) {
+	stateLock.Lock()
+	defer stateLock.Unlock()
+
+	b.pitch = pitch
+	b.walk((*busMember).applyPitch)
+}
+
+// Pitch returns the pitch of the bus.
+func (b *Bus) Pitch() float32 {
+	stateLock.Lock()
+	defer stateLock.Unlock()
+	return b.pitch
+}
+
+// SetPaused pauses or resumes the bus.
+//
+// Pausing pauses the sounds of the bus playing at the time; resuming plays
+// them again, unless they are stopped or still under another paused bus.
+// Sounds played while the bus is paused are not paused.
+//
+// The default is false.
+func (b *Bus) SetPaused(paused bool) {
+	stateLock.Lock()
+	was := b.isPaused()
+	b.paused = paused
+	now := b.isPaused()
+
+	var players []busPlayer
+	if was != now {
+		b.walk(func(m *busMember) {
+			switch {
+			case now && !m.busPaused && sourceStatus(m.source) == Playing:
+				m.busPaused = true
+				if m.player != nil {
+					players = append(players, m.player)
+				} else {
+					m.pause()
+				}
+			case !now && m.busPaused && !m.bus.isPaused():
+				m.busPaused = false
+				if sourceStatus(m.source) == Paused {
+					if m.player != nil {
+						players = append(players, m.player)
+					} else {
+						m.play()
+					}
+				}
+			}
+		})
+	}
+	stateLock.Unlock()
+
+	// the streams take their own locks, before stateLock;
+	// a stream of several sources is called once
+	called := make(map[busPlayer]bool)
+	for _, p := range players {
+		if called[p] {
+			continue
+		}
+		called[p] = true
+		if now {
+			p.Pause()
+		} else {
+			p.Play()
+		}
+	}
+}
+
+// IsPaused tells if the bus is paused, not counting the buses above.
+func (b *Bus) IsPaused() bool {
+	stateLock.Lock()
+	defer stateLock.Unlock()
+	return b.paused
+}
+
+// gain returns the volume of the bus multiplied down from the master bus,
+// from 0 to 1. stateLock must be held.
+func (b *Bus) gain() float32 {
+	gain := float32(1)
+	for ; b != nil; b = b.parent {
+		if b.muted {
+			return 0
+		}
+		gain *= b.volume * 0.01 * b.duck
+	}
+	return gain
+}
+
+// pitchFactor returns the pitch of the bus multiplied down from the master bus.
+// stateLock must be held.
+func (b *Bus) pitchFactor() float32 {
+	pitch := float32(1)
+	for ; b != nil; b = b.parent {
+		pitch *= b.pitch
+	}
+	return pitch
+}
+
+// isPaused tells if the bus or a bus above is paused. stateLock must be held.
+func (b *Bus) isPaused() bool {
+	for ; b != nil; b = b.parent {
+		if b.paused {
+			return true
+		}
+	}
+	return false
+}
+
+// walk calls fn on the live sources of the bus and of the buses under it.
+// stateLock must be held.
+func (b *Bus) walk(fn func(m *busMember)) {
+	for m := range b.members {
+		if isLive(m.source, m.gen) {
+			fn(m)
+		}
+	}
+	for _, c := range b.children {
+		c.walk(fn)
+	}
+}
+
+// clearMembers removes the sources from the bus and the buses under it,
+// once their names are deleted by Shutdown. stateLock must be held.
+func (b *Bus) clearMembers() {
+	b.members = make(map[*busMember]struct{})
+	for _, c := range b.children {
+		c.clearMembers()
+	}
+}
+
+// SetBus puts the sound on the bus, or on the master bus if bus is nil.
+func (s *soundSource) SetBus(bus *Bus) {
+	stateLock.Lock()
+	defer stateLock.Unlock()
+
+	if bus == masterBus {
+		bus = nil
+	}
+	if s.member != nil {
+		s.leaveBus()
+	}
+	s.bus = bus
+	if s.member != nil {
+		s.joinBus()
+	}
+}
+
+// Bus returns the bus of the sound.
+func (s *soundSource) Bus() *Bus {
+	stateLock.Lock()
+	defer stateLock.Unlock()
+	return s.getBus()
+}
+
+// getBus returns the bus of the sound. stateLock must be held.
+func (s *soundSource) getBus() *Bus {
+	if s.bus == nil {
+		return masterBus
+	}
+	return s.bus
+}
+
+// joinBus adds the source to its bus, and applies the volume and the pitch
+// of the bus. stateLock must be held.
+func (s *soundSource) joinBus() {
+	m := s.member
+	m.bus = s.getBus()
+	m.busPaused = false
+	m.bus.members[m] = struct{}{}
+	m.applyVolume()
+	m.applyPitch()
+}
+
+// leaveBus removes the source from its bus. stateLock must be held.
+func (s *soundSource) leaveBus() {
+	delete(s.member.bus.members, s.member)
+}
+
+// setPlayer sets the stream paused and resumed by the bus in place of the source,
+// nil for the bus to pause and resume the source itself. stateLock must be held.
+func (s *soundSource) setPlayer(p busPlayer) {
+	if s.member != nil {
+		s.member.player = p
+	}
+}
+
+// applyVolume sets the gain of the source, by its volume and its bus.
+// stateLock must be held.
+func (m *busMember) applyVolume() {
+	C.alSourcef(m.source, C.AL_GAIN, C.float(m.volume*0.01*m.bus.gain()))
+	alCheck("alSourcef")
+}
+
+// applyPitch sets the pitch of the source, by its pitch and its bus.
+// stateLock must be held.
+func (m *busMember) applyPitch() {
+	C.alSourcef(m.source, C.AL_PITCH, C.float(m.pitch*m.bus.pitchFactor()))
+	alCheck("alSourcef")
+}
+
+// pause pauses the source for the bus, with no stream owning it.
+// stateLock must be held.
+func (m *busMember) pause() {
+	C.alSourcePause(m.source)
+	alCheck("alSourcePause")
+	emitSource(m.source, m.gen, EventPaused)
+}
+
+// play resumes the source for the bus, with no stream owning it.
+// stateLock must be held.
+func (m *busMember) play() {
+	C.alSourcePlay(m.source)
+	alCheck("alSourcePlay")
+	emitSource(m.source, m.gen, EventStarted)
+}
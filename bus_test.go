@@ -0,0 +1,43 @@
+package audio
+
+import (
+	"testing"
+	"time"
+)
+
+func TestBusPauseSound(t *testing.T) {
+	if err := Init(); err != nil {
+		t.Skip("cannot open the device:", err)
+	}
+	defer Shutdown()
+
+	bus := NewBus("Pause", nil)
+	defer bus.SetPaused(false)
+
+	s := NewSound()
+	defer s.Release()
+	s.SetBus(bus)
+	events, cancel := s.Events(8)
+	defer cancel()
+
+	s.Play()
+	bus.SetPaused(true)
+	if st := s.Status(); st != Paused {
+		t.Fatalf("Status = %v after pausing the bus, want Paused", st)
+	}
+	bus.SetPaused(false)
+	if st := s.Status(); st != Playing {
+		t.Fatalf("Status = %v after resuming the bus, want Playing", st)
+	}
+
+	for _, want := range []PlaybackEventType{EventStarted, EventPaused, EventStarted} {
+		select {
+		case ev := <-events:
+			if ev.Type != want {
+				t.Fatalf("event %v, want %v", ev.Type, want)
+			}
+		case <-time.After(time.Second):
+			t.Fatalf("no event, want %v", want)
+		}
+	}
+}
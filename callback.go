@@ -0,0 +1,378 @@
+package audio
+
+// #include "headers.h"
+import "C"
+import (
+	"fmt"
+	"sync"
+	"sync/atomic"
+	"time"
+	"unsafe"
+)
+
+const (
+	callbackFallbackBufferCount    = 4                     // buffers queued by a CallbackStream without AL_SOFT_callback_buffer
+	callbackFallbackBufferDuration = 20 * time.Millisecond // duration of each of these buffers
+)
+
+// The CallbackStreams streaming with AL_SOFT_callback_buffer, by their ids.
+// The id is passed to OpenAL in place of a pointer, as Go pointers cannot be kept by C.
+//
+// Only the callbackStates are kept, not the streams, so that streams never
+// closed can still be garbage collected (and reported as leaks in debug builds).
+var (
+	callbackLock    sync.RWMutex
+	callbackStreams = make(map[int]*callbackState)
+	callbackID      int
+)
+
+// CallbackStreamFunc fills samples with interleaved 16-bit samples,
+// returning the number of samples written.
+//
+// Returning fewer samples than asked for ends the stream after they are played;
+// Play starts it again.
+//
+// The function is called on the mixer thread of OpenAL. It should return quickly,
+// without blocking, and must not call functions of the package, or it may deadlock.
+type CallbackStreamFunc func(samples []int16) int
+
+// CallbackStream is a stream with the lowest latency possible, for synthesizers
+// or voice chat. OpenAL pulls the samples from a CallbackStreamFunc as it mixes them.
+//
+// If OpenAL lacks the AL_SOFT_callback_buffer extension, it falls back to
+// a SoundStream queueing small buffers, with a higher (yet still low) latency.
+//
+// A CallbackStream cannot seek.
+type CallbackStream struct {
+	SoundStream
+	*callbackState
+
+	// with AL_SOFT_callback_buffer
+	direct    bool
+	id        int
+	buffer    C.ALuint
+	bufferGen uint64
+
+	// without it, owned by the streaming goroutine
+	data  []int16
+	ended bool
+
+	leak *leakCheck
+}
+
+// callbackState is the part of a CallbackStream used by the mixer thread
+// of OpenAL, registered by its id.
+type callbackState struct {
+	// with AL_SOFT_callback_buffer
+	played  int64 // samples returned by fn, accessed atomically
+	padding int64 // samples of silence to give before calling fn, see PlayAt; accessed atomically
+
+	fn       CallbackStreamFunc
+	channels int
+}
+
+// NewCallbackStream creates a stream playing the samples from fn, of the channel count and the sample rate.
+//
+// The error wraps ErrOutOfSources if the OpenAL source cannot be created,
+// or ErrUnsupportedChannels if OpenAL cannot play the channel count.
+func NewCallbackStream(channelCount, sampleRate int, fn CallbackStreamFunc) (*CallbackStream, error) {
+	s := &CallbackStream{
+		callbackState: &callbackState{
+			fn:       fn,
+			channels: channelCount,
+		},
+	}
+	info := SoundFileInfo{
+		ChannelCount: channelCount,
+		SampleRate:   sampleRate,
+	}
+
+	var err error
+	if extCallbackBuffer {
+		err = s.initDirect(info)
+	} else {
+		s.SetBufferCount(callbackFallbackBufferCount)
+		s.SetBufferDuration(callbackFallbackBufferDuration)
+		err = s.Init(callbackStreamData{s}, info)
+	}
+	if err != nil {
+		s.Close()
+		return nil, fmt.Errorf("CallbackStream: cannot create: %w", err)
+	}
+
+	s.leak = newLeakCheck("CallbackStream")
+	s.leak.hold()
+	return s, nil
+}
+
+// initDirect sets up the source to stream with AL_SOFT_callback_buffer.
+func (s *CallbackStream) initDirect(info SoundFileInfo) error {
+	s.direct = true
+
+	format := getFormatFromChannelCount(info.ChannelCount)
+	if format == 0 {
+		return fmt.Errorf("%w: %d", ErrUnsupportedChannels, info.ChannelCount)
+	}
+
+	s.ctl.Lock()
+	defer s.ctl.Unlock()
+
+	stateLock.Lock()
+	err := s.soundSource.init()
+	stateLock.Unlock()
+	if err != nil {
+		return err
+	}
+
+	s.lock.Lock()
+	s.info = info
+	s.format = format
+	s.lock.Unlock()
+
+	s.buffer, s.bufferGen = genBuffer()
+
+	callbackLock.Lock()
+	callbackID++
+	s.id = callbackID
+	callbackStreams[s.id] = s.callbackState
+	callbackLock.Unlock()
+
+	C.__GoAudio_C_BufferCallback(s.buffer, format, C.ALsizei(info.SampleRate), C.uintptr_t(s.id))
+	if err = alError("alBufferCallbackSOFT"); err != nil {
+		return err
+	}
+
+	stateLock.Lock()
+	C.alSourcei(s.source, C.AL_BUFFER, C.ALint(s.buffer))
+	alCheck("alSourcei")
+	stateLock.Unlock()
+	return nil
+}
+
+// Play starts/resumes playing the stream.
+func (s *CallbackStream) Play() {
+	if !s.direct {
+		s.SoundStream.Play()
+		return
+	}
+	s.ctl.Lock()
+	defer s.ctl.Unlock()
+
+	if s.source == 0 {
+		panic("CallbackStream: call of nil object on Play()")
+	}
+	atomic.StoreInt64(&s.callbackState.padding, 0)
+	C.alSourcePlay(s.source)
+	alCheck("alSourcePlay")
+	emit(&s.soundSource, EventStarted)
+}
+
+// Pause pauses the stream if playing.
+func (s *CallbackStream) Pause() {
+	if !s.direct {
+		s.SoundStream.Pause()
+		return
+	}
+	s.ctl.Lock()
+	defer s.ctl.Unlock()
+
+	if s.soundSource.Status() == Playing {
+		emit(&s.soundSource, EventPaused)
+	}
+	C.alSourcePause(s.source)
+	alCheck("alSourcePause")
+}
+
+// Stop stops the stream if playing.
+//
+// The samples already taken from the CallbackStreamFunc are dropped.
+func (s *CallbackStream) Stop() {
+	if !s.direct {
+		s.SoundStream.Stop()
+		return
+	}
+	s.ctl.Lock()
+	defer s.ctl.Unlock()
+
+	if s.soundSource.Status() != Stopped {
+		emit(&s.soundSource, EventStopped)
+	}
+	C.alSourceStop(s.source)
+	alCheck("alSourceStop")
+	atomic.StoreInt64(&s.played, 0)
+	atomic.StoreInt64(&s.callbackState.padding, 0)
+}
+
+// Status returns the current status of the stream.
+func (s *CallbackStream) Status() PlayStatus {
+	if !s.direct {
+		return s.SoundStream.Status()
+	}
+	return s.soundSource.Status()
+}
+
+// PlayingOffset returns the time played since the stream is started.
+//
+// With AL_SOFT_callback_buffer, it is ahead of what is heard
+// by the samples OpenAL is mixing.
+func (s *CallbackStream) PlayingOffset() time.Duration {
+	return framesToDuration(s.PlayingOffsetSamples(), s.SampleRate())
+}
+
+// PlayingOffsetSamples returns the number of samples of a single channel (frames)
+// played since the stream is started.
+//
+// With AL_SOFT_callback_buffer, it is ahead of what is heard
+// by the samples OpenAL is mixing.
+func (s *CallbackStream) PlayingOffsetSamples() int64 {
+	if !s.direct {
+		return s.SoundStream.PlayingOffsetSamples()
+	}
+	return atomic.LoadInt64(&s.played) / int64(s.channels)
+}
+
+// Clock samples the playback position of the stream.
+//
+// With AL_SOFT_callback_buffer, the position is the one of PlayingOffsetSamples,
+// and the latency is of the device only (ALC_SOFT_device_clock).
+func (s *CallbackStream) Clock() Clock {
+	if !s.direct {
+		return s.SoundStream.Clock()
+	}
+
+	c := Clock{
+		Time:    time.Now(),
+		Playing: s.Status() == Playing,
+	}
+	c.setOffset(s.PlayingOffsetSamples(), 0, s.SampleRate())
+
+	if extDeviceClock {
+		var v [2]C.int64_t
+		C.__GoAudio_C_GetInteger64v(alcDevice, C.ALC_DEVICE_CLOCK_LATENCY_SOFT, 2, &v[0])
+		alcCheck(alcDevice, "alcGetInteger64vSOFT")
+		c.DeviceClock, c.Latency = time.Duration(v[0]), time.Duration(v[1])
+	}
+	return c
+}
+
+// SetPlayingOffset does nothing, as a CallbackStream cannot seek.
+func (s *CallbackStream) SetPlayingOffset(offset time.Duration) {}
+
+// SetPlayingOffsetSamples does nothing, as a CallbackStream cannot seek.
+func (s *CallbackStream) SetPlayingOffsetSamples(offset int64) {}
+
+// Close stops the stream and frees its OpenAL objects.
+//
+// Calling Close more than once does nothing.
+func (s *CallbackStream) Close() {
+	s.leak.release()
+	if !s.direct {
+		s.SoundStream.Close()
+		return
+	}
+	s.ctl.Lock()
+	defer s.ctl.Unlock()
+
+	if s.source != 0 {
+		stateLock.Lock()
+		C.alSourceStop(s.source)
+		alCheck("alSourceStop")
+		s.soundSource.close()
+		stateLock.Unlock()
+	}
+	if s.buffer != 0 {
+		deleteBuffer(s.buffer, s.bufferGen)
+		s.buffer = 0
+	}
+
+	callbackLock.Lock()
+	delete(callbackStreams, s.id)
+	callbackLock.Unlock()
+
+	unwatch(&s.soundSource)
+}
+
+// fill calls fn for at most len(samples), in whole frames.
+func (s *callbackState) fill(samples []int16) int {
+	samples = samples[:len(samples)-len(samples)%s.channels]
+	n := s.fn(samples)
+	if n < 0 {
+		n = 0
+	}
+	if n > len(samples) {
+		n = len(samples)
+	}
+	return n - n%s.channels
+}
+
+//export __GoAudio_BufferCallback
+func __GoAudio_BufferCallback(id C.uintptr_t, data unsafe.Pointer, size C.int) C.int {
+	callbackLock.RLock()
+	s := callbackStreams[int(id)]
+	callbackLock.RUnlock()
+	if s == nil {
+		return 0
+	}
+
+	count := int(size) / int(unsafe.Sizeof(int16(0)))
+	samples := (*[1 << 28]int16)(data)[:count:count]
+	return C.int(s.mix(samples) * int(unsafe.Sizeof(int16(0))))
+}
+
+// mix fills the samples for the mixer thread, with the silence left before
+// a scheduled start and then from fn. It returns the number of samples filled.
+func (s *callbackState) mix(samples []int16) int {
+	count := len(samples)
+
+	// the silence before a scheduled start
+	var silence int
+	if padding := atomic.LoadInt64(&s.padding); padding > 0 {
+		silence = count
+		if padding < int64(count) {
+			silence = int(padding)
+		}
+		for i := range samples[:silence] {
+			samples[i] = 0
+		}
+		atomic.AddInt64(&s.padding, -int64(silence))
+	}
+
+	var n int
+	if silence < count {
+		n = s.fill(samples[silence:])
+		atomic.AddInt64(&s.played, int64(n))
+	}
+	return silence + n
+}
+
+// callbackStreamData satisfies SoundStreamInterface,
+// used if OpenAL lacks AL_SOFT_callback_buffer.
+type callbackStreamData struct {
+	s *CallbackStream
+}
+
+func (d callbackStreamData) GetData() []int16 {
+	s := d.s
+	if s.ended {
+		return nil
+	}
+
+	size := int(float64(s.SampleRate())*s.BufferDuration().Seconds()) * s.channels
+	if size < s.channels {
+		size = s.channels
+	}
+	if len(s.data) != size {
+		s.data = make([]int16, size)
+	}
+
+	n := s.fill(s.data)
+	if n < len(s.data) {
+		s.ended = true
+	}
+	return s.data[:n]
+}
+
+// Seek only restarts the stream, which is stopped.
+func (d callbackStreamData) Seek(offset time.Duration) {
+	d.s.ended = false
+}
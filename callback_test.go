@@ -0,0 +1,94 @@
+package audio
+
+import "testing"
+
+func TestCallbackStateFill(t *testing.T) {
+	var ret int
+	s := &callbackState{channels: 2, fn: func(samples []int16) int {
+		if len(samples)%2 != 0 {
+			t.Errorf("fn called for %d samples, not whole frames", len(samples))
+		}
+		return ret
+	}}
+
+	tests := []struct{ size, ret, want int }{
+		{8, 8, 8},
+		{9, 8, 8},   // the partial frame is not asked for
+		{8, 5, 4},   // nor kept
+		{8, 100, 8}, // more than asked for
+		{8, -1, 0},
+	}
+	for _, tt := range tests {
+		ret = tt.ret
+		if got := s.fill(make([]int16, tt.size)); got != tt.want {
+			t.Errorf("fill of %d samples, fn returning %d = %d, want %d", tt.size, tt.ret, got, tt.want)
+		}
+	}
+}
+
+func TestCallbackStreamFallback(t *testing.T) {
+	if err := Init(); err != nil {
+		t.Skip("cannot open the device:", err)
+	}
+	defer Shutdown()
+	if extCallbackBuffer {
+		t.Skip("AL_SOFT_callback_buffer is supported")
+	}
+
+	calls := 0
+	s, err := NewCallbackStream(2, 44100, func(samples []int16) int {
+		calls++
+		for i := range samples {
+			samples[i] = int16(calls)
+		}
+		if calls == 2 {
+			return 3 // ends the stream, with a partial frame dropped
+		}
+		return len(samples)
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer s.Close()
+
+	// called directly, before the streaming goroutine runs
+	d := callbackStreamData{s}
+	first := d.GetData()
+	want := int(float64(44100)*callbackFallbackBufferDuration.Seconds()) * 2
+	if len(first) != want || first[0] != 1 {
+		t.Fatalf("GetData = %d samples of %d, want %d of 1", len(first), first[0], want)
+	}
+	if got := d.GetData(); len(got) != 2 || got[0] != 2 {
+		t.Fatalf("GetData = %v, want 2 samples of 2", got)
+	}
+	if got := d.GetData(); got != nil || calls != 2 {
+		t.Fatalf("GetData = %d samples after the end, fn called %d times", len(got), calls)
+	}
+
+	// Seek starts it again
+	d.Seek(0)
+	if got := d.GetData(); len(got) != want || got[0] != 3 {
+		t.Errorf("GetData after Seek = %d samples of %d, want %d of 3", len(got), got[0], want)
+	}
+}
+
+func TestCallbackStateMix(t *testing.T) {
+	s := &callbackState{channels: 1, padding: 6, fn: func(samples []int16) int {
+		for i := range samples {
+			samples[i] = 1
+		}
+		return len(samples)
+	}}
+
+	// the silence of PlayAt comes first, across the calls
+	got := make([]int16, 4)
+	if n := s.mix(got); n != 4 || !equalSamples(got, []int16{0, 0, 0, 0}) {
+		t.Errorf("mix = %d, %v; want 4 samples of silence", n, got)
+	}
+	if n := s.mix(got); n != 4 || !equalSamples(got, []int16{0, 0, 1, 1}) {
+		t.Errorf("mix = %d, %v; want 2 samples of silence, then 2 from fn", n, got)
+	}
+	if s.padding != 0 || s.played != 2 {
+		t.Errorf("padding = %d, played = %d after the silence; want 0 and 2", s.padding, s.played)
+	}
+}
@@ -0,0 +1,147 @@
+package audio
+
+// #include "headers.h"
+import "C"
+import "time"
+
+// maxClockInterpolation limits how far the position is interpolated
+// past the last change of AL_SAMPLE_OFFSET, in case the source stalls.
+const maxClockInterpolation = 100 * time.Millisecond
+
+// Clock is the playback position of a sound, sampled at a point in time,
+// for synchronizing video or animation with the audio.
+//
+// With the AL_SOFT_source_latency extension, the position is exact to the
+// sample, and comes with the output latency of the device. Without it,
+// the position reported by OpenAL only changes once every mixing block,
+// so it is interpolated by the time passed since it last changed.
+type Clock struct {
+	Offset        time.Duration // the playing position, i.e., of the samples being mixed
+	OffsetSamples int64         // Offset in samples of a single channel (frames), rounded down
+	Latency       time.Duration // the output latency; the samples at Offset are heard after it
+	DeviceClock   time.Duration // the clock of the device when sampled (ALC_SOFT_device_clock), or 0 without it
+	Time          time.Time     // the local time when sampled
+	Playing       bool          // the sound is playing, and the position moves on
+	Interpolated  bool          // Offset is interpolated, without AL_SOFT_source_latency
+}
+
+// Heard returns the position being heard at c.Time, compensated for the latency.
+func (c Clock) Heard() time.Duration {
+	if c.Offset < c.Latency {
+		return 0
+	}
+	return c.Offset - c.Latency
+}
+
+// At returns the position heard at time t, extrapolated from c.Time
+// assuming a pitch of 1.
+func (c Clock) At(t time.Time) time.Duration {
+	if !c.Playing {
+		return c.Heard()
+	}
+	return c.Heard() + t.Sub(c.Time)
+}
+
+// clockState keeps the last change of AL_SAMPLE_OFFSET, for the interpolation.
+type clockState struct {
+	offset int64
+	time   time.Time
+}
+
+// sampleClock samples the position of the source, in frames of 32.32 fixed point,
+// along with the rest of the Clock. stateLock must be held.
+func (s *soundSource) sampleClock(sampleRate int) (offset int64, c Clock) {
+	c.Time = time.Now()
+	c.Playing = s.status() == Playing
+
+	var v [2]C.int64_t
+	if extSourceLatency {
+		C.__GoAudio_C_GetSourcei64v(s.source, C.AL_SAMPLE_OFFSET_LATENCY_SOFT, &v[0])
+		alCheck("alGetSourcei64vSOFT")
+		offset, c.Latency = int64(v[0]), time.Duration(v[1])
+
+		if extDeviceClock {
+			C.__GoAudio_C_GetSourcei64v(s.source, C.AL_SAMPLE_OFFSET_CLOCK_SOFT, &v[0])
+			alCheck("alGetSourcei64vSOFT")
+			offset, c.DeviceClock = int64(v[0]), time.Duration(v[1])
+		}
+		return
+	}
+
+	var frames C.ALint
+	C.alGetSourcei(s.source, C.AL_SAMPLE_OFFSET, &frames)
+	alCheck("alGetSourcei")
+	offset = int64(frames) << 32
+	c.Interpolated = true
+
+	if c.Playing && int64(frames) == s.clock.offset && !s.clock.time.IsZero() {
+		elapsed := c.Time.Sub(s.clock.time)
+		if elapsed > maxClockInterpolation {
+			elapsed = maxClockInterpolation
+		}
+		offset += int64(elapsed.Seconds() * float64(sampleRate) * (1 << 32))
+	} else {
+		s.clock = clockState{offset: int64(frames), time: c.Time}
+	}
+
+	if extDeviceClock {
+		C.__GoAudio_C_GetInteger64v(alcDevice, C.ALC_DEVICE_CLOCK_LATENCY_SOFT, 2, &v[0])
+		alcCheck(alcDevice, "alcGetInteger64vSOFT")
+		c.DeviceClock, c.Latency = time.Duration(v[0]), time.Duration(v[1])
+	}
+	return
+}
+
+// setOffset sets Offset and OffsetSamples to base frames plus offset, in 32.32 fixed point.
+func (c *Clock) setOffset(base, offset int64, sampleRate int) {
+	c.OffsetSamples = base + offset>>32
+	if c.OffsetSamples < 0 {
+		// still in the silence before a scheduled start
+		c.OffsetSamples = 0
+		return
+	}
+	c.Offset = framesToDuration(c.OffsetSamples, sampleRate)
+	if sampleRate > 0 {
+		frac := float64(offset&(1<<32-1)) / (1 << 32)
+		c.Offset += time.Duration(frac * float64(time.Second) / float64(sampleRate))
+	}
+}
+
+// Clock samples the playback position of the sound.
+func (s *Sound) Clock() Clock {
+	stateLock.Lock()
+	defer stateLock.Unlock()
+
+	var rate int
+	if s.buffer != nil {
+		rate = s.buffer.info.SampleRate
+	}
+	if s.source == 0 || rate == 0 {
+		return Clock{Time: time.Now()}
+	}
+
+	offset, c := s.sampleClock(rate)
+	c.setOffset(0, offset, rate)
+	return c
+}
+
+// Clock samples the playback position of the stream.
+func (s *SoundStream) Clock() Clock {
+	rate := s.SampleRate()
+
+	// the offset of the source and seekOffset change together under s.lock,
+	// as the streaming goroutine unqueues the buffers
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	stateLock.Lock()
+	if s.source == 0 || rate == 0 {
+		stateLock.Unlock()
+		return Clock{Time: time.Now()}
+	}
+	offset, c := s.sampleClock(rate)
+	stateLock.Unlock()
+
+	c.setOffset(s.seekOffset, offset, rate)
+	return c
+}
@@ -0,0 +1,81 @@
+package audio
+
+import (
+	"testing"
+	"time"
+)
+
+func TestClockHeard(t *testing.T) {
+	now := time.Now()
+	c := Clock{Offset: time.Second, Latency: 30 * time.Millisecond, Time: now, Playing: true}
+	if got := c.Heard(); got != 970*time.Millisecond {
+		t.Errorf("Heard = %v, want 970ms", got)
+	}
+	if got := c.At(now.Add(100 * time.Millisecond)); got != 1070*time.Millisecond {
+		t.Errorf("At 100ms later = %v, want 1.07s", got)
+	}
+
+	c.Playing = false
+	if got := c.At(now.Add(time.Second)); got != 970*time.Millisecond {
+		t.Errorf("At when paused = %v, want 970ms", got)
+	}
+	c.Offset = 10 * time.Millisecond
+	if got := c.Heard(); got != 0 {
+		t.Errorf("Heard within the latency = %v, want 0", got)
+	}
+}
+
+func TestClockSetOffset(t *testing.T) {
+	var c Clock
+	// a frame and a half past the base, at 1000 Hz
+	c.setOffset(1000, 3<<31, 1000)
+	if c.OffsetSamples != 1001 || c.Offset != 1001500*time.Microsecond {
+		t.Errorf("setOffset = (%d, %v), want (1001, 1.0015s)", c.OffsetSamples, c.Offset)
+	}
+
+	// in the silence before a scheduled start
+	c = Clock{}
+	c.setOffset(-500, 10<<32, 1000)
+	if c.OffsetSamples != 0 || c.Offset != 0 {
+		t.Errorf("setOffset before the start = (%d, %v), want (0, 0)", c.OffsetSamples, c.Offset)
+	}
+}
+
+func TestSoundClockInterpolated(t *testing.T) {
+	if err := Init(); err != nil {
+		t.Skip("cannot open the device:", err)
+	}
+	defer Shutdown()
+	if extSourceLatency {
+		t.Skip("AL_SOFT_source_latency is supported")
+	}
+
+	b := NewSoundBuffer()
+	defer b.Release()
+	loadRaw(t, b, 44100, 1)
+	s := NewSound()
+	defer s.Release()
+	s.SetBuffer(b)
+
+	if c := s.Clock(); c.Playing || c.Offset != 0 {
+		t.Errorf("Clock of a stopped sound = %+v", c)
+	}
+
+	// the position moves on between the changes of AL_SAMPLE_OFFSET,
+	// up to maxClockInterpolation
+	s.Play()
+	first := s.Clock()
+	time.Sleep(20 * time.Millisecond)
+	second := s.Clock()
+	if !second.Playing || !second.Interpolated {
+		t.Fatalf("Clock of a playing sound = %+v", second)
+	}
+	if d := second.Offset - first.Offset; d < 10*time.Millisecond || d > maxClockInterpolation {
+		t.Errorf("Clock moved by %v in 20ms", d)
+	}
+	time.Sleep(maxClockInterpolation)
+	third := s.Clock()
+	if d := third.Offset - framesToDuration(s.PlayingOffsetSamples(), 44100); d > maxClockInterpolation+time.Millisecond {
+		t.Errorf("Clock interpolated by %v past AL_SAMPLE_OFFSET, over the limit", d)
+	}
+}
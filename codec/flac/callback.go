@@ -14,6 +14,7 @@ import (
 	"unsafe"
 
 	"github.com/Edgaru089/audio"
+	"github.com/Edgaru089/audio/pcm"
 )
 
 //export __GoAudioFLAC_StreamRead
@@ -157,32 +158,17 @@ func __GoAudioFLAC_StreamWrite(
 	reader := readers[int(clientData)]
 	lock.RUnlock()
 
-	// sample count in this frame
-	_ = int(frame.header.blocksize * frame.header.channels)
+	bits := int(frame.header.bits_per_sample)
+	if !pcm.ValidBits(bits) {
+		reader.err = fmt.Errorf("flac decode error: unsupported bits per sample: %d", bits)
+		return C.FLAC__STREAM_DECODER_WRITE_STATUS_ABORT
+	}
+	reader.bits = bits
 
+	// the samples are converted when written into the read buffer
 	for i := 0; i < int(frame.header.blocksize); i++ {
 		for j := 0; j < int(frame.header.channels); j++ {
-			var sample int32 = 0
-			// let's do some dithering!!!
-			switch frame.header.bits_per_sample {
-			case 8:
-				sample = readBuffer(buffer, j, i) << 8
-			case 16:
-				sample = readBuffer(buffer, j, i)
-			case 24:
-				sample = readBuffer(buffer, j, i) >> 8
-			case 32:
-				sample = readBuffer(buffer, j, i) >> 16
-			default:
-				panic(fmt.Sprint("__GoAudioFLAC_StreamWrite: unsupported bits per sample: ", frame.header.bits_per_sample))
-			}
-
-			if reader.readBuffer != nil && reader.alreadyRead < len(reader.readBuffer) {
-				reader.readBuffer[reader.alreadyRead] = int16(sample)
-				reader.alreadyRead++
-			} else {
-				reader.leftoverBuffer = append(reader.leftoverBuffer, int16(sample))
-			}
+			reader.put(readBuffer(buffer, j, i))
 		}
 	}
 
@@ -12,6 +12,7 @@ import (
 	"unsafe"
 
 	"github.com/Edgaru089/audio"
+	"github.com/Edgaru089/audio/pcm"
 )
 
 type SoundFileReaderFLAC struct {
@@ -22,10 +23,15 @@ type SoundFileReaderFLAC struct {
 	file io.ReadSeeker
 	info audio.SoundFileInfo
 
-	readBuffer  []int16 // The main buffer to be written first.
-	alreadyRead int     // The number of bytes already written into the buffer. Subsequent writing should happen at buffer[already].
+	readBuffer      []int16   // The main buffer to be written first, for Read.
+	readBufferFloat []float32 // The main buffer to be written first, for ReadFloat.
+	alreadyRead     int       // The number of samples already written into the buffer. Subsequent writing should happen at buffer[already].
 
-	leftoverBuffer []int16 // Leftover samples from reading a frame that does not fit into the main buffer.
+	leftoverBuffer []int32 // Leftover samples from reading a frame that does not fit into the main buffer.
+
+	bits      int            // Bit depth of the decoded samples.
+	channel   int            // Channel of the next sample written into the main buffer.
+	quantizer *pcm.Quantizer // Reduces samples deeper than 16 bits for Read.
 
 	err error
 }
@@ -76,6 +82,7 @@ func (r *SoundFileReaderFLAC) Open(file io.ReadSeeker) (info audio.SoundFileInfo
 		return
 	}
 
+	r.quantizer = pcm.NewQuantizer(pcm.DefaultDither(), r.info.ChannelCount)
 	return r.info, nil
 }
 
@@ -92,9 +99,11 @@ func (r *SoundFileReaderFLAC) Seek(sampleOffset int64) error {
 
 	// clear the read buffer and the leftover
 	// the seek operation will trigger a read of one frame
-	r.readBuffer = nil
+	r.readBuffer, r.readBufferFloat = nil, nil
 	r.alreadyRead = 0
 	r.leftoverBuffer = r.leftoverBuffer[:0]
+	r.channel = 0
+	r.quantizer.Reset()
 
 	// FLAC seeks expect absolute sample offset without channels
 	if sampleOffset < r.info.SampleCount {
@@ -117,31 +126,71 @@ func (r *SoundFileReaderFLAC) Read(data []int16) (samplesRead int64, err error)
 		panic("flac: call Read on nil Reader")
 	}
 
+	r.readBuffer, r.readBufferFloat = data, nil
+	return r.read(len(data))
+}
+
+// ReadFloat reads float audio samples, keeping the full bit depth of the file.
+//
+// It satisfies audio.SoundFileFloatReader.
+func (r *SoundFileReaderFLAC) ReadFloat(data []float32) (samplesRead int64, err error) {
+	if r.decoder == nil {
+		panic("flac: call ReadFloat on nil Reader")
+	}
+
+	r.readBuffer, r.readBufferFloat = nil, data
+	return r.read(len(data))
+}
+
+// SetDither sets the dither used by Read to reduce samples deeper than 16 bits.
+//
+// The default is pcm.DefaultDither() when the file is opened.
+func (r *SoundFileReaderFLAC) SetDither(dither pcm.Dither) {
+	r.quantizer = pcm.NewQuantizer(dither, r.info.ChannelCount)
+}
+
+// put writes a sample into the main buffer,
+// or into the leftover if the main buffer is full.
+func (r *SoundFileReaderFLAC) put(sample int32) {
+	switch {
+	case r.readBufferFloat != nil && r.alreadyRead < len(r.readBufferFloat):
+		r.readBufferFloat[r.alreadyRead] = pcm.ToFloat32(sample, r.bits)
+	case r.readBuffer != nil && r.alreadyRead < len(r.readBuffer):
+		r.readBuffer[r.alreadyRead] = r.quantizer.Quantize(r.channel, sample, r.bits)
+	default:
+		r.leftoverBuffer = append(r.leftoverBuffer, sample)
+		return
+	}
+
+	r.alreadyRead++
+	r.channel++
+	if r.channel >= r.info.ChannelCount {
+		r.channel = 0
+	}
+}
+
+// read fills count samples into the main buffer set by Read or ReadFloat,
+// from the leftover first, and then from newly decoded frames.
+func (r *SoundFileReaderFLAC) read(count int) (samplesRead int64, err error) {
 	r.err = nil
 	r.alreadyRead = 0
 
 	// if the leftover is not empty, use that first
 	if len(r.leftoverBuffer) > 0 {
-		if len(r.leftoverBuffer) > len(data) {
-			// with leftover only we can fill the read request
-			copy(data, r.leftoverBuffer)
-
-			// move the remaining of the leftover to the beginning
-			copy(r.leftoverBuffer, r.leftoverBuffer[len(data):])
-			r.leftoverBuffer = r.leftoverBuffer[:len(r.leftoverBuffer)-len(data)]
-
-			return int64(len(data)), nil
-		} else {
-			// copy all of leftover and then decode new frames
-			copy(data, r.leftoverBuffer)
-			r.alreadyRead = len(r.leftoverBuffer)
-			r.leftoverBuffer = r.leftoverBuffer[:0]
+		n := len(r.leftoverBuffer)
+		if n > count {
+			n = count
+		}
+		for _, sample := range r.leftoverBuffer[:n] {
+			r.put(sample)
 		}
-	}
 
-	r.readBuffer = data
+		// move the remaining of the leftover to the beginning
+		copy(r.leftoverBuffer, r.leftoverBuffer[n:])
+		r.leftoverBuffer = r.leftoverBuffer[:len(r.leftoverBuffer)-n]
+	}
 
-	for r.alreadyRead < len(r.readBuffer) {
+	for r.alreadyRead < count {
 
 		// it calls the write callback, everything happens there
 		// this returns FALSE on fatal error (not including EOF)
@@ -156,6 +205,9 @@ func (r *SoundFileReaderFLAC) Read(data []int16) (samplesRead int64, err error)
 		}
 	}
 
+	// frames decoded from now on (e.g., by Seek) go to the leftover
+	r.readBuffer, r.readBufferFloat = nil, nil
+
 	return int64(r.alreadyRead), r.err
 }
 
@@ -0,0 +1,17 @@
+// Package midi implements a pure Go Standard MIDI File player for the parent audio package,
+// rendered with a SoundFont 2 wavetable synthesizer.
+//
+// A SoundFont is needed to render MIDI files. Load one with LoadSoundFont and set it with
+// SetDefaultSoundFont, so that the registered codec can open .mid files for Music and SoundBuffer:
+//
+//	sf, err := midi.LoadSoundFont(file)
+//	if err != nil {
+//		// ...
+//	}
+//	midi.SetDefaultSoundFont(sf)
+//
+// The Synthesizer can also be played directly with MIDI messages.
+//
+// The synthesizer implements the generators, the envelopes, the LFOs, the low-pass filter and the
+// modulators (including the default ones) of SoundFont 2.04. The reverb and chorus sends are ignored.
+package midi
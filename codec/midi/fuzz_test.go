@@ -0,0 +1,34 @@
+//go:build go1.18
+// +build go1.18
+
+package midi
+
+import (
+	"bytes"
+	"testing"
+)
+
+func FuzzLoadSoundFont(f *testing.F) {
+	f.Add(testSoundFont())
+	for _, data := range malformedSoundFonts {
+		f.Add([]byte(data))
+	}
+
+	f.Fuzz(func(t *testing.T, data []byte) {
+		sf, err := LoadSoundFont(bytes.NewReader(data))
+		if err == nil {
+			playSoundFont(sf)
+		}
+	})
+}
+
+func FuzzParseSMF(f *testing.F) {
+	f.Add(testSMF())
+	for _, data := range malformedSMFs {
+		f.Add([]byte(data))
+	}
+
+	f.Fuzz(func(t *testing.T, data []byte) {
+		parseSMF(data)
+	})
+}
@@ -0,0 +1,176 @@
+package midi
+
+import "math"
+
+// modulator is a SoundFont 2 modulator record.
+type modulator struct {
+	src    uint16 // source operator
+	dst    uint16 // destination generator
+	amount int16
+	amtSrc uint16 // amount source operator
+	trans  uint16 // transform
+}
+
+// Fields of the source operators.
+const (
+	srcIndexMask = 0x007F
+	srcCC        = 0x0080 // the index is a MIDI controller
+	srcNegative  = 0x0100 // the source goes from max to min
+	srcBipolar   = 0x0200 // the source goes from -1 to 1
+	srcTypeShift = 10
+)
+
+// General controller sources, if srcCC is not set.
+const (
+	srcNone                  = 0
+	srcVelocity              = 2
+	srcKey                   = 3
+	srcPolyPressure          = 10
+	srcChannelPressure       = 13
+	srcPitchWheel            = 14
+	srcPitchWheelSensitivity = 16
+)
+
+// Source curve types.
+const (
+	curveLinear = iota
+	curveConcave
+	curveConvex
+	curveSwitch
+)
+
+const transAbsolute = 2
+
+// defaultModulators are the default modulators of SoundFont 2.04, section 8.4.
+//
+// The default velocity to filter cutoff modulator is left out,
+// like most synthesizers do, as it muffles most soft notes.
+var defaultModulators = []modulator{
+	// velocity to attenuation
+	{src: srcVelocity | srcNegative | curveConcave<<srcTypeShift, dst: genInitialAttenuation, amount: 960},
+	// channel pressure to vibrato LFO pitch depth
+	{src: srcChannelPressure, dst: genVibLfoToPitch, amount: 50},
+	// modulation wheel (CC1) to vibrato LFO pitch depth
+	{src: srcCC | 1, dst: genVibLfoToPitch, amount: 50},
+	// volume (CC7) to attenuation
+	{src: srcCC | 7 | srcNegative | curveConcave<<srcTypeShift, dst: genInitialAttenuation, amount: 960},
+	// pan (CC10) to pan
+	{src: srcCC | 10 | srcBipolar, dst: genPan, amount: 1000},
+	// expression (CC11) to attenuation
+	{src: srcCC | 11 | srcNegative | curveConcave<<srcTypeShift, dst: genInitialAttenuation, amount: 960},
+	// reverb (CC91) and chorus (CC93) sends
+	{src: srcCC | 91, dst: genReverbEffectsSend, amount: 200},
+	{src: srcCC | 93, dst: genChorusEffectsSend, amount: 200},
+	// pitch wheel to pitch, scaled by the sensitivity
+	{src: srcPitchWheel | srcBipolar, dst: genPitch, amount: 12700, amtSrc: srcPitchWheelSensitivity},
+}
+
+// identical tells if two modulators are the same modulator, which only differs by amount.
+func (m modulator) identical(o modulator) bool {
+	return m.src == o.src && m.dst == o.dst && m.amtSrc == o.amtSrc && m.trans == o.trans
+}
+
+// mergeModulators adds mods into list, replacing the identical ones.
+func mergeModulators(list, mods []modulator) []modulator {
+	list = append([]modulator(nil), list...)
+outer:
+	for _, m := range mods {
+		for i := range list {
+			if list[i].identical(m) {
+				list[i] = m
+				continue outer
+			}
+		}
+		list = append(list, m)
+	}
+	return list
+}
+
+// concave is the concave curve of SoundFont, 0 ~ 1 for x in 0 ~ 1.
+func concave(x float64) float64 {
+	if x >= 1 {
+		return 1
+	}
+	if x <= 0 {
+		return 0
+	}
+	return math.Min(1, -5.0/12*math.Log10(1-x))
+}
+
+// curve maps the normalized controller value x (0 ~ 1) with the curve of the source operator.
+func curve(op uint16, x float64) float64 {
+	if op&srcNegative != 0 {
+		x = 1 - x
+	}
+
+	shape := func(x float64) float64 {
+		switch op >> srcTypeShift {
+		case curveConcave:
+			return concave(x)
+		case curveConvex:
+			return 1 - concave(1-x)
+		case curveSwitch:
+			if x >= 0.5 {
+				return 1
+			}
+			return 0
+		}
+		return x
+	}
+
+	if op&srcBipolar != 0 {
+		if x >= 0.5 {
+			return shape(2*x - 1)
+		}
+		return -shape(1 - 2*x)
+	}
+	return shape(x)
+}
+
+// sourceValue returns the value of the source operator, for the note on the channel.
+func sourceValue(op uint16, ch *channel, key, vel int) float64 {
+	index := int(op & srcIndexMask)
+	var x float64
+
+	if op&srcCC != 0 {
+		switch {
+		case index == 0 || index == 6 || (index >= 32 && index <= 63) || (index >= 98 && index <= 101) || index >= 120:
+			// not allowed as sources
+			return 0
+		}
+		x = float64(ch.cc[index]) / 128
+	} else {
+		switch index {
+		case srcNone:
+			return 1
+		case srcVelocity:
+			x = float64(vel) / 128
+		case srcKey:
+			x = float64(key) / 128
+		case srcPolyPressure:
+			x = float64(ch.keyPressure[key]) / 128
+		case srcChannelPressure:
+			x = float64(ch.pressure) / 128
+		case srcPitchWheel:
+			x = float64(ch.pitchBend) / 16384
+		case srcPitchWheelSensitivity:
+			return ch.bendRange / 128
+		default:
+			return 0
+		}
+	}
+
+	return curve(op, x)
+}
+
+// value returns the amount of the modulator added to its destination generator.
+func (m modulator) value(ch *channel, key, vel int) float64 {
+	v := float64(m.amount) * sourceValue(m.src, ch, key, vel)
+	if m.amtSrc != srcNone {
+		v *= sourceValue(m.amtSrc, ch, key, vel)
+	}
+	if m.trans == transAbsolute {
+		v = math.Abs(v)
+	}
+	return v
+}
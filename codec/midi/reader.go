@@ -0,0 +1,271 @@
+package midi
+
+import (
+	"errors"
+	"io"
+	"math"
+	"sync"
+	"time"
+
+	"github.com/Edgaru089/audio"
+)
+
+const (
+	DefaultSampleRate = 44100 // the sample rate MIDI files are rendered at by default
+
+	// TailLength is the time rendered after the last event of a song,
+	// for the released notes to fade out.
+	TailLength = 2 * time.Second
+
+	// seekPreroll is the time rendered before the target of a seek,
+	// so that the notes started before it are playing.
+	seekPreroll = 2 * time.Second
+)
+
+// Magic is the magic header of Standard MIDI Files.
+// It is at the very beginning of the file.
+var Magic = []byte("MThd")
+
+// SoundFileCheckMidi is the check function of Standard MIDI Files.
+var SoundFileCheckMidi = audio.SoundFileCheckMagic(Magic, 0)
+
+var (
+	defaultSoundFont *SoundFont
+	lock             sync.RWMutex
+)
+
+// SetDefaultSoundFont sets the SoundFont used by the registered codec to render MIDI files.
+func SetDefaultSoundFont(sf *SoundFont) {
+	lock.Lock()
+	defaultSoundFont = sf
+	lock.Unlock()
+}
+
+// DefaultSoundFont returns the SoundFont set by SetDefaultSoundFont.
+func DefaultSoundFont() *SoundFont {
+	lock.RLock()
+	defer lock.RUnlock()
+	return defaultSoundFont
+}
+
+func init() {
+	audio.RegisterSoundFileReader(
+		SoundFileCheckMidi,
+		func() audio.SoundFileReader {
+			return NewSoundFileReaderMidi(DefaultSoundFont(), DefaultSampleRate)
+		},
+	)
+}
+
+// SoundFileReaderMidi renders Standard MIDI Files with a SoundFont.
+//
+// The output is always stereo, in 16 bits, or in 32-bit float with ReadFloat.
+type SoundFileReaderMidi struct {
+	sf   *SoundFont
+	rate int
+
+	song  *song
+	synth *Synthesizer
+	info  audio.SoundFileInfo
+
+	frames int64 // length in frames, including the tail
+	end    int64 // frame of the last event
+	pos    int64 // current frame
+	next   int   // index of the next event to be played
+	ended  bool  // the notes are released at the end of the song
+
+	mix []float32
+}
+
+// NewSoundFileReaderMidi creates a new MIDI reader, rendering with the SoundFont at the sample rate.
+//
+// The reader registered for the audio package uses the SoundFont set by SetDefaultSoundFont,
+// rendering at DefaultSampleRate.
+func NewSoundFileReaderMidi(sf *SoundFont, sampleRate int) *SoundFileReaderMidi {
+	if sampleRate <= 0 {
+		sampleRate = DefaultSampleRate
+	}
+	return &SoundFileReaderMidi{sf: sf, rate: sampleRate}
+}
+
+func (r *SoundFileReaderMidi) Open(file io.ReadSeeker) (info audio.SoundFileInfo, err error) {
+	if r.sf == nil {
+		return audio.SoundFileInfo{}, errors.New("midi: no SoundFont set")
+	}
+
+	data, err := io.ReadAll(file)
+	if err != nil {
+		return audio.SoundFileInfo{}, err
+	}
+	r.song, err = parseSMF(data)
+	if err != nil {
+		return audio.SoundFileInfo{}, err
+	}
+
+	r.synth = NewSynthesizer(r.sf, r.rate)
+	r.end = r.frameOf(r.song.duration)
+	r.frames = r.end + int64(TailLength.Seconds()*float64(r.rate))
+
+	r.info = audio.SoundFileInfo{
+		SampleCount:  r.frames * 2,
+		ChannelCount: 2,
+		SampleRate:   r.rate,
+	}
+	return r.info, nil
+}
+
+func (r *SoundFileReaderMidi) Info() audio.SoundFileInfo {
+	return r.info
+}
+
+// frameOf returns the frame of the time in seconds.
+func (r *SoundFileReaderMidi) frameOf(t float64) int64 {
+	return int64(math.Round(t * float64(r.rate)))
+}
+
+// dispatch plays the events up to the current position.
+//
+// If notes is false, only the events changing the state of the channels
+// are played, and the events right at the current position are left.
+func (r *SoundFileReaderMidi) dispatch(notes bool) {
+	limit := r.pos
+	if !notes {
+		limit--
+	}
+
+	events := r.song.events
+	for r.next < len(events) && r.frameOf(events[r.next].time) <= limit {
+		e := &events[r.next]
+		r.next++
+		if e.status == 0 {
+			// tempo change
+			continue
+		}
+		if t := e.status & 0xF0; !notes && (t == msgNoteOn || t == msgNoteOff) {
+			continue
+		}
+		r.synth.Message(e.status, e.data1, e.data2)
+	}
+
+	if r.next == len(events) && r.pos >= r.end && !r.ended {
+		r.synth.AllNotesOff()
+		r.ended = true
+	}
+}
+
+// render renders at most the given number of frames into r.mix,
+// stopping at the next event. It returns the number of frames rendered.
+func (r *SoundFileReaderMidi) render(frames int) int {
+	r.dispatch(true)
+
+	if r.next < len(r.song.events) {
+		if until := r.frameOf(r.song.events[r.next].time) - r.pos; until < int64(frames) {
+			frames = int(until)
+		}
+	}
+
+	if cap(r.mix) < frames*2 {
+		r.mix = make([]float32, frames*2)
+	}
+	r.mix = r.mix[:frames*2]
+	r.synth.Render(r.mix)
+
+	r.pos += int64(frames)
+	return frames
+}
+
+func (r *SoundFileReaderMidi) Read(data []int16) (samplesRead int64, err error) {
+	if r.pos >= r.frames {
+		return 0, io.EOF
+	}
+
+	frames := int64(len(data) / 2)
+	if left := r.frames - r.pos; frames > left {
+		frames = left
+	}
+
+	var done int64
+	for done < frames {
+		n := r.render(int(frames - done))
+		for i, v := range r.mix[:n*2] {
+			s := float64(v) * 32767
+			if s > 32767 {
+				s = 32767
+			} else if s < -32768 {
+				s = -32768
+			}
+			data[done*2+int64(i)] = int16(s)
+		}
+		done += int64(n)
+	}
+
+	return done * 2, nil
+}
+
+// Seek changes the read position.
+//
+// As the synthesizer cannot jump in time, the song is replayed from the
+// beginning without notes up to a short while before the target,
+// and then rendered up to the target, so that the notes started
+// shortly before the target sound as they should.
+func (r *SoundFileReaderMidi) Seek(sampleOffset int64) error {
+	target := sampleOffset / 2
+	if target < 0 {
+		target = 0
+	}
+	if target > r.frames {
+		target = r.frames
+	}
+
+	preroll := int64(seekPreroll.Seconds() * float64(r.rate))
+	if target < r.pos || target-r.pos > preroll {
+		r.synth.Reset()
+		r.next = 0
+		r.ended = false
+		r.pos = target - preroll
+		if r.pos < 0 {
+			r.pos = 0
+		}
+		r.dispatch(false)
+	}
+
+	for r.pos < target {
+		n := target - r.pos
+		if n > 4096 {
+			n = 4096
+		}
+		r.render(int(n))
+	}
+	return nil
+}
+
+// ReadFloat reads the rendered samples without reducing them to 16 bits.
+// The samples are not clipped, and may go out of [-1, 1] on loud passages.
+//
+// It satisfies audio.SoundFileFloatReader.
+func (r *SoundFileReaderMidi) ReadFloat(data []float32) (samplesRead int64, err error) {
+	if r.pos >= r.frames {
+		return 0, io.EOF
+	}
+
+	frames := int64(len(data) / 2)
+	if left := r.frames - r.pos; frames > left {
+		frames = left
+	}
+
+	var done int64
+	for done < frames {
+		n := r.render(int(frames - done))
+		for i, v := range r.mix[:n*2] {
+			data[done*2+int64(i)] = v
+		}
+		done += int64(n)
+	}
+
+	return done * 2, nil
+}
+
+func (r *SoundFileReaderMidi) Close() error {
+	r.song, r.synth = nil, nil
+	return nil
+}
@@ -0,0 +1,236 @@
+package midi
+
+import (
+	"encoding/binary"
+	"errors"
+	"sort"
+)
+
+// MIDI channel message types, in the high nibble of the status byte.
+const (
+	msgNoteOff         = 0x80
+	msgNoteOn          = 0x90
+	msgKeyPressure     = 0xA0
+	msgControlChange   = 0xB0
+	msgProgramChange   = 0xC0
+	msgChannelPressure = 0xD0
+	msgPitchBend       = 0xE0
+)
+
+// Meta events of SMF.
+const (
+	metaEndOfTrack = 0x2F
+	metaTempo      = 0x51
+)
+
+const defaultTempo = 500000 // microseconds per quarter note, 120 BPM
+
+// event is a channel message in a song.
+type event struct {
+	time   float64 // in seconds from the beginning
+	tick   int64
+	status uint8 // message type and channel
+	data1  uint8
+	data2  uint8
+
+	tempo int // microseconds per quarter note if it is a tempo change, 0 otherwise
+	order int // sequence number, for a stable sort
+}
+
+// song is a parsed Standard MIDI File, with the events of all tracks merged.
+type song struct {
+	events   []event
+	duration float64 // time of the last event, in seconds
+}
+
+var errTruncated = errors.New("midi: file truncated")
+
+// readVarLen reads a variable length quantity, returning the value and the number of bytes read.
+func readVarLen(b []byte) (value int64, n int) {
+	for n < len(b) && n < 4 {
+		c := b[n]
+		n++
+		value = value<<7 | int64(c&0x7F)
+		if c&0x80 == 0 {
+			return value, n
+		}
+	}
+	return value, -1
+}
+
+// parseSMF parses a Standard MIDI File of format 0, 1 or 2.
+//
+// Tracks of a format 2 file are played one after another.
+func parseSMF(data []byte) (*song, error) {
+	if len(data) < 14 || string(data[:4]) != "MThd" {
+		return nil, errors.New("midi: not a Standard MIDI File")
+	}
+
+	headerLen := int(binary.BigEndian.Uint32(data[4:]))
+	format := binary.BigEndian.Uint16(data[8:])
+	numTracks := int(binary.BigEndian.Uint16(data[10:]))
+	division := binary.BigEndian.Uint16(data[12:])
+	if headerLen < 6 || 8+headerLen > len(data) {
+		return nil, errTruncated
+	}
+	if format > 2 {
+		return nil, errors.New("midi: unknown SMF format")
+	}
+	if division == 0 {
+		return nil, errors.New("midi: invalid time division")
+	}
+
+	var events []event
+	var trackStart int64 // starting tick of the track, for format 2
+	pos := 8 + headerLen
+	for track := 0; track < numTracks && pos+8 <= len(data); {
+		id := string(data[pos : pos+4])
+		length := int(binary.BigEndian.Uint32(data[pos+4:]))
+		pos += 8
+		end := pos + length
+		if end > len(data) || length < 0 {
+			// tolerate a truncated last track
+			end = len(data)
+		}
+		if id != "MTrk" {
+			// alien chunk
+			pos = end
+			continue
+		}
+
+		last, err := parseTrack(data[pos:end], trackStart, &events)
+		if err != nil {
+			return nil, err
+		}
+		if format == 2 {
+			trackStart = last
+		}
+
+		pos = end
+		track++
+	}
+
+	sort.SliceStable(events, func(i, j int) bool {
+		if events[i].tick != events[j].tick {
+			return events[i].tick < events[j].tick
+		}
+		return events[i].order < events[j].order
+	})
+
+	// convert ticks to seconds with the tempo map
+	s := &song{events: events}
+	if division&0x8000 != 0 {
+		// SMPTE: frames per second and ticks per frame
+		fps := -float64(int8(division >> 8))
+		if fps == 29 {
+			fps = 29.97
+		}
+		perTick := 1 / (fps * float64(division&0xFF))
+		for i := range s.events {
+			s.events[i].time = float64(s.events[i].tick) * perTick
+		}
+	} else {
+		tempo := float64(defaultTempo)
+		var lastTick int64
+		var lastTime float64
+		for i := range s.events {
+			e := &s.events[i]
+			e.time = lastTime + float64(e.tick-lastTick)*tempo/1e6/float64(division)
+			lastTick, lastTime = e.tick, e.time
+			if e.tempo != 0 {
+				tempo = float64(e.tempo)
+			}
+		}
+	}
+
+	if len(s.events) > 0 {
+		s.duration = s.events[len(s.events)-1].time
+	}
+	return s, nil
+}
+
+// parseTrack parses the events in the track chunk into events, returning the tick of the track end.
+func parseTrack(b []byte, tick int64, events *[]event) (int64, error) {
+	var running uint8
+	pos := 0
+	for pos < len(b) {
+		delta, n := readVarLen(b[pos:])
+		if n < 0 {
+			return tick, errTruncated
+		}
+		pos += n
+		tick += delta
+		if pos >= len(b) {
+			break
+		}
+
+		status := b[pos]
+		if status < 0x80 {
+			// running status
+			if running == 0 {
+				return tick, errors.New("midi: data byte without status")
+			}
+			status = running
+		} else {
+			pos++
+		}
+
+		switch {
+		case status == 0xFF:
+			// meta event
+			if pos >= len(b) {
+				return tick, errTruncated
+			}
+			typ := b[pos]
+			length, n := readVarLen(b[pos+1:])
+			if n < 0 || pos+1+n+int(length) > len(b) {
+				return tick, errTruncated
+			}
+			body := b[pos+1+n : pos+1+n+int(length)]
+			pos += 1 + n + int(length)
+
+			switch typ {
+			case metaTempo:
+				if len(body) >= 3 {
+					tempo := int(body[0])<<16 | int(body[1])<<8 | int(body[2])
+					if tempo > 0 {
+						*events = append(*events, event{tick: tick, tempo: tempo, order: len(*events)})
+					}
+				}
+			case metaEndOfTrack:
+				return tick, nil
+			}
+
+		case status == 0xF0 || status == 0xF7:
+			// system exclusive, ignored
+			length, n := readVarLen(b[pos:])
+			if n < 0 || pos+n+int(length) > len(b) {
+				return tick, errTruncated
+			}
+			pos += n + int(length)
+			running = 0
+
+		case status >= 0xF0:
+			// other system messages do not appear in files
+			return tick, errors.New("midi: unexpected system message")
+
+		default:
+			running = status
+			e := event{tick: tick, status: status, order: len(*events)}
+			size := 2
+			if t := status & 0xF0; t == msgProgramChange || t == msgChannelPressure {
+				size = 1
+			}
+			if pos+size > len(b) {
+				return tick, errTruncated
+			}
+			e.data1 = b[pos] & 0x7F
+			if size == 2 {
+				e.data2 = b[pos+1] & 0x7F
+			}
+			pos += size
+			*events = append(*events, e)
+		}
+	}
+	return tick, nil
+}
@@ -0,0 +1,194 @@
+package midi
+
+import (
+	"bytes"
+	"encoding/binary"
+	"io"
+	"math"
+	"testing"
+)
+
+// smfChunk returns the SMF chunk of the id.
+func smfChunk(id string, data []byte) []byte {
+	b := make([]byte, 8, 8+len(data))
+	copy(b, id)
+	binary.BigEndian.PutUint32(b[4:], uint32(len(data)))
+	return append(b, data...)
+}
+
+// testSMF returns a Standard MIDI File of format 1 at 96 ticks per quarter note,
+// with a tempo track at 240 BPM, and a track playing two notes, the second one
+// with running status.
+func testSMF() []byte {
+	tempo := []byte{
+		0x00, 0xFF, metaTempo, 0x03, 0x03, 0xD0, 0x90, // 250000 us per quarter note
+		0x00, 0xFF, metaEndOfTrack, 0x00,
+	}
+	notes := []byte{
+		0x00, 0xC0, 0x00, // program change
+		0x00, 0x90, 60, 100,
+		0x60, 0x80, 60, 0, // a quarter note later
+		0x00, 0x90, 64, 100,
+		0x81, 0x40, 64, 0, // note on with velocity 0, 192 ticks later
+		0x00, 0xFF, metaEndOfTrack, 0x00,
+	}
+
+	header := []byte{0, 1, 0, 2, 0, 96}
+	return bytes.Join([][]byte{
+		smfChunk("MThd", header),
+		smfChunk("MTrk", tempo),
+		smfChunk("XFIH", []byte("alien")),
+		smfChunk("MTrk", notes),
+	}, nil)
+}
+
+func TestReadVarLen(t *testing.T) {
+	tests := []struct {
+		data  []byte
+		value int64
+		n     int
+	}{
+		{[]byte{0x00}, 0, 1},
+		{[]byte{0x7F}, 0x7F, 1},
+		{[]byte{0x81, 0x00}, 0x80, 2},
+		{[]byte{0xFF, 0xFF, 0xFF, 0x7F}, 0x0FFFFFFF, 4},
+		{[]byte{0x81}, 1, -1},
+		{[]byte{0xFF, 0xFF, 0xFF, 0xFF, 0x7F}, 0x0FFFFFFF, -1},
+	}
+	for _, tt := range tests {
+		value, n := readVarLen(tt.data)
+		if n != tt.n || (n > 0 && value != tt.value) {
+			t.Errorf("readVarLen(% x) = (%d, %d), want (%d, %d)", tt.data, value, n, tt.value, tt.n)
+		}
+	}
+}
+
+func TestParseSMF(t *testing.T) {
+	s, err := parseSMF(testSMF())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	want := []struct {
+		time   float64
+		status uint8
+		data1  uint8
+	}{
+		{0, 0, 0}, // the tempo change
+		{0, msgProgramChange, 0},
+		{0, msgNoteOn, 60},
+		{0.25, msgNoteOff, 60},
+		{0.25, msgNoteOn, 64},
+		{0.75, msgNoteOn, 64},
+	}
+	if len(s.events) != len(want) {
+		t.Fatalf("%d events, want %d", len(s.events), len(want))
+	}
+	for i, w := range want {
+		e := s.events[i]
+		if math.Abs(e.time-w.time) > 1e-9 || e.status != w.status || e.data1 != w.data1 {
+			t.Errorf("event %d = {%v %#x %d}, want {%v %#x %d}", i, e.time, e.status, e.data1, w.time, w.status, w.data1)
+		}
+	}
+	if math.Abs(s.duration-0.75) > 1e-9 {
+		t.Errorf("duration = %v, want 0.75", s.duration)
+	}
+}
+
+// malformedSMFs are inputs parseSMF must reject without panicking.
+// They are also the seeds of FuzzParseSMF.
+var malformedSMFs = []string{
+	"",
+	"MThd",
+	"MThd\x00\x00\x00\x06\x00\x00\x00\x01\x00\x00",                             // no time division
+	"MThd\x00\x00\x00\x06\x00\x03\x00\x01\x00\x60",                             // format 3
+	"MThd\xff\xff\xff\xff\x00\x00\x00\x01\x00\x60",                             // header past the end
+	"MThd\x00\x00\x00\x06\x00\x00\x00\x01\x00\x60MTrk\x00\x00\x00\x02\x00\x40", // data byte without status
+	"MThd\x00\x00\x00\x06\x00\x00\x00\x01\x00\x60MTrk\x00\x00\x00\x03\x00\xff\x51",
+	"MThd\x00\x00\x00\x06\x00\x00\x00\x01\x00\x60MTrk\x00\x00\x00\x02\x00\x90",
+	"MThd\x00\x00\x00\x06\x00\x00\x00\x01\x00\x60MTrk\x00\x00\x00\x02\x00\xf1",
+	"MThd\x00\x00\x00\x06\x00\x00\x00\x01\x00\x60MTrk\x00\x00\x00\x04\xff\xff\xff\xff",
+}
+
+func TestParseSMFMalformed(t *testing.T) {
+	for _, data := range malformedSMFs {
+		if _, err := parseSMF([]byte(data)); err == nil {
+			t.Errorf("parseSMF(%q) succeeded", data)
+		}
+	}
+}
+
+func TestParseSMFTruncated(t *testing.T) {
+	data := testSMF()
+	for n := 0; n < len(data); n++ {
+		parseSMF(data[:n])
+	}
+}
+
+func TestSoundFileReaderMidi(t *testing.T) {
+	sf, err := LoadSoundFont(bytes.NewReader(testSoundFont()))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	r := NewSoundFileReaderMidi(sf, 22050)
+	info, err := r.Open(bytes.NewReader(testSMF()))
+	if err != nil {
+		t.Fatal(err)
+	}
+	frames := int64(math.Round(0.75*22050)) + int64(TailLength.Seconds()*22050)
+	if info.ChannelCount != 2 || info.SampleRate != 22050 || info.SampleCount != frames*2 {
+		t.Fatalf("info = %v, want %d stereo frames at 22050 Hz", info, frames)
+	}
+
+	// read it all in odd sizes
+	buf := make([]int16, 1001*2)
+	var total int64
+	var peak int16
+	for {
+		n, err := r.Read(buf)
+		total += n
+		for _, v := range buf[:n] {
+			if v > peak {
+				peak = v
+			}
+		}
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+	if total != info.SampleCount {
+		t.Errorf("read %d samples, want %d", total, info.SampleCount)
+	}
+	if peak == 0 {
+		t.Errorf("the song rendered silence")
+	}
+
+	// seeking back renders the same samples again
+	if err := r.Seek(11025 * 2); err != nil {
+		t.Fatal(err)
+	}
+	a := make([]int16, 512)
+	r.Read(a)
+	r.Seek(11025 * 2)
+	b := make([]int16, 512)
+	r.Read(b)
+	if !equalInt16(a, b) {
+		t.Errorf("the samples after two seeks to the same offset differ")
+	}
+}
+
+func equalInt16(a, b []int16) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for i := range a {
+		if a[i] != b[i] {
+			return false
+		}
+	}
+	return true
+}
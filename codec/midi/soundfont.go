@@ -0,0 +1,446 @@
+package midi
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"strings"
+)
+
+// SoundFont 2 generators.
+const (
+	genStartAddrsOffset           = 0
+	genEndAddrsOffset             = 1
+	genStartloopAddrsOffset       = 2
+	genEndloopAddrsOffset         = 3
+	genStartAddrsCoarseOffset     = 4
+	genModLfoToPitch              = 5
+	genVibLfoToPitch              = 6
+	genModEnvToPitch              = 7
+	genInitialFilterFc            = 8
+	genInitialFilterQ             = 9
+	genModLfoToFilterFc           = 10
+	genModEnvToFilterFc           = 11
+	genEndAddrsCoarseOffset       = 12
+	genModLfoToVolume             = 13
+	genChorusEffectsSend          = 15
+	genReverbEffectsSend          = 16
+	genPan                        = 17
+	genDelayModLFO                = 21
+	genFreqModLFO                 = 22
+	genDelayVibLFO                = 23
+	genFreqVibLFO                 = 24
+	genDelayModEnv                = 25
+	genAttackModEnv               = 26
+	genHoldModEnv                 = 27
+	genDecayModEnv                = 28
+	genSustainModEnv              = 29
+	genReleaseModEnv              = 30
+	genKeynumToModEnvHold         = 31
+	genKeynumToModEnvDecay        = 32
+	genDelayVolEnv                = 33
+	genAttackVolEnv               = 34
+	genHoldVolEnv                 = 35
+	genDecayVolEnv                = 36
+	genSustainVolEnv              = 37
+	genReleaseVolEnv              = 38
+	genKeynumToVolEnvHold         = 39
+	genKeynumToVolEnvDecay        = 40
+	genInstrument                 = 41
+	genKeyRange                   = 43
+	genVelRange                   = 44
+	genStartloopAddrsCoarseOffset = 45
+	genKeynum                     = 46
+	genVelocity                   = 47
+	genInitialAttenuation         = 48
+	genEndloopAddrsCoarseOffset   = 50
+	genCoarseTune                 = 51
+	genFineTune                   = 52
+	genSampleID                   = 53
+	genSampleModes                = 54
+	genScaleTuning                = 56
+	genExclusiveClass             = 57
+	genOverridingRootKey          = 58
+
+	// genPitch is not a real generator, but the destination of the
+	// pitch wheel modulator, in cents.
+	genPitch = 59
+
+	genCount = 60
+)
+
+// generators is a set of generator values.
+type generators [genCount]int16
+
+// defaultGenerators returns the generators with their default values.
+func defaultGenerators() (g generators) {
+	g[genInitialFilterFc] = 13500
+	for _, i := range []int{
+		genDelayModLFO, genDelayVibLFO,
+		genDelayModEnv, genAttackModEnv, genHoldModEnv, genDecayModEnv, genReleaseModEnv,
+		genDelayVolEnv, genAttackVolEnv, genHoldVolEnv, genDecayVolEnv, genReleaseVolEnv,
+	} {
+		g[i] = -12000
+	}
+	g[genKeyRange] = 127 << 8
+	g[genVelRange] = 127 << 8
+	g[genKeynum] = -1
+	g[genVelocity] = -1
+	g[genScaleTuning] = 100
+	g[genOverridingRootKey] = -1
+	return
+}
+
+// Sample types in the sample headers.
+const (
+	sampleROM = 0x8000
+)
+
+type sampleHeader struct {
+	name               string
+	start, end         int
+	loopStart, loopEnd int
+	sampleRate         int
+	originalPitch      int
+	pitchCorrection    int
+	sampleType         int
+}
+
+// zone is a preset or instrument zone.
+type zone struct {
+	gens  generators
+	set   [genCount]bool // generators set in the zone
+	mods  []modulator
+	keyLo int
+	keyHi int
+	velLo int
+	velHi int
+
+	linkIndex int           // index of the instrument or the sample, -1 for none
+	inst      *instrument   // for preset zones
+	sample    *sampleHeader // for instrument zones
+}
+
+// matches tells if the zone is to be played by the key and velocity.
+func (z *zone) matches(key, vel int) bool {
+	return key >= z.keyLo && key <= z.keyHi && vel >= z.velLo && vel <= z.velHi
+}
+
+type instrument struct {
+	name   string
+	global *zone
+	zones  []*zone
+}
+
+type preset struct {
+	name    string
+	program int
+	bank    int
+	global  *zone
+	zones   []*zone
+}
+
+// SoundFont is a SoundFont 2 instrument bank loaded into memory.
+//
+// A SoundFont is read-only after it is loaded, and can be shared by many
+// synthesizers and readers at the same time.
+type SoundFont struct {
+	Name string // name of the bank
+
+	data    []int16 // all the sample data
+	presets map[int]*preset
+	first   *preset // the first preset, used when nothing else matches
+}
+
+// presetKey returns the key of the preset in SoundFont.presets.
+func presetKey(bank, program int) int {
+	return bank<<7 | program
+}
+
+// chunk is a RIFF chunk.
+type chunk struct {
+	id   string
+	data []byte
+}
+
+// readChunks splits the data into RIFF chunks.
+func readChunks(data []byte) (chunks []chunk) {
+	for len(data) >= 8 {
+		id := string(data[:4])
+		size := int(binary.LittleEndian.Uint32(data[4:]))
+		data = data[8:]
+		if size > len(data) || size < 0 {
+			size = len(data)
+		}
+		chunks = append(chunks, chunk{id: id, data: data[:size]})
+		data = data[size:]
+		if size%2 == 1 && len(data) > 0 {
+			// padding byte
+			data = data[1:]
+		}
+	}
+	return
+}
+
+// findList returns the contents of the LIST chunk of the given type.
+func findList(chunks []chunk, typ string) []chunk {
+	for _, c := range chunks {
+		if c.id == "LIST" && len(c.data) >= 4 && string(c.data[:4]) == typ {
+			return readChunks(c.data[4:])
+		}
+	}
+	return nil
+}
+
+// findChunk returns the data of the chunk with the id.
+func findChunk(chunks []chunk, id string) []byte {
+	for _, c := range chunks {
+		if c.id == id {
+			return c.data
+		}
+	}
+	return nil
+}
+
+// cstr returns the null-terminated string of the fixed-size field.
+func cstr(b []byte) string {
+	if i := strings.IndexByte(string(b), 0); i != -1 {
+		b = b[:i]
+	}
+	return strings.TrimRight(string(b), " ")
+}
+
+// bag is a zone index record of pbag or ibag.
+type bag struct {
+	gen, mod int
+}
+
+func readBags(b []byte) []bag {
+	bags := make([]bag, len(b)/4)
+	for i := range bags {
+		bags[i].gen = int(binary.LittleEndian.Uint16(b[i*4:]))
+		bags[i].mod = int(binary.LittleEndian.Uint16(b[i*4+2:]))
+	}
+	return bags
+}
+
+type genRecord struct {
+	oper   int
+	amount int16
+}
+
+func readGens(b []byte) []genRecord {
+	gens := make([]genRecord, len(b)/4)
+	for i := range gens {
+		gens[i].oper = int(binary.LittleEndian.Uint16(b[i*4:]))
+		gens[i].amount = int16(binary.LittleEndian.Uint16(b[i*4+2:]))
+	}
+	return gens
+}
+
+func readMods(b []byte) []modulator {
+	mods := make([]modulator, len(b)/10)
+	for i := range mods {
+		r := b[i*10:]
+		mods[i] = modulator{
+			src:    binary.LittleEndian.Uint16(r[0:]),
+			dst:    binary.LittleEndian.Uint16(r[2:]),
+			amount: int16(binary.LittleEndian.Uint16(r[4:])),
+			amtSrc: binary.LittleEndian.Uint16(r[6:]),
+			trans:  binary.LittleEndian.Uint16(r[8:]),
+		}
+	}
+	return mods
+}
+
+// readZones builds the zones from the bag range [first, last).
+//
+// link is the generator that links the zone to the lower level (genInstrument or genSampleID);
+// a first zone without it is the global zone.
+func readZones(bags []bag, gens []genRecord, mods []modulator, first, last int, link int) (global *zone, zones []*zone, err error) {
+	if first < 0 || last >= len(bags) || first > last {
+		return nil, nil, errors.New("midi: invalid zone index in SoundFont")
+	}
+
+	for i := first; i < last; i++ {
+		g0, g1 := bags[i].gen, bags[i+1].gen
+		m0, m1 := bags[i].mod, bags[i+1].mod
+		if g0 > g1 || g1 > len(gens) || m0 > m1 || m1 > len(mods) {
+			return nil, nil, errors.New("midi: invalid generator index in SoundFont")
+		}
+
+		z := &zone{keyHi: 127, velHi: 127, linkIndex: -1}
+		for _, g := range gens[g0:g1] {
+			if g.oper >= genCount || g.oper == genPitch {
+				continue
+			}
+			switch g.oper {
+			case genKeyRange:
+				z.keyLo, z.keyHi = int(uint16(g.amount)&0xFF), int(uint16(g.amount)>>8)
+			case genVelRange:
+				z.velLo, z.velHi = int(uint16(g.amount)&0xFF), int(uint16(g.amount)>>8)
+			case link:
+				z.linkIndex = int(uint16(g.amount))
+			}
+			z.gens[g.oper] = g.amount
+			z.set[g.oper] = true
+		}
+		z.mods = append(z.mods, mods[m0:m1]...)
+
+		if z.linkIndex == -1 {
+			if i == first && global == nil {
+				global = z
+			}
+			// zones without a link other than the first are ignored
+			continue
+		}
+		zones = append(zones, z)
+	}
+	return
+}
+
+// LoadSoundFont loads a SoundFont 2 (.sf2) file.
+func LoadSoundFont(file io.Reader) (*SoundFont, error) {
+	data, err := io.ReadAll(file)
+	if err != nil {
+		return nil, err
+	}
+
+	if len(data) < 12 || string(data[:4]) != "RIFF" || string(data[8:12]) != "sfbk" {
+		return nil, errors.New("midi: not a SoundFont 2 file")
+	}
+	size := int64(binary.LittleEndian.Uint32(data[4:]))
+	if size < 4 {
+		return nil, errors.New("midi: SoundFont RIFF chunk too small")
+	}
+	if size+8 < int64(len(data)) {
+		data = data[:size+8]
+	}
+	top := readChunks(data[12:])
+
+	sf := &SoundFont{presets: make(map[int]*preset)}
+
+	if info := findList(top, "INFO"); info != nil {
+		sf.Name = cstr(findChunk(info, "INAM"))
+	}
+
+	sdta := findList(top, "sdta")
+	smpl := findChunk(sdta, "smpl")
+	sf.data = make([]int16, len(smpl)/2)
+	for i := range sf.data {
+		sf.data[i] = int16(binary.LittleEndian.Uint16(smpl[i*2:]))
+	}
+
+	pdta := findList(top, "pdta")
+	if pdta == nil {
+		return nil, errors.New("midi: SoundFont has no pdta chunk")
+	}
+
+	// sample headers, the last one is the terminal record
+	shdr := findChunk(pdta, "shdr")
+	samples := make([]*sampleHeader, 0, len(shdr)/46)
+	for i := 0; i+46 <= len(shdr); i += 46 {
+		r := shdr[i:]
+		s := &sampleHeader{
+			name:            cstr(r[0:20]),
+			start:           int(binary.LittleEndian.Uint32(r[20:])),
+			end:             int(binary.LittleEndian.Uint32(r[24:])),
+			loopStart:       int(binary.LittleEndian.Uint32(r[28:])),
+			loopEnd:         int(binary.LittleEndian.Uint32(r[32:])),
+			sampleRate:      int(binary.LittleEndian.Uint32(r[36:])),
+			originalPitch:   int(r[40]),
+			pitchCorrection: int(int8(r[41])),
+			sampleType:      int(binary.LittleEndian.Uint16(r[44:])),
+		}
+		if s.originalPitch > 127 {
+			s.originalPitch = 60
+		}
+		if s.sampleRate <= 0 {
+			s.sampleRate = 44100
+		}
+		samples = append(samples, s)
+	}
+
+	// instruments, the last one is the terminal record
+	ibags := readBags(findChunk(pdta, "ibag"))
+	igens := readGens(findChunk(pdta, "igen"))
+	imods := readMods(findChunk(pdta, "imod"))
+	instData := findChunk(pdta, "inst")
+	instruments := make([]*instrument, 0, len(instData)/22)
+	for i := 0; i+44 <= len(instData); i += 22 {
+		inst := &instrument{name: cstr(instData[i : i+20])}
+		first := int(binary.LittleEndian.Uint16(instData[i+20:]))
+		last := int(binary.LittleEndian.Uint16(instData[i+42:]))
+
+		inst.global, inst.zones, err = readZones(ibags, igens, imods, first, last, genSampleID)
+		if err != nil {
+			return nil, err
+		}
+		for _, z := range inst.zones {
+			if z.linkIndex >= len(samples)-1 {
+				return nil, fmt.Errorf("midi: instrument %q refers to a invalid sample", inst.name)
+			}
+			z.sample = samples[z.linkIndex]
+		}
+		instruments = append(instruments, inst)
+	}
+
+	// presets, the last one is the terminal record
+	pbags := readBags(findChunk(pdta, "pbag"))
+	pgens := readGens(findChunk(pdta, "pgen"))
+	pmods := readMods(findChunk(pdta, "pmod"))
+	phdr := findChunk(pdta, "phdr")
+	for i := 0; i+76 <= len(phdr); i += 38 {
+		p := &preset{
+			name:    cstr(phdr[i : i+20]),
+			program: int(binary.LittleEndian.Uint16(phdr[i+20:])),
+			bank:    int(binary.LittleEndian.Uint16(phdr[i+22:])),
+		}
+		first := int(binary.LittleEndian.Uint16(phdr[i+24:]))
+		last := int(binary.LittleEndian.Uint16(phdr[i+62:]))
+
+		p.global, p.zones, err = readZones(pbags, pgens, pmods, first, last, genInstrument)
+		if err != nil {
+			return nil, err
+		}
+		for _, z := range p.zones {
+			if z.linkIndex >= len(instruments) {
+				return nil, fmt.Errorf("midi: preset %q refers to a invalid instrument", p.name)
+			}
+			z.inst = instruments[z.linkIndex]
+		}
+
+		if p.program > 127 || p.bank > 128 {
+			continue
+		}
+		key := presetKey(p.bank, p.program)
+		if _, ok := sf.presets[key]; !ok {
+			sf.presets[key] = p
+		}
+		if sf.first == nil {
+			sf.first = p
+		}
+	}
+
+	if sf.first == nil {
+		return nil, errors.New("midi: SoundFont has no presets")
+	}
+	return sf, nil
+}
+
+// findPreset returns the preset for the bank and program, falling back
+// to bank 0 (or program 0 of the percussion bank 128), and then to the first preset.
+func (sf *SoundFont) findPreset(bank, program int) *preset {
+	if p, ok := sf.presets[presetKey(bank, program)]; ok {
+		return p
+	}
+	if bank == percussionBank {
+		if p, ok := sf.presets[presetKey(percussionBank, 0)]; ok {
+			return p
+		}
+	} else if p, ok := sf.presets[presetKey(0, program)]; ok {
+		return p
+	}
+	return sf.first
+}
@@ -0,0 +1,183 @@
+package midi
+
+import (
+	"bytes"
+	"encoding/binary"
+	"math"
+	"testing"
+)
+
+// riffChunk returns the RIFF chunk of the id, padded to an even size.
+func riffChunk(id string, data ...[]byte) []byte {
+	body := bytes.Join(data, nil)
+	b := make([]byte, 8, 8+len(body)+1)
+	copy(b, id)
+	binary.LittleEndian.PutUint32(b[4:], uint32(len(body)))
+	b = append(b, body...)
+	if len(body)%2 == 1 {
+		b = append(b, 0)
+	}
+	return b
+}
+
+// record packs the values little-endian: strings are padded to fixed-size
+// fields given by the int after them, and other values are written by their size.
+func record(fields ...interface{}) []byte {
+	var buf bytes.Buffer
+	for i := 0; i < len(fields); i++ {
+		if s, ok := fields[i].(string); ok {
+			b := make([]byte, fields[i+1].(int))
+			copy(b, s)
+			buf.Write(b)
+			i++
+			continue
+		}
+		binary.Write(&buf, binary.LittleEndian, fields[i])
+	}
+	return buf.Bytes()
+}
+
+// testSoundFont returns a SoundFont 2 file with a preset, on bank 0 and program 0,
+// of an instrument playing a looped sine wave sample.
+func testSoundFont() []byte {
+	const length = 200
+	smpl := make([]byte, (length+46)*2)
+	for i := 0; i < length; i++ {
+		v := int16(16000 * math.Sin(2*math.Pi*float64(i)/50))
+		binary.LittleEndian.PutUint16(smpl[i*2:], uint16(v))
+	}
+
+	shdr := bytes.Join([][]byte{
+		record("sine", 20, uint32(0), uint32(length), uint32(50), uint32(150), uint32(44100), uint8(60), int8(0), uint16(0), uint16(1)),
+		record("EOS", 20, uint32(0), uint32(0), uint32(0), uint32(0), uint32(0), uint8(0), int8(0), uint16(0), uint16(0)),
+	}, nil)
+
+	return riffChunk("RIFF", []byte("sfbk"),
+		riffChunk("LIST", []byte("INFO"), riffChunk("INAM", []byte("Test\x00"))),
+		riffChunk("LIST", []byte("sdta"), riffChunk("smpl", smpl)),
+		riffChunk("LIST", []byte("pdta"),
+			riffChunk("phdr",
+				record("Sine", 20, uint16(0), uint16(0), uint16(0), uint32(0), uint32(0), uint32(0)),
+				record("EOP", 20, uint16(0), uint16(0), uint16(1), uint32(0), uint32(0), uint32(0)),
+			),
+			riffChunk("pbag", record(uint16(0), uint16(0), uint16(1), uint16(0))),
+			riffChunk("pmod", make([]byte, 10)),
+			riffChunk("pgen", record(uint16(genInstrument), uint16(0), uint16(0), uint16(0))),
+			riffChunk("inst",
+				record("Sine", 20, uint16(0)),
+				record("EOI", 20, uint16(1)),
+			),
+			riffChunk("ibag", record(uint16(0), uint16(0), uint16(2), uint16(0))),
+			riffChunk("imod", make([]byte, 10)),
+			riffChunk("igen", record(
+				uint16(genSampleModes), uint16(1),
+				uint16(genSampleID), uint16(0),
+				uint16(0), uint16(0),
+			)),
+			riffChunk("shdr", shdr),
+		),
+	)
+}
+
+func TestLoadSoundFont(t *testing.T) {
+	sf, err := LoadSoundFont(bytes.NewReader(testSoundFont()))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if sf.Name != "Test" {
+		t.Errorf("Name = %q, want %q", sf.Name, "Test")
+	}
+
+	p := sf.findPreset(0, 0)
+	if p == nil || p.name != "Sine" {
+		t.Fatalf("findPreset(0, 0) = %v, want the preset Sine", p)
+	}
+	if len(p.zones) != 1 || p.zones[0].inst == nil || len(p.zones[0].inst.zones) != 1 {
+		t.Fatalf("preset zones not linked to the instrument")
+	}
+	s := p.zones[0].inst.zones[0].sample
+	if s.start != 0 || s.end != 200 || s.loopStart != 50 || s.loopEnd != 150 {
+		t.Errorf("sample = %+v, want 0-200 looped at 50-150", s)
+	}
+
+	// an unknown program falls back to the first preset
+	if sf.findPreset(0, 42) != p {
+		t.Errorf("findPreset(0, 42) did not fall back to the first preset")
+	}
+}
+
+func TestSynthesizerRender(t *testing.T) {
+	sf, err := LoadSoundFont(bytes.NewReader(testSoundFont()))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	s := NewSynthesizer(sf, 44100)
+	s.NoteOn(0, 60, 100)
+	if s.ActiveVoices() != 1 {
+		t.Fatalf("ActiveVoices = %d, want 1", s.ActiveVoices())
+	}
+
+	out := make([]float32, 2*4410)
+	s.Render(out)
+	var peak float64
+	for _, v := range out {
+		peak = math.Max(peak, math.Abs(float64(v)))
+	}
+	if peak == 0 {
+		t.Errorf("the note rendered silence")
+	}
+
+	s.NoteOff(0, 60)
+	for i := 0; i < 100 && s.ActiveVoices() > 0; i++ {
+		s.Render(out)
+	}
+	if s.ActiveVoices() != 0 {
+		t.Errorf("the note did not end after release")
+	}
+}
+
+// malformedSoundFonts are inputs LoadSoundFont must reject without panicking.
+// They are also the seeds of FuzzLoadSoundFont.
+var malformedSoundFonts = []string{
+	"",
+	"RIFF",
+	"RIFF\x00\x00\x00\x00sfbk",
+	"RIFF\x03\x00\x00\x00sfbk",
+	"RIFF\xff\xff\xff\xffsfbk",
+	"RIFF\x04\x00\x00\x00sfbkLIST",
+	"RIFF\x10\x00\x00\x00sfbkLIST\xff\xff\xff\xffpdta",
+	"RIFX\x04\x00\x00\x00sfbk",
+}
+
+func TestLoadSoundFontMalformed(t *testing.T) {
+	for _, data := range malformedSoundFonts {
+		if _, err := LoadSoundFont(bytes.NewReader([]byte(data))); err == nil {
+			t.Errorf("LoadSoundFont(%q) succeeded", data)
+		}
+	}
+}
+
+func TestLoadSoundFontTruncated(t *testing.T) {
+	data := testSoundFont()
+	for n := 0; n < len(data); n++ {
+		sf, err := LoadSoundFont(bytes.NewReader(data[:n]))
+		if err == nil {
+			playSoundFont(sf)
+		}
+	}
+}
+
+// playSoundFont plays a few notes on the SoundFont, to check the samples
+// loaded from a corrupted file do not crash the synthesizer.
+func playSoundFont(sf *SoundFont) {
+	s := NewSynthesizer(sf, 22050)
+	out := make([]float32, 2*512)
+	for _, key := range []int{0, 60, 127} {
+		s.NoteOn(0, key, 127)
+		s.NoteOn(9, key, 127)
+		s.Render(out)
+	}
+	s.AllNotesOff()
+	s.Render(out)
+}
@@ -0,0 +1,411 @@
+package midi
+
+const (
+	percussionChannel = 9   // MIDI channel 10 plays percussion
+	percussionBank    = 128 // bank of the percussion presets in SoundFont
+	maxVoices         = 256 // maximum number of voices playing at the same time
+
+	masterGain = 0.7 // gain applied to the mixed voices
+)
+
+// MIDI controllers handled by the synthesizer.
+const (
+	ccBankSelect        = 0
+	ccDataEntry         = 6
+	ccVolume            = 7
+	ccPan               = 10
+	ccExpression        = 11
+	ccDataEntryLSB      = 38
+	ccSustain           = 64
+	ccNRPNLSB           = 98
+	ccNRPNMSB           = 99
+	ccRPNLSB            = 100
+	ccRPNMSB            = 101
+	ccAllSoundOff       = 120
+	ccResetControllers  = 121
+	ccAllNotesOff       = 123
+	rpnPitchBendRange   = 0
+	rpnNone             = 0x3FFF
+	defaultBendRange    = 2 // semitones
+	defaultPitchBend    = 8192
+	defaultChannelCount = 16
+)
+
+// channel is the state of a MIDI channel.
+type channel struct {
+	program     int
+	bank        int
+	cc          [128]uint8
+	pitchBend   int     // 0 ~ 16383, 8192 in the center
+	bendRange   float64 // pitch bend sensitivity in semitones
+	pressure    int
+	keyPressure [128]uint8
+	rpn         int // selected registered parameter, rpnNone for none
+}
+
+// resetControllers resets the controllers to their defaults.
+func (c *channel) resetControllers() {
+	c.cc = [128]uint8{}
+	c.cc[ccVolume] = 100
+	c.cc[ccPan] = 64
+	c.cc[ccExpression] = 127
+	c.pitchBend = defaultPitchBend
+	c.pressure = 0
+	c.keyPressure = [128]uint8{}
+	c.rpn = rpnNone
+}
+
+// Synthesizer is a SoundFont 2 wavetable synthesizer with 16 MIDI channels.
+//
+// A Synthesizer is not safe for concurrent use.
+type Synthesizer struct {
+	sf   *SoundFont
+	rate float64
+
+	channels [defaultChannelCount]channel
+	voices   []*voice
+	nextID   uint64
+
+	block []float32
+}
+
+// NewSynthesizer creates a synthesizer playing the SoundFont, rendering at the sample rate.
+func NewSynthesizer(sf *SoundFont, sampleRate int) *Synthesizer {
+	s := &Synthesizer{
+		sf:    sf,
+		rate:  float64(sampleRate),
+		block: make([]float32, blockSize*2),
+	}
+	s.Reset()
+	return s
+}
+
+// Reset stops all the voices, and resets the state of all channels.
+func (s *Synthesizer) Reset() {
+	s.voices = s.voices[:0]
+	for i := range s.channels {
+		c := &s.channels[i]
+		c.program = 0
+		c.bank = 0
+		c.bendRange = defaultBendRange
+		c.resetControllers()
+	}
+}
+
+// ActiveVoices returns the number of voices playing.
+func (s *Synthesizer) ActiveVoices() int {
+	return len(s.voices)
+}
+
+// Message handles a MIDI channel message. System messages are ignored.
+func (s *Synthesizer) Message(status, data1, data2 uint8) {
+	ch := int(status & 0x0F)
+	switch status & 0xF0 {
+	case msgNoteOff:
+		s.NoteOff(ch, int(data1))
+	case msgNoteOn:
+		s.NoteOn(ch, int(data1), int(data2))
+	case msgKeyPressure:
+		s.channels[ch].keyPressure[data1&0x7F] = data2 & 0x7F
+		s.updateChannel(ch)
+	case msgControlChange:
+		s.ControlChange(ch, int(data1), int(data2))
+	case msgProgramChange:
+		s.ProgramChange(ch, int(data1))
+	case msgChannelPressure:
+		s.ChannelPressure(ch, int(data1))
+	case msgPitchBend:
+		s.PitchBend(ch, int(data1)|int(data2)<<7)
+	}
+}
+
+// NoteOn starts a note on the channel (0 ~ 15). A velocity of 0 stops the note.
+func (s *Synthesizer) NoteOn(ch, key, velocity int) {
+	if ch < 0 || ch >= defaultChannelCount || key < 0 || key > 127 {
+		return
+	}
+	if velocity <= 0 {
+		s.NoteOff(ch, key)
+		return
+	}
+	if velocity > 127 {
+		velocity = 127
+	}
+
+	c := &s.channels[ch]
+	bank := c.bank
+	if ch == percussionChannel {
+		bank = percussionBank
+	}
+	p := s.sf.findPreset(bank, c.program)
+
+	s.nextID++
+	id := s.nextID
+
+	for _, pz := range p.zones {
+		if !pz.matches(key, velocity) || (p.global != nil && !p.global.matches(key, velocity)) {
+			continue
+		}
+		inst := pz.inst
+		for _, iz := range inst.zones {
+			if !iz.matches(key, velocity) || (inst.global != nil && !inst.global.matches(key, velocity)) {
+				continue
+			}
+			if iz.sample.sampleType&sampleROM != 0 {
+				continue
+			}
+			s.startVoice(ch, key, velocity, id, p, pz, inst, iz)
+		}
+	}
+}
+
+// presetAdditive tells if the generator can be set at the preset level, where it is added to the instrument.
+func presetAdditive(gen int) bool {
+	switch gen {
+	case genStartAddrsOffset, genEndAddrsOffset, genStartloopAddrsOffset, genEndloopAddrsOffset,
+		genStartAddrsCoarseOffset, genEndAddrsCoarseOffset, genStartloopAddrsCoarseOffset, genEndloopAddrsCoarseOffset,
+		genInstrument, genKeyRange, genVelRange, genKeynum, genVelocity, genSampleID, genSampleModes,
+		genExclusiveClass, genOverridingRootKey:
+		return false
+	}
+	return true
+}
+
+func (s *Synthesizer) startVoice(ch, key, vel int, id uint64, p *preset, pz *zone, inst *instrument, iz *zone) {
+	v := &voice{
+		ch:      &s.channels[ch],
+		chIndex: ch,
+		key:     key,
+		vel:     vel,
+		id:      id,
+	}
+
+	// instrument generators override the defaults, local zones override the global zone
+	gens := defaultGenerators()
+	instMods := defaultModulators
+	for _, z := range []*zone{inst.global, iz} {
+		if z == nil {
+			continue
+		}
+		for i := range gens {
+			if z.set[i] {
+				gens[i] = z.gens[i]
+			}
+		}
+		instMods = mergeModulators(instMods, z.mods)
+	}
+
+	// preset generators are added to them
+	var add generators
+	var presetMods []modulator
+	for _, z := range []*zone{p.global, pz} {
+		if z == nil {
+			continue
+		}
+		for i := range add {
+			if z.set[i] && presetAdditive(i) {
+				add[i] = z.gens[i]
+			}
+		}
+		presetMods = mergeModulators(presetMods, z.mods)
+	}
+
+	for i := range v.base {
+		v.base[i] = float64(gens[i]) + float64(add[i])
+	}
+	v.mods = append(instMods, presetMods...)
+	if gens[genVelocity] >= 0 {
+		v.vel = int(gens[genVelocity])
+	}
+
+	v.updateModulators()
+	v.start(iz.sample, s.sf.data, s.rate)
+	if !v.active {
+		return
+	}
+
+	// exclusive class stops the other voices of the class on the channel
+	if v.exclusiveClass != 0 {
+		for _, o := range s.voices {
+			if o.chIndex == ch && o.exclusiveClass == v.exclusiveClass && o.id != id {
+				o.kill()
+			}
+		}
+	}
+
+	if len(s.voices) >= maxVoices {
+		s.stealVoice()
+	}
+	s.voices = append(s.voices, v)
+}
+
+// stealVoice removes a voice to make room for a new one,
+// the quietest released one if any, or the oldest one.
+func (s *Synthesizer) stealVoice() {
+	victim := 0
+	for i, v := range s.voices {
+		w := s.voices[victim]
+		switch {
+		case v.released && !w.released:
+			victim = i
+		case v.released == w.released && v.released && v.volEnv.level < w.volEnv.level:
+			victim = i
+		case v.released == w.released && !v.released && v.id < w.id:
+			victim = i
+		}
+	}
+	copy(s.voices[victim:], s.voices[victim+1:])
+	s.voices[len(s.voices)-1] = nil
+	s.voices = s.voices[:len(s.voices)-1]
+}
+
+// NoteOff releases the note on the channel.
+func (s *Synthesizer) NoteOff(ch, key int) {
+	if ch < 0 || ch >= defaultChannelCount {
+		return
+	}
+	sustain := s.channels[ch].cc[ccSustain] >= 64
+	for _, v := range s.voices {
+		if v.chIndex != ch || v.key != key || v.released || v.sustained {
+			continue
+		}
+		if sustain {
+			v.sustained = true
+		} else {
+			v.release()
+		}
+	}
+}
+
+// ControlChange changes the value of the controller on the channel.
+func (s *Synthesizer) ControlChange(ch, controller, value int) {
+	if ch < 0 || ch >= defaultChannelCount || controller < 0 || controller > 127 {
+		return
+	}
+	c := &s.channels[ch]
+	value &= 0x7F
+	c.cc[controller] = uint8(value)
+
+	switch controller {
+	case ccBankSelect:
+		c.bank = value
+	case ccSustain:
+		if value < 64 {
+			for _, v := range s.voices {
+				if v.chIndex == ch && v.sustained {
+					v.release()
+				}
+			}
+		}
+	case ccRPNLSB, ccRPNMSB:
+		c.rpn = int(c.cc[ccRPNMSB])<<7 | int(c.cc[ccRPNLSB])
+	case ccNRPNLSB, ccNRPNMSB:
+		c.rpn = rpnNone
+	case ccDataEntry, ccDataEntryLSB:
+		if c.rpn == rpnPitchBendRange {
+			c.bendRange = float64(c.cc[ccDataEntry]) + float64(c.cc[ccDataEntryLSB])/100
+		}
+	case ccAllSoundOff:
+		n := 0
+		for _, v := range s.voices {
+			if v.chIndex != ch {
+				s.voices[n] = v
+				n++
+			}
+		}
+		s.voices = s.voices[:n]
+	case ccResetControllers:
+		c.resetControllers()
+	case ccAllNotesOff:
+		for _, v := range s.voices {
+			if v.chIndex == ch {
+				v.release()
+			}
+		}
+	}
+
+	s.updateChannel(ch)
+}
+
+// ProgramChange changes the program (instrument) of the channel.
+func (s *Synthesizer) ProgramChange(ch, program int) {
+	if ch < 0 || ch >= defaultChannelCount {
+		return
+	}
+	s.channels[ch].program = program & 0x7F
+}
+
+// ChannelPressure sets the aftertouch of the channel.
+func (s *Synthesizer) ChannelPressure(ch, value int) {
+	if ch < 0 || ch >= defaultChannelCount {
+		return
+	}
+	s.channels[ch].pressure = value & 0x7F
+	s.updateChannel(ch)
+}
+
+// PitchBend sets the pitch wheel of the channel, 0 ~ 16383 with 8192 in the center.
+func (s *Synthesizer) PitchBend(ch, value int) {
+	if ch < 0 || ch >= defaultChannelCount {
+		return
+	}
+	if value < 0 {
+		value = 0
+	} else if value > 16383 {
+		value = 16383
+	}
+	s.channels[ch].pitchBend = value
+	s.updateChannel(ch)
+}
+
+// AllNotesOff releases all the notes on all channels.
+func (s *Synthesizer) AllNotesOff() {
+	for _, v := range s.voices {
+		v.release()
+	}
+}
+
+// updateChannel recomputes the modulators of the voices on the channel.
+func (s *Synthesizer) updateChannel(ch int) {
+	for _, v := range s.voices {
+		if v.chIndex == ch {
+			v.updateModulators()
+		}
+	}
+}
+
+// Render renders interleaved stereo frames into out, replacing its contents.
+func (s *Synthesizer) Render(out []float32) {
+	for i := range out {
+		out[i] = 0
+	}
+
+	for len(out) >= 2 {
+		n := len(out) / 2
+		if n > blockSize {
+			n = blockSize
+		}
+		block := s.block[:n*2]
+		for i := range block {
+			block[i] = 0
+		}
+
+		alive := 0
+		for _, v := range s.voices {
+			v.render(block, s.rate)
+			if v.active {
+				s.voices[alive] = v
+				alive++
+			}
+		}
+		for i := alive; i < len(s.voices); i++ {
+			s.voices[i] = nil
+		}
+		s.voices = s.voices[:alive]
+
+		for i, x := range block {
+			out[i] = x * masterGain
+		}
+		out = out[n*2:]
+	}
+}
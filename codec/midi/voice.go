@@ -0,0 +1,392 @@
+package midi
+
+import "math"
+
+const (
+	blockSize  = 64   // frames rendered between updates of the envelopes, the LFOs and the modulators
+	silenceCB  = 960  // attenuation in centibels at which a voice is considered silent
+	minCutoff  = 20.0 // range of the low-pass filter cutoff, in Hz
+	lfoBaseHz  = 8.176
+	filterBase = 8.176 // frequency of absolute cents 0
+)
+
+// timecents converts timecents into seconds, 0 for the minimum value.
+func timecents(tc float64) float64 {
+	if tc <= -12000 {
+		return 0
+	}
+	return math.Exp2(tc / 1200)
+}
+
+// Envelope stages.
+const (
+	stageDelay = iota
+	stageAttack
+	stageHold
+	stageDecay
+	stageSustain
+	stageRelease
+	stageDone
+)
+
+// envelope is a DAHDSR envelope of SoundFont.
+//
+// The level goes from 0 to 1. For the volume envelope, the level is linear in
+// decibels after the attack, 0 being -100 dB, and linear in amplitude in the attack.
+type envelope struct {
+	delay, attack, hold, decay, release float64 // in seconds
+	sustain                             float64 // sustain level, 0 ~ 1
+
+	stage int
+	time  float64 // time spent in the stage
+	level float64
+}
+
+// setup sets the envelope up from the generators, starting at the delay generator,
+// for the key of the note.
+//
+// The sustain of the volume envelope is an attenuation in centibels, with 1000 cB
+// being level 0; the sustain of the modulation envelope is in 0.1%, the same scale.
+func (e *envelope) setup(g *[genCount]float64, delay, keyToHold, keyToDecay int, key int) {
+	e.delay = timecents(g[delay])
+	e.attack = timecents(g[delay+1])
+	e.hold = timecents(g[delay+2] + g[keyToHold]*float64(60-key))
+	e.decay = timecents(g[delay+3] + g[keyToDecay]*float64(60-key))
+	e.sustain = 1 - math.Max(0, math.Min(1000, g[delay+4]))/1000
+	e.release = timecents(g[delay+5])
+}
+
+// next advances the envelope by dt seconds.
+func (e *envelope) next(dt float64) {
+	e.time += dt
+	for {
+		switch e.stage {
+		case stageDelay:
+			if e.time < e.delay {
+				e.level = 0
+				return
+			}
+			e.time -= e.delay
+			e.stage = stageAttack
+		case stageAttack:
+			if e.time < e.attack {
+				e.level = e.time / e.attack
+				return
+			}
+			e.time -= e.attack
+			e.stage = stageHold
+		case stageHold:
+			e.level = 1
+			if e.time < e.hold {
+				return
+			}
+			e.time -= e.hold
+			e.stage = stageDecay
+		case stageDecay:
+			// the decay time is the time to go from the full level to 0
+			e.level = 1 - e.time/math.Max(e.decay, 1e-6)
+			if e.level > e.sustain {
+				return
+			}
+			e.level = e.sustain
+			e.stage = stageSustain
+		case stageSustain:
+			e.level = e.sustain
+			return
+		case stageRelease:
+			e.level -= dt / math.Max(e.release, 1e-6)
+			if e.level <= 0 {
+				e.level = 0
+				e.stage = stageDone
+			}
+			return
+		case stageDone:
+			e.level = 0
+			return
+		}
+	}
+}
+
+// startRelease moves the envelope into the release stage.
+//
+// dB tells if the level is to be converted from amplitude, in the attack of a volume envelope.
+func (e *envelope) startRelease(dB bool) {
+	if e.stage >= stageRelease {
+		return
+	}
+	switch {
+	case e.stage == stageDelay:
+		e.level = 0
+	case e.stage == stageAttack && dB:
+		if e.level > 0 {
+			e.level = math.Max(0, 1+20*math.Log10(e.level)/100)
+		}
+	}
+	e.stage = stageRelease
+	e.time = 0
+}
+
+// volumeGain returns the gain of a volume envelope.
+func (e *envelope) volumeGain() float64 {
+	if e.stage == stageAttack {
+		return e.level
+	}
+	if e.level <= 0 {
+		return 0
+	}
+	return math.Pow(10, (e.level-1)*100/20)
+}
+
+// lfo is a triangle low frequency oscillator.
+type lfo struct {
+	delay float64 // in seconds
+	freq  float64 // in Hz
+	time  float64
+	value float64 // -1 ~ 1
+}
+
+func (l *lfo) setup(delayTc, freqCents float64) {
+	l.delay = timecents(delayTc)
+	l.freq = lfoBaseHz * math.Exp2(freqCents/1200)
+}
+
+func (l *lfo) next(dt float64) {
+	l.time += dt
+	if l.time < l.delay {
+		l.value = 0
+		return
+	}
+	phase := math.Mod((l.time-l.delay)*l.freq, 1)
+	switch {
+	case phase < 0.25:
+		l.value = phase * 4
+	case phase < 0.75:
+		l.value = 2 - phase*4
+	default:
+		l.value = phase*4 - 4
+	}
+}
+
+// filter is a resonant 2-pole low-pass filter.
+type filter struct {
+	enabled        bool
+	cutoff, q      float64 // the coefficients are computed for these
+	b0, b1, b2     float64
+	a1, a2         float64
+	x1, x2, y1, y2 float64
+}
+
+// set computes the coefficients for the cutoff (in Hz) and the resonance (in dB).
+func (f *filter) set(cutoff, qdB, rate float64) {
+	cutoff = math.Max(minCutoff, math.Min(cutoff, rate*0.45))
+	if cutoff >= rate*0.45 && qdB <= 0 {
+		f.enabled = false
+		return
+	}
+	if f.enabled && cutoff == f.cutoff && qdB == f.q {
+		return
+	}
+	if !f.enabled {
+		f.x1, f.x2, f.y1, f.y2 = 0, 0, 0, 0
+	}
+	f.enabled = true
+	f.cutoff, f.q = cutoff, qdB
+
+	q := math.Sqrt2 / 2 * math.Pow(10, qdB/20)
+	w := 2 * math.Pi * cutoff / rate
+	alpha := math.Sin(w) / (2 * q)
+	cos := math.Cos(w)
+	a0 := 1 + alpha
+	f.b0 = (1 - cos) / 2 / a0
+	f.b1 = (1 - cos) / a0
+	f.b2 = f.b0
+	f.a1 = -2 * cos / a0
+	f.a2 = (1 - alpha) / a0
+}
+
+func (f *filter) process(x float64) float64 {
+	y := f.b0*x + f.b1*f.x1 + f.b2*f.x2 - f.a1*f.y1 - f.a2*f.y2
+	f.x2, f.x1 = f.x1, x
+	f.y2, f.y1 = f.y1, y
+	return y
+}
+
+// Sample modes.
+const (
+	modeNoLoop           = 0
+	modeLoop             = 1
+	modeLoopUntilRelease = 3
+)
+
+// voice is a sample playing on the synthesizer.
+type voice struct {
+	ch      *channel
+	chIndex int
+	key     int // the key of the note
+	vel     int
+	id      uint64 // increasing with every note on
+
+	base [genCount]float64 // generators before the modulators
+	gen  [genCount]float64 // generators after the modulators
+	mods []modulator
+
+	data               []int16
+	end                int
+	loopStart, loopEnd int
+	mode               int
+	pos                float64
+	rootCents          float64 // pitch offset in cents, before the modulations
+	rateRatio          float64 // sample rate of the sample / output rate
+	exclusiveClass     int
+
+	volEnv, modEnv envelope
+	modLFO, vibLFO lfo
+	filter         filter
+
+	released  bool // note off received
+	sustained bool // note off received, but held by the sustain pedal
+	active    bool
+
+	gainL, gainR float64 // gains at the end of the last block
+}
+
+// updateModulators computes the generators after applying the modulators.
+func (v *voice) updateModulators() {
+	v.gen = v.base
+	for _, m := range v.mods {
+		if int(m.dst) < genCount {
+			v.gen[m.dst] += m.value(v.ch, v.key, v.vel)
+		}
+	}
+}
+
+// start sets up the playback from the generators, after updateModulators.
+func (v *voice) start(s *sampleHeader, data []int16, rate float64) {
+	g := &v.gen
+
+	start := s.start + int(g[genStartAddrsOffset]) + int(g[genStartAddrsCoarseOffset])*32768
+	end := s.end + int(g[genEndAddrsOffset]) + int(g[genEndAddrsCoarseOffset])*32768
+	loopStart := s.loopStart + int(g[genStartloopAddrsOffset]) + int(g[genStartloopAddrsCoarseOffset])*32768
+	loopEnd := s.loopEnd + int(g[genEndloopAddrsOffset]) + int(g[genEndloopAddrsCoarseOffset])*32768
+
+	if end > len(data) {
+		end = len(data)
+	}
+	if start < 0 {
+		start = 0
+	}
+	v.data = data
+	v.end = end
+	v.pos = float64(start)
+	v.loopStart, v.loopEnd = loopStart, loopEnd
+	v.mode = int(g[genSampleModes]) & 3
+	if v.mode == 2 || loopStart < start || loopEnd > end || loopEnd-loopStart < 2 {
+		v.mode = modeNoLoop
+	}
+	v.active = start < end
+
+	key := v.key
+	if g[genKeynum] >= 0 {
+		key = int(g[genKeynum])
+	}
+	root := s.originalPitch
+	if g[genOverridingRootKey] >= 0 {
+		root = int(g[genOverridingRootKey])
+	}
+	v.rootCents = float64(key-root)*g[genScaleTuning] + float64(s.pitchCorrection)
+	v.rateRatio = float64(s.sampleRate) / rate
+	v.exclusiveClass = int(g[genExclusiveClass])
+
+	v.volEnv.setup(g, genDelayVolEnv, genKeynumToVolEnvHold, genKeynumToVolEnvDecay, key)
+	v.modEnv.setup(g, genDelayModEnv, genKeynumToModEnvHold, genKeynumToModEnvDecay, key)
+	v.modLFO.setup(g[genDelayModLFO], g[genFreqModLFO])
+	v.vibLFO.setup(g[genDelayVibLFO], g[genFreqVibLFO])
+}
+
+// release starts the release of the envelopes.
+func (v *voice) release() {
+	v.released = true
+	v.sustained = false
+	v.volEnv.startRelease(true)
+	v.modEnv.startRelease(false)
+	if v.mode == modeLoopUntilRelease {
+		v.mode = modeNoLoop
+	}
+}
+
+// kill makes the voice fade out quickly, used for exclusive classes and voice stealing.
+func (v *voice) kill() {
+	v.release()
+	v.volEnv.release = 0.005
+}
+
+// render adds a block of frames of the voice into the stereo buffer out.
+func (v *voice) render(out []float32, rate float64) {
+	frames := len(out) / 2
+	dt := float64(frames) / rate
+	g := &v.gen
+
+	v.volEnv.next(dt)
+	v.modEnv.next(dt)
+	v.modLFO.next(dt)
+	v.vibLFO.next(dt)
+
+	if v.volEnv.stage == stageDone || (v.volEnv.stage > stageAttack && v.volEnv.level*1000 < 1000-silenceCB && (v.released || v.volEnv.stage == stageSustain)) {
+		v.active = false
+		return
+	}
+
+	// pitch
+	cents := v.rootCents + g[genCoarseTune]*100 + g[genFineTune] + g[genPitch] +
+		v.modEnv.level*g[genModEnvToPitch] + v.modLFO.value*g[genModLfoToPitch] + v.vibLFO.value*g[genVibLfoToPitch]
+	step := v.rateRatio * math.Exp2(cents/1200)
+
+	// filter
+	fc := g[genInitialFilterFc] + v.modEnv.level*g[genModEnvToFilterFc] + v.modLFO.value*g[genModLfoToFilterFc]
+	v.filter.set(filterBase*math.Exp2(fc/1200), math.Max(0, g[genInitialFilterQ]/10), rate)
+
+	// gain
+	att := math.Max(0, g[genInitialAttenuation]) + v.modLFO.value*g[genModLfoToVolume]
+	gain := math.Pow(10, -att/200) * v.volEnv.volumeGain()
+	pan := math.Max(-500, math.Min(500, g[genPan]))
+	angle := (pan + 500) / 1000 * math.Pi / 2
+	gainL, gainR := gain*math.Cos(angle), gain*math.Sin(angle)
+
+	stepL := (gainL - v.gainL) / float64(frames)
+	stepR := (gainR - v.gainR) / float64(frames)
+	curL, curR := v.gainL, v.gainR
+	v.gainL, v.gainR = gainL, gainR
+
+	data := v.data
+	loop := v.mode == modeLoop || v.mode == modeLoopUntilRelease
+	for i := 0; i < frames; i++ {
+		idx := int(v.pos)
+		if idx >= v.end {
+			v.active = false
+			return
+		}
+		frac := v.pos - float64(idx)
+		next := idx + 1
+		if loop && next >= v.loopEnd {
+			next = v.loopStart
+		} else if next >= v.end {
+			next = idx
+		}
+
+		s0, s1 := float64(data[idx]), float64(data[next])
+		x := (s0 + (s1-s0)*frac) / 32768
+		if v.filter.enabled {
+			x = v.filter.process(x)
+		}
+
+		curL += stepL
+		curR += stepR
+		out[i*2] += float32(x * curL)
+		out[i*2+1] += float32(x * curR)
+
+		v.pos += step
+		if loop && v.pos >= float64(v.loopEnd) {
+			v.pos = float64(v.loopStart) + math.Mod(v.pos-float64(v.loopStart), float64(v.loopEnd-v.loopStart))
+		}
+	}
+}
@@ -0,0 +1,7 @@
+// Package mod implements a pure Go player for tracker modules, providing the parent audio package
+// a codec for ProTracker MOD, ScreamTracker 3 S3M, FastTracker 2 XM and Impulse Tracker IT files.
+//
+// Modules are rendered into 16-bit or float stereo PCM on the fly. The song is scanned on Open for its
+// length and the position it loops back to, which is reported through audio.SoundFileLooper,
+// so a looping Music plays the module seamlessly like a tracker would.
+package mod
@@ -0,0 +1,222 @@
+package mod
+
+// Effects of all formats are converted into these on load.
+const (
+	fxNone = iota
+	fxArpeggio
+	fxPortaUp      // in S3M/IT, includes the fine (Fx) and extra fine (Ex) forms
+	fxPortaDown    // ditto
+	fxTonePorta    // tone portamento
+	fxVibrato      // vibrato
+	fxTonePortaVol // tone portamento + volume slide
+	fxVibratoVol   // vibrato + volume slide
+	fxTremolo
+	fxPanning // set panning, 0 ~ 255
+	fxOffset  // sample offset
+	fxVolSlide
+	fxJump  // position jump
+	fxBreak // pattern break, param is the row number in binary
+	fxVolume
+	fxSpeed
+	fxTempo // in IT, includes the tempo slides (T0x and T1x)
+	fxGlobalVolume
+	fxGlobalVolSlide
+	fxKeyOff
+	fxEnvPosition
+	fxPanSlide
+	fxRetrig // retrigger with volume change
+	fxTremor
+	fxFineVibrato
+	fxChannelVolume
+	fxChannelVolSlide
+	fxPanbrello
+	fxExtraFinePortaUp   // XM X1x
+	fxExtraFinePortaDown // XM X2x
+
+	// MOD/XM Exy and S3M/IT Sxy commands, split by the high nibble
+	fxFinePortaUp
+	fxFinePortaDown
+	fxVibratoWave
+	fxTremoloWave
+	fxPanbrelloWave
+	fxFinetune
+	fxPatternLoop
+	fxPanning4 // 4-bit panning, 0 ~ 15
+	fxRetrigSimple
+	fxFineVolUp
+	fxFineVolDown
+	fxNoteCut
+	fxNoteDelay
+	fxPatternDelay
+	fxFinePatternDelay // IT S6x, delays the row by x ticks
+	fxHighOffset       // IT SAx
+	fxNNA              // IT S7x
+	fxSurround
+
+	fxSpecial // S3M/IT Sxy, kept raw since S00 recalls the last parameter
+)
+
+// Volume column commands of XM and IT.
+const (
+	vcNone = iota
+	vcVolume
+	vcVolSlideUp
+	vcVolSlideDown
+	vcFineVolUp
+	vcFineVolDown
+	vcVibratoSpeed
+	vcVibratoDepth
+	vcPanning // 0 ~ 64
+	vcPanSlideLeft
+	vcPanSlideRight
+	vcTonePorta // param is the actual slide speed
+	vcPortaUp   // ditto
+	vcPortaDown // ditto
+)
+
+// convertExtended converts the MOD/XM Exy command.
+func convertExtended(param uint8) (effect, newParam uint8) {
+	x, y := param>>4, param&0x0F
+	switch x {
+	case 0x1:
+		return fxFinePortaUp, y
+	case 0x2:
+		return fxFinePortaDown, y
+	case 0x4:
+		return fxVibratoWave, y
+	case 0x5:
+		return fxFinetune, y
+	case 0x6:
+		return fxPatternLoop, y
+	case 0x7:
+		return fxTremoloWave, y
+	case 0x8:
+		return fxPanning4, y
+	case 0x9:
+		return fxRetrigSimple, y
+	case 0xA:
+		return fxFineVolUp, y
+	case 0xB:
+		return fxFineVolDown, y
+	case 0xC:
+		return fxNoteCut, y
+	case 0xD:
+		return fxNoteDelay, y
+	case 0xE:
+		return fxPatternDelay, y
+	}
+	// E0x filter, E3x glissando and EFx invert loop are ignored
+	return fxNone, 0
+}
+
+// convertSpecial converts the S3M/IT Sxy command.
+//
+// Unlike MOD, S00 recalls the last Sxy parameter, so this is done by the player.
+func convertSpecial(param uint8) (effect, newParam uint8) {
+	x, y := param>>4, param&0x0F
+	switch x {
+	case 0x2:
+		return fxFinetune, y
+	case 0x3:
+		return fxVibratoWave, y
+	case 0x4:
+		return fxTremoloWave, y
+	case 0x5:
+		return fxPanbrelloWave, y
+	case 0x6:
+		return fxFinePatternDelay, y
+	case 0x7:
+		return fxNNA, y
+	case 0x8:
+		return fxPanning4, y
+	case 0x9:
+		if y == 1 {
+			return fxSurround, 0
+		}
+	case 0xA:
+		return fxHighOffset, y
+	case 0xB:
+		return fxPatternLoop, y
+	case 0xC:
+		return fxNoteCut, y
+	case 0xD:
+		return fxNoteDelay, y
+	case 0xE:
+		return fxPatternDelay, y
+	}
+	return fxNone, 0
+}
+
+// convertS3MEffect converts S3M/IT effect letters (A = 1) into fx* commands.
+func convertS3MEffect(letter, param uint8, it bool) (effect, newParam uint8) {
+	switch letter {
+	case 'A' - '@':
+		return fxSpeed, param
+	case 'B' - '@':
+		return fxJump, param
+	case 'C' - '@':
+		if !it {
+			// ScreamTracker stores the row in decimal
+			return fxBreak, param>>4*10 + param&0x0F
+		}
+		return fxBreak, param
+	case 'D' - '@':
+		return fxVolSlide, param
+	case 'E' - '@':
+		return fxPortaDown, param
+	case 'F' - '@':
+		return fxPortaUp, param
+	case 'G' - '@':
+		return fxTonePorta, param
+	case 'H' - '@':
+		return fxVibrato, param
+	case 'I' - '@':
+		return fxTremor, param
+	case 'J' - '@':
+		return fxArpeggio, param
+	case 'K' - '@':
+		return fxVibratoVol, param
+	case 'L' - '@':
+		return fxTonePortaVol, param
+	case 'M' - '@':
+		return fxChannelVolume, param
+	case 'N' - '@':
+		return fxChannelVolSlide, param
+	case 'O' - '@':
+		return fxOffset, param
+	case 'P' - '@':
+		return fxPanSlide, param
+	case 'Q' - '@':
+		return fxRetrig, param
+	case 'R' - '@':
+		return fxTremolo, param
+	case 'S' - '@':
+		return fxSpecial, param
+	case 'T' - '@':
+		return fxTempo, param
+	case 'U' - '@':
+		return fxFineVibrato, param
+	case 'V' - '@':
+		return fxGlobalVolume, param
+	case 'W' - '@':
+		return fxGlobalVolSlide, param
+	case 'X' - '@':
+		if !it {
+			// ScreamTracker panning is 0 ~ 0x80, 0xA4 being surround
+			if param == 0xA4 {
+				return fxSurround, 0
+			}
+			if param > 0x80 {
+				param = 0x80
+			}
+			if param == 0x80 {
+				return fxPanning, 0xFF
+			}
+			return fxPanning, param * 2
+		}
+		return fxPanning, param
+	case 'Y' - '@':
+		return fxPanbrello, param
+	}
+	return fxNone, 0
+}
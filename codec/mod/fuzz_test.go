@@ -0,0 +1,19 @@
+//go:build go1.18
+// +build go1.18
+
+package mod
+
+import "testing"
+
+func FuzzLoad(f *testing.F) {
+	f.Add(testMOD())
+	for _, data := range malformedModules {
+		f.Add([]byte(data))
+	}
+
+	f.Fuzz(func(t *testing.T, data []byte) {
+		if m, err := load(data); err == nil {
+			playModule(m)
+		}
+	})
+}
@@ -0,0 +1,204 @@
+package mod
+
+import "encoding/binary"
+
+// bitReader reads IT compressed sample blocks, least significant bit first.
+type bitReader struct {
+	data []byte
+	pos  int
+	bits uint32
+	left uint
+}
+
+func (b *bitReader) read(n uint) uint32 {
+	for b.left < n {
+		var next uint32
+		if b.pos < len(b.data) {
+			next = uint32(b.data[b.pos])
+		}
+		b.pos++
+		b.bits |= next << b.left
+		b.left += 8
+	}
+	v := b.bits & (1<<n - 1)
+	b.bits >>= n
+	b.left -= n
+	return v
+}
+
+// decompressIT8 decompresses a 8-bit IT2.14/IT2.15 compressed sample of the given length.
+//
+// It consumes the compressed blocks from r, and returns the samples in 16 bits.
+func decompressIT8(r *reader, length int, it215 bool) []int16 {
+	out := make([]int16, 0, length)
+
+	for len(out) < length && !r.err {
+		blockLen := length - len(out)
+		if blockLen > 0x8000 {
+			blockLen = 0x8000
+		}
+		size := r.u16()
+		bits := &bitReader{data: r.bytesUpTo(size)}
+
+		var width uint = 9
+		var d1, d2 int8
+		for n := 0; n < blockLen; {
+			value := bits.read(width)
+
+			switch {
+			case width < 7:
+				// method 1, 1 ~ 6 bits
+				if value == 1<<(width-1) {
+					v := uint(bits.read(3)) + 1
+					if v >= width {
+						v++
+					}
+					width = v
+					continue
+				}
+			case width < 9:
+				// method 2, 7 ~ 8 bits
+				border := uint32(0xFF>>(9-width)) - 4
+				if value > border && value <= border+8 {
+					v := uint(value - border)
+					if v >= width {
+						v++
+					}
+					width = v
+					continue
+				}
+			case width == 9:
+				// method 3, 9 bits
+				if value&0x100 != 0 {
+					width = uint(value+1) & 0xFF
+					continue
+				}
+			default:
+				// invalid width, the data is broken
+				return append(out, make([]int16, length-len(out))...)
+			}
+
+			// sign extend
+			var v int8
+			if width < 8 {
+				shift := 8 - width
+				v = int8(uint8(value)<<shift) >> shift
+			} else {
+				v = int8(value)
+			}
+
+			d1 += v
+			d2 += d1
+			if it215 {
+				out = append(out, int16(d2)<<8)
+			} else {
+				out = append(out, int16(d1)<<8)
+			}
+			n++
+		}
+	}
+
+	if len(out) < length {
+		out = append(out, make([]int16, length-len(out))...)
+	}
+	return out
+}
+
+// decompressIT16 decompresses a 16-bit IT2.14/IT2.15 compressed sample of the given length.
+func decompressIT16(r *reader, length int, it215 bool) []int16 {
+	out := make([]int16, 0, length)
+
+	for len(out) < length && !r.err {
+		blockLen := length - len(out)
+		if blockLen > 0x4000 {
+			blockLen = 0x4000
+		}
+		size := r.u16()
+		bits := &bitReader{data: r.bytesUpTo(size)}
+
+		var width uint = 17
+		var d1, d2 int16
+		for n := 0; n < blockLen; {
+			value := bits.read(width)
+
+			switch {
+			case width < 7:
+				if value == 1<<(width-1) {
+					v := uint(bits.read(4)) + 1
+					if v >= width {
+						v++
+					}
+					width = v
+					continue
+				}
+			case width < 17:
+				border := uint32(0xFFFF>>(17-width)) - 8
+				if value > border && value <= border+16 {
+					v := uint(value - border)
+					if v >= width {
+						v++
+					}
+					width = v
+					continue
+				}
+			case width == 17:
+				if value&0x10000 != 0 {
+					width = uint(value+1) & 0xFF
+					continue
+				}
+			default:
+				return append(out, make([]int16, length-len(out))...)
+			}
+
+			var v int16
+			if width < 16 {
+				shift := 16 - width
+				v = int16(uint16(value)<<shift) >> shift
+			} else {
+				v = int16(value)
+			}
+
+			d1 += v
+			d2 += d1
+			if it215 {
+				out = append(out, d2)
+			} else {
+				out = append(out, d1)
+			}
+			n++
+		}
+	}
+
+	if len(out) < length {
+		out = append(out, make([]int16, length-len(out))...)
+	}
+	return out
+}
+
+// readITSampleData reads the sample data of the given format, as described by IT sample flags.
+func readITSampleData(r *reader, length int, flags, cvt int, cmwt int) []int16 {
+	sixteen := flags&0x02 != 0
+	compressed := flags&0x08 != 0
+	unsigned := cvt&0x01 == 0
+	it215 := cvt&0x04 != 0 && cmwt >= 0x215
+
+	read := func() []int16 {
+		switch {
+		case compressed && sixteen:
+			return decompressIT16(r, length, it215)
+		case compressed:
+			return decompressIT8(r, length, it215)
+		case sixteen:
+			return pcm16(r.bytesUpTo(length*2), binary.LittleEndian, unsigned)
+		default:
+			return pcm8(r.bytesUpTo(length), unsigned)
+		}
+	}
+
+	data := read()
+	if flags&0x04 != 0 {
+		// stereo, the right channel follows
+		data = downmix(data, read())
+	}
+	return data
+}
@@ -0,0 +1,408 @@
+package mod
+
+import (
+	"encoding/binary"
+	"errors"
+)
+
+const itHeaderSize = 192
+
+// itTonePortaTable maps the IT volume column tone portamento (g) to the actual speed.
+var itTonePortaTable = [10]uint8{0x00, 0x01, 0x04, 0x08, 0x10, 0x20, 0x40, 0x60, 0x80, 0xFF}
+
+func loadIT(data []byte) (*module, error) {
+	if len(data) < itHeaderSize || string(data[:4]) != "IMPM" {
+		return nil, errors.New("mod: not a IT file")
+	}
+
+	r := newReader(data, binary.LittleEndian)
+	m := &module{format: formatIT}
+
+	r.seek(4)
+	m.title = r.str(26)
+	r.seek(32)
+	numOrders := r.u16()
+	numInstruments := r.u16()
+	numSamples := r.u16()
+	numPatterns := r.u16()
+	r.skip(2) // created with tracker version
+	cmwt := r.u16()
+	flags := r.u16()
+	r.skip(2) // special
+	m.globalVolume = r.u8()
+	mixVolume := r.u8()
+	m.initialSpeed = r.u8()
+	m.initialTempo = r.u8()
+
+	stereo := flags&0x01 != 0
+	useInstruments := flags&0x04 != 0
+	m.linearSlides = flags&0x08 != 0
+	m.oldEffects = flags&0x10 != 0
+	m.compatGxx = flags&0x20 != 0
+
+	if m.globalVolume > 128 {
+		m.globalVolume = 128
+	}
+	if mixVolume == 0 || mixVolume > 128 {
+		mixVolume = 48
+	}
+	m.mixVolume = float64(mixVolume) / 48
+
+	r.seek(64)
+	chanPan := r.bytes(64)
+	chanVol := r.bytes(64)
+
+	for _, o := range r.bytes(numOrders) {
+		m.orders = append(m.orders, int(o))
+	}
+
+	instPointers := make([]int, numInstruments)
+	for i := range instPointers {
+		instPointers[i] = r.u32()
+	}
+	samplePointers := make([]int, numSamples)
+	for i := range samplePointers {
+		samplePointers[i] = r.u32()
+	}
+	patPointers := make([]int, numPatterns)
+	for i := range patPointers {
+		patPointers[i] = r.u32()
+	}
+	if r.err {
+		return nil, errTruncated
+	}
+
+	// samples
+	m.samples = make([]*sample, numSamples)
+	for i, ptr := range samplePointers {
+		s := &sample{pan: -1, c5speed: 8363}
+		m.samples[i] = s
+
+		r.seek(ptr)
+		if string(r.bytes(4)) != "IMPS" {
+			continue
+		}
+		r.skip(13) // file name
+		s.globalVolume = r.u8()
+		sflags := r.u8()
+		s.volume = r.u8()
+		s.name = r.str(26)
+		cvt := r.u8()
+		pan := r.u8()
+		length := r.u32()
+		s.loopStart = r.u32()
+		s.loopEnd = r.u32()
+		s.c5speed = float64(r.u32())
+		s.susStart = r.u32()
+		s.susEnd = r.u32()
+		dataPointer := r.u32()
+		s.vibRate, s.vibDepth, s.vibSweep, s.vibType = r.u8(), r.u8(), r.u8(), r.u8()
+		if r.err {
+			return nil, errTruncated
+		}
+
+		if s.globalVolume > 64 {
+			s.globalVolume = 64
+		}
+		if s.volume > 64 {
+			s.volume = 64
+		}
+		if pan&0x80 != 0 {
+			s.pan = (pan & 0x7F) * 4
+		}
+		if s.c5speed == 0 {
+			s.c5speed = 8363
+		}
+		if sflags&0x10 != 0 {
+			s.loop = loopForward
+			if sflags&0x40 != 0 {
+				s.loop = loopPingPong
+			}
+		}
+		if sflags&0x20 != 0 {
+			s.sustain = loopForward
+			if sflags&0x80 != 0 {
+				s.sustain = loopPingPong
+			}
+		}
+		// IT gives the rate at which the depth grows, 1/256 per tick
+		if s.vibSweep != 0 {
+			s.vibSweep = s.vibDepth * 256 / s.vibSweep
+		} else {
+			s.vibDepth = 0
+		}
+
+		if sflags&0x01 != 0 && length > 0 {
+			r.seek(dataPointer)
+			s.data = readITSampleData(r, length, sflags, cvt, cmwt)
+		}
+		s.fixLoop()
+	}
+
+	// instruments
+	if useInstruments {
+		m.instruments = make([]*instrument, numInstruments)
+		for i, ptr := range instPointers {
+			r.seek(ptr)
+			if cmwt < 0x200 {
+				m.instruments[i] = readITOldInstrument(r)
+			} else {
+				m.instruments[i] = readITInstrument(r)
+			}
+		}
+		if r.err {
+			return nil, errTruncated
+		}
+	} else {
+		m.instruments = sampleInstruments(m.samples)
+	}
+
+	// patterns, read with all 64 channels first
+	const maxChannels = 64
+	m.channels = 1
+	m.patterns = make([]pattern, numPatterns)
+	for p, ptr := range patPointers {
+		if ptr == 0 {
+			m.patterns[p] = pattern{rows: 64, cells: make([]cell, 64*maxChannels)}
+			continue
+		}
+
+		r.seek(ptr)
+		r.skip(2) // packed length
+		rows := r.u16()
+		r.skip(4)
+		if rows == 0 || rows > 200 {
+			rows = 64
+		}
+		pat := pattern{rows: rows, cells: make([]cell, rows*maxChannels)}
+
+		var lastMask [maxChannels]int
+		var last [maxChannels]cell
+		for row := 0; row < rows && !r.err; {
+			cv := r.u8()
+			if cv == 0 {
+				row++
+				continue
+			}
+			ch := (cv - 1) & 63
+			if cv&0x80 != 0 {
+				lastMask[ch] = r.u8()
+			}
+			mask := lastMask[ch]
+
+			c := &pat.cells[row*maxChannels+ch]
+			if mask&0x01 != 0 {
+				note := r.u8()
+				switch {
+				case note < noteMax:
+					last[ch].note = uint8(note + 1)
+				case note == 255:
+					last[ch].note = noteOff
+				case note == 254:
+					last[ch].note = noteCut
+				default:
+					last[ch].note = noteFade
+				}
+				c.note = last[ch].note
+			}
+			if mask&0x02 != 0 {
+				last[ch].instrument = uint8(r.u8())
+				c.instrument = last[ch].instrument
+			}
+			if mask&0x04 != 0 {
+				last[ch].volCmd, last[ch].volParam = convertITVolume(r.u8())
+				c.volCmd, c.volParam = last[ch].volCmd, last[ch].volParam
+			}
+			if mask&0x08 != 0 {
+				effect, param := r.u8(), r.u8()
+				last[ch].effect, last[ch].param = convertS3MEffect(uint8(effect), uint8(param), true)
+				c.effect, c.param = last[ch].effect, last[ch].param
+			}
+			if mask&0x10 != 0 {
+				c.note = last[ch].note
+			}
+			if mask&0x20 != 0 {
+				c.instrument = last[ch].instrument
+			}
+			if mask&0x40 != 0 {
+				c.volCmd, c.volParam = last[ch].volCmd, last[ch].volParam
+			}
+			if mask&0x80 != 0 {
+				c.effect, c.param = last[ch].effect, last[ch].param
+			}
+
+			if ch+1 > m.channels {
+				m.channels = ch + 1
+			}
+		}
+		m.patterns[p] = pat
+	}
+
+	// trim the unused channels
+	for p := range m.patterns {
+		pat := &m.patterns[p]
+		cells := make([]cell, pat.rows*m.channels)
+		for row := 0; row < pat.rows; row++ {
+			copy(cells[row*m.channels:(row+1)*m.channels], pat.cells[row*maxChannels:])
+		}
+		pat.cells = cells
+	}
+
+	m.channelPan = make([]int, m.channels)
+	m.channelVolume = make([]int, m.channels)
+	m.channelMuted = make([]bool, m.channels)
+	for i := 0; i < m.channels; i++ {
+		pan := int(chanPan[i])
+		m.channelMuted[i] = pan&0x80 != 0
+		pan &= 0x7F
+		if pan > 64 || !stereo {
+			// surround, or mono
+			pan = 32
+		}
+		m.channelPan[i] = pan * 4
+
+		m.channelVolume[i] = int(chanVol[i])
+		if m.channelVolume[i] > 64 {
+			m.channelVolume[i] = 64
+		}
+	}
+
+	return m, nil
+}
+
+// convertITVolume converts the value of the IT volume column.
+func convertITVolume(v int) (uint8, uint8) {
+	switch {
+	case v <= 64:
+		return vcVolume, uint8(v)
+	case v <= 74:
+		return vcFineVolUp, uint8(v - 65)
+	case v <= 84:
+		return vcFineVolDown, uint8(v - 75)
+	case v <= 94:
+		return vcVolSlideUp, uint8(v - 85)
+	case v <= 104:
+		return vcVolSlideDown, uint8(v - 95)
+	case v <= 114:
+		return vcPortaDown, uint8(v-105) * 4
+	case v <= 124:
+		return vcPortaUp, uint8(v-115) * 4
+	case v >= 128 && v <= 192:
+		return vcPanning, uint8(v - 128)
+	case v >= 193 && v <= 202:
+		return vcTonePorta, itTonePortaTable[v-193]
+	case v >= 203 && v <= 212:
+		return vcVibratoDepth, uint8(v - 203)
+	}
+	return vcNone, 0
+}
+
+// readITEnvelope reads a envelope of the new (IT 2.00+) instrument format.
+func readITEnvelope(r *reader, signed bool) (env envelope) {
+	flags := r.u8()
+	count := r.u8()
+	env.loopS, env.loopE = r.u8(), r.u8()
+	env.sustainS, env.sustainE = r.u8(), r.u8()
+
+	if count > 25 {
+		count = 25
+	}
+	points := make([]envPoint, 25)
+	for i := range points {
+		if signed {
+			points[i].value = r.s8()
+		} else {
+			points[i].value = r.u8()
+		}
+		points[i].tick = r.u16()
+	}
+	r.skip(1)
+	env.points = points[:count]
+
+	env.enabled = flags&0x01 != 0 && count > 0
+	env.loop = flags&0x02 != 0 && env.loopS <= env.loopE && env.loopE < count
+	env.sustain = flags&0x04 != 0 && env.sustainS <= env.sustainE && env.sustainE < count
+	if flags&0x80 != 0 {
+		// the pitch envelope is used as a filter envelope, which is not supported
+		env.enabled = false
+	}
+	return
+}
+
+func readITInstrument(r *reader) *instrument {
+	inst := &instrument{pan: -1}
+
+	start := r.pos
+	r.skip(17) // magic and file name
+	inst.nna = r.u8()
+	r.skip(2) // duplicate check type and action
+	inst.fadeout = r.u16() * 64
+	r.skip(2) // pitch-pan separation and center
+	inst.globalVolume = r.u8()
+	pan := r.u8()
+	r.skip(6)
+	inst.name = r.str(26)
+
+	if inst.globalVolume > 128 {
+		inst.globalVolume = 128
+	}
+	if pan&0x80 == 0 {
+		inst.pan = pan * 4
+	}
+
+	readITKeymap(r, start, inst)
+
+	r.seek(start + 304)
+	inst.volEnv = readITEnvelope(r, false)
+	inst.panEnv = readITEnvelope(r, true)
+	inst.pitchEnv = readITEnvelope(r, true)
+	return inst
+}
+
+// readITOldInstrument reads a instrument of the old (IT 1.xx) format.
+func readITOldInstrument(r *reader) *instrument {
+	inst := &instrument{pan: -1, globalVolume: 128}
+
+	start := r.pos
+	r.skip(17) // magic and file name
+	flags := r.u8()
+	loopS, loopE := r.u8(), r.u8()
+	susS, susE := r.u8(), r.u8()
+	r.skip(2)
+	inst.fadeout = r.u16() * 128
+	inst.nna = r.u8()
+	r.skip(5)
+	inst.name = r.str(26)
+
+	readITKeymap(r, start, inst)
+
+	// the node points of the volume envelope, ending with tick 0xFF
+	r.seek(start + 504)
+	env := &inst.volEnv
+	for i := 0; i < 25; i++ {
+		tick, value := r.u8(), r.u8()
+		if tick == 0xFF {
+			break
+		}
+		env.points = append(env.points, envPoint{tick: tick, value: value})
+	}
+	count := len(env.points)
+	env.enabled = flags&0x01 != 0 && count > 0
+	env.loop = flags&0x02 != 0 && loopS <= loopE && loopE < count
+	env.loopS, env.loopE = loopS, loopE
+	env.sustain = flags&0x04 != 0 && susS <= susE && susE < count
+	env.sustainS, env.sustainE = susS, susE
+	return inst
+}
+
+// readITKeymap reads the note-sample table at offset 64 of the instrument.
+func readITKeymap(r *reader, start int, inst *instrument) {
+	r.seek(start + 64)
+	for n := range inst.keymap {
+		note, smp := r.u8(), r.u8()
+		if note >= noteMax {
+			note = n
+		}
+		inst.keymap[n] = keymapEntry{note: uint8(note), sample: smp}
+	}
+}
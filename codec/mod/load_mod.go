@@ -0,0 +1,220 @@
+package mod
+
+import (
+	"encoding/binary"
+	"errors"
+	"math"
+)
+
+const (
+	modMagicOffset = 1080 // offset of the magic in a 31-sample ProTracker module
+	modHeaderSize  = 1084
+)
+
+// modChannels returns the number of channels indicated by the MOD magic, 0 if unknown.
+func modChannels(magic []byte) int {
+	switch string(magic) {
+	case "M.K.", "M!K!", "M&K!", "N.T.", "FLT4", "4CHN":
+		return 4
+	case "6CHN":
+		return 6
+	case "8CHN", "FLT8", "CD81", "OKTA", "OCTA":
+		return 8
+	}
+
+	isDigit := func(c byte) bool { return c >= '0' && c <= '9' }
+
+	// "xCHN", "xxCH" and "xxCN"
+	if isDigit(magic[0]) && string(magic[1:]) == "CHN" {
+		return int(magic[0] - '0')
+	}
+	if isDigit(magic[0]) && isDigit(magic[1]) && (string(magic[2:]) == "CH" || string(magic[2:]) == "CN") {
+		return int(magic[0]-'0')*10 + int(magic[1]-'0')
+	}
+	return 0
+}
+
+// modPeriodNote converts an Amiga period into a note number,
+// where period 428 (ProTracker C-2) is note 60.
+func modPeriodNote(period int) int {
+	if period == 0 {
+		return -1
+	}
+	note := 60 + int(math.Floor(12*math.Log2(428/float64(period))+0.5))
+	if note < 0 {
+		note = 0
+	}
+	if note >= noteMax {
+		note = noteMax - 1
+	}
+	return note
+}
+
+func loadMOD(data []byte) (*module, error) {
+	if len(data) < modHeaderSize {
+		return nil, errTruncated
+	}
+
+	channels := modChannels(data[modMagicOffset:modHeaderSize])
+	if channels == 0 || channels > 32 {
+		return nil, errors.New("mod: unknown MOD magic")
+	}
+
+	r := newReader(data, binary.BigEndian)
+	m := &module{
+		format:       formatMOD,
+		channels:     channels,
+		initialSpeed: 6,
+		initialTempo: 125,
+		globalVolume: 128,
+		mixVolume:    1,
+		amigaLimits:  channels == 4,
+	}
+
+	m.title = r.str(20)
+
+	// sample headers
+	lengths := make([]int, 31)
+	m.samples = make([]*sample, 31)
+	for i := range m.samples {
+		s := &sample{
+			name:         r.str(22),
+			pan:          -1,
+			globalVolume: 64,
+		}
+		lengths[i] = r.u16() * 2
+
+		finetune := r.u8() & 0x0F
+		if finetune >= 8 {
+			finetune -= 16
+		}
+		s.c5speed = 8363 * math.Pow(2, float64(finetune)/(12*8))
+
+		s.volume = r.u8()
+		if s.volume > 64 {
+			s.volume = 64
+		}
+
+		s.loopStart = r.u16() * 2
+		loopLength := r.u16() * 2
+		s.loopEnd = s.loopStart + loopLength
+		if loopLength > 2 {
+			s.loop = loopForward
+		}
+
+		m.samples[i] = s
+	}
+
+	// the order list
+	songLength := r.u8()
+	m.restart = r.u8()
+	if songLength == 0 || songLength > 128 {
+		songLength = 128
+	}
+	if m.restart >= songLength {
+		m.restart = 0
+	}
+
+	numPatterns := 0
+	orders := r.bytes(128)
+	for i := 0; i < 128; i++ {
+		if int(orders[i]) >= numPatterns && orders[i] < 128 {
+			numPatterns = int(orders[i]) + 1
+		}
+	}
+	for i := 0; i < songLength; i++ {
+		m.orders = append(m.orders, int(orders[i]))
+	}
+
+	// patterns
+	r.seek(modHeaderSize)
+	m.patterns = make([]pattern, numPatterns)
+	for p := range m.patterns {
+		pat := pattern{rows: 64, cells: make([]cell, 64*channels)}
+		for i := range pat.cells {
+			b := r.bytes(4)
+			c := &pat.cells[i]
+
+			period := int(b[0]&0x0F)<<8 | int(b[1])
+			c.instrument = b[0]&0xF0 | b[2]>>4
+			if note := modPeriodNote(period); note >= 0 {
+				c.note = uint8(note + 1)
+			}
+
+			effect, param := b[2]&0x0F, b[3]
+			c.effect, c.param = convertMODEffect(effect, param)
+		}
+		m.patterns[p] = pat
+	}
+	if r.err {
+		return nil, errTruncated
+	}
+
+	// sample data, truncated samples are allowed
+	for i, s := range m.samples {
+		s.data = pcm8(r.bytesUpTo(lengths[i]), false)
+		s.fixLoop()
+	}
+
+	m.instruments = sampleInstruments(m.samples)
+
+	// Amiga hard panning, softened a bit
+	m.channelPan = make([]int, channels)
+	m.channelVolume = make([]int, channels)
+	m.channelMuted = make([]bool, channels)
+	for i := range m.channelPan {
+		if i%4 == 0 || i%4 == 3 {
+			m.channelPan[i] = 64
+		} else {
+			m.channelPan[i] = 192
+		}
+		m.channelVolume[i] = 64
+	}
+
+	return m, nil
+}
+
+// convertMODEffect converts the MOD/XM effect 0 ~ F into fx* commands.
+func convertMODEffect(effect, param uint8) (uint8, uint8) {
+	switch effect {
+	case 0x0:
+		if param != 0 {
+			return fxArpeggio, param
+		}
+	case 0x1:
+		return fxPortaUp, param
+	case 0x2:
+		return fxPortaDown, param
+	case 0x3:
+		return fxTonePorta, param
+	case 0x4:
+		return fxVibrato, param
+	case 0x5:
+		return fxTonePortaVol, param
+	case 0x6:
+		return fxVibratoVol, param
+	case 0x7:
+		return fxTremolo, param
+	case 0x8:
+		return fxPanning, param
+	case 0x9:
+		return fxOffset, param
+	case 0xA:
+		return fxVolSlide, param
+	case 0xB:
+		return fxJump, param
+	case 0xC:
+		return fxVolume, param
+	case 0xD:
+		// the row is in decimal
+		return fxBreak, param>>4*10 + param&0x0F
+	case 0xE:
+		return convertExtended(param)
+	case 0xF:
+		if param < 0x20 {
+			return fxSpeed, param
+		}
+		return fxTempo, param
+	}
+	return fxNone, 0
+}
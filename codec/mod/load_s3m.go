@@ -0,0 +1,215 @@
+package mod
+
+import (
+	"encoding/binary"
+	"errors"
+)
+
+const (
+	s3mMagicOffset = 44
+	s3mHeaderSize  = 96
+)
+
+func loadS3M(data []byte) (*module, error) {
+	if len(data) < s3mHeaderSize {
+		return nil, errTruncated
+	}
+
+	r := newReader(data, binary.LittleEndian)
+	m := &module{
+		format:    formatS3M,
+		mixVolume: 1,
+	}
+
+	m.title = r.str(28)
+	r.seek(32)
+	numOrders := r.u16()
+	numInstruments := r.u16()
+	numPatterns := r.u16()
+	flags := r.u16()
+	r.skip(2) // tracker version
+	unsignedSamples := r.u16() == 2
+
+	if string(r.bytes(4)) != "SCRM" {
+		return nil, errors.New("mod: not a S3M file")
+	}
+
+	m.globalVolume = r.u8() * 2
+	m.initialSpeed = r.u8()
+	m.initialTempo = r.u8()
+	masterVolume := r.u8()
+	stereo := masterVolume&0x80 != 0
+	r.skip(1) // ultra click removal
+	defaultPan := r.u8() == 252
+
+	if m.globalVolume > 128 {
+		m.globalVolume = 128
+	}
+	m.amigaLimits = flags&0x10 != 0
+
+	// channel settings
+	r.seek(64)
+	settings := r.bytes(32)
+	for i, s := range settings {
+		if s < 16 {
+			m.channels = i + 1
+		}
+	}
+	if m.channels == 0 {
+		return nil, errors.New("mod: S3M file has no channels enabled")
+	}
+
+	m.channelPan = make([]int, m.channels)
+	m.channelVolume = make([]int, m.channels)
+	m.channelMuted = make([]bool, m.channels)
+	for i := 0; i < m.channels; i++ {
+		m.channelVolume[i] = 64
+		switch {
+		case settings[i] >= 16:
+			m.channelMuted[i] = true
+			m.channelPan[i] = 128
+		case !stereo:
+			m.channelPan[i] = 128
+		case settings[i] < 8:
+			m.channelPan[i] = 0x30
+		default:
+			m.channelPan[i] = 0xD0
+		}
+	}
+
+	// orders
+	r.seek(s3mHeaderSize)
+	for _, o := range r.bytes(numOrders) {
+		m.orders = append(m.orders, int(o))
+	}
+
+	instPointers := make([]int, numInstruments)
+	for i := range instPointers {
+		instPointers[i] = r.u16() * 16
+	}
+	patPointers := make([]int, numPatterns)
+	for i := range patPointers {
+		patPointers[i] = r.u16() * 16
+	}
+
+	if defaultPan {
+		pans := r.bytes(32)
+		for i := 0; i < m.channels; i++ {
+			if pans[i]&0x20 != 0 {
+				m.channelPan[i] = int(pans[i]&0x0F) * 256 / 15
+			}
+		}
+	}
+	if r.err {
+		return nil, errTruncated
+	}
+
+	// instruments, which are actually samples
+	m.samples = make([]*sample, numInstruments)
+	for i, ptr := range instPointers {
+		s := &sample{pan: -1, globalVolume: 64, c5speed: 8363}
+		m.samples[i] = s
+		if ptr == 0 {
+			continue
+		}
+
+		r.seek(ptr)
+		typ := r.u8()
+		r.skip(12) // file name
+		memseg := r.u8()<<16 | r.u16()
+		length := r.u32()
+		s.loopStart = r.u32()
+		s.loopEnd = r.u32()
+		s.volume = r.u8()
+		r.skip(2) // reserved, pack
+		sflags := r.u8()
+		s.c5speed = float64(r.u32())
+		r.skip(12)
+		s.name = r.str(28)
+
+		if s.volume > 64 {
+			s.volume = 64
+		}
+		if s.c5speed == 0 {
+			s.c5speed = 8363
+		}
+		if sflags&1 != 0 {
+			s.loop = loopForward
+		}
+		if typ != 1 || r.err {
+			continue
+		}
+
+		// sample data
+		width := 1
+		if sflags&4 != 0 {
+			width = 2
+		}
+		r.seek(memseg * 16)
+		if sflags&2 != 0 {
+			left := r.bytesUpTo(length * width)
+			right := r.bytesUpTo(length * width)
+			if width == 2 {
+				s.data = downmix(pcm16(left, binary.LittleEndian, unsignedSamples), pcm16(right, binary.LittleEndian, unsignedSamples))
+			} else {
+				s.data = downmix(pcm8(left, unsignedSamples), pcm8(right, unsignedSamples))
+			}
+		} else {
+			b := r.bytesUpTo(length * width)
+			if width == 2 {
+				s.data = pcm16(b, binary.LittleEndian, unsignedSamples)
+			} else {
+				s.data = pcm8(b, unsignedSamples)
+			}
+		}
+		s.fixLoop()
+	}
+	m.instruments = sampleInstruments(m.samples)
+
+	// patterns
+	m.patterns = make([]pattern, numPatterns)
+	for p, ptr := range patPointers {
+		pat := pattern{rows: 64, cells: make([]cell, 64*m.channels)}
+		m.patterns[p] = pat
+		if ptr == 0 {
+			continue
+		}
+
+		r.seek(ptr + 2) // skip the packed length
+		for row := 0; row < 64 && !r.err; {
+			what := r.u8()
+			if what == 0 {
+				row++
+				continue
+			}
+
+			var c cell
+			if what&0x20 != 0 {
+				note, inst := r.u8(), r.u8()
+				switch {
+				case note == 254:
+					c.note = noteCut
+				case note < 0xA0 && note&0x0F < 12:
+					c.note = uint8((note>>4)*12+note&0x0F+12) + 1
+				}
+				c.instrument = uint8(inst)
+			}
+			if what&0x40 != 0 {
+				vol := r.u8()
+				if vol <= 64 {
+					c.volCmd, c.volParam = vcVolume, uint8(vol)
+				}
+			}
+			if what&0x80 != 0 {
+				effect, param := r.u8(), r.u8()
+				c.effect, c.param = convertS3MEffect(uint8(effect), uint8(param), false)
+			}
+
+			if ch := int(what & 0x1F); ch < m.channels {
+				pat.cells[row*m.channels+ch] = c
+			}
+		}
+	}
+
+	return m, nil
+}
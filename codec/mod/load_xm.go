@@ -0,0 +1,345 @@
+package mod
+
+import (
+	"encoding/binary"
+	"errors"
+	"math"
+)
+
+const xmMagic = "Extended Module: "
+
+// xmVibratoWave maps the auto vibrato waveforms of XM instruments.
+var xmVibratoWave = [4]int{waveSine, waveSquare, waveRampDown, waveRampUp}
+
+func loadXM(data []byte) (*module, error) {
+	if len(data) < 80 || string(data[:len(xmMagic)]) != xmMagic {
+		return nil, errors.New("mod: not a XM file")
+	}
+
+	r := newReader(data, binary.LittleEndian)
+	m := &module{
+		format:       formatXM,
+		globalVolume: 128,
+		mixVolume:    1,
+	}
+
+	r.seek(17)
+	m.title = r.str(20)
+	r.seek(60)
+	headerSize := r.u32()
+	songLength := r.u16()
+	m.restart = r.u16()
+	m.channels = r.u16()
+	numPatterns := r.u16()
+	numInstruments := r.u16()
+	flags := r.u16()
+	m.initialSpeed = r.u16()
+	m.initialTempo = r.u16()
+	orders := r.bytes(256)
+
+	if m.channels == 0 || m.channels > 64 {
+		return nil, errors.New("mod: invalid number of channels in XM")
+	}
+	if songLength > 256 {
+		songLength = 256
+	}
+	if m.restart >= songLength {
+		m.restart = 0
+	}
+	m.linearSlides = flags&1 != 0
+	for _, o := range orders[:songLength] {
+		m.orders = append(m.orders, int(o))
+	}
+
+	m.channelPan = make([]int, m.channels)
+	m.channelVolume = make([]int, m.channels)
+	m.channelMuted = make([]bool, m.channels)
+	for i := range m.channelPan {
+		m.channelPan[i] = 128
+		m.channelVolume[i] = 64
+	}
+
+	// patterns
+	r.seek(60 + headerSize)
+	m.patterns = make([]pattern, numPatterns)
+	for p := range m.patterns {
+		start := r.pos
+		length := r.u32()
+		r.skip(1) // packing type
+		rows := r.u16()
+		packedSize := r.u16()
+		if r.err {
+			return nil, errTruncated
+		}
+		if rows == 0 || rows > 256 {
+			rows = 64
+		}
+
+		pat := pattern{rows: rows, cells: make([]cell, rows*m.channels)}
+		r.seek(start + length)
+		end := r.pos + packedSize
+		if packedSize > 0 {
+			for i := range pat.cells {
+				if r.pos >= end {
+					break
+				}
+				pat.cells[i] = readXMCell(r)
+			}
+		}
+		r.seek(end)
+		m.patterns[p] = pat
+	}
+
+	// instruments
+	m.instruments = make([]*instrument, numInstruments)
+	for i := range m.instruments {
+		inst, samples, err := readXMInstrument(r, len(m.samples))
+		if err != nil {
+			return nil, err
+		}
+		m.instruments[i] = inst
+		m.samples = append(m.samples, samples...)
+	}
+
+	return m, nil
+}
+
+func readXMCell(r *reader) (c cell) {
+	var note, inst, vol, effect, param int
+
+	b := r.u8()
+	if b&0x80 != 0 {
+		if b&0x01 != 0 {
+			note = r.u8()
+		}
+		if b&0x02 != 0 {
+			inst = r.u8()
+		}
+		if b&0x04 != 0 {
+			vol = r.u8()
+		}
+		if b&0x08 != 0 {
+			effect = r.u8()
+		}
+		if b&0x10 != 0 {
+			param = r.u8()
+		}
+	} else {
+		note = b
+		inst = r.u8()
+		vol = r.u8()
+		effect = r.u8()
+		param = r.u8()
+	}
+
+	switch {
+	case note == 97:
+		c.note = noteOff
+	case note > 0 && note < 97:
+		// XM note 1 is C-0, 12 notes lower than ours
+		c.note = uint8(note + 12)
+	}
+	c.instrument = uint8(inst)
+
+	x, y := uint8(vol>>4), uint8(vol&0x0F)
+	switch x {
+	case 0x1, 0x2, 0x3, 0x4:
+		c.volCmd, c.volParam = vcVolume, uint8(vol-0x10)
+	case 0x5:
+		if y == 0 {
+			c.volCmd, c.volParam = vcVolume, 64
+		}
+	case 0x6:
+		c.volCmd, c.volParam = vcVolSlideDown, y
+	case 0x7:
+		c.volCmd, c.volParam = vcVolSlideUp, y
+	case 0x8:
+		c.volCmd, c.volParam = vcFineVolDown, y
+	case 0x9:
+		c.volCmd, c.volParam = vcFineVolUp, y
+	case 0xA:
+		c.volCmd, c.volParam = vcVibratoSpeed, y
+	case 0xB:
+		c.volCmd, c.volParam = vcVibratoDepth, y
+	case 0xC:
+		c.volCmd, c.volParam = vcPanning, y*64/15
+	case 0xD:
+		c.volCmd, c.volParam = vcPanSlideLeft, y
+	case 0xE:
+		c.volCmd, c.volParam = vcPanSlideRight, y
+	case 0xF:
+		c.volCmd, c.volParam = vcTonePorta, y<<4
+	}
+
+	e, p := uint8(effect), uint8(param)
+	switch {
+	case e <= 0xF:
+		c.effect, c.param = convertMODEffect(e, p)
+		if e == 0xE && p>>4 == 0x9 && p&0x0F == 0 {
+			// E90 does nothing in FastTracker 2
+			c.effect = fxNone
+		}
+	case e == 'G'-'A'+10:
+		c.effect, c.param = fxGlobalVolume, p
+	case e == 'H'-'A'+10:
+		c.effect, c.param = fxGlobalVolSlide, p
+	case e == 'K'-'A'+10:
+		c.effect, c.param = fxKeyOff, p
+	case e == 'L'-'A'+10:
+		c.effect, c.param = fxEnvPosition, p
+	case e == 'P'-'A'+10:
+		c.effect, c.param = fxPanSlide, p
+	case e == 'R'-'A'+10:
+		c.effect, c.param = fxRetrig, p
+	case e == 'T'-'A'+10:
+		c.effect, c.param = fxTremor, p
+	case e == 'X'-'A'+10:
+		switch p >> 4 {
+		case 1:
+			c.effect, c.param = fxExtraFinePortaUp, p&0x0F
+		case 2:
+			c.effect, c.param = fxExtraFinePortaDown, p&0x0F
+		}
+	}
+	return
+}
+
+// readXMEnvelope reads the 12 points of an XM envelope.
+func readXMEnvelope(r *reader) (env envelope) {
+	env.points = make([]envPoint, 12)
+	for i := range env.points {
+		env.points[i].tick = r.u16()
+		env.points[i].value = r.u16()
+	}
+	return
+}
+
+// setupXMEnvelope sets the flags of the envelope read from the instrument header.
+func setupXMEnvelope(env *envelope, count, sustain, loopS, loopE, flags int, center int) {
+	if count > len(env.points) {
+		count = len(env.points)
+	}
+	env.points = env.points[:count]
+	for i := range env.points {
+		env.points[i].value -= center
+	}
+
+	env.enabled = flags&1 != 0 && count > 0
+	env.sustain = flags&2 != 0 && sustain < count
+	env.sustainS, env.sustainE = sustain, sustain
+	env.loop = flags&4 != 0 && loopS <= loopE && loopE < count
+	env.loopS, env.loopE = loopS, loopE
+}
+
+// readXMInstrument reads the instrument, together with its samples.
+// The samples are numbered from firstSample + 1.
+func readXMInstrument(r *reader, firstSample int) (inst *instrument, samples []*sample, err error) {
+	start := r.pos
+	size := r.u32()
+	inst = &instrument{globalVolume: 128, pan: -1}
+	inst.name = r.str(22)
+	r.skip(1) // type
+	numSamples := r.u16()
+	if r.err {
+		return nil, nil, errTruncated
+	}
+
+	if numSamples == 0 {
+		r.seek(start + size)
+		return inst, nil, nil
+	}
+
+	sampleHeaderSize := r.u32()
+	sampleMap := r.bytes(96)
+	volEnv := readXMEnvelope(r)
+	panEnv := readXMEnvelope(r)
+	volPoints, panPoints := r.u8(), r.u8()
+	volSustain, volLoopS, volLoopE := r.u8(), r.u8(), r.u8()
+	panSustain, panLoopS, panLoopE := r.u8(), r.u8(), r.u8()
+	volFlags, panFlags := r.u8(), r.u8()
+	vibType, vibSweep, vibDepth, vibRate := r.u8(), r.u8(), r.u8(), r.u8()
+	inst.fadeout = r.u16() * 2
+	if r.err {
+		return nil, nil, errTruncated
+	}
+
+	setupXMEnvelope(&volEnv, volPoints, volSustain, volLoopS, volLoopE, volFlags, 0)
+	setupXMEnvelope(&panEnv, panPoints, panSustain, panLoopS, panLoopE, panFlags, 32)
+	inst.volEnv, inst.panEnv = volEnv, panEnv
+
+	for n := range inst.keymap {
+		inst.keymap[n].note = uint8(n)
+		// the XM sample map starts at C-0, which is our note 12
+		if k := n - 12; k >= 0 && k < 96 && int(sampleMap[k]) < numSamples {
+			inst.keymap[n].sample = firstSample + int(sampleMap[k]) + 1
+		}
+	}
+
+	// sample headers
+	r.seek(start + size)
+	samples = make([]*sample, numSamples)
+	lengths := make([]int, numSamples)
+	sixteen := make([]bool, numSamples)
+	for i := range samples {
+		hstart := r.pos
+		s := &sample{globalVolume: 64}
+		lengths[i] = r.u32()
+		s.loopStart = r.u32()
+		loopLength := r.u32()
+		s.volume = r.u8()
+		finetune := r.s8()
+		typ := r.u8()
+		s.pan = r.u8()
+		relnote := r.s8()
+		r.skip(1)
+		s.name = r.str(22)
+		r.seek(hstart + sampleHeaderSize)
+
+		if s.volume > 64 {
+			s.volume = 64
+		}
+		s.c5speed = 8363 * math.Pow(2, (float64(relnote)+float64(finetune)/128)/12)
+		s.loopEnd = s.loopStart + loopLength
+		switch typ & 3 {
+		case 1:
+			s.loop = loopForward
+		case 2:
+			s.loop = loopPingPong
+		}
+		sixteen[i] = typ&0x10 != 0
+		if sixteen[i] {
+			s.loopStart /= 2
+			s.loopEnd /= 2
+		}
+
+		// auto vibrato is per instrument in XM
+		s.vibType, s.vibSweep, s.vibDepth, s.vibRate = xmVibratoWave[vibType&3], vibSweep, vibDepth, vibRate
+		samples[i] = s
+	}
+	if r.err {
+		return nil, nil, errTruncated
+	}
+
+	// sample data, delta encoded
+	for i, s := range samples {
+		b := r.bytesUpTo(lengths[i])
+		if sixteen[i] {
+			s.data = pcm16(b, binary.LittleEndian, false)
+			var acc int16
+			for j := range s.data {
+				acc += s.data[j]
+				s.data[j] = acc
+			}
+		} else {
+			s.data = make([]int16, len(b))
+			var acc int8
+			for j := range b {
+				acc += int8(b[j])
+				s.data[j] = int16(acc) << 8
+			}
+		}
+		s.fixLoop()
+	}
+
+	return inst, samples, nil
+}
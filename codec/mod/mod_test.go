@@ -0,0 +1,191 @@
+package mod
+
+import (
+	"bytes"
+	"encoding/binary"
+	"io"
+	"math"
+	"testing"
+)
+
+// testMOD returns a 4-channel ProTracker module of one pattern, playing a looped
+// square wave sample on the first row of the first channel.
+func testMOD() []byte {
+	b := make([]byte, modHeaderSize)
+	copy(b, "test song")
+
+	// sample 1: 64 bytes, looped over all of it
+	s := b[20:]
+	copy(s, "square")
+	binary.BigEndian.PutUint16(s[22:], 32) // length in words
+	s[25] = 64                             // volume
+	binary.BigEndian.PutUint16(s[26:], 0)  // loop start
+	binary.BigEndian.PutUint16(s[28:], 32) // loop length
+
+	b[950] = 1 // song length
+	b[952] = 0 // order 0 plays pattern 0
+	copy(b[modMagicOffset:], "M.K.")
+
+	pat := make([]byte, 64*4*4)
+	binary.BigEndian.PutUint16(pat[0:], 428) // C-2
+	pat[2] = 1 << 4                          // instrument 1
+	b = append(b, pat...)
+
+	for i := 0; i < 64; i++ {
+		if i%16 < 8 {
+			b = append(b, 0x60)
+		} else {
+			b = append(b, 0xA0)
+		}
+	}
+	return b
+}
+
+func TestLoadMOD(t *testing.T) {
+	m, err := load(testMOD())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if m.title != "test song" || m.channels != 4 || len(m.orders) != 1 || len(m.patterns) != 1 {
+		t.Fatalf("module = %q, %d channels, %d orders, %d patterns; want \"test song\", 4, 1, 1",
+			m.title, m.channels, len(m.orders), len(m.patterns))
+	}
+
+	s := m.samples[0]
+	if len(s.data) != 64 || s.loop != loopForward || s.loopStart != 0 || s.loopEnd != 64 {
+		t.Errorf("sample = %d bytes looped %v at %d-%d, want 64 bytes looped at 0-64", len(s.data), s.loop, s.loopStart, s.loopEnd)
+	}
+	if c := m.cellAt(0, 0, 0); c.note != 61 || c.instrument != 1 {
+		t.Errorf("cell = note %d, instrument %d; want 61, 1", c.note, c.instrument)
+	}
+}
+
+func TestModChannels(t *testing.T) {
+	tests := []struct {
+		magic    string
+		channels int
+	}{
+		{"M.K.", 4}, {"6CHN", 6}, {"FLT8", 8}, {"2CHN", 2}, {"12CH", 12}, {"32CN", 32}, {"ABCD", 0}, {"X2CH", 0},
+	}
+	for _, tt := range tests {
+		if got := modChannels([]byte(tt.magic)); got != tt.channels {
+			t.Errorf("modChannels(%q) = %d, want %d", tt.magic, got, tt.channels)
+		}
+	}
+}
+
+func TestModPeriodNote(t *testing.T) {
+	tests := []struct{ period, note int }{
+		{0, -1}, {428, 60}, {214, 72}, {856, 48}, {1, noteMax - 1},
+	}
+	for _, tt := range tests {
+		if got := modPeriodNote(tt.period); got != tt.note {
+			t.Errorf("modPeriodNote(%d) = %d, want %d", tt.period, got, tt.note)
+		}
+	}
+}
+
+func TestSoundFileReaderMod(t *testing.T) {
+	const rate = 8000
+
+	r := NewSoundFileReaderMod(rate)
+	info, err := r.Open(bytes.NewReader(testMOD()))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// 64 rows of 6 ticks at 125 BPM, 2.5 / 125 seconds each
+	const frames = 64 * 6 * rate / 50
+	if info.SampleCount != frames*2 || info.ChannelCount != 2 || info.SampleRate != rate {
+		t.Fatalf("info = %v, want %d stereo frames at %d Hz", info, frames, rate)
+	}
+	if start, end := r.LoopPoints(); start != 0 || end != frames*2 {
+		t.Errorf("LoopPoints = (%d, %d), want (0, %d)", start, end, frames*2)
+	}
+	if r.OrderOffset(0) != 0 || r.OrderOffset(1) != -1 {
+		t.Errorf("OrderOffset = %d, %d; want 0, -1", r.OrderOffset(0), r.OrderOffset(1))
+	}
+
+	buf := make([]float32, 777*2)
+	var total int64
+	var peak float64
+	for {
+		n, err := r.ReadFloat(buf)
+		total += n
+		for _, v := range buf[:n] {
+			peak = math.Max(peak, math.Abs(float64(v)))
+		}
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+	if total != info.SampleCount {
+		t.Errorf("read %d samples, want %d", total, info.SampleCount)
+	}
+	if peak == 0 {
+		t.Errorf("the module rendered silence")
+	}
+
+	// seeking renders the same samples as reading up to the offset
+	r.Seek(0)
+	skip := make([]int16, 3000*2)
+	r.Read(skip)
+	a := make([]int16, 256)
+	r.Read(a)
+	r.Seek(3000 * 2)
+	b := make([]int16, 256)
+	r.Read(b)
+	for i := range a {
+		if a[i] != b[i] {
+			t.Fatalf("sample %d after seeking = %d, want %d", i, b[i], a[i])
+		}
+	}
+}
+
+// malformedModules are inputs load must reject without panicking.
+// They are also the seeds of FuzzLoad.
+var malformedModules = []string{
+	"",
+	"IMPM",
+	"IMPM\xff\xff\xff\xff\xff\xff\xff\xff\xff\xff\xff\xff\xff\xff\xff\xff\xff\xff\xff\xff\xff\xff\xff\xff\xff\xff\xff\xff\xff\xff\xff\xff\xff\xff\xff\xff\xff\xff\xff\xff",
+	"Extended Module: ",
+	"Extended Module: test\x00\x00\x00\x00\x00\x00\x00\x00\x00\x00\x00\x00\x00\x00\x00\x00\x1a",
+	"\x00\x00\x00\x00\x00\x00\x00\x00\x00\x00\x00\x00\x00\x00\x00\x00\x00\x00\x00\x00\x00\x00\x00\x00\x00\x00\x00\x00\x10\x00\x00\x00\xff\xff\xff\xff\xff\xff\x00\x00\x00\x00\x00\x00SCRM",
+}
+
+func TestLoadMalformed(t *testing.T) {
+	for _, data := range malformedModules {
+		if _, err := load([]byte(data)); err == nil {
+			t.Errorf("load(%q) succeeded", data)
+		}
+	}
+}
+
+func TestLoadMODTruncated(t *testing.T) {
+	data := testMOD()
+	for n := modHeaderSize - 4; n < len(data); n++ {
+		if m, err := load(data[:n]); err == nil {
+			playModule(m)
+		}
+	}
+}
+
+// playModule scans and renders the beginning of a module, to check a module
+// loaded from a corrupted file does not crash the player.
+func playModule(m *module) {
+	if len(m.orders) == 0 {
+		return
+	}
+	r := &SoundFileReaderMod{rate: 4000, mod: m}
+	r.scan()
+	r.player = newPlayer(m, r.rate)
+	r.gain = 1
+	buf := make([]int16, 1024)
+	r.Read(buf)
+	r.Seek(r.frames - 512)
+	r.Read(buf)
+	r.Seek(0)
+}
@@ -0,0 +1,319 @@
+package mod
+
+import (
+	"encoding/binary"
+	"errors"
+	"strings"
+)
+
+// format is the file format a module was loaded from.
+type format int8
+
+const (
+	formatMOD format = iota
+	formatS3M
+	formatXM
+	formatIT
+)
+
+// Special values of cell.note.
+//
+// Normal notes are stored as 1 + the note number, where note 60 is the
+// reference note at which a sample plays at its C5Speed.
+const (
+	noteNone = 0
+	noteMax  = 120 // notes are 1 ~ noteMax
+	noteFade = 253 // IT note fade (~~)
+	noteCut  = 254 // note cut (^^)
+	noteOff  = 255 // key off (==)
+)
+
+// Special values in the order list.
+const (
+	orderSkip = 254 // "+++" marker, skipped
+	orderEnd  = 255 // "---" marker, end of song
+)
+
+// cell is one note slot in a pattern.
+type cell struct {
+	note       uint8
+	instrument uint8 // 1-based, 0 for none
+	volCmd     uint8 // volume column command, vc*
+	volParam   uint8
+	effect     uint8 // fx*
+	param      uint8
+}
+
+type pattern struct {
+	rows  int
+	cells []cell // rows * channels
+}
+
+// loop mode of samples
+const (
+	loopNone = iota
+	loopForward
+	loopPingPong
+)
+
+type sample struct {
+	name string
+	data []int16 // mono sample data
+
+	loop               int // loop mode
+	loopStart, loopEnd int
+	sustain            int // sustain loop mode, IT only
+	susStart, susEnd   int
+
+	volume       int // default volume, 0 ~ 64
+	globalVolume int // 0 ~ 64
+	pan          int // default panning 0 ~ 256, -1 for none
+	c5speed      float64
+
+	// auto vibrato
+	vibType, vibSweep, vibDepth, vibRate int
+}
+
+type envPoint struct {
+	tick  int
+	value int // 0 ~ 64 for volume, -32 ~ 32 for panning and pitch
+}
+
+type envelope struct {
+	enabled  bool
+	points   []envPoint
+	loop     bool
+	loopS    int // point indices
+	loopE    int
+	sustain  bool
+	sustainS int
+	sustainE int
+}
+
+// New note actions, IT only.
+const (
+	nnaCut = iota
+	nnaContinue
+	nnaOff
+	nnaFade
+)
+
+type keymapEntry struct {
+	note   uint8 // note to be played, 0 ~ 119
+	sample int   // 1-based, 0 for none
+}
+
+type instrument struct {
+	name   string
+	keymap [noteMax]keymapEntry
+
+	volEnv, panEnv, pitchEnv envelope
+
+	fadeout      int // subtracted from the 65536-based fade volume each tick after key off
+	globalVolume int // 0 ~ 128
+	pan          int // default panning 0 ~ 256, -1 for none
+	nna          int
+}
+
+type module struct {
+	title  string
+	format format
+
+	channels int
+	orders   []int
+	restart  int // order to restart from at the end of the order list
+
+	patterns    []pattern
+	instruments []*instrument // indexed by cell.instrument - 1
+	samples     []*sample
+
+	initialSpeed  int
+	initialTempo  int
+	globalVolume  int // 0 ~ 128
+	mixVolume     float64
+	linearSlides  bool
+	oldEffects    bool   // IT "old effects" flag
+	compatGxx     bool   // IT "compatible Gxx" flag, tone porta memory not shared with E/F
+	amigaLimits   bool   // clamp periods to the ProTracker range
+	channelPan    []int  // 0 ~ 256
+	channelVolume []int  // 0 ~ 64
+	channelMuted  []bool // disabled channels
+}
+
+var errTruncated = errors.New("mod: file truncated")
+
+// cellAt returns the cell at the row and channel of the pattern, or an empty one if out of range.
+func (m *module) cellAt(pat, row, ch int) cell {
+	if pat < 0 || pat >= len(m.patterns) {
+		return cell{}
+	}
+	p := &m.patterns[pat]
+	if row >= p.rows {
+		return cell{}
+	}
+	return p.cells[row*m.channels+ch]
+}
+
+// patternRows returns the number of rows of the pattern, 64 for a missing one.
+func (m *module) patternRows(pat int) int {
+	if pat < 0 || pat >= len(m.patterns) {
+		return 64
+	}
+	return m.patterns[pat].rows
+}
+
+// instrumentAt returns the 1-based instrument, or nil.
+func (m *module) instrumentAt(num int) *instrument {
+	if num <= 0 || num > len(m.instruments) {
+		return nil
+	}
+	return m.instruments[num-1]
+}
+
+// sampleAt returns the 1-based sample, or nil.
+func (m *module) sampleAt(num int) *sample {
+	if num <= 0 || num > len(m.samples) {
+		return nil
+	}
+	return m.samples[num-1]
+}
+
+// sampleInstruments creates an instrument for each sample, mapping every
+// note to the note itself on the sample. It is used by formats without instruments.
+func sampleInstruments(samples []*sample) []*instrument {
+	insts := make([]*instrument, len(samples))
+	for i, s := range samples {
+		inst := &instrument{
+			name:         s.name,
+			globalVolume: 128,
+			pan:          -1,
+		}
+		for n := range inst.keymap {
+			inst.keymap[n] = keymapEntry{note: uint8(n), sample: i + 1}
+		}
+		insts[i] = inst
+	}
+	return insts
+}
+
+// fixLoop validates the loop points of the sample, disabling invalid loops.
+func (s *sample) fixLoop() {
+	if s.loopEnd > len(s.data) {
+		s.loopEnd = len(s.data)
+	}
+	if s.loopStart < 0 || s.loopStart >= s.loopEnd {
+		s.loop = loopNone
+	}
+	if s.susEnd > len(s.data) {
+		s.susEnd = len(s.data)
+	}
+	if s.susStart < 0 || s.susStart >= s.susEnd {
+		s.sustain = loopNone
+	}
+}
+
+// reader is a little helper to read binary data from a byte slice.
+//
+// Reading past the end of the data yields zeros and sets the err flag.
+type reader struct {
+	data  []byte
+	pos   int
+	order binary.ByteOrder
+	err   bool
+}
+
+func newReader(data []byte, order binary.ByteOrder) *reader {
+	return &reader{data: data, order: order}
+}
+
+func (r *reader) seek(pos int) {
+	r.pos = pos
+}
+
+func (r *reader) skip(n int) {
+	r.pos += n
+}
+
+func (r *reader) bytes(n int) []byte {
+	if n < 0 || r.pos < 0 || r.pos+n > len(r.data) {
+		r.err = true
+		r.pos += n
+		return make([]byte, n)
+	}
+	b := r.data[r.pos : r.pos+n]
+	r.pos += n
+	return b
+}
+
+// bytesUpTo returns at most n bytes, less if the data ends earlier.
+func (r *reader) bytesUpTo(n int) []byte {
+	if r.pos < 0 || r.pos >= len(r.data) {
+		return nil
+	}
+	if r.pos+n > len(r.data) {
+		n = len(r.data) - r.pos
+	}
+	b := r.data[r.pos : r.pos+n]
+	r.pos += n
+	return b
+}
+
+func (r *reader) u8() int {
+	return int(r.bytes(1)[0])
+}
+
+func (r *reader) s8() int {
+	return int(int8(r.bytes(1)[0]))
+}
+
+func (r *reader) u16() int {
+	return int(r.order.Uint16(r.bytes(2)))
+}
+
+func (r *reader) u32() int {
+	return int(r.order.Uint32(r.bytes(4)))
+}
+
+func (r *reader) str(n int) string {
+	b := r.bytes(n)
+	if i := strings.IndexByte(string(b), 0); i != -1 {
+		b = b[:i]
+	}
+	return strings.TrimRight(string(b), " ")
+}
+
+// pcm8 converts signed 8-bit samples into 16 bits.
+func pcm8(b []byte, unsigned bool) []int16 {
+	d := make([]int16, len(b))
+	for i, v := range b {
+		if unsigned {
+			v ^= 0x80
+		}
+		d[i] = int16(int8(v)) << 8
+	}
+	return d
+}
+
+// pcm16 converts signed 16-bit samples in the given byte order.
+func pcm16(b []byte, order binary.ByteOrder, unsigned bool) []int16 {
+	d := make([]int16, len(b)/2)
+	for i := range d {
+		v := order.Uint16(b[i*2:])
+		if unsigned {
+			v ^= 0x8000
+		}
+		d[i] = int16(v)
+	}
+	return d
+}
+
+// downmix averages the left and right halves of a stereo sample into mono.
+func downmix(left, right []int16) []int16 {
+	if len(right) < len(left) {
+		left = left[:len(right)]
+	}
+	for i := range left {
+		left[i] = int16((int32(left[i]) + int32(right[i])) / 2)
+	}
+	return left
+}
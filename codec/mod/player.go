@@ -0,0 +1,1129 @@
+package mod
+
+import "math"
+
+// channel is the state of a pattern channel.
+type channel struct {
+	index int
+	cell  cell // cell of the current row
+
+	inst   *instrument
+	sample *sample
+	voice  *voice // the foreground voice, nil if none
+
+	note        int     // current note, 0 ~ 119
+	period      float64 // current period, after slides
+	portaTarget float64 // target period of the tone portamento
+	volume      int     // note volume, 0 ~ 64
+	chanVolume  int     // channel volume, 0 ~ 64
+	pan         int     // 0 ~ 256
+	nna         int
+	highOffset  int
+
+	// effect memory
+	volSlideMem, vcVolSlideMem, portaMem, portaUpMem, portaDownMem        uint8
+	finePortaUpMem, finePortaDownMem, xfinePortaUpMem, xfinePortaDownMem  uint8
+	fineVolUpMem, fineVolDownMem                                          uint8
+	tonePortaMem, offsetMem, retrigMem, tremorMem, arpMem                 uint8
+	panSlideMem, globalVolSlideMem, chanVolSlideMem, tempoMem, specialMem uint8
+
+	vibSpeed, vibDepth, vibWave, vibPos     int
+	tremSpeed, tremDepth, tremWave, tremPos int
+	panbSpeed, panbDepth, panbWave, panbPos int
+	vibNoRetrig, tremNoRetrig               bool
+
+	loopRow, loopCount int
+	retrigCount        int
+	tremorCount        int
+	noteDelay          int // tick to trigger the note of the row, -1 if already triggered
+
+	// effects on the current tick only
+	vibDelta  float64 // period offset of vibrato
+	tremDelta int     // volume offset of tremolo
+	panbDelta int     // panning offset of panbrello
+	arp       int     // semitones of arpeggio
+	tremorOff bool
+}
+
+// playerState is the song position and the channel states, without the voices.
+//
+// It can be copied to be restored later.
+type playerState struct {
+	order, row, tick int
+	speed, tempo     int
+	globalVolume     int
+
+	rowDelay   int  // rows left to repeat for pattern delay
+	repeat     bool // repeating the row
+	delaySet   bool // pattern delay already set for the row
+	extraTicks int  // extra ticks of the row, from fine pattern delay
+
+	jumpOrder, breakRow, loopJump int // -1 for none
+	stopped                       bool
+
+	frac float64 // fractional frames carried over between ticks
+	rnd  uint32  // random seed
+
+	channels []channel
+}
+
+// player plays a module tick by tick.
+type player struct {
+	playerState
+
+	mod    *module
+	rate   int
+	silent bool // no voices are created, used when scanning the song
+
+	voices []*voice
+
+	visited map[int]bool // visited rows, order<<8 | row; nil if not tracked
+	looped  bool         // the song went back to a visited row
+}
+
+func newPlayer(m *module, rate int) *player {
+	p := &player{mod: m, rate: rate}
+	p.reset()
+	return p
+}
+
+// reset puts the player at the beginning of the song.
+func (p *player) reset() {
+	m := p.mod
+	for _, v := range p.voices {
+		v.cut()
+	}
+
+	p.playerState = playerState{
+		speed:        m.initialSpeed,
+		tempo:        m.initialTempo,
+		globalVolume: m.globalVolume,
+		jumpOrder:    -1,
+		breakRow:     -1,
+		loopJump:     -1,
+		rnd:          0x2545F491,
+		channels:     make([]channel, m.channels),
+	}
+	if p.speed == 0 {
+		p.speed = 6
+	}
+	if p.tempo < 32 {
+		p.tempo = 125
+	}
+
+	for i := range p.channels {
+		p.channels[i] = channel{
+			index:      i,
+			pan:        m.channelPan[i],
+			chanVolume: m.channelVolume[i],
+			noteDelay:  -1,
+		}
+	}
+
+	if p.visited != nil {
+		p.visited = make(map[int]bool)
+	}
+	p.looped = false
+	p.order = -1
+	p.setPosition(0, 0)
+}
+
+// snapshot returns a copy of the current state, without the voices.
+func (p *player) snapshot() playerState {
+	s := p.playerState
+	s.channels = append([]channel(nil), p.channels...)
+	for i := range s.channels {
+		s.channels[i].voice = nil
+	}
+	return s
+}
+
+// restore restores a state from snapshot. The voices playing are cut.
+func (p *player) restore(s playerState) {
+	for _, v := range p.voices {
+		v.cut()
+	}
+	p.playerState = s
+	p.channels = append([]channel(nil), s.channels...)
+}
+
+// setPosition moves the song to the order and row, skipping the marker orders.
+func (p *player) setPosition(order, row int) {
+	m := p.mod
+	for tries := 0; ; tries++ {
+		if tries > len(m.orders) {
+			// nothing to play at all
+			p.stopped = true
+			return
+		}
+		if order < 0 || order >= len(m.orders) || m.orders[order] == orderEnd {
+			order, row = m.restart, 0
+			continue
+		}
+		if m.orders[order] == orderSkip {
+			order++
+			continue
+		}
+		break
+	}
+
+	if row >= m.patternRows(m.orders[order]) {
+		row = 0
+	}
+	if order != p.order {
+		for i := range p.channels {
+			p.channels[i].loopRow, p.channels[i].loopCount = 0, 0
+		}
+	}
+	p.order, p.row = order, row
+
+	if p.visited != nil {
+		key := order<<8 | row
+		if p.visited[key] {
+			p.looped = true
+		}
+		p.visited[key] = true
+	}
+}
+
+// tickFrames returns the number of output frames of this tick.
+func (p *player) tickFrames() int {
+	f := float64(p.rate)*2.5/float64(p.tempo) + p.frac
+	n := int(f)
+	p.frac = f - float64(n)
+	return n
+}
+
+// processTick plays a tick, and returns the number of frames it lasts.
+func (p *player) processTick() int {
+	if p.tick == 0 && !p.repeat {
+		p.delaySet = false
+		p.startRow()
+	}
+
+	first := p.tick == 0
+	for i := range p.channels {
+		p.channelTick(&p.channels[i], first)
+	}
+	p.updateVoices()
+
+	frames := p.tickFrames()
+	p.advance()
+	return frames
+}
+
+// advance moves to the next tick, and to the next row if the row has ended.
+func (p *player) advance() {
+	p.tick++
+	if p.tick < p.speed+p.extraTicks {
+		return
+	}
+
+	p.tick = 0
+	if p.rowDelay > 0 {
+		p.rowDelay--
+		p.repeat = true
+		return
+	}
+	p.repeat = false
+	p.nextRow()
+}
+
+func (p *player) nextRow() {
+	order, row := p.order, p.row+1
+
+	switch {
+	case p.loopJump >= 0:
+		row = p.loopJump
+		if p.visited != nil {
+			// rows in a pattern loop are visited again legitimately
+			for r := row; r <= p.row; r++ {
+				delete(p.visited, order<<8|r)
+			}
+		}
+	case p.jumpOrder >= 0 || p.breakRow >= 0:
+		if p.jumpOrder >= 0 {
+			order = p.jumpOrder
+		} else {
+			order++
+		}
+		row = 0
+		if p.breakRow >= 0 {
+			row = p.breakRow
+		}
+	case row >= p.mod.patternRows(p.mod.orders[p.order]):
+		order++
+		row = 0
+	}
+
+	p.jumpOrder, p.breakRow, p.loopJump = -1, -1, -1
+	p.extraTicks = 0
+	p.setPosition(order, row)
+}
+
+// startRow reads the cells of the new row.
+func (p *player) startRow() {
+	pat := p.mod.orders[p.order]
+	for i := range p.channels {
+		ch := &p.channels[i]
+		ch.cell = p.mod.cellAt(pat, p.row, i)
+
+		if ch.cell.effect == fxSpecial {
+			param := ch.cell.param
+			if param == 0 {
+				param = ch.specialMem
+			} else {
+				ch.specialMem = param
+			}
+			ch.cell.effect, ch.cell.param = convertSpecial(param)
+		}
+
+		ch.noteDelay = 0
+		if ch.cell.effect == fxNoteDelay && ch.cell.param > 0 {
+			ch.noteDelay = int(ch.cell.param)
+		}
+	}
+}
+
+func (p *player) channelTick(ch *channel, first bool) {
+	ch.vibDelta, ch.tremDelta, ch.panbDelta, ch.arp = 0, 0, 0, 0
+	ch.tremorOff = false
+
+	if ch.noteDelay == p.tick && !p.repeat {
+		p.trigger(ch)
+		ch.noteDelay = -1
+	}
+
+	p.effect(ch, ch.cell.effect, ch.cell.param, first)
+	p.volumeColumn(ch, first)
+}
+
+// isS3M tells if the effects work in the ScreamTracker way.
+func (p *player) isS3M() bool {
+	return p.mod.format == formatS3M || p.mod.format == formatIT
+}
+
+// trigger handles the note and the instrument of the row.
+func (p *player) trigger(ch *channel) {
+	m := p.mod
+	c := ch.cell
+	note := int(c.note)
+	isNote := note >= 1 && note <= noteMax
+	tonePorta := c.effect == fxTonePorta || c.effect == fxTonePortaVol || c.volCmd == vcTonePorta
+
+	if c.instrument != 0 {
+		if inst := m.instrumentAt(int(c.instrument)); inst != nil {
+			ch.inst = inst
+			ch.nna = inst.nna
+
+			key := ch.note
+			if isNote {
+				key = note - 1
+			}
+			if smp := m.sampleAt(inst.keymap[key].sample); smp != nil {
+				ch.volume = smp.volume
+				if smp.pan >= 0 {
+					ch.pan = smp.pan
+				}
+			}
+			if inst.pan >= 0 {
+				ch.pan = inst.pan
+			}
+
+			if v := ch.voice; v != nil && (!isNote || tonePorta) && (m.format == formatXM || m.format == formatIT) {
+				v.resetEnvelopes()
+			}
+		}
+	}
+
+	switch {
+	case note == noteOff:
+		p.keyOff(ch)
+	case note == noteCut:
+		p.cutNote(ch)
+	case note == noteFade:
+		if v := ch.voice; v != nil {
+			v.fading = true
+		}
+	case isNote && ch.inst != nil:
+		km := ch.inst.keymap[note-1]
+		smp := m.sampleAt(km.sample)
+		if smp == nil || len(smp.data) == 0 {
+			if m.format == formatXM {
+				p.cutNote(ch)
+			}
+			break
+		}
+
+		if tonePorta && ch.sample != nil && (ch.voice != nil || p.silent) {
+			ch.portaTarget = p.notePeriod(int(km.note), ch.sample)
+			break
+		}
+
+		ch.note = int(km.note)
+		ch.sample = smp
+		ch.period = p.notePeriod(ch.note, smp)
+		ch.portaTarget = ch.period
+		if !ch.vibNoRetrig {
+			ch.vibPos = 0
+		}
+		if !ch.tremNoRetrig {
+			ch.tremPos = 0
+		}
+		ch.retrigCount, ch.tremorCount = 0, 0
+
+		offset := 0
+		if c.effect == fxOffset {
+			param := c.param
+			if param == 0 {
+				param = ch.offsetMem
+			} else {
+				ch.offsetMem = param
+			}
+			offset = int(param)*256 + ch.highOffset*65536
+		}
+		p.startVoice(ch, smp, offset, ch.nna)
+	}
+
+	// the volume is set after the defaults of the instrument
+	if c.volCmd == vcVolume {
+		ch.volume = int(c.volParam)
+	}
+	if c.effect == fxVolume {
+		ch.volume = int(c.param)
+		if ch.volume > 64 {
+			ch.volume = 64
+		}
+	}
+}
+
+// startVoice starts a new voice on the channel, leaving the old one to the New Note Action.
+func (p *player) startVoice(ch *channel, smp *sample, offset int, nna int) {
+	if p.silent {
+		return
+	}
+
+	if old := ch.voice; old != nil {
+		switch nna {
+		case nnaContinue:
+			old.background = true
+		case nnaOff:
+			old.background = true
+			p.releaseVoice(old)
+		case nnaFade:
+			old.background = true
+			old.fading = true
+		default:
+			old.cut()
+		}
+	}
+
+	v := newVoice(smp, ch.inst, offset)
+	v.owner = ch.index
+	p.voices = append(p.voices, v)
+	ch.voice = v
+
+	// drop the oldest background voices if there are too many
+	for i := 0; len(p.voices) > maxVoices && i < len(p.voices); i++ {
+		if p.voices[i].background && !p.voices[i].dying {
+			p.voices[i].cut()
+			p.voices[i].active = false
+		}
+	}
+}
+
+// releaseVoice handles a key off on the voice.
+func (p *player) releaseVoice(v *voice) {
+	v.keyOn = false
+	if v.inst != nil && v.inst.volEnv.enabled && !v.volEnvOff {
+		if p.mod.format != formatIT || v.inst.volEnv.loop {
+			v.fading = true
+		}
+		return
+	}
+	if p.mod.format == formatIT {
+		v.fading = true
+	} else {
+		v.cut()
+	}
+}
+
+// keyOff releases the note on the channel.
+func (p *player) keyOff(ch *channel) {
+	v := ch.voice
+	if v == nil {
+		return
+	}
+	p.releaseVoice(v)
+	if v.dying {
+		// the note is cut in XM without a volume envelope, but the channel keeps its state
+		ch.voice = nil
+		ch.volume = 0
+	}
+}
+
+// cutNote stops the note on the channel.
+func (p *player) cutNote(ch *channel) {
+	if v := ch.voice; v != nil {
+		v.cut()
+		ch.voice = nil
+	}
+}
+
+// notePeriod returns the period of the note played on the sample.
+func (p *player) notePeriod(note int, s *sample) float64 {
+	if p.mod.linearSlides {
+		return float64(linearBase - note*semitone)
+	}
+	return amigaClock / (s.c5speed * math.Exp2(float64(note-60)/12))
+}
+
+// frequency returns the playback frequency of the sample at the period.
+func (p *player) frequency(period float64, s *sample) float64 {
+	if p.mod.linearSlides {
+		return s.c5speed * math.Exp2((linearC5-period)/pitchOctave)
+	}
+	if period < minPeriod {
+		period = minPeriod
+	}
+	return amigaClock / period
+}
+
+// clampPeriod keeps the period of the channel in range after slides.
+func (p *player) clampPeriod(ch *channel) {
+	lo, hi := float64(minPeriod), float64(maxPeriod)
+	if p.mod.amigaLimits && !p.mod.linearSlides {
+		lo, hi = 113*4, 856*4
+	}
+	ch.period = math.Max(lo, math.Min(hi, ch.period))
+}
+
+func clamp(v, lo, hi int) int {
+	if v < lo {
+		return lo
+	}
+	if v > hi {
+		return hi
+	}
+	return v
+}
+
+// s3mSlide returns the delta of a ScreamTracker style slide (Dxy) on this tick.
+//
+// Dx0 slides up and D0y slides down on every tick but the first.
+// DxF and DFy slide up and down finely on the first tick only.
+func s3mSlide(param uint8, first bool) int {
+	x, y := int(param>>4), int(param&0x0F)
+	switch {
+	case y == 0x0F && x != 0:
+		if first {
+			return x
+		}
+	case x == 0x0F && y != 0:
+		if first {
+			return -y
+		}
+	case y == 0:
+		if !first {
+			return x
+		}
+	case x == 0:
+		if !first {
+			return -y
+		}
+	}
+	return 0
+}
+
+// memory returns param, or the remembered value in mem if param is 0.
+func memory(mem *uint8, param uint8) uint8 {
+	if param == 0 {
+		return *mem
+	}
+	*mem = param
+	return param
+}
+
+func (p *player) volSlide(ch *channel, param uint8, first bool) {
+	switch {
+	case p.isS3M():
+		param = memory(&ch.volSlideMem, param)
+		ch.volume += s3mSlide(param, first)
+	default:
+		if p.mod.format == formatXM {
+			param = memory(&ch.volSlideMem, param)
+		}
+		if !first {
+			if param>>4 != 0 {
+				ch.volume += int(param >> 4)
+			} else {
+				ch.volume -= int(param & 0x0F)
+			}
+		}
+	}
+	ch.volume = clamp(ch.volume, 0, 64)
+}
+
+// porta slides the period of the channel, up in pitch if up is set.
+func (p *player) porta(ch *channel, up bool, param uint8, first bool) {
+	var delta float64
+	switch {
+	case p.isS3M():
+		param = memory(&ch.portaMem, param)
+		switch {
+		case param >= 0xF0:
+			if first {
+				delta = float64(param&0x0F) * 4
+			}
+		case param >= 0xE0:
+			if first {
+				delta = float64(param & 0x0F)
+			}
+		default:
+			if !first {
+				delta = float64(param) * 4
+			}
+		}
+	default:
+		if p.mod.format == formatXM {
+			if up {
+				param = memory(&ch.portaUpMem, param)
+			} else {
+				param = memory(&ch.portaDownMem, param)
+			}
+		}
+		if !first {
+			delta = float64(param) * 4
+		}
+	}
+
+	if up {
+		ch.period -= delta
+	} else {
+		ch.period += delta
+	}
+	p.clampPeriod(ch)
+}
+
+// finePorta slides the period on the first tick only, by the number of 1/4 periods.
+func (p *player) finePorta(ch *channel, up bool, amount float64, first bool) {
+	if !first {
+		return
+	}
+	if up {
+		ch.period -= amount
+	} else {
+		ch.period += amount
+	}
+	p.clampPeriod(ch)
+}
+
+func (p *player) tonePorta(ch *channel, param uint8, first bool) {
+	speed := memory(&ch.tonePortaMem, param)
+	if first || speed == 0 {
+		return
+	}
+
+	step := float64(speed) * 4
+	if ch.period < ch.portaTarget {
+		ch.period = math.Min(ch.period+step, ch.portaTarget)
+	} else if ch.period > ch.portaTarget {
+		ch.period = math.Max(ch.period-step, ch.portaTarget)
+	}
+}
+
+// vibrato applies the vibrato, with the depth multiplied by scale (4 for normal, 1 for fine).
+func (p *player) vibrato(ch *channel, param uint8, first bool, scale int) {
+	if param>>4 != 0 {
+		ch.vibSpeed = int(param >> 4)
+	}
+	if param&0x0F != 0 {
+		ch.vibDepth = int(param&0x0F) * scale
+	}
+	if first && !p.mod.oldEffects {
+		return
+	}
+
+	w := waveValue(ch.vibWave, ch.vibPos, &p.rnd)
+	ch.vibDelta = float64(w*ch.vibDepth) / 128
+	if p.mod.oldEffects {
+		ch.vibDelta *= 2
+	}
+	ch.vibPos += ch.vibSpeed
+}
+
+func (p *player) tremolo(ch *channel, param uint8, first bool) {
+	if param>>4 != 0 {
+		ch.tremSpeed = int(param >> 4)
+	}
+	if param&0x0F != 0 {
+		ch.tremDepth = int(param & 0x0F)
+	}
+	if first {
+		return
+	}
+
+	w := waveValue(ch.tremWave, ch.tremPos, &p.rnd)
+	ch.tremDelta = w * ch.tremDepth / 64
+	ch.tremPos += ch.tremSpeed
+}
+
+// retrigVolume applies the volume change of the retrig effect (Qxy/Rxy).
+func retrigVolume(vol int, x uint8) int {
+	switch x {
+	case 0x1, 0x2, 0x3, 0x4, 0x5:
+		vol -= 1 << (x - 1)
+	case 0x6:
+		vol = vol * 2 / 3
+	case 0x7:
+		vol /= 2
+	case 0x9, 0xA, 0xB, 0xC, 0xD:
+		vol += 1 << (x - 9)
+	case 0xE:
+		vol = vol * 3 / 2
+	case 0xF:
+		vol *= 2
+	}
+	return clamp(vol, 0, 64)
+}
+
+// retrigger restarts the sample of the channel.
+func (p *player) retrigger(ch *channel) {
+	if ch.sample != nil {
+		p.startVoice(ch, ch.sample, 0, nnaCut)
+	}
+}
+
+func (p *player) effect(ch *channel, fx, param uint8, first bool) {
+	m := p.mod
+	flow := first && !p.repeat // flow control happens once per row
+
+	switch fx {
+	case fxArpeggio:
+		param = memory(&ch.arpMem, param)
+		switch p.tick % 3 {
+		case 1:
+			ch.arp = int(param >> 4)
+		case 2:
+			ch.arp = int(param & 0x0F)
+		}
+
+	case fxPortaUp:
+		p.porta(ch, true, param, first)
+	case fxPortaDown:
+		p.porta(ch, false, param, first)
+	case fxFinePortaUp:
+		if m.format == formatXM {
+			param = memory(&ch.finePortaUpMem, param)
+		}
+		p.finePorta(ch, true, float64(param)*4, first)
+	case fxFinePortaDown:
+		if m.format == formatXM {
+			param = memory(&ch.finePortaDownMem, param)
+		}
+		p.finePorta(ch, false, float64(param)*4, first)
+	case fxExtraFinePortaUp:
+		param = memory(&ch.xfinePortaUpMem, param)
+		p.finePorta(ch, true, float64(param), first)
+	case fxExtraFinePortaDown:
+		param = memory(&ch.xfinePortaDownMem, param)
+		p.finePorta(ch, false, float64(param), first)
+
+	case fxTonePorta:
+		p.tonePorta(ch, param, first)
+	case fxTonePortaVol:
+		p.tonePorta(ch, 0, first)
+		p.volSlide(ch, param, first)
+	case fxVibrato:
+		p.vibrato(ch, param, first, 4)
+	case fxFineVibrato:
+		p.vibrato(ch, param, first, 1)
+	case fxVibratoVol:
+		p.vibrato(ch, 0, first, 4)
+		p.volSlide(ch, param, first)
+	case fxTremolo:
+		p.tremolo(ch, param, first)
+	case fxVolSlide:
+		p.volSlide(ch, param, first)
+
+	case fxFineVolUp, fxFineVolDown:
+		if m.format == formatXM {
+			if fx == fxFineVolUp {
+				param = memory(&ch.fineVolUpMem, param)
+			} else {
+				param = memory(&ch.fineVolDownMem, param)
+			}
+		}
+		if first {
+			if fx == fxFineVolUp {
+				ch.volume = clamp(ch.volume+int(param), 0, 64)
+			} else {
+				ch.volume = clamp(ch.volume-int(param), 0, 64)
+			}
+		}
+
+	case fxPanning:
+		if first {
+			ch.pan = int(param) * 256 / 255
+		}
+	case fxPanning4:
+		if first {
+			ch.pan = int(param) * 256 / 15
+		}
+	case fxSurround:
+		if first {
+			ch.pan = 128
+		}
+	case fxPanSlide:
+		param = memory(&ch.panSlideMem, param)
+		if m.format == formatIT {
+			// Px0 slides to the left
+			ch.pan = clamp(ch.pan-s3mSlide(param, first)*4, 0, 256)
+		} else if !first {
+			if param>>4 != 0 {
+				ch.pan = clamp(ch.pan+int(param>>4), 0, 256)
+			} else {
+				ch.pan = clamp(ch.pan-int(param&0x0F), 0, 256)
+			}
+		}
+	case fxPanbrello:
+		if param>>4 != 0 {
+			ch.panbSpeed = int(param >> 4)
+		}
+		if param&0x0F != 0 {
+			ch.panbDepth = int(param & 0x0F)
+		}
+		if !first {
+			ch.panbDelta = waveValue(ch.panbWave, ch.panbPos, &p.rnd) * ch.panbDepth / 32
+			ch.panbPos += ch.panbSpeed
+		}
+
+	case fxJump:
+		if flow {
+			p.jumpOrder = int(param)
+		}
+	case fxBreak:
+		if flow {
+			p.breakRow = int(param)
+		}
+	case fxPatternLoop:
+		if !flow {
+			break
+		}
+		switch {
+		case param == 0:
+			ch.loopRow = p.row
+		case ch.loopCount == 0:
+			ch.loopCount = int(param)
+			p.loopJump = ch.loopRow
+		default:
+			ch.loopCount--
+			if ch.loopCount > 0 {
+				p.loopJump = ch.loopRow
+			} else if m.format == formatIT {
+				ch.loopRow = p.row + 1
+			}
+		}
+	case fxPatternDelay:
+		if flow && !p.delaySet {
+			p.rowDelay = int(param)
+			p.delaySet = true
+		}
+	case fxFinePatternDelay:
+		if flow {
+			p.extraTicks += int(param)
+		}
+
+	case fxSpeed:
+		if flow {
+			if param > 0 {
+				p.speed = int(param)
+			} else if m.format == formatMOD {
+				p.stopped = true
+			}
+		}
+	case fxTempo:
+		if m.format == formatIT {
+			param = memory(&ch.tempoMem, param)
+		}
+		switch {
+		case param >= 0x20:
+			if first {
+				p.tempo = int(param)
+			}
+		case m.format == formatIT && !first:
+			if param>>4 == 0 {
+				p.tempo -= int(param & 0x0F)
+			} else {
+				p.tempo += int(param & 0x0F)
+			}
+			p.tempo = clamp(p.tempo, 32, 255)
+		}
+
+	case fxGlobalVolume:
+		if first {
+			v := int(param)
+			if m.format != formatIT {
+				v *= 2
+			}
+			p.globalVolume = clamp(v, 0, 128)
+		}
+	case fxGlobalVolSlide:
+		param = memory(&ch.globalVolSlideMem, param)
+		if m.format == formatXM {
+			if !first {
+				if param>>4 != 0 {
+					p.globalVolume += int(param>>4) * 2
+				} else {
+					p.globalVolume -= int(param&0x0F) * 2
+				}
+			}
+		} else {
+			p.globalVolume += s3mSlide(param, first)
+		}
+		p.globalVolume = clamp(p.globalVolume, 0, 128)
+
+	case fxChannelVolume:
+		if first {
+			ch.chanVolume = clamp(int(param), 0, 64)
+		}
+	case fxChannelVolSlide:
+		param = memory(&ch.chanVolSlideMem, param)
+		ch.chanVolume = clamp(ch.chanVolume+s3mSlide(param, first), 0, 64)
+
+	case fxRetrig:
+		param = memory(&ch.retrigMem, param)
+		interval := int(param & 0x0F)
+		if interval == 0 || (first && ch.cell.note != noteNone && !p.repeat) {
+			break
+		}
+		ch.retrigCount++
+		if ch.retrigCount >= interval {
+			ch.retrigCount = 0
+			p.retrigger(ch)
+			ch.volume = retrigVolume(ch.volume, param>>4)
+		}
+	case fxRetrigSimple:
+		if param > 0 && p.tick > 0 && p.tick%int(param) == 0 {
+			p.retrigger(ch)
+		}
+
+	case fxTremor:
+		param = memory(&ch.tremorMem, param)
+		on, off := int(param>>4), int(param&0x0F)
+		if !m.oldEffects {
+			on++
+			off++
+		}
+		if !first || m.format != formatXM {
+			ch.tremorOff = ch.tremorCount%(on+off) >= on
+			ch.tremorCount++
+		}
+
+	case fxNoteCut:
+		tick := int(param)
+		if tick == 0 && m.format == formatIT {
+			tick = 1
+		}
+		if p.tick == tick {
+			if m.format == formatIT {
+				p.cutNote(ch)
+			} else {
+				ch.volume = 0
+			}
+		}
+	case fxKeyOff:
+		if p.tick == int(param) {
+			p.keyOff(ch)
+		}
+	case fxEnvPosition:
+		if first && ch.voice != nil {
+			ch.voice.volEnvPos = int(param)
+			ch.voice.panEnvPos = int(param)
+		}
+
+	case fxVibratoWave:
+		if first {
+			ch.vibWave, ch.vibNoRetrig = int(param&3), param&4 != 0
+		}
+	case fxTremoloWave:
+		if first {
+			ch.tremWave, ch.tremNoRetrig = int(param&3), param&4 != 0
+		}
+	case fxPanbrelloWave:
+		if first {
+			ch.panbWave = int(param & 3)
+		}
+	case fxHighOffset:
+		if first {
+			ch.highOffset = int(param)
+		}
+	case fxNNA:
+		if first {
+			p.nnaEffect(ch, param)
+		}
+	}
+}
+
+// nnaEffect handles the IT S7x command.
+func (p *player) nnaEffect(ch *channel, param uint8) {
+	switch param {
+	case 0x0, 0x1, 0x2:
+		// act on the background voices of the channel
+		for _, v := range p.voices {
+			if !v.background || v.owner != ch.index {
+				continue
+			}
+			switch param {
+			case 0x0:
+				v.cut()
+			case 0x1:
+				p.releaseVoice(v)
+			case 0x2:
+				v.fading = true
+			}
+		}
+	case 0x3:
+		ch.nna = nnaCut
+	case 0x4:
+		ch.nna = nnaContinue
+	case 0x5:
+		ch.nna = nnaOff
+	case 0x6:
+		ch.nna = nnaFade
+	case 0x7, 0x8:
+		if ch.voice != nil {
+			ch.voice.volEnvOff = param == 0x7
+		}
+	}
+}
+
+func (p *player) volumeColumn(ch *channel, first bool) {
+	param := ch.cell.volParam
+
+	switch ch.cell.volCmd {
+	case vcVolSlideUp, vcVolSlideDown:
+		if p.mod.format == formatIT {
+			param = memory(&ch.vcVolSlideMem, param)
+		}
+		if !first {
+			if ch.cell.volCmd == vcVolSlideUp {
+				ch.volume = clamp(ch.volume+int(param), 0, 64)
+			} else {
+				ch.volume = clamp(ch.volume-int(param), 0, 64)
+			}
+		}
+	case vcFineVolUp, vcFineVolDown:
+		if p.mod.format == formatIT {
+			param = memory(&ch.vcVolSlideMem, param)
+		}
+		if first {
+			if ch.cell.volCmd == vcFineVolUp {
+				ch.volume = clamp(ch.volume+int(param), 0, 64)
+			} else {
+				ch.volume = clamp(ch.volume-int(param), 0, 64)
+			}
+		}
+	case vcVibratoSpeed:
+		if param != 0 {
+			ch.vibSpeed = int(param)
+		}
+	case vcVibratoDepth:
+		p.vibrato(ch, param, first, 4)
+	case vcPanning:
+		if first {
+			ch.pan = int(param) * 4
+		}
+	case vcPanSlideLeft:
+		if !first {
+			ch.pan = clamp(ch.pan-int(param), 0, 256)
+		}
+	case vcPanSlideRight:
+		if !first {
+			ch.pan = clamp(ch.pan+int(param), 0, 256)
+		}
+	case vcTonePorta:
+		p.tonePorta(ch, param, first)
+	case vcPortaUp:
+		p.porta(ch, true, param, first)
+	case vcPortaDown:
+		p.porta(ch, false, param, first)
+	}
+}
+
+// autovibrato returns the period offset of the auto vibrato of the voice, and advances it.
+func (p *player) autovibrato(v *voice) float64 {
+	s := v.smp
+	if s.vibDepth == 0 || s.vibRate == 0 {
+		return 0
+	}
+
+	depth := float64(s.vibDepth)
+	if s.vibSweep > 0 && v.autovibTicks < s.vibSweep {
+		depth *= float64(v.autovibTicks) / float64(s.vibSweep)
+	}
+	v.autovibTicks++
+
+	delta := float64(waveValue(s.vibType, v.autovibPos>>2, &p.rnd)) * depth / 64
+	v.autovibPos += s.vibRate
+	if p.mod.format == formatIT {
+		// the depth of IT is 0 ~ 64, 4 times finer
+		delta /= 4
+	}
+	return delta
+}
+
+// updateVoices computes the parameters of the voices from the channels and the envelopes.
+func (p *player) updateVoices() {
+	m := p.mod
+
+	for i := range p.channels {
+		ch := &p.channels[i]
+		v := ch.voice
+		if v == nil {
+			continue
+		}
+		if !v.active {
+			ch.voice = nil
+			continue
+		}
+
+		vol := clamp(ch.volume+ch.tremDelta, 0, 64)
+		if ch.tremorOff || m.channelMuted[i] {
+			vol = 0
+		}
+		gain := float64(vol) / 64 * float64(ch.chanVolume) / 64 * float64(v.smp.globalVolume) / 64 * float64(p.globalVolume) / 128
+		if v.inst != nil {
+			gain *= float64(v.inst.globalVolume) / 128
+		}
+		v.chGain = gain
+		v.chPan = float64(clamp(ch.pan+ch.panbDelta, 0, 256))
+
+		period := ch.period + ch.vibDelta + p.autovibrato(v)
+		v.chFreq = p.frequency(period, v.smp) * math.Exp2(float64(ch.arp)/12)
+	}
+
+	rate := float64(p.rate)
+	it := m.format == formatIT
+	n := 0
+	for _, v := range p.voices {
+		if !v.active {
+			continue
+		}
+		v.update(rate, it)
+		p.voices[n] = v
+		n++
+	}
+	for i := n; i < len(p.voices); i++ {
+		p.voices[i] = nil
+	}
+	p.voices = p.voices[:n]
+}
+
+// mix mixes the voices into the stereo buffer, which is not cleared first.
+func (p *player) mix(out []float32) {
+	rate := float64(p.rate)
+	for _, v := range p.voices {
+		v.mix(out, rate)
+	}
+}
@@ -0,0 +1,348 @@
+package mod
+
+import (
+	"errors"
+	"io"
+	"math"
+
+	"github.com/Edgaru089/audio"
+)
+
+const (
+	DefaultSampleRate = 44100 // the sample rate modules are rendered at by default
+
+	maxSongLength = 3600 // songs are cut off after this many seconds
+)
+
+// Magics of the module formats.
+var (
+	MagicIT  = []byte("IMPM")              // at the very beginning of the file
+	MagicXM  = []byte("Extended Module: ") // ditto
+	MagicS3M = []byte("SCRM")              // at offset 44
+)
+
+var (
+	SoundFileCheckIT  = audio.SoundFileCheckMagic(MagicIT, 0)
+	SoundFileCheckXM  = audio.SoundFileCheckMagic(MagicXM, 0)
+	SoundFileCheckS3M = audio.SoundFileCheckMagic(MagicS3M, 44)
+)
+
+// SoundFileCheckMOD checks if a given file is a ProTracker module,
+// by the channel magic at offset 1080 ("M.K.", "8CHN", etc).
+func SoundFileCheckMOD(file io.ReadSeeker) (ok bool) {
+	_, err := file.Seek(modMagicOffset, io.SeekStart)
+	if err != nil {
+		return false
+	}
+
+	buf := make([]byte, 4)
+	_, err = io.ReadFull(file, buf)
+	if err != nil {
+		return false
+	}
+
+	return modChannels(buf) != 0
+}
+
+func init() {
+	alloc := func() audio.SoundFileReader {
+		return NewSoundFileReaderMod(DefaultSampleRate)
+	}
+
+	audio.RegisterSoundFileReader(SoundFileCheckIT, alloc)
+	audio.RegisterSoundFileReader(SoundFileCheckXM, alloc)
+	audio.RegisterSoundFileReader(SoundFileCheckS3M, alloc)
+	audio.RegisterSoundFileReader(SoundFileCheckMOD, alloc)
+}
+
+// checkpoint is the player state at the beginning of an order, for seeking.
+type checkpoint struct {
+	frame int64
+	state playerState
+}
+
+// SoundFileReaderMod is a renderer for MOD, S3M, XM and IT tracker modules.
+//
+// The output is always stereo, in 16 bits, or in 32-bit float with ReadFloat.
+type SoundFileReaderMod struct {
+	rate int
+
+	mod    *module
+	player *player
+	info   audio.SoundFileInfo
+
+	frames      int64   // length of the song in frames, up to where it loops
+	loopStart   int64   // frame the song loops back to
+	ended       bool    // the song stops instead of looping
+	orderFrames []int64 // first frame of each order, -1 if it is never played
+	checkpoints []checkpoint
+
+	pos      int64 // current frame
+	tickLeft int   // frames left in the current tick
+	gain     float64
+	mix      []float32
+}
+
+// NewSoundFileReaderMod creates a new module reader, which renders at the given sample rate.
+//
+// The reader registered for the audio package renders at DefaultSampleRate.
+func NewSoundFileReaderMod(sampleRate int) *SoundFileReaderMod {
+	if sampleRate <= 0 {
+		sampleRate = DefaultSampleRate
+	}
+	return &SoundFileReaderMod{rate: sampleRate}
+}
+
+// load detects the format of the module and loads it.
+func load(data []byte) (*module, error) {
+	switch {
+	case len(data) >= len(MagicIT) && string(data[:len(MagicIT)]) == string(MagicIT):
+		return loadIT(data)
+	case len(data) >= len(MagicXM) && string(data[:len(MagicXM)]) == string(MagicXM):
+		return loadXM(data)
+	case len(data) >= 48 && string(data[44:48]) == string(MagicS3M):
+		return loadS3M(data)
+	case len(data) >= modHeaderSize && modChannels(data[modMagicOffset:modHeaderSize]) != 0:
+		return loadMOD(data)
+	}
+	return nil, errors.New("mod: unknown module format")
+}
+
+func (r *SoundFileReaderMod) Open(file io.ReadSeeker) (info audio.SoundFileInfo, err error) {
+	data, err := io.ReadAll(file)
+	if err != nil {
+		return audio.SoundFileInfo{}, err
+	}
+
+	r.mod, err = load(data)
+	if err != nil {
+		return audio.SoundFileInfo{}, err
+	}
+	if len(r.mod.orders) == 0 {
+		return audio.SoundFileInfo{}, errors.New("mod: empty order list")
+	}
+
+	r.scan()
+
+	r.player = newPlayer(r.mod, r.rate)
+	r.gain = r.mod.mixVolume * 2 / math.Sqrt(float64(r.mod.channels))
+
+	r.info = audio.SoundFileInfo{
+		SampleCount:  r.frames * 2,
+		ChannelCount: 2,
+		SampleRate:   r.rate,
+	}
+	return r.info, nil
+}
+
+// scan plays the song silently to find its length and loop point,
+// taking a checkpoint at the beginning of each order.
+func (r *SoundFileReaderMod) scan() {
+	p := newPlayer(r.mod, r.rate)
+	p.silent = true
+	p.visited = make(map[int]bool)
+	p.visited[p.order<<8|p.row] = true
+
+	r.orderFrames = make([]int64, len(r.mod.orders))
+	for i := range r.orderFrames {
+		r.orderFrames[i] = -1
+	}
+	r.checkpoints = nil
+
+	rowFrames := make(map[int]int64) // first frame of each visited row
+	lastOrder := -1
+	var frame int64
+	for frame < int64(maxSongLength*r.rate) {
+		if p.tick == 0 && !p.repeat {
+			if _, ok := rowFrames[p.order<<8|p.row]; !ok {
+				rowFrames[p.order<<8|p.row] = frame
+			}
+			if p.order != lastOrder {
+				if r.orderFrames[p.order] == -1 {
+					r.orderFrames[p.order] = frame
+				}
+				r.checkpoints = append(r.checkpoints, checkpoint{frame: frame, state: p.snapshot()})
+				lastOrder = p.order
+			}
+		}
+
+		frame += int64(p.processTick())
+
+		if p.stopped {
+			r.ended = true
+			break
+		}
+		if p.looped {
+			r.loopStart = rowFrames[p.order<<8|p.row]
+			break
+		}
+	}
+	r.frames = frame
+}
+
+func (r *SoundFileReaderMod) Info() audio.SoundFileInfo {
+	return r.info
+}
+
+// Title returns the song title of the module.
+func (r *SoundFileReaderMod) Title() string {
+	return r.mod.title
+}
+
+// LoopPoints returns the section the song loops over, in samples.
+//
+// The song jumps back to start after playing to end, which is also the
+// length of the song. If the song stops instead, start is 0.
+func (r *SoundFileReaderMod) LoopPoints() (start, end int64) {
+	return r.loopStart * 2, r.frames * 2
+}
+
+// OrderCount returns the number of entries in the order list of the module.
+func (r *SoundFileReaderMod) OrderCount() int {
+	return len(r.mod.orders)
+}
+
+// OrderOffset returns the offset in samples at which the order is first played.
+//
+// It returns -1 if the order is never played.
+func (r *SoundFileReaderMod) OrderOffset(order int) int64 {
+	if order < 0 || order >= len(r.orderFrames) || r.orderFrames[order] == -1 {
+		return -1
+	}
+	return r.orderFrames[order] * 2
+}
+
+// SeekOrder changes the read position to the beginning of the order.
+func (r *SoundFileReaderMod) SeekOrder(order int) error {
+	offset := r.OrderOffset(order)
+	if offset == -1 {
+		return errors.New("mod: order is not played in the song")
+	}
+	return r.Seek(offset)
+}
+
+func (r *SoundFileReaderMod) Seek(sampleOffset int64) error {
+	target := sampleOffset / 2
+	if target < 0 {
+		target = 0
+	}
+	if target > r.frames {
+		target = r.frames
+	}
+	if target == r.pos {
+		return nil
+	}
+
+	// the player is already at the loop start when it reaches the end,
+	// keep it running so the voices carry over
+	if r.pos == r.frames && target == r.loopStart && !r.ended {
+		r.pos = target
+		return nil
+	}
+
+	// restart from the nearest checkpoint, and render up to the target
+	if target < r.pos || r.pos == r.frames {
+		cp := &r.checkpoints[0]
+		for i := range r.checkpoints {
+			if r.checkpoints[i].frame > target {
+				break
+			}
+			cp = &r.checkpoints[i]
+		}
+		r.player.restore(cp.state)
+		r.pos = cp.frame
+		r.tickLeft = 0
+	}
+	for r.pos < target {
+		n := target - r.pos
+		if n > 4096 {
+			n = 4096
+		}
+		r.render(int(n))
+	}
+	return nil
+}
+
+// render renders at most the given number of frames into r.mix,
+// returning the number of frames rendered.
+func (r *SoundFileReaderMod) render(frames int) int {
+	for r.tickLeft == 0 {
+		r.tickLeft = r.player.processTick()
+	}
+	if frames > r.tickLeft {
+		frames = r.tickLeft
+	}
+
+	if cap(r.mix) < frames*2 {
+		r.mix = make([]float32, frames*2)
+	}
+	r.mix = r.mix[:frames*2]
+	for i := range r.mix {
+		r.mix[i] = 0
+	}
+	r.player.mix(r.mix)
+
+	r.tickLeft -= frames
+	r.pos += int64(frames)
+	return frames
+}
+
+func (r *SoundFileReaderMod) Read(data []int16) (samplesRead int64, err error) {
+	if r.pos >= r.frames {
+		return 0, io.EOF
+	}
+
+	frames := int64(len(data) / 2)
+	if left := r.frames - r.pos; frames > left {
+		frames = left
+	}
+
+	var done int64
+	for done < frames {
+		n := r.render(int(frames - done))
+		for i, v := range r.mix[:n*2] {
+			s := float64(v) * r.gain * 32767
+			if s > 32767 {
+				s = 32767
+			} else if s < -32768 {
+				s = -32768
+			}
+			data[done*2+int64(i)] = int16(s)
+		}
+		done += int64(n)
+	}
+
+	return done * 2, nil
+}
+
+// ReadFloat reads the rendered samples without reducing them to 16 bits.
+// The samples are not clipped, and may go out of [-1, 1] on loud passages.
+//
+// It satisfies audio.SoundFileFloatReader.
+func (r *SoundFileReaderMod) ReadFloat(data []float32) (samplesRead int64, err error) {
+	if r.pos >= r.frames {
+		return 0, io.EOF
+	}
+
+	frames := int64(len(data) / 2)
+	if left := r.frames - r.pos; frames > left {
+		frames = left
+	}
+
+	var done int64
+	for done < frames {
+		n := r.render(int(frames - done))
+		for i, v := range r.mix[:n*2] {
+			data[done*2+int64(i)] = v * float32(r.gain)
+		}
+		done += int64(n)
+	}
+
+	return done * 2, nil
+}
+
+func (r *SoundFileReaderMod) Close() error {
+	r.mod, r.player = nil, nil
+	r.checkpoints = nil
+	return nil
+}
@@ -0,0 +1,295 @@
+package mod
+
+import "math"
+
+const (
+	maxVoices   = 256                // maximum number of voices playing at the same time
+	rampLength  = 1.5 / 1000         // volume ramping length in seconds, to remove clicks
+	fadeMax     = 65536              // fade volume at the beginning of a note
+	amigaClock  = 14317456           // periods are 4 times the Amiga periods, 1712 being C-5 at 8363 Hz
+	maxPeriod   = 1 << 20            // periods are kept in this range
+	minPeriod   = 1                  // ditto
+	linearBase  = 7680               // linear period of note 0
+	linearC5    = linearBase - 60*64 // linear period of note 60, played at the C5Speed
+	semitone    = 64                 // linear periods in a semitone
+	pitchOctave = 12 * semitone      // linear periods in an octave
+)
+
+// Vibrato, tremolo and panbrello waveforms.
+const (
+	waveSine = iota
+	waveRampDown
+	waveSquare
+	waveRandom
+	waveRampUp
+)
+
+// waveValue returns the value of the waveform at position pos (0 ~ 63), in range -255 ~ 255.
+//
+// The random waveform takes its value from rnd.
+func waveValue(wave, pos int, rnd *uint32) int {
+	pos &= 63
+	switch wave {
+	case waveSine:
+		return int(math.Round(255 * math.Sin(2*math.Pi*float64(pos)/64)))
+	case waveRampDown:
+		return 255 - pos*8
+	case waveRampUp:
+		return pos*8 - 255
+	case waveSquare:
+		if pos < 32 {
+			return 255
+		}
+		return -255
+	default:
+		// xorshift
+		*rnd ^= *rnd << 13
+		*rnd ^= *rnd >> 17
+		*rnd ^= *rnd << 5
+		return int(*rnd%511) - 255
+	}
+}
+
+// voice is a sample playing on the mixer, either driven by a channel,
+// or left in the background by a New Note Action.
+type voice struct {
+	smp  *sample
+	inst *instrument
+
+	pos    float64 // sample position in frames
+	dir    float64 // 1 forward, -1 backward in a ping-pong loop
+	active bool
+
+	keyOn     bool
+	fading    bool
+	fade      int
+	volEnvOff bool
+
+	volEnvPos, panEnvPos, pitchEnvPos int
+	autovibPos, autovibTicks          int
+
+	// parameters computed by the channel, before envelopes
+	chGain, chPan, chFreq float64
+
+	owner      int  // index of the channel that started the voice
+	background bool // left behind by the channel
+	dying      bool // ramping down before being removed
+
+	// mixer state
+	freq         float64
+	curL, curR   float64
+	stepL, stepR float64
+	ramp         int // frames left for the volume ramp
+}
+
+func newVoice(smp *sample, inst *instrument, offset int) *voice {
+	v := &voice{
+		smp:    smp,
+		inst:   inst,
+		pos:    float64(offset),
+		dir:    1,
+		active: offset < len(smp.data),
+		keyOn:  true,
+		fade:   fadeMax,
+	}
+	return v
+}
+
+// cut stops the voice after a short ramp.
+func (v *voice) cut() {
+	v.dying = true
+	v.background = true
+}
+
+// resetEnvelopes restarts the envelopes and the fade of the voice.
+func (v *voice) resetEnvelopes() {
+	v.volEnvPos, v.panEnvPos, v.pitchEnvPos = 0, 0, 0
+	v.autovibPos, v.autovibTicks = 0, 0
+	v.keyOn = true
+	v.fading = false
+	v.fade = fadeMax
+}
+
+// envValue returns the value of the envelope at the tick position.
+func (e *envelope) value(pos int) float64 {
+	pts := e.points
+	if pos <= pts[0].tick {
+		return float64(pts[0].value)
+	}
+	for i := 1; i < len(pts); i++ {
+		if pos < pts[i].tick {
+			a, b := pts[i-1], pts[i]
+			if b.tick == a.tick {
+				return float64(b.value)
+			}
+			return float64(a.value) + float64(b.value-a.value)*float64(pos-a.tick)/float64(b.tick-a.tick)
+		}
+	}
+	return float64(pts[len(pts)-1].value)
+}
+
+// next advances the tick position of the envelope.
+func (e *envelope) next(pos int, keyOn bool) int {
+	pos++
+	if e.sustain && keyOn {
+		if end := e.points[e.sustainE].tick; pos > end {
+			pos = e.points[e.sustainS].tick
+		}
+		return pos
+	}
+	if e.loop {
+		if end := e.points[e.loopE].tick; pos > end {
+			pos = e.points[e.loopS].tick
+		}
+		return pos
+	}
+	if last := e.points[len(e.points)-1].tick; pos > last {
+		pos = last
+	}
+	return pos
+}
+
+// ended tells if the envelope has reached its last point.
+func (e *envelope) ended(pos int) bool {
+	return !e.loop && pos >= e.points[len(e.points)-1].tick
+}
+
+// update applies the envelopes to the parameters from the channel, and advances them by a tick.
+//
+// rate is the output sample rate.
+func (v *voice) update(rate float64, it bool) {
+	if !v.active {
+		return
+	}
+
+	gain, pan, freq := v.chGain, v.chPan, v.chFreq
+
+	if inst := v.inst; inst != nil {
+		if env := &inst.volEnv; env.enabled && !v.volEnvOff {
+			gain *= env.value(v.volEnvPos) / 64
+			if it && env.ended(v.volEnvPos) {
+				if env.value(v.volEnvPos) == 0 {
+					v.dying = true
+				} else if !v.keyOn {
+					v.fading = true
+				}
+			}
+			v.volEnvPos = env.next(v.volEnvPos, v.keyOn)
+		}
+		if env := &inst.panEnv; env.enabled {
+			e := env.value(v.panEnvPos) / 32
+			pan += e * (128 - math.Abs(pan-128))
+			v.panEnvPos = env.next(v.panEnvPos, v.keyOn)
+		}
+		if env := &inst.pitchEnv; env.enabled {
+			freq *= math.Exp2(env.value(v.pitchEnvPos) / 24)
+			v.pitchEnvPos = env.next(v.pitchEnvPos, v.keyOn)
+		}
+
+		if v.fading {
+			gain *= float64(v.fade) / fadeMax
+			v.fade -= inst.fadeout
+			if v.fade <= 0 {
+				v.fade = 0
+				v.dying = true
+			}
+		}
+	}
+
+	if v.dying {
+		gain = 0
+	}
+
+	v.freq = freq
+
+	// equal power panning
+	p := math.Max(0, math.Min(1, pan/256)) * math.Pi / 2
+	targetL, targetR := gain*math.Cos(p), gain*math.Sin(p)
+
+	v.ramp = int(rate * rampLength)
+	if v.ramp < 1 {
+		v.ramp = 1
+	}
+	v.stepL = (targetL - v.curL) / float64(v.ramp)
+	v.stepR = (targetR - v.curR) / float64(v.ramp)
+}
+
+// loopRange returns the loop in effect.
+func (v *voice) loopRange() (mode, start, end int) {
+	s := v.smp
+	if v.keyOn && s.sustain != loopNone {
+		return s.sustain, s.susStart, s.susEnd
+	}
+	if s.loop != loopNone {
+		return s.loop, s.loopStart, s.loopEnd
+	}
+	return loopNone, 0, len(s.data)
+}
+
+// mix adds frames of the voice into the stereo buffer.
+func (v *voice) mix(out []float32, rate float64) {
+	data := v.smp.data
+	step := v.freq / rate
+	frames := len(out) / 2
+
+	mode, ls, le := v.loopRange()
+
+	for i := 0; i < frames; i++ {
+		if !v.active {
+			return
+		}
+
+		if v.ramp > 0 {
+			v.curL += v.stepL
+			v.curR += v.stepR
+			v.ramp--
+			if v.ramp == 0 && v.dying {
+				v.active = false
+			}
+		}
+
+		idx := int(v.pos)
+		frac := v.pos - float64(idx)
+		if idx >= len(data) {
+			idx = len(data) - 1
+		}
+
+		// the next sample, for interpolation
+		next := idx + 1
+		if next >= le {
+			if mode == loopForward {
+				next = ls
+			} else {
+				next = idx
+			}
+		}
+
+		s0, s1 := float64(data[idx]), float64(data[next])
+		smp := (s0 + (s1-s0)*frac) / 32768
+
+		out[i*2] += float32(smp * v.curL)
+		out[i*2+1] += float32(smp * v.curR)
+
+		// advance
+		v.pos += step * v.dir
+		if v.dir > 0 && v.pos >= float64(le) {
+			switch mode {
+			case loopNone:
+				v.active = false
+			case loopForward:
+				v.pos = float64(ls) + math.Mod(v.pos-float64(ls), float64(le-ls))
+			case loopPingPong:
+				over := math.Mod(v.pos-float64(le), float64(le-ls))
+				v.pos = float64(le) - 1 - over
+				if v.pos < float64(ls) {
+					v.pos = float64(ls)
+				}
+				v.dir = -1
+			}
+		} else if v.dir < 0 && v.pos < float64(ls) {
+			over := math.Mod(float64(ls)-v.pos, float64(le-ls))
+			v.pos = float64(ls) + over
+			v.dir = 1
+		}
+	}
+}
@@ -17,6 +17,9 @@ import (
 	"github.com/Edgaru089/audio"
 )
 
+// maxChannels is the maximum number of channels of a Vorbis stream.
+const maxChannels = 255
+
 type SoundFileReaderOgg struct {
 	id int
 
@@ -131,6 +134,50 @@ func (r *SoundFileReaderOgg) Read(data []int16) (samplesRead int64, err error) {
 	return
 }
 
+// ReadFloat reads float audio samples, decoded by Vorbis natively.
+//
+// It satisfies audio.SoundFileFloatReader.
+func (r *SoundFileReaderOgg) ReadFloat(data []float32) (samplesRead int64, err error) {
+	if r.vorbis == nil {
+		panic("ogg: call ReadFloat on nil Reader")
+	}
+
+	channels := int64(r.info.ChannelCount)
+	maxcount := int64(len(data)) / channels * channels
+
+	for samplesRead < maxcount {
+
+		var pcm **C.float
+		frames := int64(C.ov_read_float(r.vorbis, &pcm, C.int((maxcount-samplesRead)/channels), nil))
+		if frames > 0 {
+			// pcm[channel][frame], interleave them into data
+			chans := (*[maxChannels]*C.float)(unsafe.Pointer(pcm))[:channels:channels]
+			for c, ptr := range chans {
+				samples := (*[1 << 28]C.float)(unsafe.Pointer(ptr))[:frames:frames]
+				for i, v := range samples {
+					data[samplesRead+int64(i)*channels+int64(c)] = float32(v)
+				}
+			}
+			samplesRead += frames * channels
+		} else if frames == 0 {
+			return samplesRead, io.EOF
+		} else {
+			switch frames {
+			case C.OV_HOLE:
+				return samplesRead, errors.New("ogg: ReadFloat: there was an interruption in the data (garbage between pages, loss of sync followed by recapture, or a corrupt page)")
+			case C.OV_EBADLINK:
+				return samplesRead, errors.New("ogg: ReadFloat: an invalid stream section was supplied to libvorbisfile, or the requested link is corrupt.")
+			case C.OV_EINVAL:
+				return samplesRead, errors.New("ogg: ReadFloat: initial file headers couldn't be read or are corrupt, or the initial open call for vf failed.")
+			default:
+				return samplesRead, errors.New("ogg: ReadFloat: unknown error")
+			}
+		}
+	}
+
+	return
+}
+
 func (r *SoundFileReaderOgg) Close() error {
 	if r.vorbis != nil {
 		C.ov_clear(r.vorbis)
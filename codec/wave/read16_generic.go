@@ -0,0 +1,16 @@
+//go:build !amd64 && !386
+// +build !amd64,!386
+
+package wave
+
+// reads 16-bit raw PCM data from the 16-bit raw PCM file
+//
+// on other systems, the samples are decoded one by one
+func (r *SoundFileReaderWave) read16(data []int16) (samplesRead int64, err error) {
+	n, err := r.readRaw(len(data))
+	for i := 0; i < n; i++ {
+		data[i] = int16(r.sample(i))
+	}
+
+	return readResult(n, len(data), err)
+}
@@ -4,11 +4,10 @@ package wave
 
 import (
 	"errors"
-	"fmt"
 	"io"
-	"time"
 
 	"github.com/Edgaru089/audio"
+	"github.com/Edgaru089/audio/pcm"
 )
 
 const (
@@ -28,6 +27,9 @@ type SoundFileReaderWave struct {
 	bytesPerSample         int
 	dataOffset, dataLength int64
 	readOffset             int64 // current read position, relative to dataOffset
+
+	buf       []byte
+	quantizer *pcm.Quantizer // reduces 24 and 32-bit samples for Read
 }
 
 // SoundFileCheckWave checks if a given file is in RIFF/WAVE audio format.
@@ -152,10 +154,10 @@ func (r *SoundFileReaderWave) Open(file io.ReadSeeker) (info audio.SoundFileInfo
 			}
 
 			// BitsPerSample (2 bytes)
-			// should be 8 or 16 only
+			// should be 8, 16, 24 or 32
 			bitsPerSample, nerr := readcode(file, 16)
-			if nerr != nil || (bitsPerSample != 8 && bitsPerSample != 16) {
-				err = newerror(nerr, "Wave: Audio format error (not 8 or 16 bits per sample)")
+			if nerr != nil || bitsPerSample%8 != 0 || !pcm.ValidBits(int(bitsPerSample)) {
+				err = newerror(nerr, "Wave: Audio format error (not 8, 16, 24 or 32 bits per sample)")
 				break
 			}
 
@@ -200,6 +202,7 @@ func (r *SoundFileReaderWave) Open(file io.ReadSeeker) (info audio.SoundFileInfo
 
 	r.info = info
 	r.file = file
+	r.quantizer = pcm.NewQuantizer(pcm.DefaultDither(), info.ChannelCount)
 	return info, nil
 }
 
@@ -209,61 +212,108 @@ func (r *SoundFileReaderWave) Info() audio.SoundFileInfo {
 
 func (r *SoundFileReaderWave) Seek(sampleOffset int64) error {
 	r.readOffset = sampleOffset * int64(r.bytesPerSample)
+	r.quantizer.Reset()
 	_, err := r.file.Seek(r.dataOffset+r.readOffset, io.SeekStart)
 	return err
 }
 
-// reads from file BYTES bytes, then decode the first 16 bits.
-func readcode16(file io.ReadSeeker, bytes int) (val16 int16, err error) {
-	var buf [4]byte
-	_, err = file.Read(buf[:bytes])
-	if err != nil {
-		return
+// SetDither sets the dither used by Read to reduce 24 and 32-bit samples.
+//
+// The default is pcm.DefaultDither() when the file is opened.
+func (r *SoundFileReaderWave) SetDither(dither pcm.Dither) {
+	r.quantizer = pcm.NewQuantizer(dither, r.info.ChannelCount)
+}
+
+// readRaw reads at most count samples of raw bytes into r.buf.
+//
+// It returns the number of whole samples read.
+func (r *SoundFileReaderWave) readRaw(count int) (samples int, err error) {
+	toread := int64(count * r.bytesPerSample)
+	if toread > r.dataLength-r.readOffset {
+		toread = r.dataLength - r.readOffset
+	}
+	if toread <= 0 {
+		return 0, io.EOF
 	}
 
-	switch bytes {
-	case 1: // 8-bit
-		val16 = int16(buf[0]) << 8
-	case 2, 3, 4: // 16, 24 and 32-bit
-		val16 = int16(buf[0]) | int16(buf[1])<<8
+	if int64(cap(r.buf)) < toread {
+		r.buf = make([]byte, toread)
 	}
+	r.buf = r.buf[:toread]
 
-	return
+	n, err := io.ReadFull(r.file, r.buf)
+	if err == io.ErrUnexpectedEOF {
+		err = io.EOF
+	}
+
+	// keep the file position on a sample boundary
+	if rem := n % r.bytesPerSample; rem != 0 {
+		r.file.Seek(int64(-rem), io.SeekCurrent)
+		n -= rem
+	}
+	r.readOffset += int64(n)
+
+	return n / r.bytesPerSample, err
 }
 
-func (r *SoundFileReaderWave) Read(data []int16) (samplesRead int64, err error) {
+// sample decodes the i-th sample in r.buf.
+func (r *SoundFileReaderWave) sample(i int) int32 {
+	bits := r.bytesPerSample * 8
+	v := decode(r.buf[i*r.bytesPerSample:], bits)
+	if bits == 8 {
+		// 8-bit samples are unsigned
+		return int32(v) - 128
+	}
+	return pcm.SignExtend(uint32(v), bits)
+}
 
-	t := time.Now()
+// readResult returns the result of a Read of n samples into a slice of length want.
+func readResult(n, want int, err error) (samplesRead int64, rerr error) {
+	if n == want {
+		// data is full, return success regardless of r.readOffset or EOF
+		return int64(n), nil
+	}
 
-	if r.bytesPerSample == 1 { // 8-bit
+	// data is not full but EOF
+	if err == nil {
+		err = io.EOF
+	}
+	return int64(n), err
+}
 
-		for samplesRead < int64(len(data)) && r.readOffset < r.dataLength {
+func (r *SoundFileReaderWave) Read(data []int16) (samplesRead int64, err error) {
 
-			data[samplesRead], err = readcode16(r.file, r.bytesPerSample)
-			if err != nil {
-				return
-			}
+	if r.bytesPerSample == 2 { // 16-bit
+		return r.read16(data) // use some dirty stuff to speed it up on little-endian systems
+	}
 
-			samplesRead++
-			r.readOffset += int64(r.bytesPerSample)
+	// the sample at the read position is on this channel
+	channel := int(r.readOffset/int64(r.bytesPerSample)) % r.info.ChannelCount
 
-			if time.Since(t) > time.Millisecond*10 {
-				fmt.Printf("\rWave: Read over: samplesRead=%d, readOffset=%d (dataLength=%d)", samplesRead, r.readOffset, r.dataLength)
-				t = time.Now()
-			}
+	n, err := r.readRaw(len(data))
+	bits := r.bytesPerSample * 8
+	for i := 0; i < n; i++ {
+		data[i] = r.quantizer.Quantize(channel, r.sample(i), bits)
+		channel++
+		if channel == r.info.ChannelCount {
+			channel = 0
 		}
-
-	} else if r.bytesPerSample == 2 { // 16-bit
-		return r.read16(data) // use some dirty stuff to speed it up on little-endian systems
 	}
 
-	if samplesRead == int64(len(data)) {
-		// data is full, return success regardless of r.readOffset or EOF
-		return
+	return readResult(n, len(data), err)
+}
+
+// ReadFloat reads float audio samples, keeping the full bit depth of the file.
+//
+// It satisfies audio.SoundFileFloatReader.
+func (r *SoundFileReaderWave) ReadFloat(data []float32) (samplesRead int64, err error) {
+	n, err := r.readRaw(len(data))
+	bits := r.bytesPerSample * 8
+	for i := 0; i < n; i++ {
+		data[i] = pcm.ToFloat32(r.sample(i), bits)
 	}
 
-	// data is not full but EOF
-	return samplesRead, io.EOF
+	return readResult(n, len(data), err)
 }
 
 func (r *SoundFileReaderWave) Close() error {
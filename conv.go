@@ -5,6 +5,7 @@ package audio
 import "C"
 import (
 	"reflect"
+	"time"
 	"unsafe"
 )
 
@@ -40,3 +41,22 @@ func c_str_const(str string) *C.char {
 
 	return (*C.char)((unsafe.Pointer)(str_internal.Data))
 }
+
+// framesToDuration converts a number of frames at the sample rate to time,
+// without the rounding errors of float seconds.
+func framesToDuration(frames int64, sampleRate int) time.Duration {
+	if sampleRate <= 0 {
+		return 0
+	}
+	rate := int64(sampleRate)
+	return time.Duration(frames/rate)*time.Second + time.Duration(frames%rate)*time.Second/time.Duration(rate)
+}
+
+// durationToFrames converts time to the nearest number of frames at the sample rate.
+//
+// It is the inverse of framesToDuration.
+func durationToFrames(d time.Duration, sampleRate int) int64 {
+	rate := int64(sampleRate)
+	secs, rem := int64(d/time.Second), int64(d%time.Second)
+	return secs*rate + (rem*rate+int64(time.Second)/2)/int64(time.Second)
+}
@@ -0,0 +1,9 @@
+//go:build audiodebug
+// +build audiodebug
+
+package audio
+
+// debugBuild is true if built with the audiodebug tag.
+//
+// Debug builds report objects garbage collected without being released.
+const debugBuild = true
@@ -3,13 +3,23 @@ package audio
 // #include "headers.h"
 import "C"
 import (
-	"errors"
+	"fmt"
+	"time"
 )
 
 var (
 	alcDevice  *C.ALCdevice
 	alcContext *C.ALCcontext
 
+	extFloat32        bool // AL_EXT_FLOAT32 is supported
+	extCallbackBuffer bool // AL_SOFT_callback_buffer is supported
+	extSourceLatency  bool // AL_SOFT_source_latency is supported
+	extDeviceClock    bool // ALC_SOFT_device_clock is supported
+	extStartDelay     bool // AL_SOFT_source_start_delay is supported
+
+	initTime time.Time // when the device is opened, the time base of DeviceClock without ALC_SOFT_device_clock
+
+	// listener state, protected by stateLock
 	listenerVolume    float32 = 100.0
 	listenerPosition          = [3]float32{0, 0, 0}
 	listenerDirection         = [3]float32{0, 0, -1}
@@ -19,15 +29,43 @@ var (
 func initDevice() (err error) {
 	alcDevice = C.alcOpenDevice(nil)
 	if alcDevice == nil {
-		return errors.New("failed to open audio device")
+		return ErrNoDevice
 	}
 
 	alcContext = C.alcCreateContext(alcDevice, nil)
 	if alcContext == nil {
-		return errors.New("failed to create audio context")
+		err = deviceError(ErrNoDevice, "cannot create context", alcError(alcDevice, "alcCreateContext"))
+		C.alcCloseDevice(alcDevice)
+		alcDevice = nil
+		return err
+	}
+
+	if C.alcMakeContextCurrent(alcContext) == C.ALC_FALSE {
+		err = deviceError(ErrNoDevice, "cannot make context current", alcError(alcDevice, "alcMakeContextCurrent"))
+		C.alcDestroyContext(alcContext)
+		C.alcCloseDevice(alcDevice)
+		alcContext, alcDevice = nil, nil
+		return err
 	}
 
-	C.alcMakeContextCurrent(alcContext)
+	// query the extensions once, so that they can be read without locking
+	extFloat32 = isExtensionSupported("AL_EXT_FLOAT32")
+	extCallbackBuffer = isExtensionSupported("AL_SOFT_callback_buffer") && C.__GoAudio_C_LoadBufferCallback() != 0
+	extSourceLatency = isExtensionSupported("AL_SOFT_source_latency") && C.__GoAudio_C_LoadSourceLatency() != 0
+	extDeviceClock = isExtensionSupported("ALC_SOFT_device_clock") && C.__GoAudio_C_LoadDeviceClock(alcDevice) != 0
+	extStartDelay = isExtensionSupported("AL_SOFT_source_start_delay") && C.__GoAudio_C_LoadStartDelay() != 0
+	initTime = time.Now()
+	initEvents()
+
+	// the ducking rules are kept across Shutdown
+	tweenLock.Lock()
+	if len(duckRules) > 0 {
+		startScheduler()
+	}
+	tweenLock.Unlock()
+
+	stateLock.Lock()
+	defer stateLock.Unlock()
 
 	orientation := []float32{
 		listenerDirection[0], listenerDirection[1], listenerDirection[2],
@@ -35,12 +73,23 @@ func initDevice() (err error) {
 	}
 
 	C.alListenerf(C.AL_GAIN, C.float(listenerVolume*0.01))
+	alCheck("alListenerf")
 	C.alListenerfv(C.AL_POSITION, ptrf(listenerPosition[:]))
+	alCheck("alListenerfv")
 	C.alListenerfv(C.AL_ORIENTATION, ptrf(orientation))
+	alCheck("alListenerfv")
 
 	return nil
 }
 
+// deviceError wraps the sentinel error with the message, and the ALC error if there is one.
+func deviceError(sentinel error, msg string, alcerr error) error {
+	if alcerr != nil {
+		return fmt.Errorf("%w: %s (%v)", sentinel, msg, alcerr)
+	}
+	return fmt.Errorf("%w: %s", sentinel, msg)
+}
+
 func isExtensionSupported(name string) bool {
 	cstr, free := c_str(name)
 	defer free()
@@ -80,11 +129,53 @@ func getFormatFromChannelCount(channelCount int) C.ALenum {
 	return format
 }
 
+// isFloatSupported tells if OpenAL accepts 32-bit float buffers.
+func isFloatSupported() bool {
+	return extFloat32
+}
+
+// getFloatFormatFromChannelCount returns the 32-bit float format for the channel count.
+//
+// It returns 0 if float buffers or the channel count are not supported.
+func getFloatFormatFromChannelCount(channelCount int) C.ALenum {
+	if !isFloatSupported() {
+		return 0
+	}
+
+	var format C.ALenum
+
+	switch channelCount {
+	case 1:
+		format = C.AL_FORMAT_MONO_FLOAT32
+	case 2:
+		format = C.AL_FORMAT_STEREO_FLOAT32
+	case 4:
+		format = C.alGetEnumValue(c_str_const("AL_FORMAT_QUAD32\x00"))
+	case 6:
+		format = C.alGetEnumValue(c_str_const("AL_FORMAT_51CHN32\x00"))
+	case 7:
+		format = C.alGetEnumValue(c_str_const("AL_FORMAT_61CHN32\x00"))
+	case 8:
+		format = C.alGetEnumValue(c_str_const("AL_FORMAT_71CHN32\x00"))
+	}
+
+	// a bug on macOS
+	if format == -1 {
+		format = 0
+	}
+
+	return format
+}
+
 // SetGlobalVolume sets the global volume of the listener, from 0 to 100.
 //
 // The default is 100.
 func SetGlobalVolume(volume float32) {
+	stateLock.Lock()
+	defer stateLock.Unlock()
+
 	C.alListenerf(C.AL_GAIN, (C.float)(volume*0.01))
+	alCheck("alListenerf")
 	listenerVolume = volume
 }
 
@@ -92,6 +183,9 @@ func SetGlobalVolume(volume float32) {
 //
 // The default is 100.
 func GetGlobalVolume() float32 {
+	stateLock.Lock()
+	defer stateLock.Unlock()
+
 	return listenerVolume
 }
 
@@ -99,7 +193,11 @@ func GetGlobalVolume() float32 {
 //
 // The default is [0, 0, 0].
 func SetListenerPosition(pos [3]float32) {
+	stateLock.Lock()
+	defer stateLock.Unlock()
+
 	C.alListenerfv(C.AL_POSITION, ptrf(pos[:]))
+	alCheck("alListenerfv")
 	listenerPosition = pos
 }
 
@@ -107,6 +205,9 @@ func SetListenerPosition(pos [3]float32) {
 //
 // The default is [0, 0, 0].
 func GetListenerPosition() [3]float32 {
+	stateLock.Lock()
+	defer stateLock.Unlock()
+
 	return listenerPosition
 }
 
@@ -116,11 +217,15 @@ func GetListenerPosition() [3]float32 {
 //
 // the default is [0, 0, -1] (Z-Minus).
 func SetListenerDirection(dir [3]float32) {
+	stateLock.Lock()
+	defer stateLock.Unlock()
+
 	orientation := []float32{
 		dir[0], dir[1], dir[2],
 		listenerUpVector[0], listenerUpVector[1], listenerUpVector[2],
 	}
 	C.alListenerfv(C.AL_ORIENTATION, ptrf(orientation))
+	alCheck("alListenerfv")
 
 	listenerDirection = dir
 }
@@ -129,6 +234,9 @@ func SetListenerDirection(dir [3]float32) {
 //
 // the default is [0, 0, -1] (Z-Minus).
 func GetListenerDirection() [3]float32 {
+	stateLock.Lock()
+	defer stateLock.Unlock()
+
 	return listenerDirection
 }
 
@@ -138,11 +246,15 @@ func GetListenerDirection() [3]float32 {
 //
 // the default is [0, 1, 0] (Y-Plus).
 func SetListenerUpVector(up [3]float32) {
+	stateLock.Lock()
+	defer stateLock.Unlock()
+
 	orientation := []float32{
 		listenerDirection[0], listenerDirection[1], listenerDirection[2],
 		up[0], up[1], up[2],
 	}
 	C.alListenerfv(C.AL_ORIENTATION, ptrf(orientation))
+	alCheck("alListenerfv")
 
 	listenerUpVector = up
 }
@@ -151,5 +263,8 @@ func SetListenerUpVector(up [3]float32) {
 //
 // the default is [0, 1, 0] (Y-Plus).
 func GetListenerUpVector() [3]float32 {
+	stateLock.Lock()
+	defer stateLock.Unlock()
+
 	return listenerUpVector
 }
@@ -0,0 +1,366 @@
+package audio
+
+// #include "headers.h"
+import "C"
+import (
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// PlaybackEventType is the kind of a PlaybackEvent.
+type PlaybackEventType int8
+
+const (
+	EventStarted  PlaybackEventType = iota // the sound started or resumed playing
+	EventPaused                            // the sound is paused
+	EventStopped                           // the sound is stopped by Stop
+	EventEnded                             // the sound reached its end
+	EventLooped                            // the music wrapped around to the start of its loop, once the buffer of the wrap is played
+	EventUnderrun                          // the stream ran out of samples in time, and is restarted
+)
+
+func (t PlaybackEventType) String() string {
+	switch t {
+	case EventStarted:
+		return "started"
+	case EventPaused:
+		return "paused"
+	case EventStopped:
+		return "stopped"
+	case EventEnded:
+		return "ended"
+	case EventLooped:
+		return "looped"
+	case EventUnderrun:
+		return "underrun"
+	}
+	return "unknown"
+}
+
+// PlaybackEvent is a change in the playback of a Sound, SoundStream or Music.
+type PlaybackEvent struct {
+	Type PlaybackEventType
+	Time time.Time // when the event is noticed
+}
+
+// dispatchPollInterval is the interval the dispatcher polls the playing Sounds
+// for their end, without AL_SOFT_events.
+const dispatchPollInterval = 10 * time.Millisecond
+
+// The events are delivered by a single dispatcher goroutine, running while
+// there are listeners. The streams report their events themselves; the end of
+// the Sounds is noticed with AL_SOFT_events, or else by polling.
+var (
+	dispatchLock    sync.Mutex
+	watches         = make(map[*soundSource]*watch)
+	dispatchQueue   []queuedEvent
+	dispatchChanged = make(map[C.ALuint]struct{}) // sources reported by AL_SOFT_events
+	dispatchWake    = make(chan struct{}, 1)
+	dispatchRunning bool
+)
+
+// watch is the listeners of a source.
+type watch struct {
+	state     PlayStatus // the state by the events so far
+	listeners []*eventListener
+}
+
+type eventListener struct {
+	fn       func(PlaybackEvent)
+	onRemove func() // called once the listener is removed, may be nil
+	removed  int32  // accessed atomically
+}
+
+type queuedEvent struct {
+	w  *watch
+	ev PlaybackEvent
+}
+
+// OnEvent registers fn to be called on the playback events of the sound.
+//
+// The functions of all the sounds are called one at a time, in the order of the events,
+// on a dispatcher goroutine. They may call the functions of the package, but they should
+// return quickly, or the events of the other sounds are delayed.
+//
+// The listener is removed by calling cancel, or when the sound is released or closed.
+func (s *soundSource) OnEvent(fn func(PlaybackEvent)) (cancel func()) {
+	return s.addListener(fn, nil)
+}
+
+// Events returns a channel receiving the playback events of the sound,
+// buffered with the size given. Events are dropped if the channel is full.
+//
+// The channel is closed when cancel is called, or when the sound is released or closed.
+func (s *soundSource) Events(size int) (events <-chan PlaybackEvent, cancel func()) {
+	ch := make(chan PlaybackEvent, size)
+
+	var lock sync.Mutex
+	var closed bool
+	send := func(ev PlaybackEvent) {
+		lock.Lock()
+		defer lock.Unlock()
+		if !closed {
+			select {
+			case ch <- ev:
+			default:
+			}
+		}
+	}
+	closeCh := func() {
+		lock.Lock()
+		defer lock.Unlock()
+		if !closed {
+			closed = true
+			close(ch)
+		}
+	}
+
+	return ch, s.addListener(send, closeCh)
+}
+
+func (s *soundSource) addListener(fn func(PlaybackEvent), onRemove func()) (cancel func()) {
+	state := Stopped
+	stateLock.Lock()
+	if isLive(s.source, s.gen) {
+		state = s.status()
+	}
+	stateLock.Unlock()
+
+	l := &eventListener{fn: fn, onRemove: onRemove}
+
+	dispatchLock.Lock()
+	w := watches[s]
+	if w == nil {
+		w = &watch{state: state}
+		watches[s] = w
+	}
+	w.listeners = append(w.listeners, l)
+	if !dispatchRunning {
+		dispatchRunning = true
+		streams.Add(1)
+		go dispatch()
+	}
+	dispatchLock.Unlock()
+
+	return func() {
+		dispatchLock.Lock()
+		removed := w.remove(l)
+		if len(w.listeners) == 0 && watches[s] == w {
+			delete(watches, s)
+		}
+		dispatchLock.Unlock()
+
+		if removed && l.onRemove != nil {
+			l.onRemove()
+		}
+	}
+}
+
+// remove removes the listener, telling if it is not removed before.
+// dispatchLock must be held.
+func (w *watch) remove(l *eventListener) bool {
+	for i, wl := range w.listeners {
+		if wl == l {
+			w.listeners = append(w.listeners[:i], w.listeners[i+1:]...)
+			atomic.StoreInt32(&l.removed, 1)
+			return true
+		}
+	}
+	return false
+}
+
+// unwatch removes all the listeners of the source.
+func unwatch(s *soundSource) {
+	dispatchLock.Lock()
+	w := watches[s]
+	delete(watches, s)
+	var listeners []*eventListener
+	if w != nil {
+		listeners = w.listeners
+		w.listeners = nil
+		for _, l := range listeners {
+			atomic.StoreInt32(&l.removed, 1)
+		}
+	}
+	dispatchLock.Unlock()
+
+	for _, l := range listeners {
+		if l.onRemove != nil {
+			l.onRemove()
+		}
+	}
+}
+
+// unwatchAll removes all the listeners, for Shutdown.
+func unwatchAll() {
+	dispatchLock.Lock()
+	var sources []*soundSource
+	for s := range watches {
+		sources = append(sources, s)
+	}
+	dispatchLock.Unlock()
+
+	for _, s := range sources {
+		unwatch(s)
+	}
+	wakeup(dispatchWake)
+}
+
+// emit queues the event of the source, if it has listeners.
+func emit(s *soundSource, t PlaybackEventType) {
+	dispatchLock.Lock()
+	defer dispatchLock.Unlock()
+	emitLocked(s, t)
+}
+
+// emitSource queues the event of the source of the name and the generation,
+// if it has listeners. stateLock must be held.
+func emitSource(source C.ALuint, gen uint64, t PlaybackEventType) {
+	dispatchLock.Lock()
+	defer dispatchLock.Unlock()
+
+	for s := range watches {
+		if s.source == source && s.gen == gen {
+			emitLocked(s, t)
+			return
+		}
+	}
+}
+
+// emitLocked is emit with dispatchLock held.
+func emitLocked(s *soundSource, t PlaybackEventType) {
+	w := watches[s]
+	if w == nil {
+		return
+	}
+
+	switch t {
+	case EventStarted:
+		w.state = Playing
+	case EventPaused:
+		w.state = Paused
+	case EventStopped, EventEnded:
+		w.state = Stopped
+	}
+
+	dispatchQueue = append(dispatchQueue, queuedEvent{w: w, ev: PlaybackEvent{Type: t, Time: time.Now()}})
+	wakeup(dispatchWake)
+}
+
+// sourceChanged is called on the state change events of AL_SOFT_events.
+func sourceChanged(source C.ALuint) {
+	dispatchLock.Lock()
+	defer dispatchLock.Unlock()
+
+	if len(watches) > 0 {
+		dispatchChanged[source] = struct{}{}
+		wakeup(dispatchWake)
+	}
+}
+
+// dispatch is the dispatcher goroutine.
+func dispatch() {
+	defer streams.Done()
+
+	for {
+		checkEnded()
+		deliver()
+
+		dispatchLock.Lock()
+		if len(dispatchQueue) == 0 && (len(watches) == 0 || isShuttingDown()) {
+			dispatchRunning = false
+			dispatchLock.Unlock()
+			return
+		}
+		poll := false
+		if !extEvents {
+			for _, w := range watches {
+				if w.state == Playing {
+					poll = true
+					break
+				}
+			}
+		}
+		pending := len(dispatchQueue) > 0
+		dispatchLock.Unlock()
+
+		if pending {
+			continue
+		}
+		var timeout <-chan time.Time
+		if poll {
+			timeout = time.After(dispatchPollInterval)
+		}
+		select {
+		case <-dispatchWake:
+		case <-timeout:
+		}
+	}
+}
+
+// checkEnded emits EventEnded for the playing Sounds found stopped,
+// among the sources changed, or all of them without AL_SOFT_events.
+func checkEnded() {
+	dispatchLock.Lock()
+	changed := dispatchChanged
+	dispatchChanged = make(map[C.ALuint]struct{})
+	var playing []*soundSource
+	for s, w := range watches {
+		if w.state == Playing {
+			playing = append(playing, s)
+		}
+	}
+	dispatchLock.Unlock()
+
+	if len(playing) == 0 {
+		return
+	}
+
+	var ended []*soundSource
+	stateLock.Lock()
+	for _, s := range playing {
+		// the streams report their own end
+		if s.streamed || !isLive(s.source, s.gen) {
+			continue
+		}
+		if extEvents {
+			if _, ok := changed[s.source]; !ok {
+				continue
+			}
+		}
+		if s.status() == Stopped {
+			ended = append(ended, s)
+		}
+	}
+	stateLock.Unlock()
+
+	dispatchLock.Lock()
+	for _, s := range ended {
+		// skip if stopped or played again in the meantime
+		if w := watches[s]; w != nil && w.state == Playing {
+			emitLocked(s, EventEnded)
+		}
+	}
+	dispatchLock.Unlock()
+}
+
+// deliver calls the listeners on the queued events.
+func deliver() {
+	dispatchLock.Lock()
+	queue := dispatchQueue
+	dispatchQueue = nil
+	listeners := make([][]*eventListener, len(queue))
+	for i, e := range queue {
+		listeners[i] = append([]*eventListener(nil), e.w.listeners...)
+	}
+	dispatchLock.Unlock()
+
+	for i, e := range queue {
+		for _, l := range listeners[i] {
+			if atomic.LoadInt32(&l.removed) == 0 {
+				l.fn(e.ev)
+			}
+		}
+	}
+}
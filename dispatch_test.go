@@ -0,0 +1,143 @@
+package audio
+
+import (
+	"sync"
+	"testing"
+	"time"
+)
+
+// eventRecord records the events delivered to the listeners of several sounds.
+type eventRecord struct {
+	lock    sync.Mutex
+	events  []string
+	running int // listeners running at once
+	overlap bool
+}
+
+// listener returns a listener recording the events of the sound of the name.
+func (r *eventRecord) listener(name string, s *Sound) func(PlaybackEvent) {
+	return func(ev PlaybackEvent) {
+		r.lock.Lock()
+		r.running++
+		r.overlap = r.overlap || r.running > 1
+		r.events = append(r.events, name+" "+ev.Type.String())
+		r.lock.Unlock()
+
+		// the listeners may call the package
+		s.Status()
+		time.Sleep(time.Millisecond)
+
+		r.lock.Lock()
+		r.running--
+		r.lock.Unlock()
+	}
+}
+
+func (r *eventRecord) count() int {
+	r.lock.Lock()
+	defer r.lock.Unlock()
+	return len(r.events)
+}
+
+func TestEventOrder(t *testing.T) {
+	if err := Init(); err != nil {
+		t.Skip("cannot open the device:", err)
+	}
+	defer Shutdown()
+
+	a, b := NewSound(), NewSound()
+	defer a.Release()
+	defer b.Release()
+	r := &eventRecord{}
+	a.OnEvent(r.listener("a", a))
+	cancel := b.OnEvent(r.listener("b", b))
+
+	a.Play()
+	b.Play()
+	a.Pause()
+	b.Stop()
+	a.Play()
+
+	want := []string{"a started", "b started", "a paused", "b stopped", "a started"}
+	for deadline := time.Now().Add(time.Second); r.count() < len(want) && time.Now().Before(deadline); {
+		time.Sleep(time.Millisecond)
+	}
+
+	// no more events once canceled
+	cancel()
+	b.Play()
+	time.Sleep(20 * time.Millisecond)
+
+	r.lock.Lock()
+	defer r.lock.Unlock()
+	if len(r.events) != len(want) {
+		t.Fatalf("events %v, want %v", r.events, want)
+	}
+	for i := range want {
+		if r.events[i] != want[i] {
+			t.Fatalf("events %v, want %v", r.events, want)
+		}
+	}
+	if r.overlap {
+		t.Error("listeners called at once")
+	}
+}
+
+func TestEventsChannel(t *testing.T) {
+	if err := Init(); err != nil {
+		t.Skip("cannot open the device:", err)
+	}
+	defer Shutdown()
+
+	s := NewSound()
+	events, _ := s.Events(1)
+	// called after the channel, on every event
+	delivered := make(chan struct{}, 3)
+	s.OnEvent(func(PlaybackEvent) { delivered <- struct{}{} })
+
+	// the events past the size of the channel are dropped, without blocking
+	s.Play()
+	s.Pause()
+	s.Play()
+	for i := 0; i < 3; i++ {
+		select {
+		case <-delivered:
+		case <-time.After(time.Second):
+			t.Fatal("events not delivered")
+		}
+	}
+	select {
+	case ev := <-events:
+		if ev.Type != EventStarted {
+			t.Errorf("event %v, want %v", ev.Type, EventStarted)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("no event")
+	}
+	select {
+	case ev := <-events:
+		t.Errorf("event %v, want the events dropped", ev.Type)
+	default:
+	}
+
+	// closed on Release
+	s.Release()
+	select {
+	case _, ok := <-events:
+		if ok {
+			t.Error("event received after Release")
+		}
+	case <-time.After(time.Second):
+		t.Error("channel not closed by Release")
+	}
+
+	// and on cancel
+	s = NewSound()
+	defer s.Release()
+	events, cancel := s.Events(1)
+	cancel()
+	cancel()
+	if _, ok := <-events; ok {
+		t.Error("event received after cancel")
+	}
+}
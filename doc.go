@@ -5,4 +5,7 @@
 //
 // Under the hood, the audio package wraps OpenAL for playback, and libflac and libvorbis for decoding
 // of FLAC and Ogg/Vorbis audio files.
+//
+// The objects of the package are safe for concurrent use by multiple goroutines,
+// except for Init and Shutdown, which should not run concurrently with anything else.
 package audio
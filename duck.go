@@ -0,0 +1,171 @@
+package audio
+
+import (
+	"math"
+	"time"
+)
+
+// Ducking is how a DuckRule lowers its target buses.
+type Ducking struct {
+	Depth   float32       // how much the targets are lowered, in decibels, e.g., 12
+	Attack  time.Duration // the time to lower the targets, once the trigger starts playing
+	Hold    time.Duration // the time the targets stay lowered, after the trigger stops playing
+	Release time.Duration // the time to bring the targets back up, after the hold
+}
+
+// DuckTrigger is what triggers a DuckRule while playing: a Bus, with any
+// of its sounds playing, or a single Sound, SoundStream or Music.
+type DuckTrigger interface {
+	// triggering tells if the trigger is playing. stateLock must be held.
+	triggering() bool
+}
+
+// DuckRule lowers the volume of buses while its trigger plays,
+// e.g., the music and the ambience while a dialogue line plays.
+//
+// The rules are stepped by the scheduler goroutine of the tweens, which polls
+// the state of the triggers, and changes the volume of the targets smoothly,
+// linearly in decibels. The volumes lowered by several rules add up in decibels.
+type DuckRule struct {
+	trigger DuckTrigger
+	targets []*Bus
+	ducking Ducking
+
+	// stepped by the scheduler goroutine, protected by stateLock
+	level      float64   // the current attenuation, in decibels, from 0 to Depth
+	lastActive time.Time // when the trigger was last seen playing
+	lastStep   time.Time
+}
+
+// protected by tweenLock
+var duckRules []*DuckRule
+
+// ducked is the buses lowered by the rules so far, to be restored
+// once the rules are removed. It is only used by the scheduler goroutine.
+var ducked = make(map[*Bus]struct{})
+
+// AddDucking adds a rule lowering the target buses by the ducking while the trigger plays.
+//
+// The rule applies until Remove is called.
+func AddDucking(trigger DuckTrigger, ducking Ducking, targets ...*Bus) *DuckRule {
+	r := &DuckRule{
+		trigger: trigger,
+		targets: append([]*Bus(nil), targets...),
+		ducking: ducking,
+	}
+
+	tweenLock.Lock()
+	defer tweenLock.Unlock()
+
+	duckRules = append(duckRules, r)
+	startScheduler()
+	return r
+}
+
+// Remove removes the rule. The targets are brought back up at once.
+//
+// Calling Remove more than once does nothing.
+func (r *DuckRule) Remove() {
+	tweenLock.Lock()
+	defer tweenLock.Unlock()
+
+	for i, rule := range duckRules {
+		if rule == r {
+			duckRules = append(duckRules[:i], duckRules[i+1:]...)
+			break
+		}
+	}
+	// the scheduler restores the targets on its next step
+	startScheduler()
+}
+
+// Level returns how much the targets are lowered by the rule now, in decibels.
+func (r *DuckRule) Level() float32 {
+	stateLock.Lock()
+	defer stateLock.Unlock()
+	return float32(r.level)
+}
+
+// step moves the level of the rule on to the time. stateLock must be held.
+func (r *DuckRule) step(now time.Time) {
+	elapsed := now.Sub(r.lastStep)
+	if r.lastStep.IsZero() {
+		elapsed = 0
+	}
+	r.lastStep = now
+
+	depth := float64(r.ducking.Depth)
+	if r.trigger.triggering() {
+		r.lastActive = now
+		r.level = approach(r.level, depth, depth, r.ducking.Attack, elapsed)
+	} else if now.Sub(r.lastActive) >= r.ducking.Hold {
+		r.level = approach(r.level, 0, depth, r.ducking.Release, elapsed)
+	}
+}
+
+// approach moves value toward target, at the rate of span per the duration.
+func approach(value, target, span float64, d, elapsed time.Duration) float64 {
+	if d <= 0 {
+		return target
+	}
+	delta := span * float64(elapsed) / float64(d)
+	if value < target {
+		return math.Min(value+delta, target)
+	}
+	return math.Max(value-delta, target)
+}
+
+// stepDucking steps the rules, and applies the attenuation to their targets.
+// It is called by the scheduler goroutine.
+func stepDucking(rules []*DuckRule, now time.Time) {
+	if len(rules) == 0 && len(ducked) == 0 {
+		return
+	}
+
+	stateLock.Lock()
+	defer stateLock.Unlock()
+
+	levels := make(map[*Bus]float64)
+	for _, r := range rules {
+		r.step(now)
+		for _, b := range r.targets {
+			levels[b] += r.level
+		}
+	}
+	for b := range ducked {
+		if _, ok := levels[b]; !ok {
+			levels[b] = 0
+		}
+	}
+
+	for b, level := range levels {
+		duck := float32(math.Pow(10, -level/20))
+		if level == 0 {
+			duck = 1
+			delete(ducked, b)
+		} else {
+			ducked[b] = struct{}{}
+		}
+		if duck != b.duck {
+			b.duck = duck
+			b.walk((*busMember).applyVolume)
+		}
+	}
+}
+
+// triggering tells if a sound of the bus, or of a bus under it, is playing.
+// stateLock must be held.
+func (b *Bus) triggering() bool {
+	playing := false
+	b.walk(func(m *busMember) {
+		if !playing && sourceStatus(m.source) == Playing {
+			playing = true
+		}
+	})
+	return playing
+}
+
+// triggering tells if the sound is playing. stateLock must be held.
+func (s *soundSource) triggering() bool {
+	return isLive(s.source, s.gen) && s.status() == Playing
+}
@@ -0,0 +1,105 @@
+package audio
+
+import (
+	"math"
+	"testing"
+	"time"
+)
+
+// testTrigger is a DuckTrigger switched by the test.
+type testTrigger bool
+
+func (t *testTrigger) triggering() bool { return bool(*t) }
+
+func TestDuckRuleStep(t *testing.T) {
+	if err := Init(); err != nil {
+		t.Skip("cannot open the device:", err)
+	}
+	defer Shutdown()
+
+	target := NewBus("Ducked", nil)
+	var trigger testTrigger
+	ducking := Ducking{Depth: 6, Attack: 100 * time.Millisecond, Hold: 50 * time.Millisecond, Release: 100 * time.Millisecond}
+	r1 := &DuckRule{trigger: &trigger, targets: []*Bus{target}, ducking: ducking}
+	r2 := &DuckRule{trigger: &trigger, targets: []*Bus{target}, ducking: ducking}
+	rules := []*DuckRule{r1, r2}
+
+	// stepped by hand, on a clock of the test, without the scheduler
+	start := time.Now()
+	steps := []struct {
+		at      time.Duration
+		playing bool
+		level   float64 // of each rule
+	}{
+		{0, true, 0},
+		{50 * time.Millisecond, true, 3},
+		{100 * time.Millisecond, true, 6},
+		{150 * time.Millisecond, true, 6},
+		{175 * time.Millisecond, false, 6}, // held
+		{200 * time.Millisecond, false, 4.5},
+		{250 * time.Millisecond, false, 1.5},
+		{300 * time.Millisecond, false, 0},
+	}
+	for _, s := range steps {
+		trigger = testTrigger(s.playing)
+		stepDucking(rules, start.Add(s.at))
+
+		if l := r1.Level(); math.Abs(float64(l)-s.level) > 1e-3 {
+			t.Errorf("Level = %v at %v, want %v", l, s.at, s.level)
+		}
+		// the levels of the two rules add up in decibels
+		want := math.Pow(10, -2*s.level/20)
+		stateLock.Lock()
+		duck := target.duck
+		stateLock.Unlock()
+		if math.Abs(float64(duck)-want) > 1e-3 {
+			t.Errorf("duck = %v at %v, want %v", duck, s.at, want)
+		}
+	}
+
+	if n := len(ducked); n != 0 {
+		t.Errorf("%d buses still ducked, want 0", n)
+	}
+}
+
+func TestDuckingBusTrigger(t *testing.T) {
+	if err := Init(); err != nil {
+		t.Skip("cannot open the device:", err)
+	}
+	defer Shutdown()
+
+	dialogue, music := NewBus("Dialogue", nil), NewBus("Music", nil)
+	line := NewSound()
+	defer line.Release()
+	line.SetBus(dialogue)
+
+	r := AddDucking(dialogue, Ducking{Depth: 20}, music)
+	defer r.Remove()
+
+	waitLevel := func(want float32) {
+		t.Helper()
+		for deadline := time.Now().Add(time.Second); r.Level() != want && time.Now().Before(deadline); {
+			time.Sleep(time.Millisecond)
+		}
+		if l := r.Level(); l != want {
+			t.Fatalf("Level = %v, want %v", l, want)
+		}
+	}
+	gain := func() float32 {
+		stateLock.Lock()
+		defer stateLock.Unlock()
+		return music.gain()
+	}
+
+	line.Play()
+	waitLevel(20)
+	if g := gain(); math.Abs(float64(g)-0.1) > 1e-3 {
+		t.Errorf("gain = %v of the target while ducked, want 0.1", g)
+	}
+
+	line.Stop()
+	waitLevel(0)
+	if g := gain(); g != 1 {
+		t.Errorf("gain = %v of the target after the trigger, want 1", g)
+	}
+}
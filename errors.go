@@ -0,0 +1,104 @@
+package audio
+
+// #include "headers.h"
+import "C"
+import (
+	"errors"
+	"fmt"
+	"log"
+	"strings"
+)
+
+// Errors returned by the package, wrapped with the details.
+// Test them with errors.Is.
+var (
+	ErrUnknownFormat       = errors.New("unknown format")                 // no SoundFileReader can decode the file
+	ErrUnsupportedChannels = errors.New("unsupported number of channels") // OpenAL has no buffer format for the channel count
+	ErrNoDevice            = errors.New("cannot open audio device")       // the OpenAL device or context cannot be opened
+	ErrOutOfSources        = errors.New("out of sources")                 // OpenAL cannot create more sources
+)
+
+// ALError is an error reported by OpenAL (alGetError) or ALC (alcGetError).
+type ALError struct {
+	Func string // the function failed
+	Code int    // the error code
+}
+
+func (e *ALError) Error() string {
+	return fmt.Sprintf("%s: %s", e.Func, e.codeName())
+}
+
+// codeName returns the name of the error code.
+func (e *ALError) codeName() string {
+	if strings.HasPrefix(e.Func, "alc") {
+		switch e.Code {
+		case C.ALC_INVALID_DEVICE:
+			return "ALC_INVALID_DEVICE"
+		case C.ALC_INVALID_CONTEXT:
+			return "ALC_INVALID_CONTEXT"
+		case C.ALC_INVALID_ENUM:
+			return "ALC_INVALID_ENUM"
+		case C.ALC_INVALID_VALUE:
+			return "ALC_INVALID_VALUE"
+		case C.ALC_OUT_OF_MEMORY:
+			return "ALC_OUT_OF_MEMORY"
+		}
+	} else {
+		switch e.Code {
+		case C.AL_INVALID_NAME:
+			return "AL_INVALID_NAME"
+		case C.AL_INVALID_ENUM:
+			return "AL_INVALID_ENUM"
+		case C.AL_INVALID_VALUE:
+			return "AL_INVALID_VALUE"
+		case C.AL_INVALID_OPERATION:
+			return "AL_INVALID_OPERATION"
+		case C.AL_OUT_OF_MEMORY:
+			return "AL_OUT_OF_MEMORY"
+		}
+	}
+	return fmt.Sprintf("error 0x%X", e.Code)
+}
+
+// alError returns the pending OpenAL error as an *ALError
+// reported for the function, or nil if there is none.
+//
+// The error is cleared.
+func alError(function string) error {
+	if code := C.alGetError(); code != C.AL_NO_ERROR {
+		return &ALError{Func: function, Code: int(code)}
+	}
+	return nil
+}
+
+// alcError is like alError, for the ALC functions on the device.
+func alcError(device *C.ALCdevice, function string) error {
+	if code := C.alcGetError(device); code != C.ALC_NO_ERROR {
+		return &ALError{Func: function, Code: int(code)}
+	}
+	return nil
+}
+
+// debugLog logs the error in debug builds (the audiodebug build tag).
+func debugLog(err error) {
+	if debugBuild && err != nil {
+		log.Print("audio: ", err)
+	}
+}
+
+// alCheck logs the pending OpenAL error, reported for the function,
+// in debug builds.
+//
+// It is called after every OpenAL call without an error return.
+func alCheck(function string) {
+	if debugBuild {
+		debugLog(alError(function))
+	}
+}
+
+// alcCheck is like alCheck, for the ALC functions on the device.
+func alcCheck(device *C.ALCdevice, function string) {
+	if debugBuild {
+		debugLog(alcError(device, function))
+	}
+}
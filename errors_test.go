@@ -0,0 +1,47 @@
+package audio
+
+import (
+	"bytes"
+	"errors"
+	"testing"
+)
+
+func TestALErrorText(t *testing.T) {
+	tests := []struct {
+		err  ALError
+		want string
+	}{
+		{ALError{"alSourcePlay", 0xA001}, "alSourcePlay: AL_INVALID_NAME"},
+		{ALError{"alBufferData", 0xA003}, "alBufferData: AL_INVALID_VALUE"},
+		{ALError{"alcOpenDevice", 0xA001}, "alcOpenDevice: ALC_INVALID_DEVICE"},
+		{ALError{"alGenSources", 0x1234}, "alGenSources: error 0x1234"},
+	}
+	for _, tt := range tests {
+		if got := tt.err.Error(); got != tt.want {
+			t.Errorf("Error() = %q, want %q", got, tt.want)
+		}
+	}
+}
+
+func TestSentinelErrors(t *testing.T) {
+	if err := Init(); err != nil {
+		t.Skip("cannot open the device:", err)
+	}
+	defer Shutdown()
+
+	m := NewMusic()
+	defer m.Close()
+	if err := m.Open(bytes.NewReader([]byte("not a sound file"))); !errors.Is(err, ErrUnknownFormat) {
+		t.Errorf("Music.Open of an unknown format = %v, want ErrUnknownFormat", err)
+	}
+
+	b := NewSoundBuffer()
+	defer b.Release()
+	if err := b.Load(bytes.NewReader([]byte("not a sound file"))); !errors.Is(err, ErrUnknownFormat) {
+		t.Errorf("SoundBuffer.Load of an unknown format = %v, want ErrUnknownFormat", err)
+	}
+	r := NewRawPCMReader(PCMS16, nil, 3, 44100)
+	if err := b.LoadReader(r, bytes.NewReader(make([]byte, 3*2*10))); !errors.Is(err, ErrUnsupportedChannels) {
+		t.Errorf("SoundBuffer.LoadReader of 3 channels = %v, want ErrUnsupportedChannels", err)
+	}
+}
@@ -0,0 +1,73 @@
+package audio
+
+// #include "headers.h"
+import "C"
+import "sync"
+
+// With AL_SOFT_events, OpenAL reports the processed buffers and the state
+// changes of the sources on its own thread. The streams register a wake
+// channel for their source, so that they sleep until there is work to do,
+// instead of polling.
+var (
+	extEvents bool // AL_SOFT_events is supported and enabled
+
+	eventLock sync.Mutex
+	wakers    = make(map[C.ALuint]chan<- struct{}) // source name -> wake channel of the stream
+)
+
+// initEvents enables AL_SOFT_events, if supported.
+func initEvents() {
+	extEvents = isExtensionSupported("AL_SOFT_events") && C.__GoAudio_C_LoadEvents() != 0
+	if extEvents {
+		C.__GoAudio_C_EnableEvents(C.AL_TRUE)
+		alCheck("alEventControlSOFT")
+	}
+}
+
+// closeEvents disables AL_SOFT_events, before the context is destroyed.
+func closeEvents() {
+	if extEvents {
+		C.__GoAudio_C_EnableEvents(C.AL_FALSE)
+		alCheck("alEventControlSOFT")
+	}
+	extEvents = false
+}
+
+// setWaker registers the channel to be woken up by the events of the source.
+//
+// A nil channel removes the registration.
+func setWaker(source C.ALuint, wake chan<- struct{}) {
+	eventLock.Lock()
+	defer eventLock.Unlock()
+
+	if wake == nil {
+		delete(wakers, source)
+	} else {
+		wakers[source] = wake
+	}
+}
+
+// wakeup signals the channel without blocking.
+func wakeup(wake chan<- struct{}) {
+	select {
+	case wake <- struct{}{}:
+	default:
+	}
+}
+
+//export __GoAudio_Event
+func __GoAudio_Event(eventType C.int, object C.uint, param C.uint) {
+	switch eventType {
+	case C.AL_EVENT_TYPE_BUFFER_COMPLETED_SOFT, C.AL_EVENT_TYPE_SOURCE_STATE_CHANGED_SOFT:
+		eventLock.Lock()
+		wake := wakers[C.ALuint(object)]
+		eventLock.Unlock()
+
+		if wake != nil {
+			wakeup(wake)
+		}
+		if eventType == C.AL_EVENT_TYPE_SOURCE_STATE_CHANGED_SOFT {
+			sourceChanged(C.ALuint(object))
+		}
+	}
+}
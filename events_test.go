@@ -0,0 +1,55 @@
+package audio
+
+import (
+	"testing"
+	"time"
+)
+
+func TestAdaptPollInterval(t *testing.T) {
+	ms := func(n int) time.Duration { return time.Duration(n) * time.Millisecond }
+
+	tests := []struct {
+		interval, duration time.Duration
+		processed          int
+		want               time.Duration
+	}{
+		{ms(10), time.Second, 0, ms(20)},
+		{ms(10), time.Second, 1, ms(10)},
+		{ms(10), time.Second, 3, ms(5)},
+		{ms(40), time.Second, 0, SoundStreamPollInterval},
+		{ms(40), ms(60), 0, ms(30)}, // at most half a buffer
+		{ms(3), time.Second, 2, minSoundStreamPollInterval},
+		{ms(3), ms(1), 0, minSoundStreamPollInterval},
+	}
+	for _, tt := range tests {
+		if got := adaptPollInterval(tt.interval, tt.duration, tt.processed); got != tt.want {
+			t.Errorf("adaptPollInterval(%v, %v, %d) = %v, want %v", tt.interval, tt.duration, tt.processed, got, tt.want)
+		}
+	}
+
+	if got := pollInterval(ms(100)); got != ms(25) {
+		t.Errorf("pollInterval(100ms) = %v, want 25ms", got)
+	}
+}
+
+func TestWakeup(t *testing.T) {
+	wake := make(chan struct{}, 1)
+
+	// signals pile up into one, without blocking
+	wakeup(wake)
+	wakeup(wake)
+
+	timer := time.NewTimer(time.Hour)
+	timer.Stop()
+	start := time.Now()
+	sleep(timer, wake, time.Hour)
+	if d := time.Since(start); d > time.Second {
+		t.Fatalf("sleep woken after %v", d)
+	}
+
+	start = time.Now()
+	sleep(timer, wake, 10*time.Millisecond)
+	if d := time.Since(start); d < 10*time.Millisecond {
+		t.Errorf("sleep of 10ms returned after %v, with a single wakeup pending", d)
+	}
+}
@@ -0,0 +1,88 @@
+#include "ext.h"
+
+
+typedef void (AL_APIENTRY *__GoAudio_EventProc)(ALenum eventType, ALuint object, ALuint param, ALsizei length, const ALchar *message, void *userParam);
+typedef void (AL_APIENTRY *__GoAudio_EventControlProc)(ALsizei count, const ALenum *types, ALboolean enable);
+typedef void (AL_APIENTRY *__GoAudio_EventCallbackProc)(__GoAudio_EventProc callback, void *userParam);
+
+typedef ALsizei (AL_APIENTRY *__GoAudio_BufferCallbackType)(ALvoid *userptr, ALvoid *sampledata, ALsizei numbytes);
+typedef void (AL_APIENTRY *__GoAudio_BufferCallbackProc)(ALuint buffer, ALenum format, ALsizei freq, __GoAudio_BufferCallbackType callback, ALvoid *userptr);
+
+typedef void (AL_APIENTRY *__GoAudio_GetSourcei64vProc)(ALuint source, ALenum param, int64_t *values);
+typedef void (AL_APIENTRY *__GoAudio_PlayAtTimeProc)(ALuint source, int64_t start_time);
+typedef void (ALC_APIENTRY *__GoAudio_GetInteger64vProc)(ALCdevice *device, ALCenum param, ALsizei size, int64_t *values);
+
+static __GoAudio_EventControlProc  eventControl;
+static __GoAudio_EventCallbackProc eventCallback;
+static __GoAudio_BufferCallbackProc bufferCallback;
+static __GoAudio_GetSourcei64vProc getSourcei64v;
+static __GoAudio_PlayAtTimeProc    playAtTime;
+static __GoAudio_GetInteger64vProc getInteger64v;
+
+
+static void AL_APIENTRY __GoAudio_C_Event(ALenum eventType, ALuint object, ALuint param, ALsizei length, const ALchar *message, void *userParam) {
+	__GoAudio_Event(eventType, object, param);
+}
+
+int __GoAudio_C_LoadEvents(void) {
+	eventControl = (__GoAudio_EventControlProc)alGetProcAddress("alEventControlSOFT");
+	eventCallback = (__GoAudio_EventCallbackProc)alGetProcAddress("alEventCallbackSOFT");
+	return eventControl != NULL && eventCallback != NULL;
+}
+
+void __GoAudio_C_EnableEvents(ALboolean enable) {
+	static const ALenum types[] = {
+		AL_EVENT_TYPE_BUFFER_COMPLETED_SOFT,
+		AL_EVENT_TYPE_SOURCE_STATE_CHANGED_SOFT,
+	};
+
+	if (enable) {
+		eventCallback(__GoAudio_C_Event, NULL);
+		eventControl(sizeof(types) / sizeof(types[0]), types, AL_TRUE);
+	} else {
+		eventControl(sizeof(types) / sizeof(types[0]), types, AL_FALSE);
+		eventCallback(NULL, NULL);
+	}
+}
+
+
+static ALsizei AL_APIENTRY __GoAudio_C_BufferCallbackFunc(ALvoid *userptr, ALvoid *sampledata, ALsizei numbytes) {
+	return __GoAudio_BufferCallback((uintptr_t)userptr, sampledata, numbytes);
+}
+
+int __GoAudio_C_LoadBufferCallback(void) {
+	bufferCallback = (__GoAudio_BufferCallbackProc)alGetProcAddress("alBufferCallbackSOFT");
+	return bufferCallback != NULL;
+}
+
+void __GoAudio_C_BufferCallback(ALuint buffer, ALenum format, ALsizei freq, uintptr_t id) {
+	bufferCallback(buffer, format, freq, __GoAudio_C_BufferCallbackFunc, (ALvoid *)id);
+}
+
+
+int __GoAudio_C_LoadSourceLatency(void) {
+	getSourcei64v = (__GoAudio_GetSourcei64vProc)alGetProcAddress("alGetSourcei64vSOFT");
+	return getSourcei64v != NULL;
+}
+
+void __GoAudio_C_GetSourcei64v(ALuint source, ALenum param, int64_t *values) {
+	getSourcei64v(source, param, values);
+}
+
+int __GoAudio_C_LoadStartDelay(void) {
+	playAtTime = (__GoAudio_PlayAtTimeProc)alGetProcAddress("alSourcePlayAtTimeSOFT");
+	return playAtTime != NULL;
+}
+
+void __GoAudio_C_PlayAtTime(ALuint source, int64_t start_time) {
+	playAtTime(source, start_time);
+}
+
+int __GoAudio_C_LoadDeviceClock(ALCdevice *device) {
+	getInteger64v = (__GoAudio_GetInteger64vProc)alcGetProcAddress(device, "alcGetInteger64vSOFT");
+	return getInteger64v != NULL;
+}
+
+void __GoAudio_C_GetInteger64v(ALCdevice *device, ALCenum param, ALsizei size, int64_t *values) {
+	getInteger64v(device, param, size, values);
+}
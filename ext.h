@@ -0,0 +1,60 @@
+#include <AL/al.h>
+#include <AL/alc.h>
+#include <AL/alext.h>
+#include <stdint.h>
+
+
+// The bundled alext.h predates the extensions below,
+// so their constants are defined here if it lacks them.
+
+// AL_SOFT_events
+#ifndef AL_SOFT_events
+#define AL_EVENT_CALLBACK_FUNCTION_SOFT          0x19A2
+#define AL_EVENT_CALLBACK_USER_PARAM_SOFT        0x19A3
+#define AL_EVENT_TYPE_BUFFER_COMPLETED_SOFT      0x19A4
+#define AL_EVENT_TYPE_SOURCE_STATE_CHANGED_SOFT  0x19A5
+#define AL_EVENT_TYPE_DISCONNECTED_SOFT          0x19A6
+#endif
+
+// AL_SOFT_callback_buffer
+#ifndef AL_SOFT_callback_buffer
+#define AL_BUFFER_CALLBACK_FUNCTION_SOFT         0x19A0
+#define AL_BUFFER_CALLBACK_USER_PARAM_SOFT       0x19A1
+#endif
+
+// ALC_SOFT_device_clock
+#ifndef ALC_SOFT_device_clock
+#define ALC_DEVICE_CLOCK_SOFT                    0x1600
+#define ALC_DEVICE_LATENCY_SOFT                  0x1601
+#define ALC_DEVICE_CLOCK_LATENCY_SOFT            0x1602
+#define AL_SAMPLE_OFFSET_CLOCK_SOFT              0x1202
+#define AL_SEC_OFFSET_CLOCK_SOFT                 0x1203
+#endif
+
+
+// The extension functions are loaded with alGetProcAddress,
+// and called through the trampolines below.
+
+// AL_SOFT_events
+int  __GoAudio_C_LoadEvents(void);
+void __GoAudio_C_EnableEvents(ALboolean enable);
+
+// AL_SOFT_callback_buffer
+int  __GoAudio_C_LoadBufferCallback(void);
+void __GoAudio_C_BufferCallback(ALuint buffer, ALenum format, ALsizei freq, uintptr_t id);
+
+// AL_SOFT_source_latency
+int  __GoAudio_C_LoadSourceLatency(void);
+void __GoAudio_C_GetSourcei64v(ALuint source, ALenum param, int64_t *values);
+
+// AL_SOFT_source_start_delay
+int  __GoAudio_C_LoadStartDelay(void);
+void __GoAudio_C_PlayAtTime(ALuint source, int64_t start_time);
+
+// ALC_SOFT_device_clock
+int  __GoAudio_C_LoadDeviceClock(ALCdevice *device);
+void __GoAudio_C_GetInteger64v(ALCdevice *device, ALCenum param, ALsizei size, int64_t *values);
+
+// Go callbacks
+void __GoAudio_Event(int eventType, unsigned int object, unsigned int param);
+int  __GoAudio_BufferCallback(uintptr_t id, void *data, int size);
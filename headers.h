@@ -1,5 +1,5 @@
-
 #include <AL/al.h>
 #include <AL/alc.h>
 #include <AL/alext.h>
 
+#include "ext.h"
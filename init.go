@@ -3,6 +3,10 @@ package audio
 // Init initializes OpenAL resources.
 //
 // It should be called in the main function, preceeding any OpenAL calls.
-func Init() {
-	initDevice()
+// Unlike the rest of the package, Init should not be called concurrently
+// with other functions.
+//
+// The error wraps ErrNoDevice if the audio device cannot be opened.
+func Init() error {
+	return initDevice()
 }
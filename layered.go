@@ -0,0 +1,795 @@
+package audio
+
+// #include "headers.h"
+import "C"
+import (
+	"fmt"
+	"io"
+	"sync"
+	"time"
+	"unsafe"
+)
+
+// LayeredMusic streams several files in lockstep, each on a source of its own,
+// for adaptive music made of stems faded in and out with the action.
+//
+// All the layers are decoded by a single streaming goroutine, which queues the
+// same number of samples on every source, and the sources are started, paused
+// and stopped together, so that the layers never drift apart. If some of the
+// sources run dry before the others, they are all paused, refilled, and started
+// again together at the same sample. The layers must have the same sample rate;
+// shorter layers are padded with silence up to the longest one.
+//
+// Each layer has a volume of its own. The whole music is put on a bus by SetBus.
+type LayeredMusic struct {
+	ctl     sync.Mutex    // serializes the control methods, like SoundStream.ctl
+	running chan struct{} // closed when the streaming goroutine ends; protected by ctl
+	wake    chan struct{} // wakes up the streaming goroutine; protected by ctl
+
+	// set by Open, and only read by the streaming goroutine
+	layers     []*musicLayer
+	sources    []C.ALuint
+	sampleRate int
+	length     int64 // frames of the longest layer
+
+	// this group is mutex protected, like SoundStream.lock
+	lock           sync.Mutex
+	state          PlayStatus
+	streaming      bool
+	seekOffset     int64 // position of the first buffers in the queues, in frames
+	loop           bool
+	bufferCount    int
+	bufferDuration time.Duration
+
+	// owned by the streaming goroutine
+	loops []int // loop wraps in each buffer index, reported once it is played
+
+	leak *leakCheck
+}
+
+// musicLayer is a layer of a LayeredMusic.
+type musicLayer struct {
+	soundSource
+
+	reader SoundFileReader
+	info   SoundFileInfo
+	format C.ALenum
+
+	// owned by the streaming goroutine
+	buffers []C.ALuint
+	data    []int16
+	frames  int64 // frames read into data
+}
+
+// NewLayeredMusic creates a new LayeredMusic without layers.
+func NewLayeredMusic() *LayeredMusic {
+	m := &LayeredMusic{}
+	m.leak = newLeakCheck("LayeredMusic")
+	return m
+}
+
+// Open opens the files as the layers of the music, in order.
+//
+// The layers opened before are closed. The error wraps ErrUnknownFormat if
+// a file cannot be decoded, ErrUnsupportedChannels if OpenAL cannot play
+// its channel count, or ErrOutOfSources if the sources cannot be created.
+func (m *LayeredMusic) Open(files ...io.ReadSeeker) error {
+	m.ctl.Lock()
+	defer m.ctl.Unlock()
+
+	m.stop()
+	m.closeLayers()
+
+	var layers []*musicLayer
+	fail := func(err error) error {
+		m.layers = layers
+		m.closeLayers()
+		return fmt.Errorf("LayeredMusic: cannot open: %w", err)
+	}
+
+	var length int64
+	for i, file := range files {
+		if _, err := file.Seek(0, io.SeekStart); err != nil {
+			return fail(err)
+		}
+		reader := NewSoundFileReader(file)
+		if reader == nil {
+			return fail(fmt.Errorf("layer %d: %w", i, ErrUnknownFormat))
+		}
+		info, err := reader.Open(file)
+		if err != nil {
+			return fail(fmt.Errorf("layer %d: %w", i, err))
+		}
+
+		l := &musicLayer{reader: reader, info: info, format: getFormatFromChannelCount(info.ChannelCount)}
+		layers = append(layers, l)
+		if l.format == 0 {
+			return fail(fmt.Errorf("layer %d: %w: %d", i, ErrUnsupportedChannels, info.ChannelCount))
+		}
+		if info.SampleRate != layers[0].info.SampleRate {
+			return fail(fmt.Errorf("layer %d: sample rate %d, not %d", i, info.SampleRate, layers[0].info.SampleRate))
+		}
+
+		stateLock.Lock()
+		err = l.init()
+		l.streamed = true
+		stateLock.Unlock()
+		if err != nil {
+			return fail(err)
+		}
+
+		if frames := info.SampleCount / int64(info.ChannelCount); frames > length {
+			length = frames
+		}
+	}
+
+	m.layers = layers
+	m.sources = make([]C.ALuint, len(layers))
+	for i, l := range layers {
+		m.sources[i] = l.source
+	}
+	m.lock.Lock()
+	m.sampleRate = 0
+	if len(layers) > 0 {
+		m.sampleRate = layers[0].info.SampleRate
+	}
+	m.length = length
+	m.seekOffset = 0
+	m.lock.Unlock()
+
+	m.leak.hold()
+	return nil
+}
+
+// closeLayers frees the sources of the layers, and closes their readers.
+// m.ctl must be held, with the streaming goroutine stopped.
+func (m *LayeredMusic) closeLayers() {
+	stateLock.Lock()
+	for _, l := range m.layers {
+		l.soundSource.close()
+	}
+	stateLock.Unlock()
+
+	for _, l := range m.layers {
+		unwatch(&l.soundSource)
+		l.reader.Close()
+	}
+	m.layers, m.sources = nil, nil
+	m.leak.release()
+}
+
+// Close stops the music, frees the sources of its layers, and closes their readers.
+//
+// The music can be opened again after Close. Calling Close more than once does nothing.
+func (m *LayeredMusic) Close() {
+	m.ctl.Lock()
+	defer m.ctl.Unlock()
+
+	m.stop()
+	m.closeLayers()
+}
+
+// LayerCount returns the number of layers.
+func (m *LayeredMusic) LayerCount() int {
+	m.ctl.Lock()
+	defer m.ctl.Unlock()
+	return len(m.layers)
+}
+
+// layer returns the layer of the index, or nil.
+func (m *LayeredMusic) layer(i int) *musicLayer {
+	m.ctl.Lock()
+	defer m.ctl.Unlock()
+
+	if i < 0 || i >= len(m.layers) {
+		return nil
+	}
+	return m.layers[i]
+}
+
+// SetLayerVolume sets the volume of the layer of the index, from 0 to 100.
+//
+// The default is 100.
+func (m *LayeredMusic) SetLayerVolume(layer int, volume float32) {
+	if l := m.layer(layer); l != nil {
+		l.SetVolume(volume)
+	}
+}
+
+// LayerVolume returns the volume of the layer of the index, from 0 to 100.
+func (m *LayeredMusic) LayerVolume(layer int) float32 {
+	l := m.layer(layer)
+	if l == nil {
+		return 0
+	}
+	stateLock.Lock()
+	defer stateLock.Unlock()
+	return l.volume
+}
+
+// FadeLayer changes the volume of the layer of the index along the curve over
+// the duration, like FadeTo.
+func (m *LayeredMusic) FadeLayer(layer int, volume float32, d time.Duration, curve Curve) *Tween {
+	l := m.layer(layer)
+	if l == nil {
+		return startTween(0, func(float64) {}, nil)
+	}
+	return l.FadeTo(volume, d, curve)
+}
+
+// SetBus puts all the layers on the bus, or on the master bus if bus is nil.
+func (m *LayeredMusic) SetBus(bus *Bus) {
+	m.ctl.Lock()
+	defer m.ctl.Unlock()
+
+	for _, l := range m.layers {
+		l.SetBus(bus)
+	}
+}
+
+// SetLoop sets whether the music should loop after reaching the end of the longest layer.
+func (m *LayeredMusic) SetLoop(loop bool) {
+	m.lock.Lock()
+	defer m.lock.Unlock()
+	m.loop = loop
+}
+
+// Loop tells whether the music is in loop mode.
+func (m *LayeredMusic) Loop() bool {
+	m.lock.Lock()
+	defer m.lock.Unlock()
+	return m.loop
+}
+
+// SetBufferDuration sets the duration of each audio buffer, like SoundStream.SetBufferDuration.
+func (m *LayeredMusic) SetBufferDuration(duration time.Duration) {
+	if duration < 0 {
+		duration = 0
+	}
+	m.lock.Lock()
+	defer m.lock.Unlock()
+	m.bufferDuration = duration
+}
+
+// SetBufferCount sets the number of audio buffers queued on each layer,
+// like SoundStream.SetBufferCount.
+func (m *LayeredMusic) SetBufferCount(count int) {
+	if count != 0 && count < minSoundStreamBufferCount {
+		count = minSoundStreamBufferCount
+	}
+	m.lock.Lock()
+	defer m.lock.Unlock()
+	m.bufferCount = count
+}
+
+// SampleRate returns the sample rate of the layers, in samples per second.
+func (m *LayeredMusic) SampleRate() int {
+	m.lock.Lock()
+	defer m.lock.Unlock()
+	return m.sampleRate
+}
+
+// Duration returns the duration of the longest layer.
+func (m *LayeredMusic) Duration() time.Duration {
+	m.lock.Lock()
+	defer m.lock.Unlock()
+	return framesToDuration(m.length, m.sampleRate)
+}
+
+// Play starts or resumes playing all the layers together.
+//
+// It restarts the music from the beginning if it is already playing.
+func (m *LayeredMusic) Play() {
+	m.ctl.Lock()
+	defer m.ctl.Unlock()
+
+	if len(m.layers) == 0 {
+		return
+	}
+
+	m.lock.Lock()
+	streaming, state := m.streaming, m.state
+	m.lock.Unlock()
+
+	if streaming {
+		if state == Paused {
+			m.lock.Lock()
+			m.state = Playing
+			m.lock.Unlock()
+			C.alSourcePlayv(C.ALsizei(len(m.sources)), &m.sources[0])
+			alCheck("alSourcePlayv")
+			emit(&m.layers[0].soundSource, EventStarted)
+			return
+		}
+		m.stop()
+	}
+
+	m.lock.Lock()
+	m.streaming = true
+	m.state = Playing
+	m.lock.Unlock()
+	m.launch()
+	emit(&m.layers[0].soundSource, EventStarted)
+}
+
+// Pause pauses all the layers together.
+func (m *LayeredMusic) Pause() {
+	m.ctl.Lock()
+	defer m.ctl.Unlock()
+
+	m.lock.Lock()
+	if !m.streaming {
+		m.lock.Unlock()
+		return
+	}
+	m.state = Paused
+	m.lock.Unlock()
+
+	C.alSourcePausev(C.ALsizei(len(m.sources)), &m.sources[0])
+	alCheck("alSourcePausev")
+	emit(&m.layers[0].soundSource, EventPaused)
+}
+
+// Stop stops all the layers, and goes back to the beginning.
+func (m *LayeredMusic) Stop() {
+	m.ctl.Lock()
+	defer m.ctl.Unlock()
+
+	m.lock.Lock()
+	streaming := m.streaming
+	m.lock.Unlock()
+
+	m.stop()
+	if streaming {
+		emit(&m.layers[0].soundSource, EventStopped)
+	}
+}
+
+// OnEvent registers fn to be called on the playback events of the music, like
+// Sound.OnEvent. The events of the music are reported once, not for each layer.
+//
+// The listener is removed by calling cancel, or when the music is closed or
+// opened again. It is never called if the music has no layers.
+func (m *LayeredMusic) OnEvent(fn func(PlaybackEvent)) (cancel func()) {
+	l := m.layer(0)
+	if l == nil {
+		return func() {}
+	}
+	return l.OnEvent(fn)
+}
+
+// Events returns a channel receiving the playback events of the music, like
+// Sound.Events. The events of the music are reported once, not for each layer.
+//
+// The channel is closed when cancel is called, or when the music is closed or
+// opened again. It is closed at once if the music has no layers.
+func (m *LayeredMusic) Events(size int) (events <-chan PlaybackEvent, cancel func()) {
+	l := m.layer(0)
+	if l == nil {
+		ch := make(chan PlaybackEvent)
+		close(ch)
+		return ch, func() {}
+	}
+	return l.Events(size)
+}
+
+// Status returns the current status of the music.
+func (m *LayeredMusic) Status() PlayStatus {
+	l := m.layer(0)
+	if l == nil {
+		return Stopped
+	}
+
+	status := l.Status()
+	if status == Stopped {
+		m.lock.Lock()
+		if m.streaming {
+			status = m.state
+		}
+		m.lock.Unlock()
+	}
+	return status
+}
+
+// PlayingOffset returns the playing position of the layers in time.
+//
+// In loop mode, the position is wrapped back into the length of the longest layer.
+func (m *LayeredMusic) PlayingOffset() time.Duration {
+	return framesToDuration(m.PlayingOffsetSamples(), m.SampleRate())
+}
+
+// PlayingOffsetSamples returns the playing position of the layers,
+// in samples of a single channel (frames).
+func (m *LayeredMusic) PlayingOffsetSamples() int64 {
+	l := m.layer(0)
+	if l == nil {
+		return 0
+	}
+
+	// the offset of the source and seekOffset change together under m.lock,
+	// as the streaming goroutine unqueues the buffers
+	m.lock.Lock()
+	defer m.lock.Unlock()
+
+	var offset C.ALint
+	stateLock.Lock()
+	C.alGetSourcei(l.source, C.AL_SAMPLE_OFFSET, &offset)
+	alCheck("alGetSourcei")
+	stateLock.Unlock()
+
+	pos := m.seekOffset + int64(offset)
+	if m.loop && m.length > 0 {
+		pos %= m.length
+	}
+	return pos
+}
+
+// SetPlayingOffset changes the playing position of all the layers, keeping them in sync.
+//
+// It can be called when the music is playing or paused.
+// Calling on a stopped music has no effect.
+func (m *LayeredMusic) SetPlayingOffset(offset time.Duration) {
+	m.SetPlayingOffsetSamples(durationToFrames(offset, m.SampleRate()))
+}
+
+// SetPlayingOffsetSamples changes the playing position of all the layers,
+// in samples of a single channel (frames), keeping them in sync.
+func (m *LayeredMusic) SetPlayingOffsetSamples(offset int64) {
+	oldstatus := m.Status()
+
+	m.ctl.Lock()
+	defer m.ctl.Unlock()
+
+	if oldstatus == Stopped {
+		return
+	}
+	m.stop()
+
+	m.lock.Lock()
+	if offset < 0 {
+		offset = 0
+	}
+	for _, l := range m.layers {
+		l.reader.Seek(offset * int64(l.info.ChannelCount))
+	}
+	m.streaming = true
+	m.state = oldstatus
+	m.seekOffset = offset
+	m.lock.Unlock()
+	m.launch()
+}
+
+// stop stops the streaming, and seeks the layers to the beginning. m.ctl must be held.
+func (m *LayeredMusic) stop() {
+	m.lock.Lock()
+	m.streaming = false
+	m.lock.Unlock()
+
+	if m.wake != nil {
+		wakeup(m.wake)
+	}
+	if m.running != nil {
+		<-m.running
+		m.running = nil
+		m.setPlayer(nil)
+	}
+
+	m.lock.Lock()
+	m.seekOffset = 0
+	for _, l := range m.layers {
+		l.reader.Seek(0)
+	}
+	m.lock.Unlock()
+}
+
+// setPlayer sets the music paused and resumed by the bus in place of its layers,
+// or nil.
+func (m *LayeredMusic) setPlayer(p busPlayer) {
+	stateLock.Lock()
+	defer stateLock.Unlock()
+	for _, l := range m.layers {
+		l.setPlayer(p)
+	}
+}
+
+// launch starts the streaming goroutine. m.ctl must be held.
+func (m *LayeredMusic) launch() {
+	m.running = make(chan struct{})
+	m.wake = make(chan struct{}, 1)
+	startStreaming(m.wake)
+	go m.streamData(m.running, m.wake)
+}
+
+// streamData is the streaming goroutine, feeding all the layers.
+// It closes done when it ends.
+func (m *LayeredMusic) streamData(done chan struct{}, wake chan struct{}) {
+	defer endStreaming(wake)
+	defer close(done)
+
+	m.lock.Lock()
+	if m.state == Stopped {
+		m.lock.Unlock()
+		return
+	}
+	count, duration := m.bufferCount, m.bufferDuration
+	m.lock.Unlock()
+	if count == 0 {
+		count = DefaultSoundStreamBufferCount
+	}
+	if duration == 0 {
+		duration = DefaultSoundStreamBufferDuration
+	}
+	frames := durationToFrames(duration, m.sampleRate)
+	if frames < 1 {
+		frames = 1
+	}
+
+	// the bus pauses and resumes the music while it streams; it is released
+	// by the end of the music, or by stop
+	m.setPlayer(m)
+
+	// create the buffers, the same count for every layer
+	m.loops = make([]int, count)
+	for _, l := range m.layers {
+		l.buffers = make([]C.ALuint, count)
+		C.alGenBuffers(C.ALsizei(count), &l.buffers[0])
+		alCheck("alGenBuffers")
+		if extEvents {
+			setWaker(l.source, wake)
+		}
+	}
+	timer := time.NewTimer(time.Hour)
+	timer.Stop()
+	interval := pollInterval(duration)
+
+	// fill the queues, and start the sources together
+	var wantstop bool
+	for i := 0; i < count && !wantstop; i++ {
+		wantstop = m.fillStep(i, frames)
+	}
+	n := C.ALsizei(len(m.sources))
+	C.alSourcePlayv(n, &m.sources[0])
+	alCheck("alSourcePlayv")
+
+	m.lock.Lock()
+	if m.state == Paused {
+		C.alSourcePausev(n, &m.sources[0])
+		alCheck("alSourcePausev")
+	}
+	m.lock.Unlock()
+
+	for {
+		m.lock.Lock()
+		if !m.streaming {
+			m.lock.Unlock()
+			break
+		}
+		m.lock.Unlock()
+
+		if isShuttingDown() {
+			break
+		}
+
+		// refill the buffers processed by all the sources
+		processed := C.ALint(count)
+		for _, l := range m.layers {
+			var p C.ALint
+			C.alGetSourcei(l.source, C.AL_BUFFERS_PROCESSED, &p)
+			alCheck("alGetSourcei")
+			if p < processed {
+				processed = p
+			}
+		}
+
+		for i := 0; i < int(processed); i++ {
+			// the offset of the first layer changes with seekOffset, under m.lock
+			var num int
+			m.lock.Lock()
+			for j, l := range m.layers {
+				var buffer C.ALuint
+				C.alSourceUnqueueBuffers(l.source, 1, &buffer)
+				alCheck("alSourceUnqueueBuffers")
+
+				// the buffers are queued in the same order on every layer
+				if j == 0 {
+					for k := range l.buffers {
+						if l.buffers[k] == buffer {
+							num = k
+							break
+						}
+					}
+					var size C.ALint
+					C.alGetBufferi(buffer, C.AL_SIZE, &size)
+					alCheck("alGetBufferi")
+					m.seekOffset += int64(size) / int64(unsafe.Sizeof(int16(0))) / int64(l.info.ChannelCount)
+				}
+			}
+			m.lock.Unlock()
+
+			// the loop wraps in the buffers are played
+			for ; m.loops[num] > 0; m.loops[num]-- {
+				emit(&m.layers[0].soundSource, EventLooped)
+			}
+
+			if !wantstop {
+				wantstop = m.fillStep(num, frames)
+			}
+		}
+
+		// the queues are of the same length, so the sources run dry together,
+		// unless some of them are starved by the mixer
+		stopped := 0
+		for _, l := range m.layers {
+			if l.Status() == Stopped {
+				stopped++
+			}
+		}
+		ended := stopped == len(m.layers) && wantstop
+		if ended {
+			// end streaming
+			m.setPlayer(nil)
+			m.lock.Lock()
+			m.streaming = false
+			m.lock.Unlock()
+			emit(&m.layers[0].soundSource, EventEnded)
+		} else if stopped > 0 && !wantstop {
+			m.resync()
+			emit(&m.layers[0].soundSource, EventUnderrun)
+		}
+
+		if !ended {
+			if extEvents {
+				sleep(timer, wake, duration)
+			} else {
+				interval = adaptPollInterval(interval, duration, int(processed))
+				sleep(timer, wake, interval)
+			}
+		}
+	}
+
+	// stop playback, and delete the buffers
+	C.alSourceStopv(n, &m.sources[0])
+	alCheck("alSourceStopv")
+	for _, l := range m.layers {
+		if extEvents {
+			setWaker(l.source, nil)
+		}
+
+		var queued C.ALint
+		C.alGetSourcei(l.source, C.AL_BUFFERS_QUEUED, &queued)
+		alCheck("alGetSourcei")
+		var buffer C.ALuint
+		for i := 0; i < int(queued); i++ {
+			C.alSourceUnqueueBuffers(l.source, 1, &buffer)
+			alCheck("alSourceUnqueueBuffers")
+		}
+		C.alSourcei(l.source, C.AL_BUFFER, 0)
+		alCheck("alSourcei")
+		C.alDeleteBuffers(C.ALsizei(len(l.buffers)), &l.buffers[0])
+		alCheck("alDeleteBuffers")
+		l.buffers = nil
+	}
+	m.loops = nil
+
+	m.lock.Lock()
+	m.state = Stopped
+	m.streaming = false
+	m.lock.Unlock()
+}
+
+// resync restarts the sources together after some of them ran dry, from the
+// position of the ones least advanced, so that the layers stay in sync.
+// The buffers processed by all the sources must be refilled first.
+func (m *LayeredMusic) resync() {
+	m.lock.Lock()
+	defer m.lock.Unlock()
+	stateLock.Lock()
+	defer stateLock.Unlock()
+
+	n := C.ALsizei(len(m.sources))
+	C.alSourcePausev(n, &m.sources[0])
+	alCheck("alSourcePausev")
+
+	// the stopped sources start over from the first buffer left in their queues
+	offset := C.ALint(-1)
+	for _, l := range m.layers {
+		if sourceStatus(l.source) == Stopped {
+			continue
+		}
+		var o C.ALint
+		C.alGetSourcei(l.source, C.AL_SAMPLE_OFFSET, &o)
+		alCheck("alGetSourcei")
+		if offset < 0 || o < offset {
+			offset = o
+		}
+	}
+	if offset < 0 {
+		offset = 0
+	}
+	for _, l := range m.layers {
+		C.alSourcei(l.source, C.AL_SAMPLE_OFFSET, offset)
+		alCheck("alSourcei")
+	}
+
+	if m.state != Paused {
+		C.alSourcePlayv(n, &m.sources[0])
+		alCheck("alSourcePlayv")
+	}
+}
+
+// fillStep decodes the same number of frames from every layer into the buffers
+// of the index, and queues them. It returns true if the end is reached, not in
+// loop mode.
+func (m *LayeredMusic) fillStep(num int, frames int64) bool {
+	m.lock.Lock()
+	defer m.lock.Unlock()
+
+	for _, l := range m.layers {
+		if size := int(frames) * l.info.ChannelCount; len(l.data) != size {
+			l.data = make([]int16, size)
+		}
+		l.frames = 0
+	}
+
+	var filled int64
+	var looped bool
+	m.loops[num] = 0
+	for filled < frames {
+		longest := filled
+		for _, l := range m.layers {
+			ch := int64(l.info.ChannelCount)
+			l.frames = filled + int64(readFull(l.reader, l.data[filled*ch:frames*ch]))/ch
+			if l.frames > longest {
+				longest = l.frames
+			}
+		}
+
+		// pad the layers ended with silence
+		for _, l := range m.layers {
+			ch := int64(l.info.ChannelCount)
+			for i := l.frames * ch; i < longest*ch; i++ {
+				l.data[i] = 0
+			}
+		}
+
+		read := longest - filled
+		filled = longest
+		if filled < frames {
+			// all the layers are at their end
+			if !m.loop || read == 0 && looped {
+				break
+			}
+			for _, l := range m.layers {
+				l.reader.Seek(0)
+			}
+			looped = true
+			m.loops[num]++
+		}
+	}
+
+	if filled == 0 {
+		return true
+	}
+	for _, l := range m.layers {
+		size := filled * int64(l.info.ChannelCount) * int64(unsafe.Sizeof(int16(0)))
+		C.alBufferData(l.buffers[num], l.format, unsafe.Pointer(&l.data[0]), C.ALsizei(size), C.ALsizei(l.info.SampleRate))
+		alCheck("alBufferData")
+		C.alSourceQueueBuffers(l.source, 1, &l.buffers[num])
+		alCheck("alSourceQueueBuffers")
+	}
+	return filled < frames
+}
+
+// readFull reads from the reader until data is full or the end of the file,
+// returning the number of samples read.
+func readFull(reader SoundFileReader, data []int16) int {
+	total := 0
+	for total < len(data) {
+		n, err := reader.Read(data[total:])
+		total += int(n)
+		if n <= 0 || err != nil {
+			break
+		}
+	}
+	return total
+}
@@ -0,0 +1,43 @@
+package audio
+
+import (
+	"bytes"
+	"testing"
+	"time"
+)
+
+func TestLayeredMusicEvents(t *testing.T) {
+	if err := Init(); err != nil {
+		t.Skip("cannot open the device:", err)
+	}
+	defer Shutdown()
+
+	track := append(append([]byte(nil), testTrackMagic...), make([]byte, 4410*2)...)
+	m := NewLayeredMusic()
+	defer m.Close()
+	if err := m.Open(bytes.NewReader(track), bytes.NewReader(track)); err != nil {
+		t.Fatal(err)
+	}
+	m.SetLoop(true)
+	events, cancel := m.Events(8)
+	defer cancel()
+
+	m.Play()
+	m.Pause()
+	if st := m.Status(); st != Paused {
+		t.Errorf("Status = %v after Pause, want Paused", st)
+	}
+	m.Play()
+	m.Stop()
+
+	for _, want := range []PlaybackEventType{EventStarted, EventPaused, EventStarted, EventStopped} {
+		select {
+		case ev := <-events:
+			if ev.Type != want {
+				t.Fatalf("event %v, want %v", ev.Type, want)
+			}
+		case <-time.After(time.Second):
+			t.Fatalf("no event, want %v", want)
+		}
+	}
+}
@@ -0,0 +1,34 @@
+package audio
+
+import "sync"
+
+// The public API is safe for concurrent use. OpenAL itself is thread-safe,
+// so the locks only protect the state kept on the Go side.
+//
+// The locks, in the order they are taken:
+//
+//	AssetManager.lock the buffers cached by an AssetManager; not held while decoding
+//	SoundStream.ctl   serializes Init, Play, Pause, Stop, SetPlayingOffset and Close
+//	                  of a stream; held while waiting for the streaming goroutine
+//	Music.lock        the file reader and the read position of a Music, or the
+//	                  tracks of a Playlist (Playlist.lock); held while decoding
+//	SoundStream.lock  the state shared with the streaming goroutine
+//	                  (LayeredMusic.ctl and LayeredMusic.lock are taken like
+//	                  SoundStream.ctl and SoundStream.lock)
+//	VoicePool.lock    the voices of a pool, and the state of its PooledSounds
+//	SoundEvent.lock   the variant picked, and the instances playing, of a SoundEvent
+//	oneShotLock       the pool of Sounds of SoundBuffer.PlayOneShot
+//	tweenLock         the tweens and the ducking rules; not held while stepping them
+//	stateLock         the listener, the Sounds, the SoundBuffers, the buses and the OpenAL
+//	                  names of the sources
+//	liveLock          the names of the live OpenAL objects, and the wake channels
+//	                  of the streaming goroutines, for Shutdown
+//	dispatchLock      the playback event listeners, and the events to be delivered
+//	eventLock         the wake channels of the streams, for the OpenAL event thread
+//	callbackLock      the CallbackStreams by their ids, for the OpenAL mixer thread
+//
+// A goroutine holding a lock never takes a lock listed before it.
+// stateLock is held only for short sections without decoding or waiting,
+// and the streaming goroutine never takes SoundStream.ctl.
+// Unexported functions expecting a lock to be held say so in their doc comments.
+var stateLock sync.Mutex
@@ -0,0 +1,112 @@
+package audio
+
+import (
+	"bytes"
+	"math/rand"
+	"sync"
+	"testing"
+	"time"
+)
+
+// TestConcurrentUse calls the API on a playing Music and Sound from several
+// goroutines at once; it is meant to be run with the race detector.
+func TestConcurrentUse(t *testing.T) {
+	if err := Init(); err != nil {
+		t.Skip("cannot open the device:", err)
+	}
+	defer Shutdown()
+
+	b := NewSoundBuffer()
+	defer b.Release()
+	loadRaw(t, b, 4410, 1)
+	s := NewSound()
+	s.SetBuffer(b)
+
+	m := NewMusic()
+	if err := m.OpenReader(NewRawPCMReader(PCMS16, nil, 1, 44100), bytes.NewReader(make([]byte, 44100*2))); err != nil {
+		t.Fatal(err)
+	}
+	m.SetLoop(true)
+	m.OnEvent(func(PlaybackEvent) {})
+	_, cancel := s.Events(1)
+	defer cancel()
+
+	bus := NewBus("Concurrent", nil)
+	defer bus.SetPaused(false)
+	m.Play()
+	s.Play()
+
+	const workers, calls = 8, 50
+	var wg sync.WaitGroup
+	for w := 0; w < workers; w++ {
+		wg.Add(1)
+		go func(seed int64) {
+			defer wg.Done()
+			r := rand.New(rand.NewSource(seed))
+			for i := 0; i < calls; i++ {
+				offset := time.Duration(r.Intn(1000)) * time.Millisecond
+				switch r.Intn(10) {
+				case 0:
+					m.Play()
+					s.Play()
+				case 1:
+					m.Pause()
+					s.Pause()
+				case 2:
+					m.Stop()
+					s.Stop()
+				case 3:
+					m.SetVolume(r.Float32() * 100)
+					s.SetVolume(r.Float32() * 100)
+				case 4:
+					m.SetPlayingOffset(offset)
+					s.SetPlayingOffset(offset)
+				case 5:
+					SetListenerPosition([3]float32{r.Float32(), 0, 0})
+					SetListenerDirection([3]float32{0, 0, -1})
+					SetListenerUpVector([3]float32{0, 1, 0})
+					SetGlobalVolume(r.Float32() * 100)
+				case 6:
+					bus.SetVolume(r.Float32() * 100)
+					bus.SetMuted(r.Intn(2) == 0)
+					bus.SetPitch(0.5 + r.Float32())
+				case 7:
+					bus.SetPaused(r.Intn(2) == 0)
+				case 8:
+					if r.Intn(2) == 0 {
+						m.SetBus(bus)
+						s.SetBus(bus)
+					} else {
+						m.SetBus(MasterBus())
+						s.SetBus(MasterBus())
+					}
+				case 9:
+					m.Status()
+					m.PlayingOffset()
+					s.Status()
+					s.PlayingOffset()
+					GetListenerPosition()
+				}
+			}
+		}(int64(w))
+	}
+	wg.Wait()
+
+	// closed from several goroutines, while still used
+	m.Play()
+	s.Play()
+	for w := 0; w < workers; w++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			m.SetVolume(50)
+			m.Pause()
+			m.Close()
+			m.Status()
+			s.SetVolume(50)
+			s.Release()
+			s.Status()
+		}()
+	}
+	wg.Wait()
+}
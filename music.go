@@ -1,16 +1,16 @@
 package audio
 
 import (
-	"errors"
 	"fmt"
 	"io"
 	"sync"
 	"time"
 )
 
-const (
-	MusicBufferLength = time.Second // the length of the internal buffer of Music
-)
+// MusicBufferLength is the default length of the internal buffer of Music.
+//
+// Deprecated: Use DefaultSoundStreamBufferDuration, or SoundStream.SetBufferDuration.
+const MusicBufferLength = DefaultSoundStreamBufferDuration
 
 // musicStream satisfies SoundStreamInterface
 type musicStream struct {
@@ -21,14 +21,59 @@ func (m musicStream) GetData() []int16 {
 	m.music.lock.Lock()
 	defer m.music.lock.Unlock()
 
-	read, _ := m.music.file.Read(m.music.buffer)
-	return m.music.buffer[:read]
+	if size := m.music.bufferSize(); len(m.music.buffer) != size {
+		m.music.buffer = make([]int16, size)
+	}
+
+	total := m.music.fill(int64(len(m.music.buffer)), func(from, to int64) int64 {
+		read, _ := m.music.file.Read(m.music.buffer[from:to])
+		return read
+	})
+	return m.music.buffer[:total]
+}
+
+// musicFloatStream satisfies SoundStreamFloatInterface,
+// used if the file reader supports float samples.
+type musicFloatStream struct {
+	musicStream
+}
+
+func (m musicFloatStream) GetDataFloat() []float32 {
+	m.music.lock.Lock()
+	defer m.music.lock.Unlock()
+
+	reader := m.music.file.(SoundFileFloatReader)
+	if size := m.music.bufferSize(); len(m.music.floatBuffer) != size {
+		m.music.floatBuffer = make([]float32, size)
+	}
+
+	total := m.music.fill(int64(len(m.music.floatBuffer)), func(from, to int64) int64 {
+		read, _ := reader.ReadFloat(m.music.floatBuffer[from:to])
+		return read
+	})
+	return m.music.floatBuffer[:total]
 }
 
 func (m musicStream) Seek(offset time.Duration) {
+	m.SeekSample(durationToFrames(offset, m.music.SampleRate()))
+}
+
+// SeekSample satisfies SoundStreamSeeker.
+func (m musicStream) SeekSample(offset int64) {
 	m.music.lock.Lock()
 	defer m.music.lock.Unlock()
-	m.music.file.Seek(int64(offset.Seconds() * float64(m.music.info.SampleRate) * float64(m.music.info.ChannelCount)))
+
+	if m.music.file == nil {
+		// closed
+		return
+	}
+
+	info := m.music.streamInfo()
+	m.music.offset = offset * int64(info.ChannelCount)
+	if m.music.offset > info.SampleCount {
+		m.music.offset = info.SampleCount
+	}
+	m.music.file.Seek(m.music.offset)
 }
 
 // Music is a streamed sound played from a InputSoundFile.
@@ -37,45 +82,249 @@ type Music struct {
 
 	file SoundFileReader
 
-	lock   sync.Mutex
-	buffer []int16
+	lock        sync.Mutex
+	buffer      []int16   // allocated by GetData, of bufferSize samples
+	floatBuffer []float32 // allocated by GetDataFloat instead, if streaming float samples
+	offset      int64     // read position of the file, in samples
+	loop        bool
+	tempo       TempoMap
+
+	leak *leakCheck
 }
 
 func NewMusic() (m *Music) {
 	m = &Music{}
+	m.leak = newLeakCheck("Music")
 	return
 }
 
 func (m *Music) Open(file io.ReadSeeker) (err error) {
-	m.file = NewSoundFileReader(file)
-	if m.file == nil {
-		return errors.New("Music: cannot open: unknown format")
+	reader := NewSoundFileReader(file)
+	if reader == nil {
+		return fmt.Errorf("Music: cannot open: %w", ErrUnknownFormat)
+	}
+
+	return m.OpenReader(reader, file)
+}
+
+// OpenReader opens the file for streaming, decoded by the given reader.
+//
+// This is useful when the format cannot be detected from the file,
+// e.g., raw PCM data read by a RawPCMReader.
+func (m *Music) OpenReader(reader SoundFileReader, file io.ReadSeeker) (err error) {
+	_, err = file.Seek(0, io.SeekStart)
+	if err != nil {
+		return fmt.Errorf("Music: cannot seek stream: %w", err)
+	}
+
+	m.ctl.Lock()
+	defer m.ctl.Unlock()
+
+	// the old stream keeps playing if the new file cannot be opened,
+	// unless it is read by the same reader
+	m.lock.Lock()
+	same := m.file == reader
+	m.lock.Unlock()
+	if same {
+		m.stop()
 	}
 
-	m.info, err = m.file.Open(file)
+	info, err := reader.Open(file)
 	if err != nil {
-		return fmt.Errorf("Music: cannot open stream: %s", err.Error())
+		return fmt.Errorf("Music: cannot open stream: %w", err)
 	}
 
-	m.init()
+	// stop the old stream before replacing its file
+	m.stop()
+	return m.setReader(reader, info)
+}
+
+// openReader streams the reader, already opened with the info.
+func (m *Music) openReader(reader SoundFileReader, info SoundFileInfo) error {
+	m.ctl.Lock()
+	defer m.ctl.Unlock()
+
+	m.stop()
+	return m.setReader(reader, info)
+}
+
+// setReader streams the reader, opened with the info, closing the reader
+// it replaces. m.ctl must be held, with the stream stopped.
+func (m *Music) setReader(reader SoundFileReader, info SoundFileInfo) (err error) {
+	m.lock.Lock()
+	if m.file != nil && m.file != reader {
+		m.file.Close()
+	}
+	m.file = reader
+	m.offset = 0
+	m.lock.Unlock()
+
+	err = m.init(info)
+	if err != nil {
+		return fmt.Errorf("Music: cannot open stream: %w", err)
+	}
 
+	m.leak.hold()
 	return nil
 }
 
-// init is called when the music file has changed
-func (m *Music) init() {
+// init is called when the music file has changed. m.ctl must be held.
+func (m *Music) init(info SoundFileInfo) error {
 
-	m.SoundStream.Init(
-		musicStream{m},
-		m.info,
-	)
+	var iface SoundStreamInterface = musicStream{m}
+	if _, ok := m.file.(SoundFileFloatReader); ok {
+		iface = musicFloatStream{musicStream{m}}
+	}
+	return m.SoundStream.initStream(iface, info)
+}
+
+// bufferSize returns the number of samples in a buffer of BufferDuration.
+func (m *Music) bufferSize() int {
+	info := m.streamInfo()
+	size := int(float64(info.SampleRate)*m.BufferDuration().Seconds()) * info.ChannelCount
+	if size < info.ChannelCount {
+		size = info.ChannelCount
+	}
+	return size
+}
+
+// SetLoop sets whether the music should loop after reaching the end.
+//
+// If the file has a loop of its own (the reader implements SoundFileLooper),
+// the music plays to the end of the loop, and then repeats the loop section only.
+// Otherwise the whole file is repeated.
+func (m *Music) SetLoop(loop bool) {
+	m.lock.Lock()
+	m.loop = loop
+	m.lock.Unlock()
+}
+
+// Loop tells whether the music is in loop mode.
+func (m *Music) Loop() bool {
+	m.lock.Lock()
+	defer m.lock.Unlock()
+	return m.loop
+}
 
-	//if m.buffer == nil {
-	// allocate a second worth of buffer
-	m.buffer = make([]int16, int(float64(m.info.SampleRate*m.info.ChannelCount)*MusicBufferLength.Seconds()))
-	//}
+// fill reads at most size samples from the file, by calling read
+// with the range of the buffer to be read into.
+//
+// In loop mode, it fills the whole size, jumping back to the loop start at its end.
+//
+// It returns the number of samples read.
+func (m *Music) fill(size int64, read func(from, to int64) int64) int64 {
+	if !m.loop {
+		n := read(0, size)
+		m.offset += n
+		return n
+	}
+
+	start, end := m.loopPoints()
+	var total int64
+	for total < size {
+		to := size
+		if left := end - m.offset; left > 0 && left < to-total {
+			to = total + left
+		}
+
+		n := read(total, to)
+		total += n
+		m.offset += n
+
+		if n == 0 || m.offset >= end {
+			if n == 0 && m.offset == start {
+				// nothing to play in the loop
+				break
+			}
+			if m.file.Seek(start) != nil {
+				break
+			}
+			m.offset = start
+			m.markLoop(total)
+		}
+	}
+	return total
 }
 
+// loopPoints returns the loop section of the file, in samples. m.lock must be held.
+func (m *Music) loopPoints() (start, end int64) {
+	count := m.streamInfo().SampleCount
+	if looper, ok := m.file.(SoundFileLooper); ok {
+		start, end = looper.LoopPoints()
+		if start >= 0 && start < end && end <= count {
+			return
+		}
+	}
+	return 0, count
+}
+
+// PlayingOffset returns the playing position of the music in time.
+//
+// In loop mode, the position is wrapped back into the loop section.
+func (m *Music) PlayingOffset() time.Duration {
+	return framesToDuration(m.PlayingOffsetSamples(), m.SampleRate())
+}
+
+// PlayingOffsetSamples returns the playing position of the music,
+// in samples of a single channel (frames).
+//
+// In loop mode, the position is wrapped back into the loop section.
+func (m *Music) PlayingOffsetSamples() int64 {
+	return m.wrapLoop(m.SoundStream.PlayingOffsetSamples())
+}
+
+// Clock samples the playback position of the music.
+//
+// In loop mode, the position is wrapped back into the loop section.
+func (m *Music) Clock() Clock {
+	c := m.SoundStream.Clock()
+	if wrapped := m.wrapLoop(c.OffsetSamples); wrapped != c.OffsetSamples {
+		c.Offset -= framesToDuration(c.OffsetSamples, m.SampleRate()) - framesToDuration(wrapped, m.SampleRate())
+		c.OffsetSamples = wrapped
+	}
+	return c
+}
+
+// wrapLoop wraps the offset in frames back into the loop section, in loop mode.
+func (m *Music) wrapLoop(offset int64) int64 {
+	m.lock.Lock()
+	loop := m.loop && m.file != nil
+	var start, end int64
+	if loop {
+		start, end = m.loopPoints()
+	}
+	m.lock.Unlock()
+
+	channels := int64(m.ChannelCount())
+	if !loop || channels == 0 {
+		return offset
+	}
+
+	// the loop points are in samples of all the channels
+	start, end = start/channels, end/channels
+	if end <= start {
+		return offset
+	}
+	if offset >= end {
+		offset = start + (offset-start)%(end-start)
+	}
+	return offset
+}
+
+// Close stops the music, frees its OpenAL source, and closes the file reader.
+//
+// The music can be opened again after Close. Calling Close more than once does nothing.
 func (m *Music) Close() {
-	m.SoundStream.Close()
+	m.ctl.Lock()
+	defer m.ctl.Unlock()
+
+	m.SoundStream.close()
+	m.leak.release()
+
+	m.lock.Lock()
+	if m.file != nil {
+		m.file.Close()
+		m.file = nil
+	}
+	m.lock.Unlock()
 }
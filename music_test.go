@@ -0,0 +1,56 @@
+package audio
+
+import (
+	"bytes"
+	"testing"
+)
+
+// closeCountReader is a RawPCMReader counting its Closes.
+type closeCountReader struct {
+	*RawPCMReader
+	closes int
+}
+
+func (r *closeCountReader) Close() error {
+	r.closes++
+	return r.RawPCMReader.Close()
+}
+
+func TestMusicOpenReader(t *testing.T) {
+	if err := Init(); err != nil {
+		t.Skip("cannot open the device:", err)
+	}
+	defer Shutdown()
+
+	m := NewMusic()
+	file := func() *bytes.Reader { return bytes.NewReader(make([]byte, 44100*2)) }
+	first := &closeCountReader{RawPCMReader: NewRawPCMReader(PCMS16, nil, 1, 44100)}
+	if err := m.OpenReader(first, file()); err != nil {
+		t.Fatal(err)
+	}
+	m.Play()
+
+	// a file that cannot be opened leaves the old one playing
+	if err := m.OpenReader(NewRawPCMReader(PCMS16, nil, 0, 44100), file()); err == nil {
+		t.Fatal("OpenReader of a reader without channels succeeded")
+	}
+	if st := m.Status(); st != Playing {
+		t.Errorf("Status = %v after a failed OpenReader, want Playing", st)
+	}
+	if first.closes != 0 {
+		t.Errorf("old reader closed %d times by a failed OpenReader", first.closes)
+	}
+
+	// the old reader is closed once replaced, and the new one by Close
+	second := &closeCountReader{RawPCMReader: NewRawPCMReader(PCMS16, nil, 1, 44100)}
+	if err := m.OpenReader(second, file()); err != nil {
+		t.Fatal(err)
+	}
+	if first.closes != 1 || second.closes != 0 {
+		t.Errorf("readers closed %d and %d times after OpenReader, want 1 and 0", first.closes, second.closes)
+	}
+	m.Close()
+	if first.closes != 1 || second.closes != 1 {
+		t.Errorf("readers closed %d and %d times after Close, want 1 and 1", first.closes, second.closes)
+	}
+}
@@ -0,0 +1,145 @@
+package audio
+
+import (
+	"fmt"
+	"sync"
+)
+
+// OneShotOptions are the properties of a sound played by SoundBuffer.PlayOneShot.
+type OneShotOptions struct {
+	Volume             float32    // from 0 to 100; the zero value is taken as 100, unless HasVolume
+	HasVolume          bool       // Volume is set even if zero, e.g., to start the sound silent
+	Pitch              float32    // the zero value is taken as 1
+	Position           [3]float32 // the 3D position of the sound
+	RelativeToListener bool       // Position is relative to the listener
+	Bus                *Bus       // the bus of the sound; nil for the master bus
+}
+
+// maxFreeOneShots is the most free Sounds kept in the pool of PlayOneShot;
+// the Sounds ending while it is full are released.
+const maxFreeOneShots = 16
+
+// The sounds played by PlayOneShot are taken from a pool of free Sounds,
+// and return to it when the playback event listener of the Sound sees it
+// ended or stopped.
+var (
+	oneShotLock  sync.Mutex
+	oneShotFree  []*Sound
+	oneShotsBusy = make(map[*Sound]uint64) // Sound playing -> id of its OneShot
+	oneShotID    uint64
+)
+
+// OneShot is a handle to a sound played by SoundBuffer.PlayOneShot.
+type OneShot struct {
+	sound *Sound
+	id    uint64
+}
+
+// PlayOneShot plays the buffer once on a Sound of its own, with the options given,
+// without the need to keep or release the Sound.
+//
+// The Sound is taken from an internal pool, and given back to it when the playback
+// ends. The handle returned can stop the sound early, and may be ignored.
+//
+// The error wraps ErrOutOfSources if there is no free Sound, and no more OpenAL
+// sources can be created.
+func (b *SoundBuffer) PlayOneShot(opts OneShotOptions) (*OneShot, error) {
+	if opts.Volume == 0 && !opts.HasVolume {
+		opts.Volume = 100
+	}
+	if opts.Pitch == 0 {
+		opts.Pitch = 1
+	}
+
+	oneShotLock.Lock()
+	defer oneShotLock.Unlock()
+
+	var s *Sound
+	if n := len(oneShotFree); n > 0 {
+		s = oneShotFree[n-1]
+		oneShotFree = oneShotFree[:n-1]
+	} else {
+		s = &Sound{}
+		stateLock.Lock()
+		err := s.soundSource.init()
+		stateLock.Unlock()
+		if err != nil {
+			return nil, fmt.Errorf("SoundBuffer: cannot play one-shot: %w", err)
+		}
+		s.addListener(func(ev PlaybackEvent) {
+			if ev.Type == EventEnded || ev.Type == EventStopped {
+				recycleOneShot(s)
+			}
+		}, func() {
+			dropOneShot(s)
+		})
+	}
+
+	oneShotID++
+	oneShotsBusy[s] = oneShotID
+
+	s.SetBuffer(b)
+	s.SetVolume(opts.Volume)
+	s.SetPitch(opts.Pitch)
+	s.SetPosition(opts.Position)
+	s.SetRelativeToListener(opts.RelativeToListener)
+	s.SetBus(opts.Bus)
+	s.Play()
+
+	return &OneShot{sound: s, id: oneShotID}, nil
+}
+
+// recycleOneShot gives the Sound back to the pool, if it is playing a one-shot,
+// or releases it if the pool is full.
+func recycleOneShot(s *Sound) {
+	oneShotLock.Lock()
+	if _, ok := oneShotsBusy[s]; !ok {
+		oneShotLock.Unlock()
+		return
+	}
+	delete(oneShotsBusy, s)
+	if len(oneShotFree) >= maxFreeOneShots {
+		oneShotLock.Unlock()
+		// after oneShotLock, taken again by dropOneShot
+		s.Release()
+		return
+	}
+	s.SetBuffer(nil)
+	oneShotFree = append(oneShotFree, s)
+	oneShotLock.Unlock()
+}
+
+// dropOneShot removes the Sound from the pool, once its source is deleted by Shutdown.
+func dropOneShot(s *Sound) {
+	oneShotLock.Lock()
+	defer oneShotLock.Unlock()
+
+	delete(oneShotsBusy, s)
+	for i, f := range oneShotFree {
+		if f == s {
+			oneShotFree = append(oneShotFree[:i], oneShotFree[i+1:]...)
+			break
+		}
+	}
+}
+
+// Stop stops the sound early, giving its Sound back to the pool.
+//
+// Calling Stop after the sound has ended does nothing.
+func (o *OneShot) Stop() {
+	oneShotLock.Lock()
+	defer oneShotLock.Unlock()
+
+	if o == nil || oneShotsBusy[o.sound] != o.id {
+		return
+	}
+	o.sound.Stop()
+}
+
+// IsPlaying tells if the sound has not ended or been stopped yet.
+func (o *OneShot) IsPlaying() bool {
+	oneShotLock.Lock()
+	defer oneShotLock.Unlock()
+
+	return o != nil && oneShotsBusy[o.sound] == o.id && o.sound.Status() == Playing
+}
@@ -0,0 +1,96 @@
+package audio
+
+import (
+	"testing"
+	"time"
+)
+
+func TestOneShotPoolCapped(t *testing.T) {
+	if err := Init(); err != nil {
+		t.Skip("cannot open the device:", err)
+	}
+	defer Shutdown()
+
+	b := NewSoundBuffer()
+	defer b.Release()
+
+	const n = maxFreeOneShots + 4
+	shots := make([]*OneShot, n)
+	for i := range shots {
+		o, err := b.PlayOneShot(OneShotOptions{})
+		if err != nil {
+			t.Fatal(err)
+		}
+		shots[i] = o
+	}
+	for _, o := range shots {
+		o.Stop()
+	}
+
+	// the Sounds are given back by the dispatcher
+	idle := func() bool {
+		oneShotLock.Lock()
+		defer oneShotLock.Unlock()
+		return len(oneShotsBusy) == 0
+	}
+	for deadline := time.Now().Add(time.Second); !idle() && time.Now().Before(deadline); {
+		time.Sleep(time.Millisecond)
+	}
+	if !idle() {
+		t.Fatal("the one-shots were not given back to the pool")
+	}
+
+	oneShotLock.Lock()
+	free := len(oneShotFree)
+	oneShotLock.Unlock()
+	if free != maxFreeOneShots {
+		t.Errorf("%d free Sounds kept, want %d", free, maxFreeOneShots)
+	}
+
+	released := 0
+	for _, o := range shots {
+		stateLock.Lock()
+		if o.sound.source == 0 {
+			released++
+		}
+		stateLock.Unlock()
+	}
+	if released != n-maxFreeOneShots {
+		t.Errorf("%d Sounds released, want %d", released, n-maxFreeOneShots)
+	}
+}
+
+func TestOneShotVolume(t *testing.T) {
+	if err := Init(); err != nil {
+		t.Skip("cannot open the device:", err)
+	}
+	defer Shutdown()
+
+	b := NewSoundBuffer()
+	defer b.Release()
+
+	volume := func(o *OneShot) float32 {
+		stateLock.Lock()
+		defer stateLock.Unlock()
+		return o.sound.volume
+	}
+
+	for _, c := range []struct {
+		opts OneShotOptions
+		want float32
+	}{
+		{OneShotOptions{}, 100},
+		{OneShotOptions{Volume: 50}, 50},
+		{OneShotOptions{HasVolume: true}, 0},
+		{OneShotOptions{Volume: 50, HasVolume: true}, 50},
+	} {
+		o, err := b.PlayOneShot(c.opts)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if v := volume(o); v != c.want {
+			t.Errorf("volume = %v with %+v, want %v", v, c.opts, c.want)
+		}
+		o.Stop()
+	}
+}
@@ -0,0 +1,95 @@
+// Package pcm converts PCM samples between bit depths and formats,
+// for the codecs of github.com/Edgaru089/audio.
+//
+// Integer samples are passed around as int32 in their native bit depth,
+// i.e., a 24-bit sample goes from -8388608 to 8388607. Samples deeper than
+// 16 bits are reduced to 16 bits by a Quantizer, with dither to avoid the
+// distortion truncation would cause.
+package pcm
+
+import "sync"
+
+const (
+	MinBits = 1  // the minimum bit depth of integer samples
+	MaxBits = 32 // the maximum bit depth of integer samples
+)
+
+// ValidBits tells if the bit depth can be handled by the package.
+func ValidBits(bits int) bool {
+	return bits >= MinBits && bits <= MaxBits
+}
+
+// Expand scales a sample of the bit depth to the full range of int32.
+func Expand(sample int32, bits int) int32 {
+	return sample << uint(32-bits)
+}
+
+// ToFloat32 converts a sample of the bit depth to float, normalized to [-1, 1).
+func ToFloat32(sample int32, bits int) float32 {
+	return float32(float64(sample) / float64(int64(1)<<uint(bits-1)))
+}
+
+// FromFloat32 converts a float sample in [-1, 1] to 16 bits, clipping it if out of range.
+//
+// It does not dither, as float samples in [-1, 1] seldom come from
+// a source with more precision than 16 bits needs.
+func FromFloat32(f float32) int16 {
+	v := f * 32768
+	if v != v { // NaN
+		return 0
+	}
+	if v >= 32767 {
+		return 32767
+	}
+	if v <= -32768 {
+		return -32768
+	}
+	return int16(v)
+}
+
+// SignExtend sign-extends a sample of the bit depth, stored in the low bits of v.
+func SignExtend(v uint32, bits int) int32 {
+	return int32(v<<uint(32-bits)) >> uint(32-bits)
+}
+
+// Dither is the method a Quantizer uses to reduce the bit depth.
+type Dither int8
+
+const (
+	DitherNone   Dither = iota // round to the nearest value, without dither
+	DitherTPDF                 // triangular (TPDF) dither of 2 LSBs peak-to-peak
+	DitherShaped               // TPDF dither with noise shaping, moving the noise to the less audible high frequencies
+)
+
+func (d Dither) String() string {
+	switch d {
+	case DitherNone:
+		return "none"
+	case DitherTPDF:
+		return "tpdf"
+	case DitherShaped:
+		return "shaped"
+	}
+	return "unknown"
+}
+
+var (
+	defaultDither = DitherTPDF
+	lock          sync.RWMutex
+)
+
+// SetDefaultDither sets the dither used by the codecs reducing samples to 16 bits.
+//
+// It takes effect on readers opened afterwards. The default is DitherTPDF.
+func SetDefaultDither(d Dither) {
+	lock.Lock()
+	defaultDither = d
+	lock.Unlock()
+}
+
+// DefaultDither returns the dither set by SetDefaultDither.
+func DefaultDither() Dither {
+	lock.RLock()
+	defer lock.RUnlock()
+	return defaultDither
+}
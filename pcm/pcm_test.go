@@ -0,0 +1,212 @@
+package pcm
+
+import (
+	"math"
+	"sync"
+	"testing"
+)
+
+func TestConversions(t *testing.T) {
+	if got := Expand(-1, 24); got != -256 {
+		t.Errorf("Expand(-1, 24) = %d, want -256", got)
+	}
+	if got := Expand(0x7FFF, 16); got != 0x7FFF0000 {
+		t.Errorf("Expand(0x7FFF, 16) = %#x, want 0x7FFF0000", got)
+	}
+
+	floats := []struct {
+		sample int32
+		bits   int
+		want   float32
+	}{
+		{0, 16, 0}, {-32768, 16, -1}, {16384, 16, 0.5}, {-4194304, 24, -0.5}, {math.MinInt32, 32, -1},
+	}
+	for _, tt := range floats {
+		if got := ToFloat32(tt.sample, tt.bits); got != tt.want {
+			t.Errorf("ToFloat32(%d, %d) = %v, want %v", tt.sample, tt.bits, got, tt.want)
+		}
+	}
+
+	for _, tt := range []struct {
+		f    float32
+		want int16
+	}{
+		{0, 0}, {0.5, 16384}, {-1, -32768}, {1, 32767}, {2, 32767}, {-2, -32768}, {float32(math.NaN()), 0},
+	} {
+		if got := FromFloat32(tt.f); got != tt.want {
+			t.Errorf("FromFloat32(%v) = %d, want %d", tt.f, got, tt.want)
+		}
+	}
+
+	for _, tt := range []struct {
+		v    uint32
+		bits int
+		want int32
+	}{
+		{0x7FFFFF, 24, 0x7FFFFF}, {0x800000, 24, -0x800000}, {0xFFFFFF, 24, -1}, {0x1FF, 8, -1}, {0xFFFFFFFF, 32, -1},
+	} {
+		if got := SignExtend(tt.v, tt.bits); got != tt.want {
+			t.Errorf("SignExtend(%#x, %d) = %d, want %d", tt.v, tt.bits, got, tt.want)
+		}
+	}
+
+	if ValidBits(0) || !ValidBits(1) || !ValidBits(32) || ValidBits(33) {
+		t.Errorf("ValidBits does not accept exactly 1 to 32")
+	}
+}
+
+func TestQuantizeExact(t *testing.T) {
+	for _, d := range []Dither{DitherNone, DitherTPDF, DitherShaped} {
+		q := NewQuantizer(d, 2)
+		// 16 bits and less are converted without dither
+		for _, tt := range []struct {
+			sample int32
+			bits   int
+			want   int16
+		}{
+			{1234, 16, 1234}, {-32768, 16, -32768}, {-128, 8, -32768}, {1, 12, 16},
+		} {
+			if got := q.Quantize(0, tt.sample, tt.bits); got != tt.want {
+				t.Errorf("%v: Quantize(%d, %d) = %d, want %d", d, tt.sample, tt.bits, got, tt.want)
+			}
+		}
+	}
+
+	// rounding to the nearest value without dither
+	q := NewQuantizer(DitherNone, 1)
+	for _, tt := range []struct {
+		sample int32
+		want   int16
+	}{
+		{0x1234_7F, 0x1234}, {0x1234_80, 0x1235}, {-0x80, 0}, {-0x81, -1}, {0x7FFFFF, 32767}, {-0x800000, -32768},
+	} {
+		if got := q.Quantize(0, tt.sample, 24); got != tt.want {
+			t.Errorf("none: Quantize(%#x, 24) = %#x, want %#x", tt.sample, got, tt.want)
+		}
+	}
+}
+
+// quantizeStats quantizes n samples of the 24-bit value on one channel, returning the mean
+// and the standard deviation of the error, and the largest error, in 16-bit LSBs.
+func quantizeStats(q *Quantizer, value int32, n int) (mean, stddev, max float64) {
+	x := float64(value) / 256
+	var sum, sum2 float64
+	for i := 0; i < n; i++ {
+		e := float64(q.Quantize(0, value, 24)) - x
+		sum += e
+		sum2 += e * e
+		max = math.Max(max, math.Abs(e))
+	}
+	mean = sum / float64(n)
+	return mean, math.Sqrt(sum2/float64(n) - mean*mean), max
+}
+
+func TestQuantizeDither(t *testing.T) {
+	const n = 100000
+	// a quarter of a LSB above 100, which rounding alone would lose
+	const value = 100*256 + 64
+
+	tests := []struct {
+		dither   Dither
+		maxError float64
+	}{
+		{DitherTPDF, 1.5},
+		{DitherShaped, 8}, // the shaped noise is louder, but out of the audible band
+	}
+	for _, tt := range tests {
+		mean, stddev, max := quantizeStats(NewQuantizer(tt.dither, 1), value, n)
+		if math.Abs(mean) > 0.02 {
+			t.Errorf("%v: mean error %v LSB, want the dither to keep the average", tt.dither, mean)
+		}
+		if stddev == 0 {
+			t.Errorf("%v: no noise added", tt.dither)
+		}
+		if max > tt.maxError {
+			t.Errorf("%v: error up to %v LSB, want at most %v", tt.dither, max, tt.maxError)
+		}
+	}
+
+	if mean, _, _ := quantizeStats(NewQuantizer(DitherNone, 1), value, 100); math.Abs(mean+0.25) > 1e-9 {
+		t.Errorf("none: mean error %v LSB, want -0.25", mean)
+	}
+}
+
+func TestQuantizeShapedSpectrum(t *testing.T) {
+	// the shaped noise has less energy at low frequencies than TPDF,
+	// measured by the error summed over blocks (a crude low-pass)
+	lowEnergy := func(d Dither) float64 {
+		q := NewQuantizer(d, 1)
+		var energy float64
+		for b := 0; b < 1000; b++ {
+			var sum float64
+			for i := 0; i < 32; i++ {
+				v := int32(1000 * math.Sin(float64(b*32+i)/10))
+				sum += float64(q.Quantize(0, v, 24)) - float64(v)/256
+			}
+			energy += sum * sum
+		}
+		return energy
+	}
+	if shaped, tpdf := lowEnergy(DitherShaped), lowEnergy(DitherTPDF); shaped >= tpdf {
+		t.Errorf("low frequency noise energy: shaped %v, TPDF %v; want shaped lower", shaped, tpdf)
+	}
+}
+
+func TestQuantizerReset(t *testing.T) {
+	q := NewQuantizer(DitherShaped, 2)
+	run := func() []int16 {
+		out := make([]int16, 64)
+		for i := range out {
+			out[i] = q.Quantize(i%2, int32(i*1000), 24)
+		}
+		return out
+	}
+
+	a := run()
+	q.Reset()
+	b := run()
+	for i := range a {
+		if a[i] != b[i] {
+			t.Fatalf("sample %d after Reset = %d, want %d", i, b[i], a[i])
+		}
+	}
+	if q.Dither() != DitherShaped {
+		t.Errorf("Dither = %v, want shaped", q.Dither())
+	}
+}
+
+func TestQuantizeClip(t *testing.T) {
+	for _, d := range []Dither{DitherNone, DitherTPDF, DitherShaped} {
+		q := NewQuantizer(d, 1)
+		for i := 0; i < 1000; i++ {
+			if got := q.Quantize(0, math.MaxInt32, 32); got < 32760 {
+				t.Fatalf("%v: full scale quantized to %d", d, got)
+			}
+			if got := q.Quantize(0, math.MinInt32, 32); got > -32760 {
+				t.Fatalf("%v: negative full scale quantized to %d", d, got)
+			}
+		}
+	}
+}
+
+func TestDefaultDither(t *testing.T) {
+	defer SetDefaultDither(DefaultDither())
+
+	var wg sync.WaitGroup
+	for i := 0; i < 8; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			for j := 0; j < 100; j++ {
+				SetDefaultDither(Dither(j % 3))
+				DefaultDither()
+			}
+		}(i)
+	}
+	wg.Wait()
+
+	SetDefaultDither(DitherNone)
+	if d := DefaultDither(); d != DitherNone {
+		t.Errorf("DefaultDither = %v, want none", d)
+	}
+}
@@ -0,0 +1,93 @@
+package pcm
+
+import "math"
+
+// shapingFilter is the error feedback filter for noise shaping,
+// the 3-tap F-weighted filter of Wannamaker, with most of the noise
+// moved above the frequencies the ear is the most sensitive to.
+var shapingFilter = [3]float64{1.623, -0.982, 0.109}
+
+// Quantizer reduces samples to 16 bits, with dither if they are deeper.
+//
+// It keeps the state of the dither for each channel, so a Quantizer
+// is to be used for a single stream, and is not safe for concurrent use.
+type Quantizer struct {
+	dither Dither
+	errors [][len(shapingFilter)]float64 // quantization errors of the previous samples, per channel
+	seed   uint32
+}
+
+// NewQuantizer creates a quantizer for a stream of the given number of channels.
+func NewQuantizer(dither Dither, channelCount int) *Quantizer {
+	if channelCount < 1 {
+		channelCount = 1
+	}
+	q := &Quantizer{
+		dither: dither,
+		errors: make([][len(shapingFilter)]float64, channelCount),
+	}
+	q.Reset()
+	return q
+}
+
+// Dither returns the dither method of the quantizer.
+func (q *Quantizer) Dither() Dither {
+	return q.dither
+}
+
+// Reset clears the state of the quantizer, e.g., after a seek.
+func (q *Quantizer) Reset() {
+	for i := range q.errors {
+		q.errors[i] = [len(shapingFilter)]float64{}
+	}
+	q.seed = 0x9E3779B9
+}
+
+// random returns a uniform random number in [-0.5, 0.5).
+func (q *Quantizer) random() float64 {
+	// xorshift32
+	q.seed ^= q.seed << 13
+	q.seed ^= q.seed >> 17
+	q.seed ^= q.seed << 5
+	return float64(q.seed)/(1<<32) - 0.5
+}
+
+// Quantize reduces a sample of the bit depth on the channel to 16 bits.
+//
+// Samples of 16 bits or less are converted exactly, without dither.
+func (q *Quantizer) Quantize(channel int, sample int32, bits int) int16 {
+	if bits <= 16 {
+		return int16(sample << uint(16-bits))
+	}
+
+	// the sample in units of the 16-bit LSB
+	x := float64(sample) / float64(int64(1)<<uint(bits-16))
+
+	var e *[len(shapingFilter)]float64
+	if q.dither == DitherShaped {
+		e = &q.errors[channel%len(q.errors)]
+		for i, h := range shapingFilter {
+			x -= h * e[i]
+		}
+	}
+
+	var d float64
+	if q.dither != DitherNone {
+		d = q.random() + q.random()
+	}
+	y := math.Floor(x + d + 0.5)
+
+	if e != nil {
+		// the error is taken before clipping, or the feedback would run away
+		copy(e[1:], e[:len(e)-1])
+		e[0] = y - x
+	}
+
+	if y > 32767 {
+		return 32767
+	}
+	if y < -32768 {
+		return -32768
+	}
+	return int16(y)
+}
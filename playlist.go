@@ -0,0 +1,585 @@
+package audio
+
+import (
+	"fmt"
+	"io"
+	"math/rand"
+	"os"
+	"sync"
+	"time"
+)
+
+// RepeatMode is what a Playlist plays after a track ends.
+type RepeatMode int8
+
+const (
+	RepeatOff RepeatMode = iota // the next track, stopping after the last one
+	RepeatOne                   // the same track again
+	RepeatAll                   // the next track, going back to the first one after the last
+)
+
+// playlistStream satisfies SoundStreamInterface
+type playlistStream struct {
+	playlist *Playlist
+}
+
+func (p playlistStream) GetData() []int16 {
+	p.playlist.lock.Lock()
+	defer p.playlist.lock.Unlock()
+	return p.playlist.decode()
+}
+
+// Seek does nothing; the Playlist restarts the stream to seek.
+func (p playlistStream) Seek(offset time.Duration) {}
+
+// Playlist streams a queue of music files one after another, like a Music.
+//
+// The tracks are decoded into the buffers of the same stream, so that there is
+// no gap between them. The format of the stream is the one of the track it
+// starts with; the tracks after it are converted to that format if they differ,
+// in channel count or in sample rate. Next, Previous, PlayTrack and
+// SetPlayingOffset restart the stream in the format of the track played.
+type Playlist struct {
+	SoundStream
+
+	lock    sync.Mutex // the tracks and the decoding state, like Music.lock
+	tracks  []playlistTrack
+	order   []int // the play order, of indices into tracks
+	shuffle bool
+	repeat  RepeatMode
+	rand    *rand.Rand
+
+	// the track being decoded, maybe ahead of the one heard
+	pos    int // in order
+	reader SoundFileReader
+	closer io.Closer // the file opened by path, if any
+	conv   *resampler
+	buffer []int16
+	ended  bool // there is no more track to decode
+
+	produced int64        // frames decoded since the stream started, counting from its seek offset
+	starts   []trackStart // where the tracks start in the stream
+
+	leak *leakCheck
+}
+
+type playlistTrack struct {
+	file io.ReadSeeker
+	path string // opened when played, instead of file
+}
+
+// trackStart is where a track starts in the stream.
+type trackStart struct {
+	frame int64 // the offset of the stream at the start of the track, in frames
+	track int
+	info  SoundFileInfo
+}
+
+// NewPlaylist creates an empty playlist.
+func NewPlaylist() *Playlist {
+	p := &Playlist{
+		rand: rand.New(rand.NewSource(time.Now().UnixNano())),
+	}
+	p.leak = newLeakCheck("Playlist")
+	return p
+}
+
+// Add appends the file to the playlist. The file stays in use until Close.
+//
+// In shuffle mode, the track is put at a random place among the tracks not played yet.
+func (p *Playlist) Add(file io.ReadSeeker) {
+	p.add(playlistTrack{file: file})
+}
+
+// AddPath appends the file at the path to the playlist.
+//
+// The file is opened when it is played, and closed after.
+func (p *Playlist) AddPath(path string) {
+	p.add(playlistTrack{path: path})
+}
+
+func (p *Playlist) add(t playlistTrack) {
+	p.lock.Lock()
+	defer p.lock.Unlock()
+
+	p.tracks = append(p.tracks, t)
+	i := len(p.tracks) - 1
+	if !p.shuffle || len(p.order) <= p.pos+1 {
+		p.order = append(p.order, i)
+		return
+	}
+	at := p.pos + 1 + p.rand.Intn(len(p.order)-p.pos)
+	p.order = append(p.order, 0)
+	copy(p.order[at+1:], p.order[at:])
+	p.order[at] = i
+}
+
+// TrackCount returns the number of tracks in the playlist.
+func (p *Playlist) TrackCount() int {
+	p.lock.Lock()
+	defer p.lock.Unlock()
+	return len(p.tracks)
+}
+
+// SetShuffle sets whether the tracks are played in a random order.
+//
+// Turning shuffle on shuffles the tracks after the one being played.
+// The default is false.
+func (p *Playlist) SetShuffle(shuffle bool) {
+	p.lock.Lock()
+	defer p.lock.Unlock()
+
+	if shuffle == p.shuffle {
+		return
+	}
+	p.shuffle = shuffle
+
+	current := -1
+	if p.pos < len(p.order) {
+		current = p.order[p.pos]
+	}
+	p.order = p.order[:0]
+	for i := range p.tracks {
+		if i != current {
+			p.order = append(p.order, i)
+		}
+	}
+	if shuffle {
+		p.rand.Shuffle(len(p.order), func(i, j int) {
+			p.order[i], p.order[j] = p.order[j], p.order[i]
+		})
+	}
+
+	// keep the current track at the same place
+	if current >= 0 {
+		if !shuffle {
+			p.pos = current
+		}
+		p.order = append(p.order, 0)
+		copy(p.order[p.pos+1:], p.order[p.pos:])
+		p.order[p.pos] = current
+	}
+}
+
+// Shuffle tells whether the tracks are played in a random order.
+func (p *Playlist) Shuffle() bool {
+	p.lock.Lock()
+	defer p.lock.Unlock()
+	return p.shuffle
+}
+
+// SetRepeat sets what is played after a track ends. The default is RepeatOff.
+func (p *Playlist) SetRepeat(mode RepeatMode) {
+	p.lock.Lock()
+	defer p.lock.Unlock()
+	p.repeat = mode
+}
+
+// Repeat returns what is played after a track ends.
+func (p *Playlist) Repeat() RepeatMode {
+	p.lock.Lock()
+	defer p.lock.Unlock()
+	return p.repeat
+}
+
+// Play starts or resumes playing the playlist.
+//
+// A paused playlist is resumed. Otherwise the track being played is played again
+// from its start, or the first track if the playlist has ended.
+func (p *Playlist) Play() {
+	if p.Status() == Paused {
+		p.SoundStream.Play()
+		return
+	}
+
+	p.ctl.Lock()
+	defer p.ctl.Unlock()
+
+	p.lock.Lock()
+	pos := 0
+	if start, ok := p.heard(); ok && !p.ended {
+		pos = p.orderOf(start.track)
+	}
+	empty := len(p.order) == 0
+	p.lock.Unlock()
+
+	if !empty {
+		debugLog(p.restart(pos, 0, Playing))
+	}
+}
+
+// Next plays the track after the one being played.
+//
+// After the last track, it plays the first one in RepeatAll mode,
+// and stops otherwise.
+func (p *Playlist) Next() error {
+	return p.skip(1)
+}
+
+// Previous plays the track before the one being played.
+//
+// Before the first track, it plays the last one in RepeatAll mode,
+// and the first one again otherwise.
+func (p *Playlist) Previous() error {
+	return p.skip(-1)
+}
+
+func (p *Playlist) skip(by int) error {
+	p.ctl.Lock()
+	defer p.ctl.Unlock()
+
+	p.lock.Lock()
+	pos := 0
+	if start, ok := p.heard(); ok {
+		pos = p.orderOf(start.track) + by
+	}
+	n, repeat := len(p.order), p.repeat
+	p.lock.Unlock()
+
+	if n == 0 {
+		return nil
+	}
+	switch {
+	case pos < 0 && repeat == RepeatAll:
+		pos = n - 1
+	case pos < 0:
+		pos = 0
+	case pos >= n && repeat == RepeatAll:
+		pos = 0
+	case pos >= n:
+		p.stopPlaylist()
+		p.lock.Lock()
+		p.ended = true
+		p.lock.Unlock()
+		return nil
+	}
+	return p.restart(pos, 0, Playing)
+}
+
+// PlayTrack plays the track of the index, in the order the tracks are added.
+func (p *Playlist) PlayTrack(track int) error {
+	p.ctl.Lock()
+	defer p.ctl.Unlock()
+
+	p.lock.Lock()
+	if track < 0 || track >= len(p.tracks) {
+		p.lock.Unlock()
+		return fmt.Errorf("Playlist: no track %d", track)
+	}
+	pos := p.orderOf(track)
+	p.lock.Unlock()
+
+	return p.restart(pos, 0, Playing)
+}
+
+// CurrentTrack returns the index of the track being played,
+// in the order the tracks are added, or -1 if there is none.
+func (p *Playlist) CurrentTrack() int {
+	p.lock.Lock()
+	defer p.lock.Unlock()
+
+	if start, ok := p.heard(); ok {
+		return start.track
+	}
+	return -1
+}
+
+// PlayingOffset returns the playing position in the track being played.
+func (p *Playlist) PlayingOffset() time.Duration {
+	return framesToDuration(p.PlayingOffsetSamples(), p.SampleRate())
+}
+
+// PlayingOffsetSamples returns the playing position in the track being played,
+// in samples of a single channel (frames) at the sample rate of the stream.
+func (p *Playlist) PlayingOffsetSamples() int64 {
+	offset := p.SoundStream.PlayingOffsetSamples()
+
+	p.lock.Lock()
+	defer p.lock.Unlock()
+	if start, ok := p.heardAt(offset); ok {
+		return offset - start.frame
+	}
+	return 0
+}
+
+// SetPlayingOffset changes the playing position in the track being played.
+func (p *Playlist) SetPlayingOffset(offset time.Duration) {
+	p.SetPlayingOffsetSamples(durationToFrames(offset, p.SampleRate()))
+}
+
+// SetPlayingOffsetSamples changes the playing position in the track being played,
+// in samples of a single channel (frames) at the sample rate of the stream.
+//
+// It can be called when the playlist is playing or paused.
+// Calling on a stopped playlist has no effect.
+func (p *Playlist) SetPlayingOffsetSamples(offset int64) {
+	p.ctl.Lock()
+	defer p.ctl.Unlock()
+
+	status := p.Status()
+	if status == Stopped {
+		return
+	}
+
+	p.lock.Lock()
+	start, ok := p.heard()
+	pos := p.orderOf(start.track)
+	p.lock.Unlock()
+	if !ok {
+		return
+	}
+
+	// the offset at the rate of the track
+	if rate := p.SampleRate(); rate > 0 && start.info.SampleRate != rate {
+		offset = offset * int64(start.info.SampleRate) / int64(rate)
+	}
+	debugLog(p.restart(pos, offset, status))
+}
+
+// Duration returns the duration of the track being played.
+func (p *Playlist) Duration() time.Duration {
+	p.lock.Lock()
+	defer p.lock.Unlock()
+
+	start, ok := p.heard()
+	if !ok || start.info.ChannelCount == 0 {
+		return 0
+	}
+	return framesToDuration(start.info.SampleCount/int64(start.info.ChannelCount), start.info.SampleRate)
+}
+
+// Stop stops playing the playlist. Play plays the track being played again from its start.
+func (p *Playlist) Stop() {
+	p.ctl.Lock()
+	defer p.ctl.Unlock()
+	p.stopPlaylist()
+}
+
+// stopPlaylist stops the stream, keeping the track heard for Play. p.ctl must be held.
+func (p *Playlist) stopPlaylist() {
+	p.lock.Lock()
+	streaming := p.streaming
+	start, ok := p.heard()
+	p.lock.Unlock()
+
+	p.stop()
+
+	// the stream is back at its start, with the tracks decoded ahead dropped
+	if ok && streaming {
+		p.lock.Lock()
+		start.frame = 0
+		p.starts = append(p.starts[:0], start)
+		p.ended = false
+		p.lock.Unlock()
+	}
+	if streaming {
+		emit(&p.soundSource, EventStopped)
+	}
+}
+
+// Close stops the playlist, frees its OpenAL source, and closes the track being decoded.
+//
+// The tracks are kept, and the playlist can be played again after Close.
+// Calling Close more than once does nothing.
+func (p *Playlist) Close() {
+	p.ctl.Lock()
+	defer p.ctl.Unlock()
+
+	p.SoundStream.close()
+	p.leak.release()
+
+	p.lock.Lock()
+	p.closeTrack()
+	p.lock.Unlock()
+}
+
+// restart starts streaming the track at the position of the order, from the offset
+// in frames of the track, in the format of the track. p.ctl must be held.
+func (p *Playlist) restart(pos int, offset int64, state PlayStatus) error {
+	p.stop()
+
+	p.lock.Lock()
+	info, err := p.openTrack(pos)
+	if err == nil && offset > 0 {
+		err = p.reader.Seek(offset * int64(info.ChannelCount))
+	}
+	if err != nil {
+		p.closeTrack()
+		p.lock.Unlock()
+		return fmt.Errorf("Playlist: cannot play: %w", err)
+	}
+	p.conv = nil
+	p.ended = false
+	p.produced = offset
+	p.starts = append(p.starts[:0], trackStart{frame: 0, track: p.order[pos], info: info})
+	p.lock.Unlock()
+
+	if err = p.initStream(playlistStream{p}, info); err != nil {
+		return fmt.Errorf("Playlist: cannot play: %w", err)
+	}
+	p.leak.hold()
+
+	p.SoundStream.lock.Lock()
+	p.streaming = true
+	p.state = state
+	p.seekOffset = offset
+	p.SoundStream.lock.Unlock()
+	p.launch()
+	if state == Playing {
+		emit(&p.soundSource, EventStarted)
+	}
+	return nil
+}
+
+// decode fills the buffer with the samples of the tracks, going on to the
+// next track at the end of one. p.lock must be held.
+func (p *Playlist) decode() []int16 {
+	info := p.streamInfo()
+	size := int(float64(info.SampleRate)*p.BufferDuration().Seconds()) * info.ChannelCount
+	if size < info.ChannelCount {
+		size = info.ChannelCount
+	}
+	if len(p.buffer) != size {
+		p.buffer = make([]int16, size)
+	}
+
+	total := 0
+	for total < size && p.reader != nil {
+		var n int
+		if p.conv != nil {
+			n = p.conv.read(p.buffer[total:], p.readTrack)
+		} else {
+			n = int(p.readTrack(p.buffer[total:]))
+		}
+
+		if n == 0 {
+			p.advance(info)
+			continue
+		}
+		total += n
+		p.produced += int64(n / info.ChannelCount)
+	}
+	return p.buffer[:total]
+}
+
+// readTrack reads from the track being decoded. p.lock must be held.
+func (p *Playlist) readTrack(data []int16) int64 {
+	n, _ := p.reader.Read(data)
+	return n
+}
+
+// advance opens the track after the one decoded, by the repeat mode,
+// converting it to the format of the stream. p.lock must be held.
+func (p *Playlist) advance(stream SoundFileInfo) {
+	p.closeTrack()
+
+	// skip the tracks that cannot be opened
+	for tries := 0; tries < len(p.order); tries++ {
+		pos := p.pos
+		switch {
+		case p.repeat == RepeatOne:
+		case pos+1 < len(p.order):
+			pos++
+		case p.repeat == RepeatAll:
+			pos = 0
+			if p.shuffle {
+				last := -1
+				if p.pos < len(p.order) {
+					last = p.order[p.pos]
+				}
+				p.rand.Shuffle(len(p.order), func(i, j int) {
+					p.order[i], p.order[j] = p.order[j], p.order[i]
+				})
+				// no repeat across the end of a round
+				if n := len(p.order); n > 1 && p.order[0] == last {
+					p.order[0], p.order[n-1] = p.order[n-1], p.order[0]
+				}
+			}
+		default:
+			p.ended = true
+			return
+		}
+
+		info, err := p.openTrack(pos)
+		if err != nil {
+			debugLog(err)
+			continue
+		}
+		p.conv = nil
+		if info.ChannelCount != stream.ChannelCount || info.SampleRate != stream.SampleRate {
+			p.conv = newResampler(info, stream)
+		}
+		p.starts = append(p.starts, trackStart{frame: p.produced, track: p.order[pos], info: info})
+		return
+	}
+	p.ended = true
+}
+
+// openTrack opens the track at the position of the order for decoding.
+// p.lock must be held.
+func (p *Playlist) openTrack(pos int) (info SoundFileInfo, err error) {
+	p.closeTrack()
+	p.pos = pos
+
+	t := p.tracks[p.order[pos]]
+	file := t.file
+	if t.path != "" {
+		f, err := os.Open(t.path)
+		if err != nil {
+			return info, err
+		}
+		file, p.closer = f, f
+	} else if _, err = file.Seek(0, io.SeekStart); err != nil {
+		return
+	}
+
+	reader := NewSoundFileReader(file)
+	if reader == nil {
+		p.closeTrack()
+		return info, ErrUnknownFormat
+	}
+	if info, err = reader.Open(file); err != nil {
+		p.closeTrack()
+		return
+	}
+	p.reader = reader
+	return
+}
+
+// closeTrack closes the track being decoded. p.lock must be held.
+func (p *Playlist) closeTrack() {
+	if p.reader != nil {
+		p.reader.Close()
+		p.reader = nil
+	}
+	if p.closer != nil {
+		p.closer.Close()
+		p.closer = nil
+	}
+}
+
+// orderOf returns the position of the track in the order. p.lock must be held.
+func (p *Playlist) orderOf(track int) int {
+	for i, t := range p.order {
+		if t == track {
+			return i
+		}
+	}
+	return 0
+}
+
+// heard returns the start of the track being heard. p.lock must be held.
+func (p *Playlist) heard() (trackStart, bool) {
+	return p.heardAt(p.SoundStream.PlayingOffsetSamples())
+}
+
+// heardAt returns the start of the track at the offset of the stream.
+// p.lock must be held.
+func (p *Playlist) heardAt(offset int64) (trackStart, bool) {
+	for i := len(p.starts) - 1; i >= 0; i-- {
+		if p.starts[i].frame <= offset {
+			return p.starts[i], true
+		}
+	}
+	return trackStart{}, false
+}
@@ -0,0 +1,162 @@
+package audio
+
+import (
+	"bytes"
+	"math/rand"
+	"testing"
+	"time"
+)
+
+// testTrackMagic starts the files of the tracks of the tests, read as raw
+// 16-bit mono samples, the magic included.
+var testTrackMagic = []byte("TRAK")
+
+func init() {
+	RegisterSoundFileReader(SoundFileCheckMagic(testTrackMagic, 0), func() SoundFileReader {
+		return NewRawPCMReader(PCMS16, nil, 1, 44100)
+	})
+}
+
+func TestPlaylistShuffleNoRepeat(t *testing.T) {
+	for seed := int64(0); seed < 200; seed++ {
+		p := &Playlist{rand: rand.New(rand.NewSource(seed))}
+		for i := 0; i < 3; i++ {
+			p.Add(bytes.NewReader(testTrackMagic))
+		}
+		p.SetShuffle(true)
+		p.SetRepeat(RepeatAll)
+
+		last := -1
+		for i := 0; i < 12; i++ {
+			p.advance(SoundFileInfo{ChannelCount: 1, SampleRate: 44100})
+			if p.ended {
+				t.Fatalf("seed %d: the playlist ended in RepeatAll", seed)
+			}
+			track := p.order[p.pos]
+			if track == last {
+				t.Fatalf("seed %d: track %d played twice in a row", seed, track)
+			}
+			last = track
+		}
+		p.closeTrack()
+	}
+}
+
+// readAll reads the samples through the resampler by out buffers of the size.
+func readAll(r *resampler, in []int16, size int) []int16 {
+	read := func(data []int16) int64 {
+		n := copy(data, in)
+		in = in[n:]
+		return int64(n)
+	}
+
+	var got []int16
+	out := make([]int16, size)
+	for {
+		n := r.read(out, read)
+		if n == 0 {
+			return got
+		}
+		got = append(got, out[:n]...)
+	}
+}
+
+func TestResampler(t *testing.T) {
+	mono := func(rate int) SoundFileInfo { return SoundFileInfo{ChannelCount: 1, SampleRate: rate} }
+	stereo := func(rate int) SoundFileInfo { return SoundFileInfo{ChannelCount: 2, SampleRate: rate} }
+
+	tests := []struct {
+		name     string
+		from, to SoundFileInfo
+		in, want []int16
+	}{
+		{"mono to stereo", mono(44100), stereo(44100), []int16{1, 2, 3}, []int16{1, 1, 2, 2, 3, 3}},
+		{"stereo to mono", stereo(44100), mono(44100), []int16{10, 20, 30, 50}, []int16{15, 40}},
+		{"upsampled", mono(22050), mono(44100), []int16{0, 100, 200}, []int16{0, 50, 100, 150, 200, 200}},
+		{"downsampled", mono(44100), mono(22050), []int16{0, 10, 20, 30, 40}, []int16{0, 20, 40}},
+		{"partial frame", stereo(44100), stereo(44100), []int16{1, 2, 3}, []int16{1, 2}},
+	}
+
+	for _, tt := range tests {
+		for _, size := range []int{2, 4, 64} {
+			got := readAll(newResampler(tt.from, tt.to), tt.in, size)
+			if !equalSamples(got, tt.want) {
+				t.Errorf("%s, by %d: got %v, want %v", tt.name, size, got, tt.want)
+			}
+		}
+	}
+}
+
+func equalSamples(a, b []int16) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for i := range a {
+		if a[i] != b[i] {
+			return false
+		}
+	}
+	return true
+}
+
+func TestPlaylistStopKeepsTrack(t *testing.T) {
+	if err := Init(); err != nil {
+		t.Skip("cannot open the device:", err)
+	}
+	defer Shutdown()
+
+	// tracks of 1000 frames, all decoded into the first buffer
+	p := NewPlaylist()
+	defer p.Close()
+	for i := 0; i < 3; i++ {
+		p.Add(bytes.NewReader(append(testTrackMagic, make([]byte, 2000-len(testTrackMagic))...)))
+	}
+
+	decoded := func() bool {
+		p.lock.Lock()
+		defer p.lock.Unlock()
+		return len(p.starts) == 3 && p.ended
+	}
+	p.Play()
+	for deadline := time.Now().Add(time.Second); !decoded() && time.Now().Before(deadline); {
+		time.Sleep(time.Millisecond)
+	}
+	if !decoded() {
+		t.Fatal("the tracks were not decoded ahead")
+	}
+
+	// moves the source of the stream into the second track, as if played
+	s := &Sound{}
+	s.source = p.source
+	s.SetPlayingOffsetSamples(1500)
+	if track := p.CurrentTrack(); track != 1 {
+		t.Fatalf("CurrentTrack = %d, want 1", track)
+	}
+
+	p.Stop()
+	if track := p.CurrentTrack(); track != 1 {
+		t.Errorf("CurrentTrack = %d after Stop, want 1", track)
+	}
+	p.Play()
+	if track := p.CurrentTrack(); track != 1 {
+		t.Errorf("CurrentTrack = %d after Stop and Play, want 1", track)
+	}
+	if off := p.PlayingOffsetSamples(); off != 0 {
+		t.Errorf("PlayingOffsetSamples = %d after Stop and Play, want 0", off)
+	}
+
+	// past the last track, the playlist has ended, and starts over
+	if err := p.PlayTrack(2); err != nil {
+		t.Fatal(err)
+	}
+	if err := p.Next(); err != nil {
+		t.Fatal(err)
+	}
+	if st := p.Status(); st != Stopped {
+		t.Errorf("Status = %v after the last track, want Stopped", st)
+	}
+	p.Play()
+	if track := p.CurrentTrack(); track != 0 {
+		t.Errorf("CurrentTrack = %d after the end and Play, want 0", track)
+	}
+}
@@ -0,0 +1,504 @@
+package audio
+
+import (
+	"errors"
+	"fmt"
+	"math"
+	"sort"
+	"sync"
+	"time"
+)
+
+// InaudibleThreshold is the audibility under which a PooledSound
+// is virtualized by VoicePool.Update, leaving its voice to others.
+const InaudibleThreshold = 0.001
+
+// VoicePool plays many sounds on a bounded set of OpenAL sources, the voices.
+//
+// Each PooledSound has a priority. When all the voices are taken, a sound
+// played takes the voice of the weakest sound playing, i.e., of the lowest
+// priority, and then of the lowest audibility (its volume attenuated by the
+// distance). The sound losing its voice, or a sound too weak to take one,
+// keeps playing virtually: its position is tracked by time, and it resumes
+// from there when it gets a voice again.
+//
+// Update should be called regularly, e.g., once every frame, to end
+// the sounds finished, and to hand the voices to the strongest sounds.
+type VoicePool struct {
+	lock   sync.Mutex
+	voices []*poolVoice
+	sounds map[*PooledSound]struct{}
+	leak   *leakCheck
+}
+
+// poolVoice is a voice of a pool, and the sound it plays.
+type poolVoice struct {
+	sound *Sound
+	owner *PooledSound // nil if free
+}
+
+// PooledSound is a sound played by a VoicePool, on a voice or virtually.
+//
+// Its methods mirror the ones of Sound.
+type PooledSound struct {
+	pool     *VoicePool
+	buffer   *SoundBuffer
+	priority int
+
+	volume      float32
+	pitch       float32
+	position    [3]float32
+	relative    bool
+	minDistance float32
+	attenuation float32
+	loop        bool
+
+	state PlayStatus
+	voice *poolVoice // nil if virtual or stopped
+
+	// the position of a virtual sound: offset at time since
+	offset time.Duration
+	since  time.Time
+}
+
+// NewVoicePool creates a pool of at most maxVoices voices.
+//
+// Fewer voices are created if OpenAL runs out of sources first.
+// The error wraps ErrOutOfSources if not a single voice can be created.
+func NewVoicePool(maxVoices int) (*VoicePool, error) {
+	p := &VoicePool{
+		sounds: make(map[*PooledSound]struct{}),
+	}
+
+	for i := 0; i < maxVoices; i++ {
+		s := &Sound{}
+		stateLock.Lock()
+		err := s.soundSource.init()
+		stateLock.Unlock()
+
+		if err != nil {
+			if errors.Is(err, ErrOutOfSources) && len(p.voices) > 0 {
+				break
+			}
+			p.Release()
+			return nil, fmt.Errorf("VoicePool: cannot create: %w", err)
+		}
+		p.voices = append(p.voices, &poolVoice{sound: s})
+	}
+
+	p.leak = newLeakCheck("VoicePool")
+	p.leak.hold()
+	return p, nil
+}
+
+// VoiceCount returns the number of voices of the pool.
+func (p *VoicePool) VoiceCount() int {
+	p.lock.Lock()
+	defer p.lock.Unlock()
+	return len(p.voices)
+}
+
+// Release stops all the sounds of the pool, and frees its voices.
+//
+// The pool and its sounds should not be used again. Calling Release more than once does nothing.
+func (p *VoicePool) Release() {
+	p.leak.release()
+
+	p.lock.Lock()
+	defer p.lock.Unlock()
+
+	for _, v := range p.voices {
+		v.sound.Release()
+	}
+	p.voices = nil
+	for s := range p.sounds {
+		s.state = Stopped
+		s.voice = nil
+	}
+	p.sounds = make(map[*PooledSound]struct{})
+}
+
+// NewSound creates a stopped sound of the buffer and the priority.
+//
+// Higher priorities win voices over lower ones.
+func (p *VoicePool) NewSound(buf *SoundBuffer, priority int) *PooledSound {
+	p.lock.Lock()
+	defer p.lock.Unlock()
+
+	s := &PooledSound{
+		pool:        p,
+		buffer:      buf,
+		priority:    priority,
+		volume:      100,
+		pitch:       1,
+		minDistance: 1,
+		attenuation: 1,
+	}
+	p.sounds[s] = struct{}{}
+	return s
+}
+
+// Update ends the sounds finished, virtualizes the sounds inaudible,
+// and gives the free or weaker voices to the strongest virtual sounds.
+func (p *VoicePool) Update() {
+	p.lock.Lock()
+	defer p.lock.Unlock()
+
+	listener := GetListenerPosition()
+	now := time.Now()
+
+	// end the sounds finished, and free the voices of the inaudible ones
+	for _, v := range p.voices {
+		s := v.owner
+		if s == nil || s.state != Playing {
+			continue
+		}
+		if v.sound.Status() == Stopped {
+			s.state = Stopped
+			p.free(v)
+		} else if s.audibility(listener) < InaudibleThreshold {
+			s.virtualize(now)
+		}
+	}
+
+	// the virtual sounds still playing and audible, strongest first
+	var waiting []*PooledSound
+	for s := range p.sounds {
+		if s.state != Playing || s.voice != nil {
+			continue
+		}
+		if s.virtualOffset(now) < 0 {
+			s.state = Stopped
+			continue
+		}
+		if s.audibility(listener) >= InaudibleThreshold {
+			waiting = append(waiting, s)
+		}
+	}
+	sort.Slice(waiting, func(i, j int) bool {
+		return waiting[i].beats(waiting[j], listener)
+	})
+
+	for _, s := range waiting {
+		if !p.take(s, listener, now) {
+			break
+		}
+	}
+}
+
+// take gives a voice to the sound, free or taken from a weaker sound,
+// telling if there is one. p.lock must be held.
+func (p *VoicePool) take(s *PooledSound, listener [3]float32, now time.Time) bool {
+	var weakest *poolVoice
+	for _, v := range p.voices {
+		if v.owner == nil || v.owner.state == Stopped {
+			if v.owner != nil {
+				p.free(v)
+			}
+			weakest = v
+			break
+		}
+		if weakest == nil || weakest.owner.beats(v.owner, listener) {
+			weakest = v
+		}
+	}
+	if weakest == nil {
+		return false
+	}
+
+	if weakest.owner != nil {
+		if !s.beats(weakest.owner, listener) {
+			return false
+		}
+		weakest.owner.virtualize(now)
+	}
+
+	s.realize(weakest, now)
+	return true
+}
+
+// free stops the voice, and takes it from its sound. p.lock must be held.
+func (p *VoicePool) free(v *poolVoice) {
+	v.sound.Stop()
+	if v.owner != nil {
+		v.owner.voice = nil
+		v.owner = nil
+	}
+}
+
+// audibility returns how loud the sound is heard, from 0 to 1,
+// by its volume and the distance to the listener.
+func (s *PooledSound) audibility(listener [3]float32) float64 {
+	gain := float64(s.volume) / 100
+
+	pos := s.position
+	if !s.relative {
+		for i := range pos {
+			pos[i] -= listener[i]
+		}
+	}
+	dist := math.Sqrt(float64(pos[0]*pos[0] + pos[1]*pos[1] + pos[2]*pos[2]))
+
+	// the inverse distance clamped model of OpenAL
+	min := float64(s.minDistance)
+	if dist > min {
+		gain *= min / (min + float64(s.attenuation)*(dist-min))
+	}
+	return gain
+}
+
+// beats tells if the sound is stronger than the other one.
+func (s *PooledSound) beats(other *PooledSound, listener [3]float32) bool {
+	if s.priority != other.priority {
+		return s.priority > other.priority
+	}
+	return s.audibility(listener) > other.audibility(listener)
+}
+
+// virtualOffset returns the position of the virtual sound,
+// or -1 if it is over. p.lock must be held.
+func (s *PooledSound) virtualOffset(now time.Time) time.Duration {
+	offset := s.offset
+	if s.state == Playing {
+		offset += time.Duration(float64(now.Sub(s.since)) * float64(s.pitch))
+	}
+
+	if s.buffer == nil {
+		return -1
+	}
+	duration := s.buffer.Duration()
+	if offset >= duration {
+		if !s.loop || duration <= 0 {
+			return -1
+		}
+		offset %= duration
+	}
+	return offset
+}
+
+// virtualize takes the voice from the sound, keeping its position. p.lock must be held.
+func (s *PooledSound) virtualize(now time.Time) {
+	v := s.voice
+	if v == nil {
+		return
+	}
+	s.offset = v.sound.PlayingOffset()
+	s.since = now
+	s.pool.free(v)
+}
+
+// realize plays the sound on the voice, from its virtual position. p.lock must be held.
+func (s *PooledSound) realize(v *poolVoice, now time.Time) {
+	offset := s.virtualOffset(now)
+	if offset < 0 {
+		offset = 0
+	}
+
+	v.owner = s
+	s.voice = v
+
+	sound := v.sound
+	sound.SetBuffer(s.buffer)
+	sound.SetVolume(s.volume)
+	sound.SetPitch(s.pitch)
+	sound.SetPosition(s.position)
+	sound.SetRelativeToListener(s.relative)
+	sound.SetMinDistance(s.minDistance)
+	sound.SetAttenuation(s.attenuation)
+	stateLock.Lock()
+	sound.setLoop(s.loop)
+	stateLock.Unlock()
+
+	sound.Play()
+	sound.SetPlayingOffset(offset)
+}
+
+// Play starts or resumes playing the sound, from the beginning if it is playing.
+//
+// It gets a voice if one is free, or if it beats the weakest sound playing.
+// Otherwise it plays virtually.
+func (s *PooledSound) Play() {
+	p := s.pool
+	p.lock.Lock()
+	defer p.lock.Unlock()
+
+	if _, ok := p.sounds[s]; !ok || s.buffer == nil {
+		return
+	}
+
+	now := time.Now()
+	switch s.state {
+	case Paused:
+		s.state = Playing
+		if s.voice != nil {
+			s.voice.sound.Play()
+			return
+		}
+		s.since = now
+	default:
+		if s.voice != nil {
+			p.free(s.voice)
+		}
+		s.state = Playing
+		s.offset = 0
+		s.since = now
+	}
+
+	p.take(s, GetListenerPosition(), now)
+}
+
+// Pause pauses the sound.
+func (s *PooledSound) Pause() {
+	p := s.pool
+	p.lock.Lock()
+	defer p.lock.Unlock()
+
+	if s.state != Playing {
+		return
+	}
+	if s.voice != nil {
+		s.voice.sound.Pause()
+	} else {
+		now := time.Now()
+		s.offset, s.since = s.virtualOffset(now), now
+		if s.offset < 0 {
+			// over already
+			s.state, s.offset = Stopped, 0
+			return
+		}
+	}
+	s.state = Paused
+}
+
+// Stop stops the sound, freeing its voice.
+func (s *PooledSound) Stop() {
+	p := s.pool
+	p.lock.Lock()
+	defer p.lock.Unlock()
+
+	if s.voice != nil {
+		p.free(s.voice)
+	}
+	s.state = Stopped
+	s.offset = 0
+}
+
+// Release stops the sound, and removes it from the pool.
+//
+// The sound should not be used again.
+func (s *PooledSound) Release() {
+	p := s.pool
+	p.lock.Lock()
+	defer p.lock.Unlock()
+
+	if s.voice != nil {
+		p.free(s.voice)
+	}
+	s.state = Stopped
+	delete(p.sounds, s)
+}
+
+// Status returns the current status of the sound, playing even if virtually.
+func (s *PooledSound) Status() PlayStatus {
+	s.pool.lock.Lock()
+	defer s.pool.lock.Unlock()
+	return s.state
+}
+
+// IsVirtual tells if the sound is playing or paused without a voice.
+func (s *PooledSound) IsVirtual() bool {
+	s.pool.lock.Lock()
+	defer s.pool.lock.Unlock()
+	return s.state != Stopped && s.voice == nil
+}
+
+// Priority returns the priority of the sound.
+func (s *PooledSound) Priority() int {
+	s.pool.lock.Lock()
+	defer s.pool.lock.Unlock()
+	return s.priority
+}
+
+// SetPriority sets the priority of the sound. It takes effect on Update.
+func (s *PooledSound) SetPriority(priority int) {
+	s.pool.lock.Lock()
+	defer s.pool.lock.Unlock()
+	s.priority = priority
+}
+
+// PlayingOffset returns the playing position of the sound in time.
+func (s *PooledSound) PlayingOffset() time.Duration {
+	s.pool.lock.Lock()
+	defer s.pool.lock.Unlock()
+
+	switch {
+	case s.voice != nil:
+		return s.voice.sound.PlayingOffset()
+	case s.state == Stopped:
+		return 0
+	}
+	if offset := s.virtualOffset(time.Now()); offset >= 0 {
+		return offset
+	}
+	return 0
+}
+
+// SetLoop sets whether the sound repeats from the beginning after reaching the end.
+//
+// The default is false.
+func (s *PooledSound) SetLoop(loop bool) {
+	s.set(func() { s.loop = loop }, func(sound *Sound) {
+		stateLock.Lock()
+		sound.setLoop(loop)
+		stateLock.Unlock()
+	})
+}
+
+// SetVolume sets the volume of the sound, from 0 to 100. See Sound.SetVolume.
+func (s *PooledSound) SetVolume(volume float32) {
+	s.set(func() { s.volume = volume }, func(sound *Sound) { sound.SetVolume(volume) })
+}
+
+// SetPitch sets the pitch of the sound. See Sound.SetPitch.
+func (s *PooledSound) SetPitch(pitch float32) {
+	s.set(func() {
+		// keep the virtual position right across the change
+		if s.state == Playing && s.voice == nil {
+			now := time.Now()
+			s.offset, s.since = s.virtualOffset(now), now
+		}
+		s.pitch = pitch
+	}, func(sound *Sound) { sound.SetPitch(pitch) })
+}
+
+// SetPosition sets the 3D position of the sound. See Sound.SetPosition.
+func (s *PooledSound) SetPosition(pos [3]float32) {
+	s.set(func() { s.position = pos }, func(sound *Sound) { sound.SetPosition(pos) })
+}
+
+// SetRelativeToListener makes the position of the sound relative to the listener or absolute.
+// See Sound.SetRelativeToListener.
+func (s *PooledSound) SetRelativeToListener(relative bool) {
+	s.set(func() { s.relative = relative }, func(sound *Sound) { sound.SetRelativeToListener(relative) })
+}
+
+// SetMinDistance sets the minimum distance of the sound. See Sound.SetMinDistance.
+func (s *PooledSound) SetMinDistance(distance float32) {
+	s.set(func() { s.minDistance = distance }, func(sound *Sound) { sound.SetMinDistance(distance) })
+}
+
+// SetAttenuation sets the attenuation factor of the sound. See Sound.SetAttenuation.
+func (s *PooledSound) SetAttenuation(attenuation float32) {
+	s.set(func() { s.attenuation = attenuation }, func(sound *Sound) { sound.SetAttenuation(attenuation) })
+}
+
+// set changes a property of the sound by update, and of its voice by apply.
+func (s *PooledSound) set(update func(), apply func(sound *Sound)) {
+	s.pool.lock.Lock()
+	defer s.pool.lock.Unlock()
+
+	update()
+	if s.voice != nil {
+		apply(s.voice.sound)
+	}
+}
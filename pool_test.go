@@ -0,0 +1,131 @@
+package audio
+
+import (
+	"testing"
+	"time"
+)
+
+func TestVoicePoolPriority(t *testing.T) {
+	if err := Init(); err != nil {
+		t.Skip("cannot open the device:", err)
+	}
+	defer Shutdown()
+
+	b := NewSoundBuffer()
+	defer b.Release()
+	loadRaw(t, b, 44100, 1)
+
+	p, err := NewVoicePool(2)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer p.Release()
+	if n := p.VoiceCount(); n != 2 {
+		t.Fatalf("VoiceCount = %d, want 2", n)
+	}
+
+	low, mid, high := p.NewSound(b, 0), p.NewSound(b, 1), p.NewSound(b, 2)
+	low.Play()
+	mid.Play()
+	if low.IsVirtual() || mid.IsVirtual() {
+		t.Fatalf("sounds virtual with voices free")
+	}
+
+	// the strongest takes the voice of the weakest, which plays on virtually
+	high.Play()
+	if high.IsVirtual() || mid.IsVirtual() {
+		t.Errorf("the stronger sounds are virtual")
+	}
+	if !low.IsVirtual() || low.Status() != Playing {
+		t.Errorf("the weakest sound is not playing virtually")
+	}
+
+	// a sound too weak to take a voice plays virtually from the start
+	weakest := p.NewSound(b, -1)
+	weakest.Play()
+	if !weakest.IsVirtual() || weakest.Status() != Playing {
+		t.Errorf("the weakest sound played took a voice")
+	}
+	weakest.Release()
+
+	// the voice freed goes to the strongest virtual sound, from its position
+	time.Sleep(50 * time.Millisecond)
+	high.Stop()
+	if !low.IsVirtual() {
+		t.Errorf("a virtual sound took a voice before Update")
+	}
+	p.Update()
+	if low.IsVirtual() {
+		t.Fatalf("the virtual sound got no voice on Update")
+	}
+	if off := low.PlayingOffset(); off < 50*time.Millisecond {
+		t.Errorf("PlayingOffset = %v resumed, want at least 50ms", off)
+	}
+}
+
+func TestVoicePoolUpdate(t *testing.T) {
+	if err := Init(); err != nil {
+		t.Skip("cannot open the device:", err)
+	}
+	defer Shutdown()
+
+	short, long := NewSoundBuffer(), NewSoundBuffer()
+	defer short.Release()
+	defer long.Release()
+	loadRaw(t, short, 441, 1) // 10ms
+	loadRaw(t, long, 44100, 1)
+
+	p, err := NewVoicePool(1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer p.Release()
+
+	// an inaudible sound leaves its voice to a virtual one on Update
+	quiet, loud := p.NewSound(long, 1), p.NewSound(long, 0)
+	quiet.Play()
+	loud.Play()
+	if !loud.IsVirtual() {
+		t.Fatalf("the weaker sound is not virtual")
+	}
+	quiet.SetVolume(0)
+	p.Update()
+	if !quiet.IsVirtual() || loud.IsVirtual() {
+		t.Errorf("the voice is not handed from the inaudible sound")
+	}
+	loud.Stop()
+	quiet.Stop()
+
+	// a virtual sound past its end is stopped on Update, a looping one is not
+	ended, looped := p.NewSound(short, 0), p.NewSound(short, 0)
+	looped.SetLoop(true)
+	loud.Play()
+	ended.Play()
+	looped.Play()
+	if !ended.IsVirtual() || !looped.IsVirtual() {
+		t.Fatalf("the sounds are not virtual")
+	}
+	time.Sleep(30 * time.Millisecond)
+	p.Update()
+	if st := ended.Status(); st != Stopped {
+		t.Errorf("Status = %v past the end, want Stopped", st)
+	}
+	if st := looped.Status(); st != Playing {
+		t.Errorf("Status = %v of a looping sound, want Playing", st)
+	}
+	if off := looped.PlayingOffset(); off >= short.Duration() {
+		t.Errorf("PlayingOffset = %v of a looping sound, want under %v", off, short.Duration())
+	}
+
+	// a paused virtual sound keeps its position
+	looped.Stop()
+	virtual := p.NewSound(long, 0)
+	virtual.Play()
+	time.Sleep(20 * time.Millisecond)
+	virtual.Pause()
+	paused := virtual.PlayingOffset()
+	time.Sleep(20 * time.Millisecond)
+	if off := virtual.PlayingOffset(); off != paused || paused < 20*time.Millisecond {
+		t.Errorf("PlayingOffset = %v paused at %v, want it kept and at least 20ms", off, paused)
+	}
+}
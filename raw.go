@@ -0,0 +1,286 @@
+package audio
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"math"
+
+	"github.com/Edgaru089/audio/pcm"
+)
+
+// PCMFormat describes the encoding of a single raw PCM sample.
+type PCMFormat int8
+
+const (
+	PCMU8  PCMFormat = iota // Unsigned 8-bit integer, silence at 128
+	PCMS16                  // Signed 16-bit integer
+	PCMS24                  // Signed 24-bit integer, packed in 3 bytes
+	PCMS32                  // Signed 32-bit integer
+	PCMF32                  // 32-bit IEEE float, nominally in [-1, 1]
+)
+
+// Size returns the size of one sample in the format, in bytes.
+func (f PCMFormat) Size() int {
+	switch f {
+	case PCMU8:
+		return 1
+	case PCMS16:
+		return 2
+	case PCMS24:
+		return 3
+	case PCMS32, PCMF32:
+		return 4
+	}
+	return 0
+}
+
+func (f PCMFormat) String() string {
+	switch f {
+	case PCMU8:
+		return "u8"
+	case PCMS16:
+		return "s16"
+	case PCMS24:
+		return "s24"
+	case PCMS32:
+		return "s32"
+	case PCMF32:
+		return "f32"
+	}
+	return fmt.Sprintf("PCMFormat(%d)", int(f))
+}
+
+// RawPCMReader is a SoundFileReader for headerless PCM data.
+//
+// Since raw PCM has no magic to sniff, it is not registered with
+// RegisterSoundFileReader. Instead it is created with the format declared
+// by the caller, and then given to SoundBuffer.LoadReader or Music.OpenReader.
+//
+// The whole file, from the beginning to the end, is treated as sample data.
+type RawPCMReader struct {
+	format PCMFormat
+	order  binary.ByteOrder
+
+	file io.ReadSeeker
+	info SoundFileInfo
+
+	dataLength int64 // length of the file in bytes, rounded down to whole frames
+	readOffset int64 // current read position, in bytes
+
+	buf       []byte
+	quantizer *pcm.Quantizer // reduces 24 and 32-bit samples for Read, created by Open
+	dither    pcm.Dither     // the dither set by SetDither, if ditherSet
+	ditherSet bool
+}
+
+// NewRawPCMReader creates a new reader for raw PCM data with the given properities.
+//
+// The byte order is ignored for 8-bit data; nil means little-endian.
+func NewRawPCMReader(format PCMFormat, order binary.ByteOrder, channelCount, sampleRate int) *RawPCMReader {
+	if order == nil {
+		order = binary.LittleEndian
+	}
+	return &RawPCMReader{
+		format: format,
+		order:  order,
+		info: SoundFileInfo{
+			ChannelCount: channelCount,
+			SampleRate:   sampleRate,
+		},
+	}
+}
+
+func (r *RawPCMReader) Open(file io.ReadSeeker) (info SoundFileInfo, err error) {
+	if r.format.Size() == 0 {
+		return SoundFileInfo{}, fmt.Errorf("RawPCMReader: unknown sample format %s", r.format)
+	}
+	if r.info.ChannelCount <= 0 || r.info.SampleRate <= 0 {
+		return SoundFileInfo{}, errors.New("RawPCMReader: channel count and sample rate must be positive")
+	}
+
+	length, err := file.Seek(0, io.SeekEnd)
+	if err != nil {
+		return SoundFileInfo{}, fmt.Errorf("RawPCMReader: cannot get file length: %s", err.Error())
+	}
+	_, err = file.Seek(0, io.SeekStart)
+	if err != nil {
+		return SoundFileInfo{}, err
+	}
+
+	// drop the trailing partial frame, if any
+	frameSize := int64(r.format.Size() * r.info.ChannelCount)
+	r.dataLength = length / frameSize * frameSize
+	r.readOffset = 0
+
+	r.info.SampleCount = r.dataLength / int64(r.format.Size())
+	r.file = file
+	dither := pcm.DefaultDither()
+	if r.ditherSet {
+		dither = r.dither
+	}
+	r.quantizer = pcm.NewQuantizer(dither, r.info.ChannelCount)
+	return r.info, nil
+}
+
+func (r *RawPCMReader) Info() SoundFileInfo {
+	return r.info
+}
+
+func (r *RawPCMReader) Seek(sampleOffset int64) error {
+	if r.file == nil {
+		return errors.New("RawPCMReader: Seek before Open")
+	}
+	if sampleOffset > r.info.SampleCount {
+		sampleOffset = r.info.SampleCount
+	}
+	if sampleOffset < 0 {
+		sampleOffset = 0
+	}
+
+	r.readOffset = sampleOffset * int64(r.format.Size())
+	r.quantizer.Reset()
+	_, err := r.file.Seek(r.readOffset, io.SeekStart)
+	return err
+}
+
+// SetDither sets the dither used by Read to reduce 24 and 32-bit samples.
+//
+// It can be called before Open, and is kept by later Opens.
+// The default is pcm.DefaultDither() when the file is opened.
+func (r *RawPCMReader) SetDither(dither pcm.Dither) {
+	r.dither, r.ditherSet = dither, true
+	if r.quantizer != nil {
+		r.quantizer = pcm.NewQuantizer(dither, r.info.ChannelCount)
+	}
+}
+
+// readRaw reads at most count samples of raw bytes into r.buf.
+//
+// It returns the number of whole samples read.
+func (r *RawPCMReader) readRaw(count int) (samples int, err error) {
+	size := r.format.Size()
+	if count == 0 {
+		return 0, nil
+	}
+
+	toread := int64(count * size)
+	if toread > r.dataLength-r.readOffset {
+		toread = r.dataLength - r.readOffset
+	}
+	if toread == 0 {
+		return 0, io.EOF
+	}
+
+	if int64(cap(r.buf)) < toread {
+		r.buf = make([]byte, toread)
+	}
+	r.buf = r.buf[:toread]
+
+	n, err := io.ReadFull(r.file, r.buf)
+	if err == io.ErrUnexpectedEOF {
+		err = io.EOF
+	}
+
+	// keep the file position on a sample boundary
+	if rem := n % size; rem != 0 {
+		r.file.Seek(int64(-rem), io.SeekCurrent)
+		n -= rem
+	}
+	r.readOffset += int64(n)
+
+	return n / size, err
+}
+
+func (r *RawPCMReader) Read(data []int16) (samplesRead int64, err error) {
+	// the sample at the read position is on this channel
+	channel := int(r.readOffset/int64(r.format.Size())) % r.info.ChannelCount
+
+	n, err := r.readRaw(len(data))
+
+	b := r.buf
+	switch r.format {
+	case PCMU8:
+		for i := 0; i < n; i++ {
+			data[i] = int16(int(b[i])-128) << 8
+		}
+	case PCMS16:
+		for i := 0; i < n; i++ {
+			data[i] = int16(r.order.Uint16(b[i*2:]))
+		}
+	case PCMS24:
+		for i := 0; i < n; i++ {
+			data[i] = r.quantizer.Quantize((channel+i)%r.info.ChannelCount, r.decode24(b[i*3:]), 24)
+		}
+	case PCMS32:
+		for i := 0; i < n; i++ {
+			data[i] = r.quantizer.Quantize((channel+i)%r.info.ChannelCount, int32(r.order.Uint32(b[i*4:])), 32)
+		}
+	case PCMF32:
+		for i := 0; i < n; i++ {
+			f := math.Float32frombits(r.order.Uint32(b[i*4:]))
+			data[i] = pcm.FromFloat32(f)
+		}
+	}
+
+	return rawReadResult(n, err)
+}
+
+// ReadFloat reads samples normalized to [-1, 1], keeping the full precision of the format.
+//
+// It satisfies SoundFileFloatReader.
+func (r *RawPCMReader) ReadFloat(data []float32) (samplesRead int64, err error) {
+	n, err := r.readRaw(len(data))
+
+	b := r.buf
+	switch r.format {
+	case PCMU8:
+		for i := 0; i < n; i++ {
+			data[i] = float32(int(b[i])-128) / (1 << 7)
+		}
+	case PCMS16:
+		for i := 0; i < n; i++ {
+			data[i] = float32(int16(r.order.Uint16(b[i*2:]))) / (1 << 15)
+		}
+	case PCMS24:
+		for i := 0; i < n; i++ {
+			data[i] = pcm.ToFloat32(r.decode24(b[i*3:]), 24)
+		}
+	case PCMS32:
+		for i := 0; i < n; i++ {
+			data[i] = pcm.ToFloat32(int32(r.order.Uint32(b[i*4:])), 32)
+		}
+	case PCMF32:
+		for i := 0; i < n; i++ {
+			data[i] = math.Float32frombits(r.order.Uint32(b[i*4:]))
+		}
+	}
+
+	return rawReadResult(n, err)
+}
+
+// rawReadResult returns the result of a read of n samples: the samples read
+// without an error, even if the end of the file is reached, and (0, io.EOF)
+// on the next call.
+func rawReadResult(n int, err error) (samplesRead int64, rerr error) {
+	if n > 0 && err == io.EOF {
+		return int64(n), nil
+	}
+	return int64(n), err
+}
+
+// decode24 decodes a signed 24-bit sample into the low 24 bits of an int32.
+func (r *RawPCMReader) decode24(b []byte) int32 {
+	var v uint32
+	if r.order == binary.BigEndian {
+		v = uint32(b[0])<<16 | uint32(b[1])<<8 | uint32(b[2])
+	} else {
+		v = uint32(b[0]) | uint32(b[1])<<8 | uint32(b[2])<<16
+	}
+	return pcm.SignExtend(v, 24)
+}
+
+func (r *RawPCMReader) Close() error {
+	return nil
+}
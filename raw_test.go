@@ -0,0 +1,142 @@
+package audio
+
+import (
+	"bytes"
+	"encoding/binary"
+	"io"
+	"testing"
+
+	"github.com/Edgaru089/audio/pcm"
+)
+
+func TestRawPCMReaderRead(t *testing.T) {
+	tests := []struct {
+		name   string
+		format PCMFormat
+		order  binary.ByteOrder
+		data   []byte
+		want   []int16
+	}{
+		{"u8", PCMU8, nil, []byte{0, 128, 255}, []int16{-32768, 0, 127 << 8}},
+		{"s16le", PCMS16, nil, []byte{0x34, 0x12, 0xff, 0xff}, []int16{0x1234, -1}},
+		{"s16be", PCMS16, binary.BigEndian, []byte{0x12, 0x34, 0x80, 0x00}, []int16{0x1234, -32768}},
+		{"f32", PCMF32, nil, []byte{0, 0, 0x80, 0x3f, 0, 0, 0x80, 0xbf}, []int16{32767, -32767}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r := NewRawPCMReader(tt.format, tt.order, 1, 44100)
+			info, err := r.Open(bytes.NewReader(tt.data))
+			if err != nil {
+				t.Fatal(err)
+			}
+			if info.SampleCount != int64(len(tt.want)) {
+				t.Fatalf("SampleCount = %d, want %d", info.SampleCount, len(tt.want))
+			}
+
+			got := make([]int16, len(tt.want))
+			n, err := r.Read(got)
+			if n != int64(len(tt.want)) || err != nil {
+				t.Fatalf("Read = (%d, %v), want (%d, nil)", n, err, len(tt.want))
+			}
+			for i := range got {
+				if diff := int(got[i]) - int(tt.want[i]); diff < -1 || diff > 1 {
+					t.Errorf("sample %d = %d, want %d", i, got[i], tt.want[i])
+				}
+			}
+		})
+	}
+}
+
+func TestRawPCMReaderEOF(t *testing.T) {
+	// 5 stereo frames, and a partial frame dropped
+	data := make([]byte, 5*2*2+3)
+	r := NewRawPCMReader(PCMS16, nil, 2, 44100)
+	info, err := r.Open(bytes.NewReader(data))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if info.SampleCount != 10 {
+		t.Fatalf("SampleCount = %d, want 10", info.SampleCount)
+	}
+
+	// the samples come first, and io.EOF on the call after
+	buf := make([]int16, 4)
+	for _, want := range []struct {
+		n   int64
+		err error
+	}{{4, nil}, {4, nil}, {2, nil}, {0, io.EOF}} {
+		n, err := r.Read(buf)
+		if n != want.n || err != want.err {
+			t.Fatalf("Read = (%d, %v), want (%d, %v)", n, err, want.n, want.err)
+		}
+	}
+
+	fbuf := make([]float32, 4)
+	if err := r.Seek(8); err != nil {
+		t.Fatal(err)
+	}
+	if n, err := r.ReadFloat(fbuf); n != 2 || err != nil {
+		t.Fatalf("ReadFloat = (%d, %v), want (2, nil)", n, err)
+	}
+	if n, err := r.ReadFloat(fbuf); n != 0 || err != io.EOF {
+		t.Fatalf("ReadFloat = (%d, %v), want (0, EOF)", n, err)
+	}
+}
+
+func TestRawPCMReaderFloat(t *testing.T) {
+	// 24-bit little-endian: 0x400000 is half of the full scale
+	data := []byte{0x00, 0x00, 0x40, 0x00, 0x00, 0xc0}
+	r := NewRawPCMReader(PCMS24, nil, 1, 48000)
+	if _, err := r.Open(bytes.NewReader(data)); err != nil {
+		t.Fatal(err)
+	}
+
+	got := make([]float32, 2)
+	if n, err := r.ReadFloat(got); n != 2 || err != nil {
+		t.Fatalf("ReadFloat = (%d, %v), want (2, nil)", n, err)
+	}
+	if got[0] != 0.5 || got[1] != -0.5 {
+		t.Errorf("ReadFloat = %v, want [0.5 -0.5]", got)
+	}
+}
+
+func TestRawPCMReaderOpenErrors(t *testing.T) {
+	for _, r := range []*RawPCMReader{
+		NewRawPCMReader(PCMFormat(42), nil, 1, 44100),
+		NewRawPCMReader(PCMS16, nil, 0, 44100),
+		NewRawPCMReader(PCMS16, nil, 1, 0),
+	} {
+		if _, err := r.Open(bytes.NewReader(nil)); err == nil {
+			t.Errorf("Open(%v, %d channels, %d Hz) succeeded", r.format, r.info.ChannelCount, r.info.SampleRate)
+		}
+	}
+}
+
+func TestRawPCMReaderDither(t *testing.T) {
+	r := NewRawPCMReader(PCMS24, nil, 1, 48000)
+	if err := r.Seek(0); err == nil {
+		t.Error("Seek before Open succeeded")
+	}
+
+	// set before Open, and kept by it
+	r.SetDither(pcm.DitherNone)
+	if _, err := r.Open(bytes.NewReader([]byte{0x56, 0x34, 0x12, 0x80, 0x34, 0x12})); err != nil {
+		t.Fatal(err)
+	}
+	if d := r.quantizer.Dither(); d != pcm.DitherNone {
+		t.Fatalf("dither = %v after Open, want %v", d, pcm.DitherNone)
+	}
+	for i := 0; i < 2; i++ {
+		got := make([]int16, 2)
+		if n, err := r.Read(got); n != 2 || err != nil {
+			t.Fatalf("Read = (%d, %v), want (2, nil)", n, err)
+		}
+		if got[0] != 0x1234 || got[1] != 0x1235 {
+			t.Errorf("Read = %#x, want [0x1234 0x1235]", got)
+		}
+		if err := r.Seek(0); err != nil {
+			t.Fatal(err)
+		}
+	}
+}
@@ -128,3 +128,30 @@ func NewSoundFileReader(file io.ReadSeeker) SoundFileReader {
 
 	return nil
 }
+
+// SoundFileLooper is implemented by SoundFileReaders whose content has
+// a loop of its own, like the song loop of a tracker module.
+//
+// A looping Music plays from the beginning to the end of the loop,
+// and then repeats the loop section only.
+type SoundFileLooper interface {
+
+	// LoopPoints returns the loop section, in samples.
+	//
+	// Two samples from two channels at the same timepoint count twice.
+	LoopPoints() (start, end int64)
+}
+
+// SoundFileFloatReader is implemented by SoundFileReaders that can decode
+// samples as 32-bit floats, without reducing them to 16 bits first.
+//
+// SoundBuffer and Music use it instead of Read when the OpenAL implementation
+// supports float buffers (the AL_EXT_FLOAT32 extension).
+type SoundFileFloatReader interface {
+
+	// ReadFloat reads audio samples from the open file, normalized to [-1, 1].
+	//
+	// It behaves the same as Read otherwise. Read and ReadFloat can be used
+	// on the same reader, continuing from the same read position.
+	ReadFloat(data []float32) (samplesRead int64, err error)
+}
@@ -0,0 +1,252 @@
+package audio
+
+// #include "headers.h"
+import "C"
+import (
+	"errors"
+	"fmt"
+	"log"
+	"runtime"
+	"sync"
+	"sync/atomic"
+)
+
+// The OpenAL names of the live objects are tracked here, so that Shutdown
+// can delete them. Only the names are kept, not the Go objects, so that
+// objects never released can still be garbage collected (and reported
+// as leaks in debug builds).
+var (
+	liveLock    sync.Mutex
+	liveSources = make(map[C.ALuint]struct{})
+	liveBuffers = make(map[C.ALuint]struct{})
+	generation  uint64 // incremented by Shutdown; names from older generations are already deleted
+
+	streams      sync.WaitGroup // streaming goroutines running
+	shuttingDown int32          // set when Shutdown is waiting for the streaming goroutines
+
+	streamWakes = make(map[chan struct{}]struct{}) // the wake channels of the streams streaming, for Shutdown to wake them
+)
+
+// genSource creates a new OpenAL source, returning its name
+// and the generation it belongs to.
+//
+// The error wraps ErrOutOfSources if no more sources can be created.
+func genSource() (name C.ALuint, gen uint64, err error) {
+	liveLock.Lock()
+	defer liveLock.Unlock()
+
+	C.alGetError() // clear any earlier error
+	C.alGenSources(1, &name)
+	if alerr := alError("alGenSources"); alerr != nil || name == 0 {
+		if alerr == nil {
+			alerr = errors.New("no source name returned")
+		}
+		return 0, generation, fmt.Errorf("%w: %v", ErrOutOfSources, alerr)
+	}
+	liveSources[name] = struct{}{}
+	return name, generation, nil
+}
+
+// deleteSource deletes the OpenAL source, if it is not already deleted by Shutdown.
+func deleteSource(name C.ALuint, gen uint64) {
+	liveLock.Lock()
+	defer liveLock.Unlock()
+
+	if name == 0 || gen != generation {
+		return
+	}
+	C.alSourcei(name, C.AL_BUFFER, 0)
+	alCheck("alSourcei")
+	C.alDeleteSources(1, &name)
+	alCheck("alDeleteSources")
+	delete(liveSources, name)
+}
+
+// genBuffer creates a new OpenAL buffer, returning its name
+// and the generation it belongs to.
+func genBuffer() (name C.ALuint, gen uint64) {
+	liveLock.Lock()
+	defer liveLock.Unlock()
+
+	C.alGenBuffers(1, &name)
+	alCheck("alGenBuffers")
+	if name != 0 {
+		liveBuffers[name] = struct{}{}
+	}
+	return name, generation
+}
+
+// deleteBuffer deletes the OpenAL buffer, if it is not already deleted by Shutdown.
+func deleteBuffer(name C.ALuint, gen uint64) {
+	liveLock.Lock()
+	defer liveLock.Unlock()
+
+	if name == 0 || gen != generation {
+		return
+	}
+	C.alDeleteBuffers(1, &name)
+	alCheck("alDeleteBuffers")
+	delete(liveBuffers, name)
+}
+
+// isLive tells if the name of the generation is not deleted by Shutdown.
+func isLive(name C.ALuint, gen uint64) bool {
+	liveLock.Lock()
+	defer liveLock.Unlock()
+	return name != 0 && gen == generation
+}
+
+// startStreaming counts a stream goroutine woken by wake,
+// for Shutdown to wake it and wait for it.
+func startStreaming(wake chan struct{}) {
+	liveLock.Lock()
+	defer liveLock.Unlock()
+	streamWakes[wake] = struct{}{}
+	streams.Add(1)
+}
+
+// endStreaming is called by a stream goroutine counted by startStreaming as it ends.
+func endStreaming(wake chan struct{}) {
+	liveLock.Lock()
+	delete(streamWakes, wake)
+	liveLock.Unlock()
+	streams.Done()
+}
+
+// isShuttingDown tells if the streaming goroutines should end for Shutdown.
+func isShuttingDown() bool {
+	return atomic.LoadInt32(&shuttingDown) != 0
+}
+
+// Shutdown releases every live Sound, SoundBuffer, SoundStream and Music,
+// and then closes the OpenAL context and the device.
+//
+// The streams are stopped, and their goroutines are waited for.
+// The playback event listeners are removed, and the tweens are stopped.
+// The buses are kept, without their sounds.
+// Music files stay open until Music.Close is called.
+//
+// The objects should not be used after Shutdown, except for releasing them,
+// which does nothing. Init can be called again to open the device again.
+//
+// Like Init, Shutdown should not be called concurrently with other functions.
+func Shutdown() {
+	atomic.StoreInt32(&shuttingDown, 1)
+	unwatchAll()
+
+	// the streams may sleep for long, e.g., before a scheduled start
+	liveLock.Lock()
+	for wake := range streamWakes {
+		wakeup(wake)
+	}
+	liveLock.Unlock()
+	streams.Wait()
+
+	liveLock.Lock()
+	for name := range liveSources {
+		C.alSourceStop(name)
+		alCheck("alSourceStop")
+		C.alSourcei(name, C.AL_BUFFER, 0)
+		alCheck("alSourcei")
+		C.alDeleteSources(1, &name)
+		alCheck("alDeleteSources")
+	}
+	for name := range liveBuffers {
+		C.alDeleteBuffers(1, &name)
+		alCheck("alDeleteBuffers")
+	}
+	liveSources = make(map[C.ALuint]struct{})
+	liveBuffers = make(map[C.ALuint]struct{})
+	generation++
+	liveLock.Unlock()
+
+	stateLock.Lock()
+	masterBus.clearMembers()
+	stateLock.Unlock()
+
+	closeEvents()
+	extFloat32 = false
+	extCallbackBuffer = false
+	extSourceLatency = false
+	extDeviceClock = false
+	extStartDelay = false
+
+	C.alcMakeContextCurrent(nil)
+	alcCheck(alcDevice, "alcMakeContextCurrent")
+	if alcContext != nil {
+		C.alcDestroyContext(alcContext)
+		alcCheck(alcDevice, "alcDestroyContext")
+		alcContext = nil
+	}
+	if alcDevice != nil {
+		if C.alcCloseDevice(alcDevice) == C.ALC_FALSE {
+			debugLog(errors.New("alcCloseDevice: failed to close the device"))
+		}
+		alcDevice = nil
+	}
+
+	atomic.StoreInt32(&shuttingDown, 0)
+}
+
+// leakCheck reports its object as leaked if the object is garbage collected
+// while holding OpenAL names, in debug builds (the audiodebug build tag).
+//
+// The finalizer is set on the leakCheck, allocated apart from its object,
+// rather than on the object itself: the objects are often in reference cycles,
+// e.g., a Music and its stream interface, and cycles with finalizers are never
+// garbage collected. The leakCheck refers to nothing, so it is collected along
+// with its object.
+//
+// Finalizers do not free anything, as they run on arbitrary goroutines,
+// maybe after the context is gone.
+type leakCheck struct {
+	name string
+
+	// protected by liveLock
+	holding bool   // the object holds OpenAL names
+	gen     uint64 // the generation of the names
+}
+
+// newLeakCheck returns the leak check of an object of the type name,
+// not holding names yet, or nil if not a debug build.
+func newLeakCheck(name string) *leakCheck {
+	if !debugBuild {
+		return nil
+	}
+	l := &leakCheck{name: name}
+	runtime.SetFinalizer(l, (*leakCheck).report)
+	return l
+}
+
+// hold marks the object holding OpenAL names, until release is called.
+// It does nothing on a nil leakCheck.
+func (l *leakCheck) hold() {
+	if l == nil {
+		return
+	}
+	liveLock.Lock()
+	defer liveLock.Unlock()
+	l.holding, l.gen = true, generation
+}
+
+// release marks the object released. It does nothing on a nil leakCheck.
+func (l *leakCheck) release() {
+	if l == nil {
+		return
+	}
+	liveLock.Lock()
+	defer liveLock.Unlock()
+	l.holding = false
+}
+
+// report is the finalizer of the leakCheck.
+func (l *leakCheck) report() {
+	liveLock.Lock()
+	// the names of older generations are released by Shutdown
+	leaked := l.holding && l.gen == generation
+	liveLock.Unlock()
+
+	if leaked {
+		log.Printf("audio: %s garbage collected without being released", l.name)
+	}
+}
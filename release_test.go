@@ -0,0 +1,117 @@
+package audio
+
+import (
+	"bytes"
+	"log"
+	"os"
+	"runtime"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+// leakLog collects the reports of the leak checks, written to the log package
+// by the finalizers.
+type leakLog struct {
+	lock sync.Mutex
+	buf  bytes.Buffer
+}
+
+func (l *leakLog) Write(p []byte) (int, error) {
+	l.lock.Lock()
+	defer l.lock.Unlock()
+	return l.buf.Write(p)
+}
+
+// count returns the number of objects of the type name reported.
+func (l *leakLog) count(name string) int {
+	l.lock.Lock()
+	defer l.lock.Unlock()
+	return strings.Count(l.buf.String(), "audio: "+name+" garbage collected")
+}
+
+func TestLeakReports(t *testing.T) {
+	if !debugBuild {
+		t.Skip("leaks are reported with the audiodebug build tag only")
+	}
+	if err := Init(); err != nil {
+		t.Skip("cannot open the device:", err)
+	}
+	defer Shutdown()
+
+	out := &leakLog{}
+	log.SetOutput(out)
+	defer log.SetOutput(os.Stderr)
+
+	kept := NewSoundBuffer()
+	func() {
+		// on a bus, and attached to a buffer still in use
+		s := NewSound()
+		s.SetBuffer(kept)
+		s.SetBus(NewBus("Leaks", nil))
+		s.Play()
+
+		// attached to one another
+		NewSound().SetBuffer(NewSoundBuffer())
+
+		// in a cycle with its stream interface
+		m := NewMusic()
+		if err := m.OpenReader(NewRawPCMReader(PCMS16, nil, 1, 44100), bytes.NewReader(make([]byte, 64))); err != nil {
+			t.Fatal(err)
+		}
+
+		// released
+		r := NewSound()
+		r.SetBuffer(kept)
+		r.Release()
+		NewSoundBuffer().Release()
+		NewMusic()
+	}()
+
+	want := map[string]int{"Sound": 2, "SoundBuffer": 1, "Music": 1}
+	reported := func() bool {
+		for name, n := range want {
+			if out.count(name) < n {
+				return false
+			}
+		}
+		return true
+	}
+	for deadline := time.Now().Add(5 * time.Second); !reported() && time.Now().Before(deadline); {
+		runtime.GC()
+		time.Sleep(10 * time.Millisecond)
+	}
+	runtime.GC()
+	time.Sleep(10 * time.Millisecond)
+
+	for name, n := range want {
+		if got := out.count(name); got != n {
+			t.Errorf("%d %s leaks reported, want %d", got, name, n)
+		}
+	}
+	kept.Release()
+}
+
+func TestShutdownWakesStreams(t *testing.T) {
+	if err := Init(); err != nil {
+		t.Skip("cannot open the device:", err)
+	}
+
+	m := NewMusic()
+	defer m.Close()
+	if err := m.OpenReader(NewRawPCMReader(PCMS16, nil, 1, 44100), bytes.NewReader(make([]byte, 44100*2))); err != nil {
+		Shutdown()
+		t.Fatal(err)
+	}
+
+	// the stream sleeps until the start is near
+	m.PlayAt(DeviceClock() + 4*time.Second)
+	time.Sleep(50 * time.Millisecond)
+
+	start := time.Now()
+	Shutdown()
+	if d := time.Since(start); d > time.Second {
+		t.Errorf("Shutdown took %v with a pending PlayAt", d)
+	}
+}
@@ -0,0 +1,112 @@
+package audio
+
+// resampler converts interleaved 16-bit samples to another channel count
+// and sample rate, interpolating linearly between the frames.
+//
+// Channels are mixed down by averaging when converting to mono, and repeated
+// when converting from mono; otherwise channel i is taken from channel
+// i modulo the input channel count.
+type resampler struct {
+	inChannels, outChannels int
+
+	step    float64 // input frames per output frame
+	pos     float64 // position of the next output frame in pending, in frames
+	pending []int16 // input frames in outChannels, not yet consumed
+	in      []int16 // read buffer
+}
+
+// newResampler creates a resampler from the format of the first info to the second one.
+func newResampler(from, to SoundFileInfo) *resampler {
+	return &resampler{
+		inChannels:  from.ChannelCount,
+		outChannels: to.ChannelCount,
+		step:        float64(from.SampleRate) / float64(to.SampleRate),
+	}
+}
+
+// read fills out with samples converted from the ones returned by read,
+// in whole frames. It returns the number of samples written, 0 once read
+// returns nothing and no more frames are pending.
+func (r *resampler) read(out []int16, read func(data []int16) int64) int {
+	oc := r.outChannels
+	frames := len(out) / oc
+
+	n := 0
+	eof := false
+	for n < frames {
+		i := int(r.pos)
+		if i+1 >= len(r.pending)/oc {
+			if eof {
+				if i >= len(r.pending)/oc {
+					break
+				}
+				// the last frame has none after it to interpolate to
+				copy(out[n*oc:(n+1)*oc], r.pending[i*oc:])
+				n++
+				r.pos += r.step
+				continue
+			}
+
+			// read enough input for the rest of out, and the frame after
+			want := (int(float64(frames-n)*r.step) + 2) * r.inChannels
+			if len(r.in) < want {
+				r.in = make([]int16, want)
+			}
+			got := int(read(r.in[:want]))
+			got -= got % r.inChannels
+			if got <= 0 {
+				eof = true
+				continue
+			}
+			r.pending = r.mix(r.pending, r.in[:got])
+			continue
+		}
+
+		frac := r.pos - float64(i)
+		for c := 0; c < oc; c++ {
+			a, b := float64(r.pending[i*oc+c]), float64(r.pending[(i+1)*oc+c])
+			out[n*oc+c] = int16(a + (b-a)*frac)
+		}
+		n++
+		r.pos += r.step
+	}
+
+	// drop the frames consumed
+	if i := int(r.pos); i > 0 {
+		if max := len(r.pending) / oc; i > max {
+			i = max
+		}
+		r.pending = append(r.pending[:0], r.pending[i*oc:]...)
+		r.pos -= float64(i)
+	}
+	return n * oc
+}
+
+// mix appends the input frames to dst, converted to the output channel count.
+func (r *resampler) mix(dst, in []int16) []int16 {
+	ic, oc := r.inChannels, r.outChannels
+	if ic == oc {
+		return append(dst, in...)
+	}
+
+	for f := 0; f+ic <= len(in); f += ic {
+		frame := in[f : f+ic]
+		switch {
+		case oc == 1:
+			var sum int
+			for _, v := range frame {
+				sum += int(v)
+			}
+			dst = append(dst, int16(sum/ic))
+		case ic == 1:
+			for c := 0; c < oc; c++ {
+				dst = append(dst, frame[0])
+			}
+		default:
+			for c := 0; c < oc; c++ {
+				dst = append(dst, frame[c%ic])
+			}
+		}
+	}
+	return dst
+}
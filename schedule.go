@@ -0,0 +1,161 @@
+package audio
+
+// #include "headers.h"
+import "C"
+import (
+	"sync/atomic"
+	"time"
+	"unsafe"
+)
+
+// DeviceClock returns the clock of the audio device, the time base of PlayAt.
+//
+// With the ALC_SOFT_device_clock extension, it counts the time the device
+// has mixed. Otherwise it is the time since Init.
+func DeviceClock() time.Duration {
+	if extDeviceClock {
+		var v C.int64_t
+		C.__GoAudio_C_GetInteger64v(alcDevice, C.ALC_DEVICE_CLOCK_SOFT, 1, &v)
+		alcCheck(alcDevice, "alcGetInteger64vSOFT")
+		return time.Duration(v)
+	}
+	return time.Since(initTime)
+}
+
+// PlayAt starts playing the sound when DeviceClock reaches t,
+// or now if t is already past.
+//
+// With the AL_SOFT_source_start_delay extension, the start is exact to the sample.
+// Otherwise it is only as exact as a timer; use a SoundStream for a better one.
+// Play, Pause or Stop cancel a pending start.
+func (s *Sound) PlayAt(t time.Duration) {
+	stateLock.Lock()
+	defer stateLock.Unlock()
+
+	s.cancelStart()
+	if extStartDelay {
+		C.__GoAudio_C_PlayAtTime(s.source, C.int64_t(t))
+		alCheck("alSourcePlayAtTimeSOFT")
+		emit(&s.soundSource, EventStarted)
+		return
+	}
+
+	delay := t - DeviceClock()
+	if delay <= 0 {
+		C.alSourcePlay(s.source)
+		alCheck("alSourcePlay")
+		emit(&s.soundSource, EventStarted)
+		return
+	}
+
+	// the timer is set while holding stateLock, which its function takes first
+	var timer *time.Timer
+	timer = time.AfterFunc(delay, func() {
+		stateLock.Lock()
+		defer stateLock.Unlock()
+
+		if s.startTimer != timer || !isLive(s.source, s.gen) {
+			return
+		}
+		s.startTimer = nil
+		C.alSourcePlay(s.source)
+		alCheck("alSourcePlay")
+		emit(&s.soundSource, EventStarted)
+	})
+	s.startTimer = timer
+}
+
+// cancelStart cancels the pending PlayAt. stateLock must be held.
+func (s *Sound) cancelStart() {
+	if s.startTimer != nil {
+		s.startTimer.Stop()
+		s.startTimer = nil
+	}
+}
+
+// PlayAt starts playing the stream from the beginning when DeviceClock reaches t,
+// or now if t is already past. A playing or paused stream is restarted.
+//
+// With the AL_SOFT_source_start_delay extension, OpenAL starts the source at t.
+// Otherwise the stream is started now, after a buffer of silence lasting until t,
+// measured just before the source is started: the start is then only as exact
+// as OpenAL starting a source, up to an update of the device late.
+func (s *SoundStream) PlayAt(t time.Duration) {
+	s.ctl.Lock()
+	defer s.ctl.Unlock()
+
+	if s.source == 0 {
+		panic("SoundStream: call of nil object on PlayAt()")
+	}
+
+	s.stop()
+
+	s.lock.Lock()
+	s.streaming = true
+	s.state = Playing
+	s.startAt = t
+	s.lock.Unlock()
+	s.launch()
+	emit(&s.soundSource, EventStarted)
+}
+
+// queueSilence queues a buffer of silence lasting until the device time startAt,
+// if it is not past. It is called by the streaming goroutine.
+func (s *SoundStream) queueSilence(startAt time.Duration) {
+	frames := durationToFrames(startAt-DeviceClock(), s.info.SampleRate)
+	if frames <= 0 {
+		return
+	}
+
+	silence := make([]byte, frames*s.frameSize())
+
+	C.alGenBuffers(1, &s.padding)
+	alCheck("alGenBuffers")
+	C.alBufferData(s.padding, s.format, unsafe.Pointer(&silence[0]), C.ALsizei(len(silence)), C.ALsizei(s.info.SampleRate))
+	alCheck("alBufferData")
+
+	// the position stays before the start until the silence is played
+	s.lock.Lock()
+	C.alSourceQueueBuffers(s.source, 1, &s.padding)
+	alCheck("alSourceQueueBuffers")
+	s.seekOffset -= frames
+	s.lock.Unlock()
+	s.paddingFrames = frames
+}
+
+// PlayAt starts playing the stream when DeviceClock reaches t,
+// or now if t is already past.
+//
+// With AL_SOFT_callback_buffer but without AL_SOFT_source_start_delay,
+// the stream is started now, giving silence to OpenAL until t, measured just
+// before the source is started: the start is then only as exact as OpenAL
+// starting a source, up to an update of the device late.
+func (s *CallbackStream) PlayAt(t time.Duration) {
+	if !s.direct {
+		s.SoundStream.PlayAt(t)
+		return
+	}
+	s.ctl.Lock()
+	defer s.ctl.Unlock()
+
+	if s.source == 0 {
+		panic("CallbackStream: call of nil object on PlayAt()")
+	}
+
+	if extStartDelay {
+		atomic.StoreInt64(&s.callbackState.padding, 0)
+		C.__GoAudio_C_PlayAtTime(s.source, C.int64_t(t))
+		alCheck("alSourcePlayAtTimeSOFT")
+		emit(&s.soundSource, EventStarted)
+		return
+	}
+
+	frames := durationToFrames(t-DeviceClock(), s.SampleRate())
+	if frames < 0 {
+		frames = 0
+	}
+	atomic.StoreInt64(&s.callbackState.padding, frames*int64(s.channels))
+	C.alSourcePlay(s.source)
+	alCheck("alSourcePlay")
+	emit(&s.soundSource, EventStarted)
+}
@@ -0,0 +1,81 @@
+package audio
+
+import (
+	"bytes"
+	"testing"
+	"time"
+)
+
+func TestSoundPlayAt(t *testing.T) {
+	if err := Init(); err != nil {
+		t.Skip("cannot open the device:", err)
+	}
+	defer Shutdown()
+	if extStartDelay {
+		t.Skip("AL_SOFT_source_start_delay is supported")
+	}
+
+	b := NewSoundBuffer()
+	defer b.Release()
+	loadRaw(t, b, 44100, 1)
+	s := NewSound()
+	defer s.Release()
+	s.SetBuffer(b)
+
+	// started by a timer
+	s.PlayAt(DeviceClock() + 30*time.Millisecond)
+	if st := s.Status(); st == Playing {
+		t.Fatal("the sound started before its time")
+	}
+	for deadline := time.Now().Add(time.Second); s.Status() != Playing && time.Now().Before(deadline); {
+		time.Sleep(time.Millisecond)
+	}
+	if st := s.Status(); st != Playing {
+		t.Fatalf("Status = %v after its start, want Playing", st)
+	}
+
+	// canceled by Stop
+	s.Stop()
+	s.PlayAt(DeviceClock() + 30*time.Millisecond)
+	s.Stop()
+	time.Sleep(60 * time.Millisecond)
+	if st := s.Status(); st != Stopped {
+		t.Errorf("Status = %v after a start canceled by Stop, want Stopped", st)
+	}
+}
+
+func TestSoundStreamPlayAtPadding(t *testing.T) {
+	if err := Init(); err != nil {
+		t.Skip("cannot open the device:", err)
+	}
+	defer Shutdown()
+	if extStartDelay {
+		t.Skip("AL_SOFT_source_start_delay is supported")
+	}
+
+	m := NewMusic()
+	defer m.Close()
+	if err := m.OpenReader(NewRawPCMReader(PCMS16, nil, 1, 44100), bytes.NewReader(make([]byte, 44100*2))); err != nil {
+		t.Fatal(err)
+	}
+
+	// the silence is queued before the music, and the position stays at 0 until it is played
+	m.PlayAt(DeviceClock() + 200*time.Millisecond)
+	seekOffset := func() int64 {
+		m.SoundStream.lock.Lock()
+		defer m.SoundStream.lock.Unlock()
+		return m.seekOffset
+	}
+	for deadline := time.Now().Add(time.Second); seekOffset() == 0 && time.Now().Before(deadline); {
+		time.Sleep(time.Millisecond)
+	}
+	if padding := -seekOffset(); padding < 4410 || padding > 8820 {
+		t.Errorf("%d frames of silence queued for a start in 200ms, want up to 8820", padding)
+	}
+	if got := m.PlayingOffsetSamples(); got != 0 {
+		t.Errorf("PlayingOffsetSamples = %d in the silence, want 0", got)
+	}
+	if c := m.Clock(); c.OffsetSamples != 0 || c.Offset != 0 {
+		t.Errorf("Clock = %+v in the silence, want at 0", c)
+	}
+}
@@ -3,61 +3,148 @@ package audio
 // #include "headers.h"
 import "C"
 import (
-	"runtime"
 	"time"
 )
 
 type Sound struct {
 	soundSource
-	buffer *SoundBuffer
+	buffer     *SoundBuffer
+	startTimer *time.Timer // pending PlayAt without AL_SOFT_source_start_delay
+	leak       *leakCheck
 }
 
 // NewSound creates a new empty Sound instance.
+//
+// If no more OpenAL sources can be created, the Sound is silent.
+// This is reported in debug builds.
 func NewSound() *Sound {
 	s := &Sound{}
-	s.soundSource.init()
 
-	runtime.SetFinalizer(
-		s,
-		func(sound *Sound) {
-			C.alSourcei(sound.source, C.AL_BUFFER, 0)
-			sound.soundSource.close()
-		},
-	)
+	stateLock.Lock()
+	debugLog(s.soundSource.init())
+	stateLock.Unlock()
 
+	s.leak = newLeakCheck("Sound")
+	s.leak.hold()
 	return s
 }
 
+// Release stops the sound, and frees its OpenAL source.
+//
+// The sound should not be used again. Calling Release more than once does nothing.
+func (s *Sound) Release() {
+	s.leak.release()
+
+	stateLock.Lock()
+	defer stateLock.Unlock()
+
+	if s.source == 0 {
+		return
+	}
+	s.cancelStart()
+	s.resetBuffer()
+	s.soundSource.close()
+	unwatch(&s.soundSource)
+}
+
 // SetBuffer sets the underlying buffer of the sound.
+//
+// The sound is stopped if it had a buffer. A nil buffer detaches
+// the sound from its buffer.
 func (s *Sound) SetBuffer(buf *SoundBuffer) {
-	s.buffer = buf
-	C.alSourcei(s.source, C.AL_BUFFER, C.ALint(buf.buffer))
+	stateLock.Lock()
+	defer stateLock.Unlock()
+
+	s.setBuffer(buf)
 }
 
-// Buffer returns the underlying buffer of the sound.
+// setBuffer sets the underlying buffer of the sound. stateLock must be held.
+func (s *Sound) setBuffer(buf *SoundBuffer) {
+	if s.buffer != nil {
+		s.resetBuffer()
+	}
+
+	if buf != nil {
+		s.buffer = buf
+		buf.attachSound(s.source)
+		C.alSourcei(s.source, C.AL_BUFFER, C.ALint(buf.buffer))
+		alCheck("alSourcei")
+	}
+}
+
+// resetBuffer stops the sound and detaches it from its buffer.
+// stateLock must be held.
+func (s *Sound) resetBuffer() {
+	if s.status() != Stopped {
+		emit(&s.soundSource, EventStopped)
+	}
+	C.alSourceStop(s.source)
+	alCheck("alSourceStop")
+
+	if s.buffer != nil {
+		C.alSourcei(s.source, C.AL_BUFFER, 0)
+		alCheck("alSourcei")
+		s.buffer.detachSound(s.source)
+		s.buffer = nil
+	}
+}
+
+// Buffer returns the underlying buffer of the sound, or nil if the buffer is released.
 func (s *Sound) Buffer() *SoundBuffer {
+	stateLock.Lock()
+	defer stateLock.Unlock()
+
+	if s.buffer != nil && s.buffer.buffer == 0 {
+		return nil
+	}
 	return s.buffer
 }
 
 // Play starts or resumes playing the sound.
 func (s *Sound) Play() {
+	stateLock.Lock()
+	defer stateLock.Unlock()
+
+	s.cancelStart()
 	C.alSourcePlay(s.source)
+	alCheck("alSourcePlay")
+	emit(&s.soundSource, EventStarted)
 }
 
 // Pause pauses the sound.
 func (s *Sound) Pause() {
+	stateLock.Lock()
+	defer stateLock.Unlock()
+
+	s.cancelStart()
+	if s.status() == Playing {
+		emit(&s.soundSource, EventPaused)
+	}
 	C.alSourcePause(s.source)
+	alCheck("alSourcePause")
 }
 
 // Stop stops playing the sound.
 func (s *Sound) Stop() {
+	stateLock.Lock()
+	defer stateLock.Unlock()
+
+	s.cancelStart()
+	if s.status() != Stopped {
+		emit(&s.soundSource, EventStopped)
+	}
 	C.alSourceStop(s.source)
+	alCheck("alSourceStop")
 }
 
 // PlayingOffset returns the playing position of the sound in time.
 func (s *Sound) PlayingOffset() time.Duration {
+	stateLock.Lock()
+	defer stateLock.Unlock()
+
 	var secs C.ALfloat
 	C.alGetSourcef(s.source, C.AL_SEC_OFFSET, &secs)
+	alCheck("alGetSourcef")
 
 	return time.Duration(float64(time.Second) * float64(secs))
 }
@@ -67,5 +154,35 @@ func (s *Sound) PlayingOffset() time.Duration {
 // It can be called when the sound is playing or paused.
 // Calling on a stopped sound has no effect.
 func (s *Sound) SetPlayingOffset(offset time.Duration) {
+	stateLock.Lock()
+	defer stateLock.Unlock()
+
 	C.alSourcef(s.source, C.AL_SEC_OFFSET, C.float(offset.Seconds()))
+	alCheck("alSourcef")
+}
+
+// PlayingOffsetSamples returns the playing position of the sound,
+// in samples of a single channel (frames), like AL_SAMPLE_OFFSET.
+func (s *Sound) PlayingOffsetSamples() int64 {
+	stateLock.Lock()
+	defer stateLock.Unlock()
+
+	var offset C.ALint
+	C.alGetSourcei(s.source, C.AL_SAMPLE_OFFSET, &offset)
+	alCheck("alGetSourcei")
+
+	return int64(offset)
+}
+
+// SetPlayingOffsetSamples changes the playing position of the sound,
+// in samples of a single channel (frames), like AL_SAMPLE_OFFSET.
+//
+// It can be called when the sound is playing or paused.
+// Calling on a stopped sound has no effect.
+func (s *Sound) SetPlayingOffsetSamples(offset int64) {
+	stateLock.Lock()
+	defer stateLock.Unlock()
+
+	C.alSourcei(s.source, C.AL_SAMPLE_OFFSET, C.ALint(offset))
+	alCheck("alSourcei")
 }
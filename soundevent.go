@@ -0,0 +1,386 @@
+package audio
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"math/rand"
+	"os"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Selection is how a SoundEvent picks the variant to play.
+type Selection int8
+
+const (
+	SelectRandom     Selection = iota // a random variant, never the one played last
+	SelectShuffle                     // each variant once in a random order, then again in another order
+	SelectSequential                  // the variants in order, wrapping around
+)
+
+var selectionNames = [...]string{"random", "shuffle", "sequential"}
+
+// String returns the name of the selection, as used in the JSON definitions.
+func (s Selection) String() string {
+	if s < 0 || int(s) >= len(selectionNames) {
+		return fmt.Sprintf("Selection(%d)", int(s))
+	}
+	return selectionNames[s]
+}
+
+// MarshalText implements encoding.TextMarshaler.
+func (s Selection) MarshalText() ([]byte, error) {
+	return []byte(s.String()), nil
+}
+
+// UnmarshalText implements encoding.TextUnmarshaler.
+func (s *Selection) UnmarshalText(text []byte) error {
+	for i, name := range selectionNames {
+		if string(text) == name {
+			*s = Selection(i)
+			return nil
+		}
+	}
+	return fmt.Errorf("SoundEvent: unknown selection %q", text)
+}
+
+// SoundEventOptions are the properties of a SoundEvent.
+type SoundEventOptions struct {
+	Select       Selection
+	Volume       [2]float32    // the range of the volume, from 0 to 100; the zero value is taken as 100
+	Pitch        [2]float32    // the range of the pitch; the zero value is taken as 1
+	Cooldown     time.Duration // the least time between two plays; plays sooner are skipped
+	MaxInstances int           // the most instances playing at once; 0 for no limit
+	Steal        bool          // at MaxInstances, stop the oldest instance instead of skipping the play
+	Bus          *Bus          // the bus of the sounds; nil for the master bus
+}
+
+// SoundEvent is a sound with variants, e.g., footsteps, played as one-shots
+// with the pitch and the volume randomized within ranges on every play.
+//
+// The SoundBuffers of the variants are not released with the event,
+// unless they were loaded by LoadSoundEvents itself.
+type SoundEvent struct {
+	lock     sync.Mutex
+	opts     SoundEventOptions
+	variants []*SoundBuffer
+	owned    bool // the variants are released by Release
+
+	rand      *rand.Rand
+	last      int   // the variant played last, -1 if none
+	bag       []int // the variants left in the shuffle
+	lastPlay  time.Time
+	instances []*OneShot // oldest first
+}
+
+// NewSoundEvent creates a sound event playing the variants.
+func NewSoundEvent(opts SoundEventOptions, variants ...*SoundBuffer) *SoundEvent {
+	return &SoundEvent{
+		opts:     opts,
+		variants: append([]*SoundBuffer(nil), variants...),
+		rand:     rand.New(rand.NewSource(time.Now().UnixNano())),
+		last:     -1,
+	}
+}
+
+// Options returns the properties of the event.
+func (e *SoundEvent) Options() SoundEventOptions {
+	e.lock.Lock()
+	defer e.lock.Unlock()
+	return e.opts
+}
+
+// SetOptions changes the properties of the event, for the plays after.
+func (e *SoundEvent) SetOptions(opts SoundEventOptions) {
+	e.lock.Lock()
+	defer e.lock.Unlock()
+	e.opts = opts
+}
+
+// Variants returns the SoundBuffers of the variants.
+func (e *SoundEvent) Variants() []*SoundBuffer {
+	e.lock.Lock()
+	defer e.lock.Unlock()
+	return append([]*SoundBuffer(nil), e.variants...)
+}
+
+// Play plays a variant of the event as a one-shot, see SoundBuffer.PlayOneShot.
+//
+// The volume and the pitch of opts are multiplied by the ones picked from the ranges
+// of the event, and its bus is used if opts.Bus is nil.
+//
+// It returns a nil OneShot, and no error, if the play is skipped by the cooldown
+// or by the limit of instances, or if the event has no variants.
+func (e *SoundEvent) Play(opts OneShotOptions) (*OneShot, error) {
+	e.lock.Lock()
+	defer e.lock.Unlock()
+
+	if len(e.variants) == 0 {
+		return nil, nil
+	}
+	now := time.Now()
+	if !e.lastPlay.IsZero() && now.Sub(e.lastPlay) < e.opts.Cooldown {
+		return nil, nil
+	}
+
+	e.pruneInstances()
+	if max := e.opts.MaxInstances; max > 0 && len(e.instances) >= max {
+		if !e.opts.Steal {
+			return nil, nil
+		}
+		for len(e.instances) >= max {
+			e.instances[0].Stop()
+			e.instances = e.instances[1:]
+		}
+	}
+
+	if opts.Volume == 0 {
+		opts.Volume = 100
+	}
+	if opts.Pitch == 0 {
+		opts.Pitch = 1
+	}
+	opts.Volume *= e.pickRange(e.opts.Volume, 100) / 100
+	opts.Pitch *= e.pickRange(e.opts.Pitch, 1)
+	if opts.Bus == nil {
+		opts.Bus = e.opts.Bus
+	}
+
+	o, err := e.variants[e.pick()].PlayOneShot(opts)
+	if err != nil {
+		return nil, err
+	}
+	e.lastPlay = now
+	e.instances = append(e.instances, o)
+	return o, nil
+}
+
+// InstanceCount returns the number of instances of the event playing.
+func (e *SoundEvent) InstanceCount() int {
+	e.lock.Lock()
+	defer e.lock.Unlock()
+	e.pruneInstances()
+	return len(e.instances)
+}
+
+// StopAll stops all the instances of the event playing.
+func (e *SoundEvent) StopAll() {
+	e.lock.Lock()
+	defer e.lock.Unlock()
+	for _, o := range e.instances {
+		o.Stop()
+	}
+	e.instances = nil
+}
+
+// Release stops the event, and releases the SoundBuffers of its variants
+// if they were loaded by LoadSoundEvents.
+//
+// The event should not be used again. Calling Release more than once does nothing.
+func (e *SoundEvent) Release() {
+	e.StopAll()
+
+	e.lock.Lock()
+	defer e.lock.Unlock()
+	if e.owned {
+		for _, b := range e.variants {
+			b.Release()
+		}
+	}
+	e.variants = nil
+}
+
+// pruneInstances forgets the instances no longer playing. e.lock must be held.
+func (e *SoundEvent) pruneInstances() {
+	playing := e.instances[:0]
+	for _, o := range e.instances {
+		if o.IsPlaying() {
+			playing = append(playing, o)
+		}
+	}
+	for i := len(playing); i < len(e.instances); i++ {
+		e.instances[i] = nil
+	}
+	e.instances = playing
+}
+
+// pickRange returns a random value in the range, or def if the range is zero.
+// e.lock must be held.
+func (e *SoundEvent) pickRange(r [2]float32, def float32) float32 {
+	lo, hi := r[0], r[1]
+	if lo == 0 && hi == 0 {
+		return def
+	}
+	if hi < lo {
+		lo, hi = hi, lo
+	}
+	return lo + (hi-lo)*e.rand.Float32()
+}
+
+// pick returns the index of the variant to play next. e.lock must be held.
+func (e *SoundEvent) pick() int {
+	n := len(e.variants)
+	if n == 1 {
+		e.last = 0
+		return 0
+	}
+
+	var i int
+	switch e.opts.Select {
+	case SelectSequential:
+		i = (e.last + 1) % n
+
+	case SelectShuffle:
+		if len(e.bag) == 0 {
+			e.bag = e.rand.Perm(n)
+			// no repeat across the end of a round
+			if e.bag[len(e.bag)-1] == e.last {
+				e.bag[0], e.bag[len(e.bag)-1] = e.bag[len(e.bag)-1], e.bag[0]
+			}
+		}
+		i = e.bag[len(e.bag)-1]
+		e.bag = e.bag[:len(e.bag)-1]
+
+	default:
+		if e.last < 0 {
+			i = e.rand.Intn(n)
+			break
+		}
+		i = e.rand.Intn(n - 1)
+		if i >= e.last {
+			i++
+		}
+	}
+	e.last = i
+	return i
+}
+
+// soundEventJSON is the definition of a SoundEvent in the files read by LoadSoundEvents.
+type soundEventJSON struct {
+	Variants     []string   `json:"variants"`
+	Select       Selection  `json:"select"`
+	Volume       [2]float32 `json:"volume"`
+	Pitch        [2]float32 `json:"pitch"`
+	Cooldown     string     `json:"cooldown"`
+	MaxInstances int        `json:"maxInstances"`
+	Steal        bool       `json:"steal"`
+	Bus          string     `json:"bus"`
+}
+
+// LoadSoundEvents reads the definitions of sound events from a JSON file, e.g.:
+//
+//	{
+//		"footstep": {
+//			"variants": ["sfx/step1.wav", "sfx/step2.wav", "sfx/step3.wav"],
+//			"select": "shuffle",
+//			"volume": [80, 100],
+//			"pitch": [0.95, 1.05],
+//			"cooldown": "80ms",
+//			"maxInstances": 4,
+//			"steal": true,
+//			"bus": "SFX/Footsteps"
+//		}
+//	}
+//
+// The fields are the ones of SoundEventOptions. select is one of "random", "shuffle"
+// and "sequential"; cooldown is parsed by time.ParseDuration; bus is a path of buses
+// under the master bus, created by NewBus if missing.
+//
+// The variants are loaded by load, e.g., from an asset cache, and are not released
+// with the events. If load is nil, the files are opened by os.Open, and the buffers
+// are released by SoundEvent.Release.
+func LoadSoundEvents(r io.Reader, load func(path string) (*SoundBuffer, error)) (map[string]*SoundEvent, error) {
+	var defs map[string]soundEventJSON
+	dec := json.NewDecoder(r)
+	dec.DisallowUnknownFields()
+	if err := dec.Decode(&defs); err != nil {
+		return nil, fmt.Errorf("SoundEvent: cannot parse definitions: %w", err)
+	}
+
+	owned := load == nil
+	if owned {
+		load = loadSoundBufferFile
+	}
+
+	events := make(map[string]*SoundEvent, len(defs))
+	release := func() {
+		for _, e := range events {
+			e.Release()
+		}
+	}
+	for name, def := range defs {
+		e, err := newSoundEventJSON(def, load, owned)
+		if err != nil {
+			release()
+			return nil, fmt.Errorf("SoundEvent: %s: %w", name, err)
+		}
+		events[name] = e
+	}
+	return events, nil
+}
+
+// newSoundEventJSON creates the event of a definition, loading its variants.
+func newSoundEventJSON(def soundEventJSON, load func(path string) (*SoundBuffer, error), owned bool) (*SoundEvent, error) {
+	if len(def.Variants) == 0 {
+		return nil, errors.New("no variants")
+	}
+
+	opts := SoundEventOptions{
+		Select:       def.Select,
+		Volume:       def.Volume,
+		Pitch:        def.Pitch,
+		MaxInstances: def.MaxInstances,
+		Steal:        def.Steal,
+	}
+	if def.Cooldown != "" {
+		d, err := time.ParseDuration(def.Cooldown)
+		if err != nil {
+			return nil, err
+		}
+		opts.Cooldown = d
+	}
+	if def.Bus != "" {
+		for _, name := range strings.Split(def.Bus, "/") {
+			if name != "" {
+				opts.Bus = NewBus(name, opts.Bus)
+			}
+		}
+	}
+
+	variants := make([]*SoundBuffer, 0, len(def.Variants))
+	for _, path := range def.Variants {
+		b, err := load(path)
+		if err != nil {
+			if owned {
+				for _, v := range variants {
+					v.Release()
+				}
+			}
+			return nil, err
+		}
+		variants = append(variants, b)
+	}
+
+	e := NewSoundEvent(opts, variants...)
+	e.owned = owned
+	return e, nil
+}
+
+// loadSoundBufferFile loads a new SoundBuffer with the file at the path.
+func loadSoundBufferFile(path string) (*SoundBuffer, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+
+	b := NewSoundBuffer()
+	if err = b.Load(file); err != nil {
+		b.Release()
+		return nil, err
+	}
+	return b, nil
+}
@@ -0,0 +1,103 @@
+package audio
+
+import (
+	"math/rand"
+	"testing"
+)
+
+// newTestEvent returns an event with n variants, without buffers, picking
+// with the seed.
+func newTestEvent(sel Selection, n int, seed int64) *SoundEvent {
+	e := NewSoundEvent(SoundEventOptions{Select: sel}, make([]*SoundBuffer, n)...)
+	e.rand = rand.New(rand.NewSource(seed))
+	return e
+}
+
+func TestSoundEventPickRandom(t *testing.T) {
+	for seed := int64(0); seed < 20; seed++ {
+		e := newTestEvent(SelectRandom, 3, seed)
+		seen := make(map[int]bool)
+		last := -1
+		for i := 0; i < 100; i++ {
+			v := e.pick()
+			if v < 0 || v >= 3 {
+				t.Fatalf("seed %d: picked %d of 3 variants", seed, v)
+			}
+			if v == last {
+				t.Fatalf("seed %d: variant %d picked twice in a row", seed, v)
+			}
+			seen[v] = true
+			last = v
+		}
+		if len(seen) != 3 {
+			t.Errorf("seed %d: %d variants picked, want 3", seed, len(seen))
+		}
+	}
+}
+
+func TestSoundEventPickShuffle(t *testing.T) {
+	const n = 4
+	for seed := int64(0); seed < 50; seed++ {
+		e := newTestEvent(SelectShuffle, n, seed)
+		last := -1
+		for round := 0; round < 10; round++ {
+			seen := make(map[int]bool)
+			for i := 0; i < n; i++ {
+				v := e.pick()
+				if seen[v] {
+					t.Fatalf("seed %d: variant %d picked twice in round %d", seed, v, round)
+				}
+				if v == last {
+					t.Fatalf("seed %d: variant %d picked twice in a row, across rounds", seed, v)
+				}
+				seen[v] = true
+				last = v
+			}
+		}
+	}
+}
+
+func TestSoundEventPickSequential(t *testing.T) {
+	e := newTestEvent(SelectSequential, 3, 0)
+	for i, want := range []int{0, 1, 2, 0, 1} {
+		if v := e.pick(); v != want {
+			t.Fatalf("pick %d = %d, want %d", i, v, want)
+		}
+	}
+
+	for _, sel := range []Selection{SelectRandom, SelectShuffle, SelectSequential} {
+		e := newTestEvent(sel, 1, 0)
+		for i := 0; i < 3; i++ {
+			if v := e.pick(); v != 0 {
+				t.Fatalf("%v: pick of a single variant = %d", sel, v)
+			}
+		}
+	}
+}
+
+func TestSoundEventPickRange(t *testing.T) {
+	e := newTestEvent(SelectRandom, 1, 0)
+	if v := e.pickRange([2]float32{}, 100); v != 100 {
+		t.Errorf("pickRange of the zero range = %v, want the default", v)
+	}
+	for i := 0; i < 100; i++ {
+		// reversed ranges are taken in order
+		if v := e.pickRange([2]float32{1.2, 0.8}, 1); v < 0.8 || v > 1.2 {
+			t.Fatalf("pickRange = %v, out of [0.8, 1.2]", v)
+		}
+	}
+}
+
+func TestSelectionText(t *testing.T) {
+	for _, sel := range []Selection{SelectRandom, SelectShuffle, SelectSequential} {
+		text, _ := sel.MarshalText()
+		var got Selection
+		if err := got.UnmarshalText(text); err != nil || got != sel {
+			t.Errorf("UnmarshalText(%q) = (%v, %v), want %v", text, got, err, sel)
+		}
+	}
+	var s Selection
+	if err := s.UnmarshalText([]byte("loud")); err == nil {
+		t.Error("UnmarshalText of an unknown name succeeded")
+	}
+}
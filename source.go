@@ -15,19 +15,70 @@ const (
 // Most of the comments below are directly copied from SFML.
 type soundSource struct {
 	source C.ALuint
+	gen    uint64     // generation of the source, see Shutdown
+	clock  clockState // protected by stateLock
+
+	streamed bool // the playback events are reported by a SoundStream; protected by stateLock
+
+	// protected by stateLock
+	volume float32    // the volume set, before the bus
+	pitch  float32    // the pitch set, before the bus
+	bus    *Bus       // nil for the master bus
+	member *busMember // the source on its bus, while it has an OpenAL name
 }
 
-func (s *soundSource) init() {
+// init creates the OpenAL source, if not yet created, and adds it to its bus.
+// stateLock must be held.
+//
+// The error wraps ErrOutOfSources if it cannot be created.
+func (s *soundSource) init() (err error) {
 	if s.source == 0 {
-		C.alGenSources(1, &s.source)
+		s.source, s.gen, err = genSource()
+		if err != nil {
+			return
+		}
 		C.alSourcei(s.source, C.AL_BUFFER, 0)
+		alCheck("alSourcei")
+
+		s.volume, s.pitch = 100, 1
+		s.member = &busMember{source: s.source, gen: s.gen, volume: s.volume, pitch: s.pitch}
+		s.joinBus()
 	}
+	return nil
 }
 
+// close frees the OpenAL source, and removes it from its bus. stateLock must be held.
 func (s *soundSource) close() {
 	if s.source != 0 {
-		C.alDeleteSources(1, &s.source)
+		s.leaveBus()
+		s.member = nil
+		deleteSource(s.source, s.gen)
+		s.source = 0
+	}
+}
+
+// status returns the current status of the source. stateLock must be held.
+func (s *soundSource) status() PlayStatus {
+	return sourceStatus(s.source)
+}
+
+// sourceStatus returns the current status of the source of the name.
+// stateLock must be held.
+func sourceStatus(source C.ALuint) PlayStatus {
+	var status C.ALint
+	C.alGetSourcei(source, C.AL_SOURCE_STATE, &status)
+	alCheck("alGetSourcei")
+
+	switch status {
+	case C.AL_INITIAL, C.AL_STOPPED:
+		return Stopped
+	case C.AL_PAUSED:
+		return Paused
+	case C.AL_PLAYING:
+		return Playing
 	}
+
+	return Stopped
 }
 
 // SetPitch sets the pitch of the sound.
@@ -39,7 +90,14 @@ func (s *soundSource) close() {
 //
 // The default value for the pitch is 1.
 func (s *soundSource) SetPitch(pitch float32) {
-	C.alSourcef(s.source, C.AL_PITCH, C.float(pitch))
+	stateLock.Lock()
+	defer stateLock.Unlock()
+
+	s.pitch = pitch
+	if s.member != nil {
+		s.member.pitch = pitch
+		s.member.applyPitch()
+	}
 }
 
 // SetVolume sets the volume of the sound.
@@ -48,7 +106,14 @@ func (s *soundSource) SetPitch(pitch float32) {
 //
 // The default value for the volume is 100.
 func (s *soundSource) SetVolume(volume float32) {
-	C.alSourcef(s.source, C.AL_GAIN, C.float(volume*0.01))
+	stateLock.Lock()
+	defer stateLock.Unlock()
+
+	s.volume = volume
+	if s.member != nil {
+		s.member.volume = volume
+		s.member.applyVolume()
+	}
 }
 
 // SetPosition sets the 3D position of the sound in the audio scene.
@@ -58,7 +123,11 @@ func (s *soundSource) SetVolume(volume float32) {
 //
 // The default position of a sound is (0, 0, 0).
 func (s *soundSource) SetPosition(pos [3]float32) {
+	stateLock.Lock()
+	defer stateLock.Unlock()
+
 	C.alSourcefv(s.source, C.AL_POSITION, ptrf(pos[:]))
+	alCheck("alSourcefv")
 }
 
 // SetRelativeToListener makes the sound's position relative to the listener or absolute.
@@ -70,10 +139,15 @@ func (s *soundSource) SetPosition(pos [3]float32) {
 //
 // The default value is false (position is absolute).
 func (s *soundSource) SetRelativeToListener(relative bool) {
+	stateLock.Lock()
+	defer stateLock.Unlock()
+
 	if relative {
 		C.alSourcei(s.source, C.AL_SOURCE_RELATIVE, 1)
+		alCheck("alSourcei")
 	} else {
 		C.alSourcei(s.source, C.AL_SOURCE_RELATIVE, 0)
+		alCheck("alSourcei")
 	}
 }
 
@@ -87,7 +161,11 @@ func (s *soundSource) SetRelativeToListener(relative bool) {
 //
 // The default value of the minimum distance is 1.
 func (s *soundSource) SetMinDistance(distance float32) {
+	stateLock.Lock()
+	defer stateLock.Unlock()
+
 	C.alSourcef(s.source, C.AL_REFERENCE_DISTANCE, C.float(distance))
+	alCheck("alSourcef")
 }
 
 // SetAttenuation sets the attenuation factor of the sound.
@@ -102,22 +180,26 @@ func (s *soundSource) SetMinDistance(distance float32) {
 //
 // The default value of the attenuation is 1.
 func (s *soundSource) SetAttenuation(attenuation float32) {
+	stateLock.Lock()
+	defer stateLock.Unlock()
+
 	C.alSourcef(s.source, C.AL_ROLLOFF_FACTOR, C.float(attenuation))
+	alCheck("alSourcef")
 }
 
-// Status returns the current status of the sound stream.
-func (s *soundSource) Status() PlayStatus {
-	var status C.ALint
-	C.alGetSourcei(s.source, C.AL_SOURCE_STATE, &status)
-
-	switch status {
-	case C.AL_INITIAL, C.AL_STOPPED:
-		return Stopped
-	case C.AL_PAUSED:
-		return Paused
-	case C.AL_PLAYING:
-		return Playing
+// setLoop sets whether the source repeats its buffer. stateLock must be held.
+func (s *soundSource) setLoop(loop bool) {
+	if loop {
+		C.alSourcei(s.source, C.AL_LOOPING, 1)
+	} else {
+		C.alSourcei(s.source, C.AL_LOOPING, 0)
 	}
+	alCheck("alSourcei")
+}
 
-	return Stopped
+// Status returns the current status of the sound stream.
+func (s *soundSource) Status() PlayStatus {
+	stateLock.Lock()
+	defer stateLock.Unlock()
+	return s.status()
 }
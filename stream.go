@@ -1,6 +1,7 @@
 package audio
 
 import (
+	"fmt"
 	"sync"
 	"time"
 	"unsafe"
@@ -10,11 +11,22 @@ import (
 import "C"
 
 const (
-	SoundStreamBufferCount  = 3                     // number of audio buffers used by the stream thread
+	DefaultSoundStreamBufferCount    = 3           // default number of audio buffers queued by a stream, see SetBufferCount
+	DefaultSoundStreamBufferDuration = time.Second // default duration of each audio buffer of a stream, see SetBufferDuration
+
 	SoundStreamRetries      = 2                     // number of retries (not counting first try) for GetData()
-	SoundStreamPollInterval = 50 * time.Millisecond // interval between stream thread polling
+	SoundStreamPollInterval = 50 * time.Millisecond // longest interval between stream thread polling, without AL_SOFT_events
+
+	minSoundStreamBufferCount  = 2                    // fewer buffers cannot play without gaps
+	minSoundStreamPollInterval = 2 * time.Millisecond // shortest interval between stream thread polling
+	maxStartSilence            = time.Second          // longest silence queued before a scheduled start, see PlayAt
 )
 
+// SoundStreamBufferCount is the default number of audio buffers used by a stream.
+//
+// Deprecated: Use DefaultSoundStreamBufferCount, or SoundStream.SetBufferCount.
+const SoundStreamBufferCount = DefaultSoundStreamBufferCount
+
 // SoundStreamInterface wraps underlying streamed audio resource.
 type SoundStreamInterface interface {
 	// SoundGetData requests a new chunk of audio samples from the stream source.
@@ -34,46 +46,188 @@ type SoundStreamInterface interface {
 	// If the sound stream in question does not support seeking, this function
 	// should do nothing.
 	Seek(time time.Duration)
+}
 
+// SoundStreamSeeker is implemented by stream sources that can seek
+// to an exact sample. The stream calls SeekSample instead of Seek.
+type SoundStreamSeeker interface {
 	// SeekSample changes the current playing position of the stream source.
 	//
-	// Unlike Seek, this function seeks by the sample offset.
+	// Unlike Seek, this function seeks by the sample offset, in samples of
+	// a single channel (frames), i.e., the time multiplied by the sample rate.
+	SeekSample(offset int64)
+}
+
+// SoundStreamFloatInterface is implemented by stream sources
+// that can provide 32-bit float samples, normalized to [-1, 1].
+//
+// If OpenAL supports float buffers (the AL_EXT_FLOAT32 extension),
+// the stream calls GetDataFloat instead of GetData.
+type SoundStreamFloatInterface interface {
+	SoundStreamInterface
+
+	// GetDataFloat requests a new chunk of float audio samples from the stream source.
 	//
-	// If the sound stream in question does not support seeking, this function
-	// should do nothing.
-	//SeekSample(offset int64)
+	// It behaves the same as GetData otherwise.
+	GetDataFloat() []float32
 }
 
 // SoundStream implements a basis for streamed audio content.
+//
+// The streaming happens in a separate goroutine, started by Play.
+// See lock.go for the locks involved.
 type SoundStream struct {
 	soundSource
 
+	ctl     sync.Mutex    // serializes the control methods, see lock.go
+	running chan struct{} // closed when the streaming goroutine ends; protected by ctl
+
+	wake chan struct{} // wakes up the streaming goroutine; protected by ctl
+
+	// set by Init, and only read by the streaming goroutine
 	info   SoundFileInfo
 	format C.ALenum
 	iface  SoundStreamInterface
+	fiface SoundStreamFloatInterface // non-nil if streaming float samples
 
 	// this group is mutex protected
-	lock       sync.Mutex
-	state      PlayStatus
-	streaming  bool
-	buffers    [SoundStreamBufferCount]C.ALuint // buffer handles
-	stopped    chan struct{}
-	seekOffset int64
+	lock           sync.Mutex
+	state          PlayStatus
+	streaming      bool
+	seekOffset     int64         // position of the first buffer in the queue, in frames
+	bufferCount    int           // 0 for the default
+	bufferDuration time.Duration // 0 for the default
+	startAt        time.Duration // device time to start at, set by PlayAt and taken by the streaming goroutine
+	queued         int64         // position of the end of the queue, in frames
+	endAt          int64         // position to end the stream at, in frames, if positive; see endAtSample
+	cut            bool          // endAt is inside the buffers already queued; see requeue
+
+	// owned by the streaming goroutine
+	buffers       []C.ALuint // buffer handles
+	padding       C.ALuint   // buffer of silence before a scheduled start, see PlayAt
+	paddingFrames int64      // frames of padding
+	order         []int      // the buffers queued after padding, by number, the first queued first
+	kept          [][]byte   // the data of each buffer, kept while it is queued; see requeue
+	loops         [][]int64  // loop wraps in each buffer, in samples into its data, reported once it is played
+	wraps         []int64    // loop wraps in the data being filled, in samples into it; see markLoop
 }
 
 // Init is called by derived classes to initialize the sound stream.
-func (s *SoundStream) Init(iface SoundStreamInterface, info SoundFileInfo) {
+//
+// The stream is stopped if it is playing.
+//
+// The error wraps ErrOutOfSources if the OpenAL source cannot be created,
+// or ErrUnsupportedChannels if OpenAL cannot play the channel count.
+func (s *SoundStream) Init(iface SoundStreamInterface, info SoundFileInfo) error {
+	s.ctl.Lock()
+	defer s.ctl.Unlock()
+
+	return s.initStream(iface, info)
+}
+
+// initStream initializes the sound stream. s.ctl must be held.
+func (s *SoundStream) initStream(iface SoundStreamInterface, info SoundFileInfo) error {
+	s.stop()
+
+	stateLock.Lock()
+	err := s.soundSource.init()
+	s.streamed = true
+	stateLock.Unlock()
+	if err != nil {
+		return fmt.Errorf("SoundStream: cannot init: %w", err)
+	}
+
+	format := getFormatFromChannelCount(info.ChannelCount)
+	var fiface SoundStreamFloatInterface
 
-	s.soundSource.init()
-	s.format = getFormatFromChannelCount(info.ChannelCount)
+	// use float samples if both the source and OpenAL support them
+	if fi, ok := iface.(SoundStreamFloatInterface); ok {
+		if f := getFloatFormatFromChannelCount(info.ChannelCount); f != 0 {
+			format = f
+			fiface = fi
+		}
+	}
+
+	s.lock.Lock()
 	s.info = info
+	s.format = format
 	s.iface = iface
+	s.fiface = fiface
+	s.lock.Unlock()
+
+	if format == 0 {
+		return fmt.Errorf("SoundStream: cannot init: %w: %d", ErrUnsupportedChannels, info.ChannelCount)
+	}
+	return nil
+}
+
+// IsFloat tells if the stream plays 32-bit float samples.
+func (s *SoundStream) IsFloat() bool {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	return s.fiface != nil
+}
+
+// SetBufferCount sets the number of audio buffers queued by the stream.
+//
+// More buffers make the stream less likely to run dry if GetData is slow,
+// at the cost of memory. At least 2 buffers are used.
+// 0 sets the default, DefaultSoundStreamBufferCount.
+//
+// It takes effect the next time the stream is played.
+func (s *SoundStream) SetBufferCount(count int) {
+	if count != 0 && count < minSoundStreamBufferCount {
+		count = minSoundStreamBufferCount
+	}
+	s.lock.Lock()
+	s.bufferCount = count
+	s.lock.Unlock()
+}
+
+// BufferCount returns the number of audio buffers queued by the stream.
+func (s *SoundStream) BufferCount() int {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	if s.bufferCount == 0 {
+		return DefaultSoundStreamBufferCount
+	}
+	return s.bufferCount
+}
+
+// SetBufferDuration sets the duration of each audio buffer of the stream.
+//
+// The duration is a hint to the SoundStreamInterface, which decides how many
+// samples GetData returns; Music follows it. Shorter buffers lower the latency
+// and the memory used, but GetData is called more often.
+// 0 or less sets the default, DefaultSoundStreamBufferDuration.
+//
+// It takes effect on the buffers filled afterwards.
+func (s *SoundStream) SetBufferDuration(duration time.Duration) {
+	if duration < 0 {
+		duration = 0
+	}
+	s.lock.Lock()
+	s.bufferDuration = duration
+	s.lock.Unlock()
+}
+
+// BufferDuration returns the duration of each audio buffer of the stream.
+func (s *SoundStream) BufferDuration() time.Duration {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	if s.bufferDuration == 0 {
+		return DefaultSoundStreamBufferDuration
+	}
+	return s.bufferDuration
 }
 
 // Play starts/resumes playing the sound stream.
 //
 // It restarts the stream from the beginning if it is already playing.
 func (s *SoundStream) Play() {
+	s.ctl.Lock()
+	defer s.ctl.Unlock()
+
 	if s.source == 0 {
 		panic("SoundStream: call of nil object on Play()")
 	}
@@ -89,20 +243,28 @@ func (s *SoundStream) Play() {
 			s.state = Playing
 			s.lock.Unlock()
 			C.alSourcePlay(s.source)
+			alCheck("alSourcePlay")
+			emit(&s.soundSource, EventStarted)
 			return
 		} else if state == Playing {
 			// stop the stream and start it again
-			s.Stop()
+			s.stop()
 		}
 	}
 
+	s.lock.Lock()
 	s.streaming = true
 	s.state = Playing
-	go s.streamData()
+	s.lock.Unlock()
+	s.launch()
+	emit(&s.soundSource, EventStarted)
 }
 
 // Pause pauses the sound stream if playing.
 func (s *SoundStream) Pause() {
+	s.ctl.Lock()
+	defer s.ctl.Unlock()
+
 	s.lock.Lock()
 	if !s.streaming { // the goroutine is not running
 		s.lock.Unlock()
@@ -112,57 +274,85 @@ func (s *SoundStream) Pause() {
 	s.lock.Unlock()
 
 	C.alSourcePause(s.source)
+	alCheck("alSourcePause")
+	emit(&s.soundSource, EventPaused)
 }
 
 // Stop stops the sound streaming if playing.
 func (s *SoundStream) Stop() {
+	s.ctl.Lock()
+	defer s.ctl.Unlock()
 
-	// signal and wait for the thread to terminate
-	var streaming bool
 	s.lock.Lock()
+	streaming := s.streaming
+	s.lock.Unlock()
 
-	if s.streaming {
-		streaming = true
-		s.stopped = make(chan struct{})
+	s.stop()
+	if streaming {
+		emit(&s.soundSource, EventStopped)
 	}
-	s.streaming = false
+}
+
+// stop stops the sound streaming, and seeks to the beginning. s.ctl must be held.
+func (s *SoundStream) stop() {
 
+	// signal and wait for the thread to terminate,
+	// even if it is already ending by itself
+	s.lock.Lock()
+	s.streaming = false
 	s.lock.Unlock()
 
-	if streaming {
-		<-s.stopped
-		close(s.stopped)
-		s.stopped = nil
+	if s.wake != nil {
+		wakeup(s.wake)
 	}
+	if s.running != nil {
+		<-s.running
+		s.running = nil
 
+		stateLock.Lock()
+		s.setPlayer(nil)
+		stateLock.Unlock()
+	}
+
+	s.lock.Lock()
 	s.seekOffset = 0
+	iface := s.iface
+	s.lock.Unlock()
 
-	if s.iface != nil {
-		s.iface.Seek(0)
+	if iface != nil {
+		iface.Seek(0)
 	}
 
 }
 
+// streamInfo returns the properities of the stream set by Init.
+func (s *SoundStream) streamInfo() SoundFileInfo {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	return s.info
+}
+
 // SampleCount returns the number of samples in the buffer.
 //
 // Two samples from two channels at the same timepoint count twice.
 func (s *SoundStream) SampleCount() int64 {
-	return s.info.SampleCount
+	return s.streamInfo().SampleCount
 }
 
 // SampleRate returns the sample rate of the buffer, in samples per second.
 func (s *SoundStream) SampleRate() int {
-	return s.info.SampleRate
+	return s.streamInfo().SampleRate
 }
 
 // ChannelCount returns the number of channels in the buffer.
 func (s *SoundStream) ChannelCount() int {
-	return s.info.ChannelCount
+	return s.streamInfo().ChannelCount
 }
 
 // Duration returns the duration of the sound in the buffer.
 func (s *SoundStream) Duration() time.Duration {
-	return time.Duration(float64(time.Second) / float64(s.info.ChannelCount) * float64(s.info.SampleCount) / float64(s.info.SampleRate))
+	info := s.streamInfo()
+	return time.Duration(float64(time.Second) / float64(info.ChannelCount) * float64(info.SampleCount) / float64(info.SampleRate))
 }
 
 // Status returns the current status of the sound stream.
@@ -181,23 +371,61 @@ func (s *SoundStream) Status() PlayStatus {
 	return status
 }
 
-// Close closes the SoundStream. It also ends the goroutine tied to it.
+// Close closes the SoundStream. It also ends the goroutine tied to it,
+// and frees the OpenAL source.
 //
-// The stream object should not be used again.
+// The stream object should not be used again, until Init is called again.
+// Calling Close more than once does nothing.
 func (s *SoundStream) Close() {
-	s.Stop()
+	s.ctl.Lock()
+	defer s.ctl.Unlock()
+
+	s.close()
+}
+
+// close stops the stream and frees the OpenAL source. s.ctl must be held.
+//
+// It shadows soundSource.close.
+func (s *SoundStream) close() {
+	if s.source == 0 {
+		return
+	}
+	s.stop()
+
+	stateLock.Lock()
+	s.soundSource.close()
+	stateLock.Unlock()
+	unwatch(&s.soundSource)
 }
 
 // PlayingOffset returns the playing position of the sound in time.
 func (s *SoundStream) PlayingOffset() time.Duration {
+	return framesToDuration(s.PlayingOffsetSamples(), s.SampleRate())
+}
+
+// PlayingOffsetSamples returns the playing position of the sound,
+// in samples of a single channel (frames), like AL_SAMPLE_OFFSET.
+func (s *SoundStream) PlayingOffsetSamples() int64 {
+	// the offset of the source and seekOffset change together under s.lock,
+	// as the streaming goroutine unqueues the buffers
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	stateLock.Lock()
 	if s.source == 0 {
+		stateLock.Unlock()
 		return 0
 	}
+	var offset C.ALint
+	C.alGetSourcei(s.source, C.AL_SAMPLE_OFFSET, &offset)
+	alCheck("alGetSourcei")
+	stateLock.Unlock()
 
-	var secs C.ALfloat
-	C.alGetSourcef(s.source, C.AL_SEC_OFFSET, &secs)
-
-	return time.Duration(float64(time.Second) * (float64(secs) + float64(s.seekOffset)/float64(s.info.ChannelCount)/float64(s.info.SampleRate)))
+	if s.seekOffset+int64(offset) < 0 {
+		// still in the silence before a scheduled start
+		return 0
+	}
+	return s.seekOffset + int64(offset)
 }
 
 // SetPlayingOffset changes the playing position of the sound.
@@ -205,6 +433,19 @@ func (s *SoundStream) PlayingOffset() time.Duration {
 // It can be called when the sound is playing or paused.
 // Calling on a stopped sound has no effect.
 func (s *SoundStream) SetPlayingOffset(offset time.Duration) {
+	s.SetPlayingOffsetSamples(durationToFrames(offset, s.SampleRate()))
+}
+
+// SetPlayingOffsetSamples changes the playing position of the sound,
+// in samples of a single channel (frames).
+//
+// The position is exact if the stream source implements SoundStreamSeeker.
+//
+// It can be called when the sound is playing or paused.
+// Calling on a stopped sound has no effect.
+func (s *SoundStream) SetPlayingOffsetSamples(offset int64) {
+	s.ctl.Lock()
+	defer s.ctl.Unlock()
 
 	// stop the streaming, seek, and then start streaming again
 
@@ -213,17 +454,37 @@ func (s *SoundStream) SetPlayingOffset(offset time.Duration) {
 		return
 	}
 
-	s.Stop()
+	s.stop()
 
-	s.iface.Seek(offset)
+	if seeker, ok := s.iface.(SoundStreamSeeker); ok {
+		seeker.SeekSample(offset)
+	} else {
+		s.iface.Seek(framesToDuration(offset, s.info.SampleRate))
+	}
 
+	s.lock.Lock()
 	s.streaming = true
 	s.state = oldstatus
-	s.seekOffset = int64(offset.Seconds() * float64(s.info.ChannelCount) * float64(s.info.SampleRate))
-	go s.streamData()
+	s.seekOffset = offset
+	s.lock.Unlock()
+	s.launch()
 }
 
-func (s *SoundStream) streamData() {
+// launch starts the streaming goroutine. s.ctl must be held.
+func (s *SoundStream) launch() {
+	s.running = make(chan struct{})
+	s.wake = make(chan struct{}, 1)
+	startStreaming(s.wake)
+	go s.streamData(s.running, s.wake)
+}
+
+// streamData is the streaming goroutine. It closes done when it ends.
+//
+// It sleeps until wake is signaled, by Stop or by the events of the source
+// (AL_SOFT_events), or until it is time to poll the source again.
+func (s *SoundStream) streamData(done chan struct{}, wake chan struct{}) {
+	defer endStreaming(wake)
+	defer close(done)
 
 	var wantstop bool
 
@@ -233,21 +494,83 @@ func (s *SoundStream) streamData() {
 		s.lock.Unlock()
 		return
 	}
+	count, duration, startAt := s.bufferCount, s.bufferDuration, s.startAt
+	s.startAt = 0
+	s.queued = s.seekOffset
 	s.lock.Unlock()
 
+	// the bus pauses and resumes the stream while it streams; it is released
+	// by the end of the stream, or by stop
+	stateLock.Lock()
+	s.setPlayer(s)
+	stateLock.Unlock()
+	if count == 0 {
+		count = DefaultSoundStreamBufferCount
+	}
+	if duration == 0 {
+		duration = DefaultSoundStreamBufferDuration
+	}
+
 	// create the buffers
-	C.alGenBuffers(SoundStreamBufferCount, &s.buffers[0])
+	s.buffers = make([]C.ALuint, count)
+	s.kept = make([][]byte, count)
+	s.loops = make([][]int64, count)
+	C.alGenBuffers(C.ALsizei(count), &s.buffers[0])
+	alCheck("alGenBuffers")
+
+	if extEvents {
+		setWaker(s.source, wake)
+		defer setWaker(s.source, nil)
+	}
+	timer := time.NewTimer(time.Hour)
+	timer.Stop()
+	interval := pollInterval(duration)
 
-	// fill the queue
-	wantstop = s.fillQueue()
+	// fill the queue, after the silence before a scheduled start
+	interrupted := false
+	if startAt != 0 && !extStartDelay {
+		// wait for the start to be near, so that the silence stays short
+		for d := startAt - DeviceClock(); d > maxStartSilence; d = startAt - DeviceClock() {
+			sleep(timer, wake, d-maxStartSilence)
+
+			s.lock.Lock()
+			streaming := s.streaming
+			s.lock.Unlock()
+			if !streaming || isShuttingDown() {
+				interrupted = true
+				break
+			}
+		}
+
+		// decode first, and measure the silence just before the source is
+		// started, so that the time spent decoding does not delay the start
+		if !interrupted {
+			var filled int
+			filled, wantstop = s.fillBuffers()
+			s.queueSilence(startAt)
+			s.queueBuffers(filled)
+		}
+	} else {
+		wantstop = s.fillQueue()
+	}
 
 	// play the sound
-	C.alSourcePlay(s.source)
+	switch {
+	case interrupted:
+		// stopped before the start; the loop below ends at once
+	case startAt != 0 && extStartDelay:
+		C.__GoAudio_C_PlayAtTime(s.source, C.int64_t(startAt))
+		alCheck("alSourcePlayAtTimeSOFT")
+	default:
+		C.alSourcePlay(s.source)
+		alCheck("alSourcePlay")
+	}
 
 	// check if the thread is launched paused
 	s.lock.Lock()
 	if s.state == Paused {
 		C.alSourcePause(s.source)
+		alCheck("alSourcePause")
 	}
 	s.lock.Unlock()
 
@@ -259,43 +582,90 @@ func (s *SoundStream) streamData() {
 		}
 		s.lock.Unlock()
 
+		// end streaming for Shutdown
+		if isShuttingDown() {
+			break
+		}
+
+		// cut the queue at an end already queued
+		s.lock.Lock()
+		cut := s.cut
+		s.cut = false
+		s.lock.Unlock()
+		if cut {
+			s.requeue()
+			wantstop = true
+		}
+
 		// interrupted
 		if s.soundSource.Status() == Stopped {
 			if !wantstop {
 				// just continue
 				C.alSourcePlay(s.source)
+				alCheck("alSourcePlay")
+				emit(&s.soundSource, EventUnderrun)
 			} else {
 				// end streaming
+				stateLock.Lock()
+				s.setPlayer(nil)
+				stateLock.Unlock()
 				s.lock.Lock()
 				s.streaming = false
 				s.lock.Unlock()
+				emit(&s.soundSource, EventEnded)
 			}
 		}
 
 		var numProcessed C.ALint
 		C.alGetSourcei(s.source, C.AL_BUFFERS_PROCESSED, &numProcessed)
+		alCheck("alGetSourcei")
 
 		for i := 0; i < int(numProcessed); i++ {
-			// pop the first (processed) buffer from the queue
+			// pop the first (processed) buffer from the queue, and add its frames
+			// to the offset at once, so that the position does not jump back
+			// by a buffer in between
 			var buffer C.ALuint
+			s.lock.Lock()
 			C.alSourceUnqueueBuffers(s.source, 1, &buffer)
+			alCheck("alSourceUnqueueBuffers")
+
+			var size, bits, channels C.ALint
+			C.alGetBufferi(buffer, C.AL_SIZE, &size)
+			alCheck("alGetBufferi")
+			C.alGetBufferi(buffer, C.AL_BITS, &bits)
+			alCheck("alGetBufferi")
+			C.alGetBufferi(buffer, C.AL_CHANNELS, &channels)
+			alCheck("alGetBufferi")
+			if bits > 0 && channels > 0 {
+				s.seekOffset += int64(size / (bits / 8) / channels)
+			}
+			s.lock.Unlock()
 
 			// find its number
 			var buffernum int
-			for i := 0; i < SoundStreamBufferCount; i++ {
+			for i := range s.buffers {
 				if s.buffers[i] == buffer {
 					buffernum = i
 					break
 				}
 			}
 
-			// add the processed sample size to the offset
-			var size, bits C.ALint
-			C.alGetBufferi(buffer, C.AL_SIZE, &size)
-			C.alGetBufferi(buffer, C.AL_BITS, &bits)
-			s.lock.Lock()
-			s.seekOffset += int64(size / (bits / 8))
-			s.lock.Unlock()
+			if buffer == s.padding {
+				// the silence is over; it is not filled again
+				C.alDeleteBuffers(1, &s.padding)
+				alCheck("alDeleteBuffers")
+				s.padding = 0
+				continue
+			}
+			if len(s.order) > 0 {
+				s.order = s.order[1:]
+			}
+
+			// the loop wraps in the buffer are played
+			for range s.loops[buffernum] {
+				emit(&s.soundSource, EventLooped)
+			}
+			s.loops[buffernum] = s.loops[buffernum][:0]
 
 			// fill and push the buffer again
 			if !wantstop {
@@ -306,89 +676,329 @@ func (s *SoundStream) streamData() {
 
 		}
 
-		// sleep for a while
+		// sleep until there is something to do
 		if s.Status() != Stopped {
-			time.Sleep(SoundStreamPollInterval)
+			if extEvents {
+				// the timeout only guards against lost events
+				sleep(timer, wake, duration)
+			} else {
+				interval = adaptPollInterval(interval, duration, int(numProcessed))
+				sleep(timer, wake, interval)
+			}
 		}
 	}
 
 	// stop playback
 	C.alSourceStop(s.source)
+	alCheck("alSourceStop")
 
 	// pop anything left in the queue
 	s.clearQueue()
 
 	// delete the buffers
 	C.alSourcei(s.source, C.AL_BUFFER, 0)
-	C.alDeleteBuffers(SoundStreamBufferCount, &s.buffers[0])
+	alCheck("alSourcei")
+	C.alDeleteBuffers(C.ALsizei(len(s.buffers)), &s.buffers[0])
+	alCheck("alDeleteBuffers")
+	s.buffers = nil
+	s.kept, s.loops = nil, nil
+	if s.padding != 0 {
+		C.alDeleteBuffers(1, &s.padding)
+		alCheck("alDeleteBuffers")
+		s.padding = 0
+	}
 
-	// signal stopped
-	var hasStopped bool
-	hasStopped = true
 	s.lock.Lock()
-	if s.stopped != nil {
-		hasStopped = true
-	}
 	s.state = Stopped
 	s.streaming = false
+	s.endAt = 0
+	s.cut = false
 	s.lock.Unlock()
-
-	if hasStopped {
-		s.stopped <- struct{}{}
-	}
 }
 
 // returns true if the new buffer reaches end of file
 func (s *SoundStream) fillAndPushBuffer(num int) bool {
-	var wantstop bool
+	filled, wantstop := s.fillBuffer(num)
+	if filled {
+		C.alSourceQueueBuffers(s.source, 1, &s.buffers[num])
+		alCheck("alSourceQueueBuffers")
+		s.order = append(s.order, num)
+	}
+	return wantstop
+}
+
+// fillBuffer fills the buffer num with the next data of the stream, without
+// queueing it. It returns whether the buffer was filled, and true if it reaches
+// end of file.
+func (s *SoundStream) fillBuffer(num int) (filled, wantstop bool) {
 
-	var data []int16
+	var data unsafe.Pointer
+	var size, sampleSize uintptr
+	s.wraps = s.wraps[:0]
 	for retries := 0; retries <= SoundStreamRetries; retries++ {
-		data = s.iface.GetData()
-		if len(data) > 0 {
+		if s.fiface != nil {
+			if samples := s.fiface.GetDataFloat(); len(samples) > 0 {
+				data = unsafe.Pointer(&samples[0])
+				sampleSize = unsafe.Sizeof(float32(0))
+				size = uintptr(len(samples)) * sampleSize
+			}
+		} else {
+			if samples := s.iface.GetData(); len(samples) > 0 {
+				data = unsafe.Pointer(&samples[0])
+				sampleSize = unsafe.Sizeof(int16(0))
+				size = uintptr(len(samples)) * sampleSize
+			}
+		}
+		if size > 0 {
 			// got data; stop trying
 			break
 		}
 	}
 
-	if len(data) > 0 {
+	// cut the data at the end set by endAtSample
+	if size > 0 && s.info.ChannelCount > 0 {
+		frameSize := sampleSize * uintptr(s.info.ChannelCount)
+		frames := int64(size / frameSize)
+
+		s.lock.Lock()
+		if s.endAt > 0 && s.queued+frames >= s.endAt {
+			frames = s.endAt - s.queued
+			if frames < 0 {
+				frames = 0
+			}
+			size = uintptr(frames) * frameSize
+			wantstop = true
+		}
+		s.queued += frames
+		s.lock.Unlock()
+	}
+
+	if size > 0 {
 		C.alBufferData(
 			s.buffers[num],
 			s.format,
-			unsafe.Pointer(&data[0]),
-			C.ALsizei(uintptr(len(data))*unsafe.Sizeof(int16(0))),
+			data,
+			C.ALsizei(size),
 			C.ALsizei(s.info.SampleRate),
 		)
-		C.alSourceQueueBuffers(s.source, 1, &s.buffers[num])
+		alCheck("alBufferData")
+		filled = true
+		s.kept[num] = C.GoBytes(data, C.int(size))
+
+		// keep the loop wraps not cut off
+		samples := int64(size / sampleSize)
+		s.loops[num] = s.loops[num][:0]
+		for _, at := range s.wraps {
+			if at < samples || at == samples && !wantstop {
+				s.loops[num] = append(s.loops[num], at)
+			}
+		}
 	} else {
 		wantstop = true
 	}
 
-	return wantstop
+	return filled, wantstop
 }
 
 // returns true if the queue reaches end of file
 func (s *SoundStream) fillQueue() bool {
-	var wantstop bool
-	for i := 0; i < SoundStreamBufferCount; i++ {
-		if s.fillAndPushBuffer(i) {
-			wantstop = true
-			break
+	filled, wantstop := s.fillBuffers()
+	s.queueBuffers(filled)
+	return wantstop
+}
+
+// fillBuffers fills the buffers in order, without queueing them, until one
+// reaches end of file. It returns the number of buffers filled, and true if
+// the stream reaches end of file.
+func (s *SoundStream) fillBuffers() (filled int, wantstop bool) {
+	for i := range s.buffers {
+		ok, stop := s.fillBuffer(i)
+		if ok {
+			filled++
+		}
+		if stop {
+			return filled, true
 		}
 	}
+	return filled, false
+}
 
-	return wantstop
+// queueBuffers queues the first n buffers, filled by fillBuffers.
+func (s *SoundStream) queueBuffers(n int) {
+	if n > 0 {
+		C.alSourceQueueBuffers(s.source, C.ALsizei(n), &s.buffers[0])
+		alCheck("alSourceQueueBuffers")
+	}
+	for i := 0; i < n; i++ {
+		s.order = append(s.order, i)
+	}
+}
+
+// requeue cuts the queue at endAt, set by endAtSample inside the buffers already
+// queued. The source is stopped where it is, and the data kept from there up to
+// endAt is queued again, in the first buffer, and played on at once.
+func (s *SoundStream) requeue() {
+	C.alSourcePause(s.source)
+	alCheck("alSourcePause")
+	underrun := s.soundSource.Status() == Stopped
+
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	var offset C.ALint
+	C.alGetSourcei(s.source, C.AL_SAMPLE_OFFSET, &offset)
+	alCheck("alGetSourcei")
+	pos, end := s.seekOffset+int64(offset), s.endAt
+	if underrun {
+		// the whole queue is played
+		pos = s.queued
+	}
+	frameSize, channels := s.frameSize(), int64(s.info.ChannelCount)
+
+	// gather the data from pos to end, from the queue in order,
+	// and the loop wraps before end
+	var data []byte
+	var loops []int64
+	start := s.seekOffset
+	if s.padding != 0 {
+		to := start + s.paddingFrames
+		if to > end {
+			to = end
+		}
+		if pos < to {
+			data = make([]byte, (to-pos)*frameSize)
+		}
+		start += s.paddingFrames
+	}
+	for _, num := range s.order {
+		kept := s.kept[num]
+		frames := int64(len(kept)) / frameSize
+		from, to := start, start+frames
+		if from < pos {
+			from = pos
+		}
+		if to > end {
+			to = end
+		}
+		if from < to {
+			data = append(data, kept[(from-start)*frameSize:(to-start)*frameSize]...)
+		}
+
+		// the wraps already played are reported with the first ones to come
+		for _, at := range s.loops[num] {
+			if frame := start + at/channels; frame < end {
+				if frame < pos {
+					frame = pos
+				}
+				loops = append(loops, (frame-pos)*channels)
+			}
+		}
+		start += frames
+	}
+
+	C.alSourceStop(s.source)
+	alCheck("alSourceStop")
+	s.clearQueue()
+	if s.padding != 0 {
+		C.alDeleteBuffers(1, &s.padding)
+		alCheck("alDeleteBuffers")
+		s.padding = 0
+	}
+	s.seekOffset, s.queued = pos, pos
+	if len(data) == 0 {
+		// the end is already played
+		return
+	}
+
+	C.alBufferData(s.buffers[0], s.format, unsafe.Pointer(&data[0]), C.ALsizei(len(data)), C.ALsizei(s.info.SampleRate))
+	alCheck("alBufferData")
+	C.alSourceQueueBuffers(s.source, 1, &s.buffers[0])
+	alCheck("alSourceQueueBuffers")
+	s.order = append(s.order, 0)
+	s.kept[0], s.loops[0] = data, loops
+	s.queued += int64(len(data)) / frameSize
+
+	C.alSourcePlay(s.source)
+	alCheck("alSourcePlay")
+	if s.state == Paused {
+		C.alSourcePause(s.source)
+		alCheck("alSourcePause")
+	}
+}
+
+// frameSize returns the size of a frame in the buffers, in bytes.
+func (s *SoundStream) frameSize() int64 {
+	size := unsafe.Sizeof(int16(0))
+	if s.fiface != nil {
+		size = unsafe.Sizeof(float32(0))
+	}
+	return int64(size) * int64(s.info.ChannelCount)
+}
+
+// markLoop records a loop wrap after the first at samples of the data being
+// returned by GetData or GetDataFloat. It is reported by EventLooped once the
+// buffer with the wrap is played. It is called by the stream source, from the
+// streaming goroutine.
+func (s *SoundStream) markLoop(at int64) {
+	s.wraps = append(s.wraps, at)
 }
 
 func (s *SoundStream) clearQueue() {
 
 	var n C.ALint
 	C.alGetSourcei(s.source, C.AL_BUFFERS_QUEUED, &n)
+	alCheck("alGetSourcei")
 
 	// dequeue all of them
 	var buffer C.ALuint
 	for i := 0; i < int(n); i++ {
 		C.alSourceUnqueueBuffers(s.source, 1, &buffer)
+		alCheck("alSourceUnqueueBuffers")
+	}
+	s.order = s.order[:0]
+
+}
+
+// sleep waits on wake for at most d.
+//
+// The timer must be stopped and drained.
+func sleep(timer *time.Timer, wake <-chan struct{}, d time.Duration) {
+	timer.Reset(d)
+	select {
+	case <-wake:
+		if !timer.Stop() {
+			<-timer.C
+		}
+	case <-timer.C:
+	}
+}
+
+// pollInterval returns the initial interval between polls for the buffer duration.
+func pollInterval(duration time.Duration) time.Duration {
+	return adaptPollInterval(duration/4, duration, 1)
+}
+
+// adaptPollInterval adjusts the interval between polls by the number of
+// buffers processed since the last poll.
+//
+// The interval is doubled if no buffer is processed, and halved if more
+// than one is, so that a poll happens about once for every buffer processed.
+func adaptPollInterval(interval, duration time.Duration, processed int) time.Duration {
+	switch {
+	case processed == 0:
+		interval *= 2
+	case processed > 1:
+		interval /= 2
 	}
 
+	if max := duration / 2; interval > max {
+		interval = max
+	}
+	if interval > SoundStreamPollInterval {
+		interval = SoundStreamPollInterval
+	}
+	if interval < minSoundStreamPollInterval {
+		interval = minSoundStreamPollInterval
+	}
+	return interval
 }
@@ -0,0 +1,117 @@
+package audio
+
+import (
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestFramesToDuration(t *testing.T) {
+	for _, rate := range []int{8000, 22050, 44100, 48000, 96000} {
+		for _, frames := range []int64{0, 1, 441, int64(rate) - 1, int64(rate), 10 * 3600 * int64(rate), 10*3600*int64(rate) + 7} {
+			d := framesToDuration(frames, rate)
+			if got := durationToFrames(d, rate); got != frames {
+				t.Errorf("%d frames at %d Hz: %v, back to %d frames", frames, rate, d, got)
+			}
+		}
+	}
+	if d := framesToDuration(44100*90, 44100); d != 90*time.Second {
+		t.Errorf("framesToDuration of 90s = %v", d)
+	}
+	if d := framesToDuration(100, 0); d != 0 {
+		t.Errorf("framesToDuration at 0 Hz = %v, want 0", d)
+	}
+}
+
+// testStream is a stream of silence, recording how it is seeked.
+type testStream struct {
+	lock sync.Mutex
+	seek time.Duration // the last offset given to Seek
+}
+
+func (s *testStream) GetData() []int16 { return make([]int16, 441) }
+
+func (s *testStream) Seek(offset time.Duration) {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	s.seek = offset
+}
+
+// testSeekerStream is a testStream seeking to exact samples.
+type testSeekerStream struct {
+	testStream
+	sample int64 // the last offset given to SeekSample
+}
+
+func (s *testSeekerStream) SeekSample(offset int64) {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	s.sample = offset
+}
+
+func TestSoundStreamSeekSample(t *testing.T) {
+	if err := Init(); err != nil {
+		t.Skip("cannot open the device:", err)
+	}
+	defer Shutdown()
+
+	info := SoundFileInfo{ChannelCount: 2, SampleRate: 44100}
+	play := func(iface SoundStreamInterface) *SoundStream {
+		s := &SoundStream{}
+		if err := s.Init(iface, info); err != nil {
+			t.Fatal(err)
+		}
+		s.Play()
+		return s
+	}
+
+	seeker := &testSeekerStream{}
+	s := play(seeker)
+	defer s.Close()
+	s.SetPlayingOffsetSamples(12345)
+	seeker.lock.Lock()
+	sample := seeker.sample
+	seeker.lock.Unlock()
+	if sample != 12345 {
+		t.Errorf("SeekSample(%d), want 12345", sample)
+	}
+	if got := s.PlayingOffsetSamples(); got != 12345 {
+		t.Errorf("PlayingOffsetSamples = %d, want 12345", got)
+	}
+
+	// without SoundStreamSeeker, the stream seeks by time
+	plain := &testStream{}
+	p := play(plain)
+	defer p.Close()
+	p.SetPlayingOffsetSamples(44100 + 441)
+	plain.lock.Lock()
+	seek := plain.seek
+	plain.lock.Unlock()
+	if seek != 1010*time.Millisecond {
+		t.Errorf("Seek(%v), want 1.01s", seek)
+	}
+	if got := p.PlayingOffset(); got != 1010*time.Millisecond {
+		t.Errorf("PlayingOffset = %v, want 1.01s", got)
+	}
+}
+
+func TestSoundPlayingOffsetSamples(t *testing.T) {
+	if err := Init(); err != nil {
+		t.Skip("cannot open the device:", err)
+	}
+	defer Shutdown()
+
+	b := NewSoundBuffer()
+	defer b.Release()
+	loadRaw(t, b, 44100, 1)
+	s := NewSound()
+	defer s.Release()
+	s.SetBuffer(b)
+
+	s.Play()
+	s.Pause()
+	s.SetPlayingOffsetSamples(441)
+	if got := s.PlayingOffsetSamples(); got != 441 {
+		t.Errorf("PlayingOffsetSamples = %d after seeking to 441, paused", got)
+	}
+}
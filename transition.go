@@ -0,0 +1,210 @@
+package audio
+
+import (
+	"errors"
+	"math"
+	"time"
+)
+
+// TempoMap is the tempo of a music, for starting transitions on its beats and bars.
+type TempoMap struct {
+	BPM         float64       // beats per minute
+	BeatsPerBar int           // beats in a bar, the upper number of the time signature; 0 is taken as 4
+	Offset      time.Duration // the position of the first beat of the first bar
+}
+
+// Quantize is the boundary of the music a transition waits for.
+type Quantize int8
+
+const (
+	QuantizeNone Quantize = iota // no waiting
+	QuantizeBeat                 // the next beat
+	QuantizeBar                  // the first beat of the next bar
+)
+
+// BeatDuration returns the duration of a beat.
+func (t TempoMap) BeatDuration() time.Duration {
+	if t.BPM <= 0 {
+		return 0
+	}
+	return time.Duration(float64(time.Minute) / t.BPM)
+}
+
+// BarDuration returns the duration of a bar.
+func (t TempoMap) BarDuration() time.Duration {
+	return t.BeatDuration() * time.Duration(t.beatsPerBar())
+}
+
+func (t TempoMap) beatsPerBar() int {
+	if t.BeatsPerBar <= 0 {
+		return 4
+	}
+	return t.BeatsPerBar
+}
+
+// Next returns the first boundary at or after the position.
+func (t TempoMap) Next(pos time.Duration, q Quantize) time.Duration {
+	if t.BPM <= 0 || q == QuantizeNone {
+		return pos
+	}
+	if pos <= t.Offset {
+		return t.Offset
+	}
+
+	// in beats, without the rounding errors of a beat in nanoseconds adding up
+	beats := float64(pos-t.Offset) / float64(time.Minute) * t.BPM
+	per := 1.0
+	if q == QuantizeBar {
+		per = float64(t.beatsPerBar())
+	}
+	n := math.Ceil(beats/per-1e-9) * per
+	return t.Offset + time.Duration(math.Ceil(n/t.BPM*float64(time.Minute)))
+}
+
+// TransitionKind is how a transition goes from a music to the next one.
+type TransitionKind int8
+
+const (
+	TransitionCut       TransitionKind = iota // the music stops, and the next one starts, at the same sample
+	TransitionCrossfade                       // the music fades out while the next one fades in, see Crossfade
+	TransitionSegment                         // a segment music is played in between, cut at both ends
+)
+
+// Transition is a change from a music to another one, see Music.TransitionTo.
+type Transition struct {
+	Kind    TransitionKind
+	At      Quantize      // the boundary of the music the transition starts at
+	Fade    time.Duration // the duration of TransitionCrossfade
+	Segment *Music        // the music played by TransitionSegment
+}
+
+// SetTempoMap sets the tempo of the music, for the transitions.
+func (m *Music) SetTempoMap(tempo TempoMap) {
+	m.lock.Lock()
+	defer m.lock.Unlock()
+	m.tempo = tempo
+}
+
+// TempoMap returns the tempo of the music.
+func (m *Music) TempoMap() TempoMap {
+	m.lock.Lock()
+	defer m.lock.Unlock()
+	return m.tempo
+}
+
+// NextBoundary returns the device clock when the next boundary of the music
+// is played, for PlayAt, e.g., to play a stinger on the next beat.
+//
+// It returns the device clock now if the music is not playing, or for QuantizeNone.
+func (m *Music) NextBoundary(q Quantize) time.Duration {
+	_, at, _ := m.boundary(q)
+	return at
+}
+
+// boundary returns the next boundary of the music, as the offset of the stream in frames,
+// and the device clock when it is played. ok is false if the music is not playing.
+//
+// The position of the stream is not wrapped into the loop, unlike the one of the music.
+func (m *Music) boundary(q Quantize) (frame int64, at time.Duration, ok bool) {
+	c := m.SoundStream.Clock()
+	if !c.Playing {
+		return 0, DeviceClock(), false
+	}
+	now := c.DeviceClock
+	if now == 0 {
+		now = DeviceClock() - time.Since(c.Time)
+	}
+
+	rate := m.SampleRate()
+	pos := m.wrapLoop(c.OffsetSamples)
+	next := durationToFrames(m.TempoMap().Next(framesToDuration(pos, rate), q), rate)
+	if next < pos {
+		next = pos
+	}
+
+	frame = c.OffsetSamples + next - pos
+	at = now + framesToDuration(frame, rate) - c.Offset
+	return frame, at, true
+}
+
+// TransitionTo goes from the music to the next one by the transition,
+// starting at the next boundary of the tempo map.
+//
+// The next music, and the segment of TransitionSegment, are started by PlayAt.
+// The segment is cut at its end, where the next music starts, even in loop mode.
+// The music is cut by its streaming goroutine at the sample of the boundary: if
+// the boundary is inside the buffers already queued, the source is stopped where
+// it is, and the samples from there up to the boundary are queued again, with
+// the gap of a restart of the source.
+//
+// If the music is not playing, the next one starts at once.
+func (m *Music) TransitionTo(next *Music, tr Transition) error {
+	if next == nil {
+		return errors.New("Music: no music to transition to")
+	}
+	if tr.Kind == TransitionSegment && tr.Segment == nil {
+		return errors.New("Music: no segment for the transition")
+	}
+
+	frame, at, playing := m.boundary(tr.At)
+	switch tr.Kind {
+	case TransitionCut:
+		next.PlayAt(at)
+		if playing {
+			m.endAtSample(frame)
+		}
+
+	case TransitionSegment:
+		tr.Segment.PlayAt(at)
+		next.PlayAt(at + tr.Segment.Duration())
+		if playing {
+			m.endAtSample(frame)
+		}
+		// the segment ends where the next music starts, even if it loops
+		if info := tr.Segment.streamInfo(); info.ChannelCount > 0 && info.SampleCount > 0 {
+			tr.Segment.endAtSample(info.SampleCount / int64(info.ChannelCount))
+		}
+
+	case TransitionCrossfade:
+		stateLock.Lock()
+		fromVolume, toVolume := m.volume, next.volume
+		stateLock.Unlock()
+
+		next.SetVolume(0)
+		next.PlayAt(at)
+		from := m
+		if !playing {
+			from = nil
+		}
+		time.AfterFunc(at-DeviceClock(), func() {
+			crossfade(from, next, fromVolume, toVolume, tr.Fade)
+		})
+	}
+	return nil
+}
+
+// endAtSample makes the streaming goroutine end the stream at the offset in frames.
+// If the samples there are already queued, the queue is cut there; see requeue.
+// It does nothing if the stream is not streaming.
+func (s *SoundStream) endAtSample(frame int64) {
+	s.ctl.Lock()
+	defer s.ctl.Unlock()
+
+	s.lock.Lock()
+	if !s.streaming {
+		s.lock.Unlock()
+		return
+	}
+	if frame < 0 {
+		frame = 0
+	}
+	// an end at 0 is not seen by fillBuffer
+	s.endAt = frame
+	s.cut = frame < s.queued || frame == 0
+	cut := s.cut
+	s.lock.Unlock()
+
+	if cut && s.wake != nil {
+		wakeup(s.wake)
+	}
+}
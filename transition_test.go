@@ -0,0 +1,132 @@
+package audio
+
+import (
+	"bytes"
+	"testing"
+	"time"
+)
+
+func TestTempoMapNext(t *testing.T) {
+	// 120 BPM: a beat every 500ms, a bar of 3 beats every 1.5s, from 100ms
+	tempo := TempoMap{BPM: 120, BeatsPerBar: 3, Offset: 100 * time.Millisecond}
+	ms := func(n int) time.Duration { return time.Duration(n) * time.Millisecond }
+
+	tests := []struct {
+		pos  time.Duration
+		q    Quantize
+		want time.Duration
+	}{
+		{ms(0), QuantizeBeat, ms(100)},
+		{ms(100), QuantizeBeat, ms(100)},
+		{ms(101), QuantizeBeat, ms(600)},
+		{ms(600), QuantizeBeat, ms(600)},
+		{ms(601), QuantizeBar, ms(1600)},
+		{ms(1600), QuantizeBar, ms(1600)},
+		{ms(1700), QuantizeNone, ms(1700)},
+		{time.Hour + ms(50), QuantizeBeat, time.Hour + ms(100)},
+	}
+	for _, tt := range tests {
+		if got := tempo.Next(tt.pos, tt.q); got != tt.want {
+			t.Errorf("Next(%v, %v) = %v, want %v", tt.pos, tt.q, got, tt.want)
+		}
+	}
+
+	// the default of 4 beats in a bar, and no tempo
+	if got := (TempoMap{BPM: 60}).Next(ms(1), QuantizeBar); got != 4*time.Second {
+		t.Errorf("Next with 4 beats in a bar = %v, want 4s", got)
+	}
+	if got := (TempoMap{}).Next(ms(1234), QuantizeBar); got != ms(1234) {
+		t.Errorf("Next without a tempo = %v, want the position", got)
+	}
+}
+
+func TestTempoMapNextOnBeats(t *testing.T) {
+	// a tempo whose beat is not a whole number of nanoseconds
+	tempo := TempoMap{BPM: 140}
+	beat := float64(time.Minute) / 140
+	for n := 1; n < 10000; n += 37 {
+		on := time.Duration(float64(n) * beat)
+		got := tempo.Next(on, QuantizeBeat)
+		if got < on || got-on > 1 {
+			t.Fatalf("Next(beat %d at %v) = %v, want the beat itself", n, on, got)
+		}
+	}
+}
+
+func TestEndAtSampleQueued(t *testing.T) {
+	if err := Init(); err != nil {
+		t.Skip("cannot open the device:", err)
+	}
+	defer Shutdown()
+
+	m := NewMusic()
+	defer m.Close()
+	if err := m.OpenReader(NewRawPCMReader(PCMS16, nil, 1, 44100), bytes.NewReader(make([]byte, 44100*2))); err != nil {
+		t.Fatal(err)
+	}
+	m.Play()
+
+	// the stream state, under its lock
+	state := func() (cut bool, queued int64) {
+		m.SoundStream.lock.Lock()
+		defer m.SoundStream.lock.Unlock()
+		return m.cut, m.queued
+	}
+	for deadline := time.Now().Add(time.Second); time.Now().Before(deadline); time.Sleep(time.Millisecond) {
+		if _, queued := state(); queued > 100 {
+			break
+		}
+	}
+	if _, queued := state(); queued <= 100 {
+		t.Fatalf("%d frames queued, want more than 100", queued)
+	}
+
+	// the end is inside the buffers queued, so they are queued again up to it
+	m.endAtSample(100)
+	for deadline := time.Now().Add(time.Second); time.Now().Before(deadline); time.Sleep(time.Millisecond) {
+		if cut, _ := state(); !cut {
+			break
+		}
+	}
+	if cut, queued := state(); cut || queued > 100 {
+		t.Errorf("cut = %v, %d frames queued after the cut at 100", cut, queued)
+	}
+}
+
+func TestTransitionSegmentEnd(t *testing.T) {
+	if err := Init(); err != nil {
+		t.Skip("cannot open the device:", err)
+	}
+	defer Shutdown()
+
+	open := func(frames int) *Music {
+		m := NewMusic()
+		if err := m.OpenReader(NewRawPCMReader(PCMS16, nil, 1, 44100), bytes.NewReader(make([]byte, frames*2))); err != nil {
+			t.Fatal(err)
+		}
+		return m
+	}
+	from, next, segment := open(44100), open(44100), open(1000)
+	defer from.Close()
+	defer next.Close()
+	defer segment.Close()
+	segment.SetLoop(true)
+
+	from.Play()
+	if err := from.TransitionTo(next, Transition{Kind: TransitionSegment, Segment: segment}); err != nil {
+		t.Fatal(err)
+	}
+
+	// the looping segment is queued up to its end only
+	queued := func() int64 {
+		segment.SoundStream.lock.Lock()
+		defer segment.SoundStream.lock.Unlock()
+		return segment.queued
+	}
+	for deadline := time.Now().Add(time.Second); queued() != 1000 && time.Now().Before(deadline); {
+		time.Sleep(time.Millisecond)
+	}
+	if n := queued(); n != 1000 {
+		t.Errorf("%d frames of the segment queued, want 1000", n)
+	}
+}
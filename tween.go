@@ -0,0 +1,321 @@
+package audio
+
+// #include "headers.h"
+import "C"
+import (
+	"math"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// Curve is the shape of a fade or a tween, from its start value to its end value.
+type Curve int8
+
+const (
+	CurveLinear      Curve = iota // a straight line
+	CurveExponential              // a constant ratio per unit of time, i.e., linear in decibels; -60 dB is taken as silence
+	CurveEqualPower               // linear in power, i.e., the square of the value; two equal-power fades in opposite directions keep the loudness of a crossfade
+)
+
+// exponentialFloor is the fraction of the louder end taken as silence by CurveExponential, -60 dB.
+const exponentialFloor = 1e-3
+
+// Interpolate returns the value of the curve between from and to at progress t, from 0 to 1.
+//
+// The exponential and equal-power curves are for non-negative values, such as a volume
+// or a pitch; they are linear if from or to is negative.
+func (c Curve) Interpolate(from, to, t float64) float64 {
+	if t <= 0 {
+		return from
+	}
+	if t >= 1 {
+		return to
+	}
+	if from < 0 || to < 0 {
+		c = CurveLinear
+	}
+
+	switch c {
+	case CurveExponential:
+		floor := exponentialFloor * math.Max(from, to)
+		if floor <= 0 {
+			return from
+		}
+		from, to = math.Max(from, floor), math.Max(to, floor)
+		return from * math.Pow(to/from, t)
+	case CurveEqualPower:
+		return math.Sqrt(from*from*(1-t) + to*to*t)
+	}
+	return from + (to-from)*t
+}
+
+// tweenInterval is the interval the scheduler goroutine steps the tweens.
+const tweenInterval = 10 * time.Millisecond
+
+// The tweens are stepped by a single scheduler goroutine, running while
+// there are tweens or ducking rules. A tween of a property of a source
+// replaces the one running on the same property.
+var (
+	tweenLock    sync.Mutex
+	tweens       = make(map[*Tween]struct{})
+	tweenKeys    = make(map[tweenKey]*Tween)
+	tweenRunning bool
+)
+
+// tweenKey is a property of a source.
+type tweenKey struct {
+	source   *soundSource
+	property int8
+}
+
+const (
+	tweenVolume int8 = iota
+	tweenPitch
+	tweenPosition
+)
+
+// Tween is a value changing over time, stepped by a scheduler goroutine.
+type Tween struct {
+	start    time.Time
+	duration time.Duration
+	step     func(progress float64) // called with the progress from 0 to 1
+	onDone   func()                 // called once the tween completes, may be nil
+	keys     []tweenKey
+
+	stopped int32 // accessed atomically
+	done    chan struct{}
+}
+
+// NewTween calls fn with the value going from from to to along the curve over
+// the duration, about every 10 milliseconds, ending with to.
+//
+// fn is called on the scheduler goroutine shared by all the tweens; it may call
+// the functions of the package, but it should return quickly.
+func NewTween(from, to float64, d time.Duration, curve Curve, fn func(value float64)) *Tween {
+	return startTween(d, func(p float64) {
+		fn(curve.Interpolate(from, to, p))
+	}, nil)
+}
+
+// startTween starts a tween of the duration, replacing the ones on the keys.
+func startTween(d time.Duration, step func(progress float64), onDone func(), keys ...tweenKey) *Tween {
+	t := &Tween{
+		start:    time.Now(),
+		duration: d,
+		step:     step,
+		onDone:   onDone,
+		keys:     keys,
+		done:     make(chan struct{}),
+	}
+
+	var replaced []*Tween
+	tweenLock.Lock()
+	for _, k := range keys {
+		if old := tweenKeys[k]; old != nil {
+			replaced = append(replaced, old)
+		}
+		tweenKeys[k] = t
+	}
+	tweens[t] = struct{}{}
+	startScheduler()
+	tweenLock.Unlock()
+
+	for _, old := range replaced {
+		old.Stop()
+	}
+	return t
+}
+
+// Stop stops the tween, leaving the value where it is.
+//
+// Stop does not wait for a call of the tween function already running.
+// Calling Stop on a tween completed or stopped does nothing.
+func (t *Tween) Stop() {
+	if atomic.SwapInt32(&t.stopped, 1) != 0 {
+		return
+	}
+	t.remove()
+}
+
+// Done returns a channel closed once the tween is completed or stopped.
+func (t *Tween) Done() <-chan struct{} {
+	return t.done
+}
+
+// remove takes the tween off the scheduler, and closes its done channel.
+func (t *Tween) remove() {
+	tweenLock.Lock()
+	delete(tweens, t)
+	for _, k := range t.keys {
+		if tweenKeys[k] == t {
+			delete(tweenKeys, k)
+		}
+	}
+	tweenLock.Unlock()
+	close(t.done)
+}
+
+// advance steps the tween to the time, completing it at its end.
+func (t *Tween) advance(now time.Time) {
+	if atomic.LoadInt32(&t.stopped) != 0 {
+		return
+	}
+
+	p := 1.0
+	if t.duration > 0 {
+		p = math.Min(float64(now.Sub(t.start))/float64(t.duration), 1)
+	}
+	t.step(p)
+
+	if p >= 1 && atomic.SwapInt32(&t.stopped, 1) == 0 {
+		t.remove()
+		if t.onDone != nil {
+			t.onDone()
+		}
+	}
+}
+
+// startScheduler starts the scheduler goroutine, if not running. tweenLock must be held.
+func startScheduler() {
+	if !tweenRunning {
+		tweenRunning = true
+		streams.Add(1)
+		go tweenLoop()
+	}
+}
+
+// tweenLoop is the scheduler goroutine, stepping the tweens and the ducking rules.
+func tweenLoop() {
+	defer streams.Done()
+
+	ticker := time.NewTicker(tweenInterval)
+	defer ticker.Stop()
+
+	for {
+		tweenLock.Lock()
+		active := make([]*Tween, 0, len(tweens))
+		for t := range tweens {
+			active = append(active, t)
+		}
+		rules := append([]*DuckRule(nil), duckRules...)
+		if len(active) == 0 && len(rules) == 0 && len(ducked) == 0 || isShuttingDown() {
+			tweenRunning = false
+			tweenLock.Unlock()
+
+			for _, t := range active {
+				t.Stop()
+			}
+			return
+		}
+		tweenLock.Unlock()
+
+		now := time.Now()
+		for _, t := range active {
+			t.advance(now)
+		}
+		stepDucking(rules, now)
+		<-ticker.C
+	}
+}
+
+// FadeTo changes the volume of the sound to the volume given, from 0 to 100,
+// along the curve over the duration.
+//
+// It replaces the fade running on the sound. SetVolume does not stop a fade; Stop
+// the Tween returned first.
+func (s *soundSource) FadeTo(volume float32, d time.Duration, curve Curve) *Tween {
+	stateLock.Lock()
+	from := s.volume
+	stateLock.Unlock()
+
+	return startTween(d, func(p float64) {
+		s.SetVolume(float32(curve.Interpolate(float64(from), float64(volume), p)))
+	}, nil, tweenKey{s, tweenVolume})
+}
+
+// PitchTo changes the pitch of the sound to the pitch given,
+// along the curve over the duration.
+//
+// It replaces the pitch tween running on the sound.
+func (s *soundSource) PitchTo(pitch float32, d time.Duration, curve Curve) *Tween {
+	stateLock.Lock()
+	from := s.pitch
+	stateLock.Unlock()
+
+	return startTween(d, func(p float64) {
+		s.SetPitch(float32(curve.Interpolate(float64(from), float64(pitch), p)))
+	}, nil, tweenKey{s, tweenPitch})
+}
+
+// MoveTo moves the sound to the 3D position given, along the curve over the duration.
+//
+// It replaces the move running on the sound.
+func (s *soundSource) MoveTo(pos [3]float32, d time.Duration, curve Curve) *Tween {
+	var from [3]float32
+	stateLock.Lock()
+	if s.source != 0 {
+		C.alGetSourcefv(s.source, C.AL_POSITION, ptrf(from[:]))
+		alCheck("alGetSourcefv")
+	}
+	stateLock.Unlock()
+
+	return startTween(d, func(p float64) {
+		var at [3]float32
+		for i := range at {
+			at[i] = float32(curve.Interpolate(float64(from[i]), float64(pos[i]), p))
+		}
+		s.SetPosition(at)
+	}, nil, tweenKey{s, tweenPosition})
+}
+
+// Crossfade fades the music from out and the music to in over the duration,
+// with equal-power curves.
+//
+// The music to is played from the start if it is not playing, and is faded in
+// up to its volume. Once faded out, the music from is stopped and its volume is
+// restored. Either music may be nil.
+func Crossfade(from, to *Music, d time.Duration) *Tween {
+	var fromVolume, toVolume float32
+	stateLock.Lock()
+	if from != nil {
+		fromVolume = from.volume
+	}
+	if to != nil {
+		toVolume = to.volume
+	}
+	stateLock.Unlock()
+
+	if to != nil {
+		to.SetVolume(0)
+		if to.Status() != Playing {
+			to.Play()
+		}
+	}
+	return crossfade(from, to, fromVolume, toVolume, d)
+}
+
+// crossfade fades from out from fromVolume, and to in up to toVolume.
+func crossfade(from, to *Music, fromVolume, toVolume float32, d time.Duration) *Tween {
+	var keys []tweenKey
+	if from != nil {
+		keys = append(keys, tweenKey{&from.soundSource, tweenVolume})
+	}
+	if to != nil {
+		keys = append(keys, tweenKey{&to.soundSource, tweenVolume})
+	}
+
+	return startTween(d, func(p float64) {
+		if from != nil {
+			from.SetVolume(float32(CurveEqualPower.Interpolate(float64(fromVolume), 0, p)))
+		}
+		if to != nil {
+			to.SetVolume(float32(CurveEqualPower.Interpolate(0, float64(toVolume), p)))
+		}
+	}, func() {
+		if from != nil {
+			from.Stop()
+			from.SetVolume(fromVolume)
+		}
+	}, keys...)
+}
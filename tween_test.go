@@ -0,0 +1,45 @@
+package audio
+
+import (
+	"math"
+	"testing"
+)
+
+func TestCurveInterpolate(t *testing.T) {
+	tests := []struct {
+		name         string
+		curve        Curve
+		from, to, at float64
+		want         float64
+	}{
+		{"linear start", CurveLinear, 10, 20, 0, 10},
+		{"linear middle", CurveLinear, 10, 20, 0.25, 12.5},
+		{"linear end", CurveLinear, 10, 20, 1, 20},
+		{"clamped before", CurveLinear, 10, 20, -1, 10},
+		{"clamped after", CurveEqualPower, 10, 20, 2, 20},
+		{"exponential middle", CurveExponential, 1, 100, 0.5, 10},
+		{"exponential down", CurveExponential, 100, 1, 0.5, 10},
+		{"exponential from silence", CurveExponential, 0, 100, 0.5, 100 * math.Sqrt(exponentialFloor)},
+		{"exponential both silent", CurveExponential, 0, 0, 0.5, 0},
+		{"equal power middle", CurveEqualPower, 0, 1, 0.5, math.Sqrt(0.5)},
+		{"equal power down", CurveEqualPower, 1, 0, 0.5, math.Sqrt(0.5)},
+		{"negative is linear", CurveExponential, -1, 1, 0.5, 0},
+	}
+
+	for _, tt := range tests {
+		if got := tt.curve.Interpolate(tt.from, tt.to, tt.at); math.Abs(got-tt.want) > 1e-9 {
+			t.Errorf("%s: Interpolate(%v, %v, %v) = %v, want %v", tt.name, tt.from, tt.to, tt.at, got, tt.want)
+		}
+	}
+}
+
+func TestCurveEqualPowerCrossfade(t *testing.T) {
+	// the powers of the two sides of a crossfade add up to the full power
+	for at := 0.0; at <= 1; at += 0.125 {
+		out := CurveEqualPower.Interpolate(1, 0, at)
+		in := CurveEqualPower.Interpolate(0, 1, at)
+		if p := out*out + in*in; math.Abs(p-1) > 1e-9 {
+			t.Errorf("power at %v = %v, want 1", at, p)
+		}
+	}
+}